@@ -3,3 +3,86 @@ package config
 import "time"
 
 const AccessTokenTime = 24 * time.Hour
+
+const ImpersonationTokenTime = 1 * time.Hour
+
+const SystemTokenTime = 1 * time.Hour
+
+const AuthCodeTime = 1 * time.Minute
+
+const IdTokenTime = 1 * time.Hour
+
+// AuthorizeCsrfTime is how long the sign-in page of the authorization endpoint can be submitted
+const AuthorizeCsrfTime = 1 * time.Hour
+
+const IdpStateTime = 10 * time.Minute
+
+const IdpMetadataCacheTime = 1 * time.Hour
+
+const LdapTimeout = 10 * time.Second
+
+const ScimTokenTouchTime = 1 * time.Minute
+
+const ApiKeyMaxTime = 365 * 24 * time.Hour
+
+const ApiKeyTouchTime = 1 * time.Minute
+
+const PasswordlessTime = 10 * time.Minute
+
+const PasswordlessResendTime = 1 * time.Minute
+
+const WebauthnTime = 5 * time.Minute
+
+const VerificationTime = 30 * time.Minute
+
+const VerificationResendTime = 1 * time.Minute
+
+const InvitationTime = 7 * 24 * time.Hour
+
+const RegistrationRateTime = 1 * time.Hour
+
+const AuthzCacheTime = 5 * time.Minute
+
+const LoginHistoryRetention = 180 * 24 * time.Hour
+
+const InactivityInterval = 1 * time.Hour
+
+const InactivityLockTime = 10 * time.Minute
+
+// InactivityReportDays is the period of GET /admin/user/dormant for clients without a policy
+const InactivityReportDays = 90
+
+const UserExpiryInterval = 1 * time.Minute
+
+const UserExpiryLockTime = 1 * time.Minute
+
+// UserExpiringWarningTime is how far ahead GET /admin/user/expiring looks by default
+const UserExpiringWarningTime = 14 * 24 * time.Hour
+
+const OutboxRelayInterval = 1 * time.Second
+
+const OutboxRelayLockTime = 30 * time.Second
+
+// OutboxMaxAttempts is how many times an event may fail to publish before it is dead-lettered, once
+// the events after it publish
+const OutboxMaxAttempts = 10
+
+const WebhookDispatchInterval = 5 * time.Second
+
+const WebhookDispatchLockTime = 2 * time.Minute
+
+const WebhookRetryBaseTime = 30 * time.Second
+
+const WebhookRetryMaxTime = 6 * time.Hour
+
+const SchedulerInterval = 15 * time.Second
+
+const JobLockTime = 10 * time.Minute
+
+const JobRetryBaseTime = 1 * time.Second
+
+const JobRunRetention = 30 * 24 * time.Hour
+
+// AvatarUrlTime is how long a signed avatar URL stays valid at least, URLs are the same within a
+// period so browsers can cache the image
+const AvatarUrlTime = 24 * time.Hour
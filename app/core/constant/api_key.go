@@ -0,0 +1,23 @@
+package constant
+
+const (
+	ApiKeyHeader = "X-API-Key"
+	ApiKeyPrefix = "umk_"
+)
+
+// An API key scope is an area of the API followed by ApiKeyRead, which allows GET requests, or
+// ApiKeyWrite, which allows every method. A key without scopes can call every area.
+const (
+	ApiKeyRead  = "read"
+	ApiKeyWrite = "write"
+)
+
+// ApiKeyAreas lists the first path segments an API key can be used on, SUPER endpoints need a
+// user signed in with a password
+var ApiKeyAreas = []string{
+	"user",
+	"admin",
+	"system",
+	"job",
+	"authz",
+}
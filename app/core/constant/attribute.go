@@ -0,0 +1,15 @@
+package constant
+
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+	// AttributeDate values are calendar dates written as 2006-01-02
+	AttributeDate = "date"
+)
+
+// AttributeLimit is the most attribute schemas a client can define
+const AttributeLimit = 50
+
+// AttributeDateLayout is the layout of date attribute values
+const AttributeDateLayout = "2006-01-02"
@@ -0,0 +1,79 @@
+package constant
+
+const (
+	AuditUserCreate             = "USER_CREATE"
+	AuditUserUpdate             = "USER_UPDATE"
+	AuditUserRoleUpdate         = "USER_ROLE_UPDATE"
+	AuditUserStatusUpdate       = "USER_STATUS_UPDATE"
+	AuditUserDelete             = "USER_DELETE"
+	AuditUserPasswordChange     = "USER_PASSWORD_CHANGE"
+	AuditUserPasswordSet        = "USER_PASSWORD_SET"
+	AuditUserImpersonate        = "USER_IMPERSONATE"
+	AuditUserContactVerify      = "USER_CONTACT_VERIFY"
+	AuditSystemCreate           = "SYSTEM_CREATE"
+	AuditSystemUpdate           = "SYSTEM_UPDATE"
+	AuditSystemDelete           = "SYSTEM_DELETE"
+	AuditSystemCredentials      = "SYSTEM_CREDENTIALS_ROTATE"
+	AuditSystemScopes           = "SYSTEM_SCOPES_UPDATE"
+	AuditSystemRedirectUris     = "SYSTEM_REDIRECT_URIS_UPDATE"
+	AuditGroupCreate            = "GROUP_CREATE"
+	AuditGroupUpdate            = "GROUP_UPDATE"
+	AuditGroupDelete            = "GROUP_DELETE"
+	AuditGroupMemberAdd         = "GROUP_MEMBER_ADD"
+	AuditGroupMemberRemove      = "GROUP_MEMBER_REMOVE"
+	AuditWebhookCreate          = "WEBHOOK_CREATE"
+	AuditWebhookUpdate          = "WEBHOOK_UPDATE"
+	AuditWebhookDelete          = "WEBHOOK_DELETE"
+	AuditWebhookRotate          = "WEBHOOK_SECRET_ROTATE"
+	AuditWebhookRedeliver       = "WEBHOOK_REDELIVER"
+	AuditJobCreate              = "JOB_CREATE"
+	AuditJobUpdate              = "JOB_UPDATE"
+	AuditJobDelete              = "JOB_DELETE"
+	AuditJobRun                 = "JOB_RUN"
+	AuditIdpCreate              = "IDP_CREATE"
+	AuditIdpUpdate              = "IDP_UPDATE"
+	AuditIdpDelete              = "IDP_DELETE"
+	AuditIdpLink                = "IDP_LINK"
+	AuditClientSettings         = "CLIENT_SETTINGS_UPDATE"
+	AuditLdapUpdate             = "LDAP_CONFIG_UPDATE"
+	AuditLdapDelete             = "LDAP_CONFIG_DELETE"
+	AuditScimTokenCreate        = "SCIM_TOKEN_CREATE"
+	AuditScimTokenDelete        = "SCIM_TOKEN_DELETE"
+	AuditApiKeyCreate           = "API_KEY_CREATE"
+	AuditApiKeyRevoke           = "API_KEY_REVOKE"
+	AuditWebauthnRegister       = "WEBAUTHN_REGISTER"
+	AuditWebauthnRemove         = "WEBAUTHN_REMOVE"
+	AuditUserInvite             = "USER_INVITE"
+	AuditUserInviteResend       = "USER_INVITE_RESEND"
+	AuditUserInviteRevoke       = "USER_INVITE_REVOKE"
+	AuditUserInviteAccept       = "USER_INVITE_ACCEPT"
+	AuditUserRegister           = "USER_REGISTER"
+	AuditUserApprove            = "USER_REGISTRATION_APPROVE"
+	AuditUserReject             = "USER_REGISTRATION_REJECT"
+	AuditUserValidityUpdate     = "USER_VALIDITY_UPDATE"
+	AuditUserAvatarUpdate       = "USER_AVATAR_UPDATE"
+	AuditUserAvatarRemove       = "USER_AVATAR_REMOVE"
+	AuditAttributeCreate        = "ATTRIBUTE_CREATE"
+	AuditAttributeUpdate        = "ATTRIBUTE_UPDATE"
+	AuditAttributeDelete        = "ATTRIBUTE_DELETE"
+	AuditPreferenceSchemaUpdate = "PREFERENCE_SCHEMA_UPDATE"
+	AuditPreferenceSchemaDelete = "PREFERENCE_SCHEMA_DELETE"
+	AuditUserExport             = "USER_EXPORT"
+	AuditUserErase              = "USER_ERASE"
+	AuditRedact                 = "AUDIT_REDACT"
+)
+
+const (
+	TargetUser             = "user"
+	TargetSystem           = "system"
+	TargetGroup            = "group"
+	TargetWebhook          = "webhook"
+	TargetJob              = "job"
+	TargetIdp              = "idp"
+	TargetClient           = "client"
+	TargetScim             = "scimToken"
+	TargetApiKey           = "apiKey"
+	TargetInvite           = "invitation"
+	TargetAttribute        = "attribute"
+	TargetPreferenceSchema = "preferenceSchema"
+)
@@ -0,0 +1,21 @@
+package constant
+
+const (
+	ActionRead   = "read"
+	ActionWrite  = "write"
+	ActionDelete = "delete"
+	ActionManage = "manage"
+)
+
+// ActionRoles maps every action known to the authorization API to the lowest role allowed to perform it
+var ActionRoles = map[string]string{
+	ActionRead:   USER,
+	ActionWrite:  USER,
+	ActionDelete: ADMIN,
+	ActionManage: ADMIN,
+}
+
+const (
+	GrantSourceDirect = "direct"
+	GrantSourceGroup  = "group"
+)
@@ -0,0 +1,21 @@
+package constant
+
+const (
+	// AvatarMaxBytes is the largest avatar upload
+	AvatarMaxBytes = 5 << 20
+	// AvatarMaxPixels bounds width times height before the image is decoded
+	AvatarMaxPixels = 40000000
+	AvatarQuality   = 85
+	// AvatarDefaultSize is the thumbnail the avatarUrl of a user points to
+	AvatarDefaultSize = 128
+)
+
+// AvatarSizes are the square thumbnails made of every avatar, in pixels
+var AvatarSizes = []int{64, 128, 256}
+
+// AvatarTypes are the accepted image types, sniffed from the content rather than trusted from the
+// upload
+var AvatarTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+// AvatarSignaturePurpose keeps avatar URL signatures apart from the other signed tokens
+const AvatarSignaturePurpose = "AVATAR"
@@ -0,0 +1,45 @@
+package constant
+
+const (
+	EventUserCreated         = "user.created"
+	EventUserUpdated         = "user.updated"
+	EventUserRoleChanged     = "user.role_changed"
+	EventUserStatusChanged   = "user.status_changed"
+	EventUserActivated       = "user.activated"
+	EventUserDeactivated     = "user.deactivated"
+	EventUserExpired         = "user.expired"
+	EventUserPasswordChanged = "user.password_changed"
+	EventUserDeleted         = "user.deleted"
+	EventUserErased          = "user.erased"
+	EventSessionCreated      = "session.created"
+	EventSessionRevoked      = "session.revoked"
+	EventSystemCreated       = "system.created"
+	EventSystemUpdated       = "system.updated"
+	EventSystemDeleted       = "system.deleted"
+)
+
+// EventTypes lists every event type a consumer can subscribe to
+var EventTypes = []string{
+	EventUserCreated,
+	EventUserUpdated,
+	EventUserRoleChanged,
+	EventUserStatusChanged,
+	EventUserActivated,
+	EventUserDeactivated,
+	EventUserExpired,
+	EventUserPasswordChanged,
+	EventUserDeleted,
+	EventUserErased,
+	EventSessionCreated,
+	EventSessionRevoked,
+	EventSystemCreated,
+	EventSystemUpdated,
+	EventSystemDeleted,
+}
+
+const EventVersion = 1
+
+// EventStream is the Redis Stream every domain event is published to
+const EventStream = "um:events"
+
+const EventStreamMaxLen = 100000
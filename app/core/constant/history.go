@@ -0,0 +1,33 @@
+package constant
+
+const (
+	LoginEventLogin     = "LOGIN"
+	LoginEventKeepAlive = "KEEP_ALIVE"
+	LoginEventLogout    = "LOGOUT"
+)
+
+const (
+	LoginFailureUserNotFound  = "USER_NOT_FOUND"
+	LoginFailureWrongPassword = "WRONG_PASSWORD"
+	LoginFailureSession       = "SESSION_ERROR"
+)
+
+const (
+	LoginFailurePasswordDisabled = "PASSWORD_LOGIN_DISABLED"
+	LoginFailureIdp              = "IDP_ERROR"
+	LoginFailureNotLinked        = "USER_NOT_LINKED"
+	LoginFailureDirectory        = "DIRECTORY_ERROR"
+)
+
+const (
+	LoginFailurePasswordless = "PASSWORDLESS_DISABLED"
+	LoginFailureWrongCode    = "WRONG_CODE"
+	LoginFailureUserInactive = "USER_INACTIVE"
+)
+
+const (
+	LoginFailurePasskey         = "WRONG_PASSKEY"
+	LoginFailurePasskeyRequired = "PASSKEY_REQUIRED"
+)
+
+const LoginFailureOutsideValidity = "OUTSIDE_VALIDITY"
@@ -0,0 +1,6 @@
+package constant
+
+const (
+	ImpersonationStart  = "IMPERSONATION_START"
+	ImpersonationAction = "IMPERSONATION_ACTION"
+)
@@ -0,0 +1,4 @@
+package constant
+
+// InvitationTokenParam is the fragment parameter of the invitation link carrying its token
+const InvitationTokenParam = "invite_token"
@@ -0,0 +1,17 @@
+package constant
+
+const (
+	JobRunSuccess = "SUCCESS"
+	JobRunPartial = "PARTIAL"
+	JobRunFailed  = "FAILED"
+	// JobRunNoTargets is a run that found no system with the job's code to call
+	JobRunNoTargets = "NO_TARGETS"
+)
+
+const (
+	JobTriggerSchedule = "SCHEDULE"
+	JobTriggerManual   = "MANUAL"
+)
+
+// JobConcurrency bounds the number of hosts a job calls at the same time
+const JobConcurrency = 10
@@ -0,0 +1,14 @@
+package constant
+
+const (
+	ChannelEmail = "email"
+	ChannelSms   = "sms"
+)
+
+const (
+	NotificationPasswordless = "PASSWORDLESS_LOGIN"
+	NotificationVerification = "CONTACT_VERIFICATION"
+	NotificationInvitation   = "USER_INVITATION"
+	NotificationRegistration = "USER_REGISTRATION"
+	NotificationInactivity   = "INACTIVITY_WARNING"
+)
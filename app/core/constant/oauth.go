@@ -0,0 +1,35 @@
+package constant
+
+const (
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeAuthorizationCode = "authorization_code"
+)
+
+const (
+	ResponseTypeCode  = "code"
+	ScopeOpenId       = "openid"
+	CodeChallengeS256 = "S256"
+)
+
+const (
+	ScopeAuthzCheck = "authz:check"
+	ScopeUserRead   = "user:read"
+)
+
+// Scopes lists every scope a system can be granted
+var Scopes = []string{
+	ScopeAuthzCheck,
+	ScopeUserRead,
+}
+
+// OAuth error codes from RFC 6749 sections 4.1.2.1 and 5.2
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthAccessDenied            = "access_denied"
+	OAuthServerError             = "server_error"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+)
@@ -0,0 +1,7 @@
+package constant
+
+const (
+	PasswordMinLength = 8
+	// PasswordMaxLength is the most bcrypt hashes, longer passwords are refused rather than truncated
+	PasswordMaxLength = 72
+)
@@ -0,0 +1,13 @@
+package constant
+
+const (
+	PasswordlessCode = "code"
+	PasswordlessLink = "link"
+)
+
+const (
+	PasswordlessCodeLength  = 6
+	PasswordlessMaxAttempts = 5
+	// PasswordlessTokenParam is the query parameter of the link carrying its token
+	PasswordlessTokenParam = "passwordless_token"
+)
@@ -0,0 +1,10 @@
+package constant
+
+const (
+	// PreferenceMaxBytes is the largest value of a preference namespace
+	PreferenceMaxBytes = 16 << 10
+	// PreferenceLimit is the most namespaces a user can keep
+	PreferenceLimit = 50
+	// PreferenceSchemaMaxBytes is the largest JSON schema of a namespace
+	PreferenceSchemaMaxBytes = 64 << 10
+)
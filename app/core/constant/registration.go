@@ -0,0 +1,4 @@
+package constant
+
+// RegistrationRateLimit is the number of sign-ups accepted from an IP within RegistrationRateTime
+const RegistrationRateLimit = 5
@@ -5,3 +5,10 @@ const (
 	ADMIN = "ADMIN"
 	USER  = "USER"
 )
+
+// RoleLevels ranks roles so a higher role inherits the permissions of a lower one
+var RoleLevels = map[string]int{
+	SUPER: 3,
+	ADMIN: 2,
+	USER:  1,
+}
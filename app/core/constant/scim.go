@@ -0,0 +1,37 @@
+package constant
+
+const (
+	ScimSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ScimSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimSchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ScimSchemaBulkRequest  = "urn:ietf:params:scim:api:messages:2.0:BulkRequest"
+	ScimSchemaBulkResponse = "urn:ietf:params:scim:api:messages:2.0:BulkResponse"
+	ScimSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ScimSchemaConfig       = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ScimSchemaResourceType = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// SCIM error types of RFC 7644 section 3.12
+const (
+	ScimInvalidFilter = "invalidFilter"
+	ScimInvalidSyntax = "invalidSyntax"
+	ScimInvalidPath   = "invalidPath"
+	ScimInvalidValue  = "invalidValue"
+	ScimUniqueness    = "uniqueness"
+	ScimTooMany       = "tooMany"
+	ScimNoTarget      = "noTarget"
+)
+
+const (
+	ScimTokenPrefix = "scim_"
+	// ScimActorPrefix marks audit events of a SCIM client, followed by the id of its token
+	ScimActorPrefix = "scim:"
+)
+
+const (
+	ScimContentType       = "application/scim+json"
+	ScimMaxResults        = 200
+	ScimBulkMaxOperations = 100
+	ScimBulkMaxPayload    = 1 << 20
+)
@@ -0,0 +1,12 @@
+package constant
+
+// SourceLdap marks users synced from a directory, their password is checked by the directory.
+// The passwords of users of any other source are kept by um-api.
+const SourceLdap = "LDAP"
+
+// SourceRegistration marks users who signed up with the registration code of their client
+const SourceRegistration = "REGISTRATION"
+
+// LdapDefaultUserFilter finds an Active Directory user by account name, {username} is replaced
+// by the escaped username
+const LdapDefaultUserFilter = "(&(objectClass=user)(sAMAccountName={username}))"
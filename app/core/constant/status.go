@@ -3,4 +3,8 @@ package constant
 const (
 	ACTIVE   = "ACTIVE"
 	INACTIVE = "INACTIVE"
+	// PENDING users were invited and haven't accepted yet
+	PENDING = "PENDING"
+	// EXPIRED users were past their validUntil
+	EXPIRED = "EXPIRED"
 )
@@ -0,0 +1,13 @@
+package constant
+
+const (
+	VerificationCode = "code"
+	VerificationLink = "link"
+)
+
+const (
+	VerificationCodeLength  = 6
+	VerificationMaxAttempts = 5
+	// VerificationTokenParam is the fragment parameter of the link carrying its token
+	VerificationTokenParam = "verification_token"
+)
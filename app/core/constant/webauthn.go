@@ -0,0 +1,9 @@
+package constant
+
+const (
+	WebauthnRegister = "register"
+	WebauthnLogin    = "login"
+	WebauthnMfa      = "mfa"
+)
+
+const WebauthnDefaultName = "Passkey"
@@ -0,0 +1,17 @@
+package constant
+
+const (
+	DeliveryPending = "PENDING"
+	DeliverySuccess = "SUCCESS"
+	DeliveryFailed  = "FAILED"
+	DeliveryDead    = "DEAD"
+)
+
+// WebhookAllEvents subscribes a webhook to every event type
+const WebhookAllEvents = "*"
+
+// WebhookMaxAttempts is the number of failed attempts after which a delivery is dead-lettered
+const WebhookMaxAttempts = 8
+
+// WebhookConsumerGroup is the consumer group reading EventStream for webhook fan-out
+const WebhookConsumerGroup = "um-webhooks"
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchLimit bounds the search for the next run of expressions that rarely or never match,
+// such as "0 0 30 2 *"
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+type cronField struct {
+	min int
+	max int
+}
+
+var cronFields = []cronField{
+	{min: 0, max: 59}, // minute
+	{min: 0, max: 23}, // hour
+	{min: 1, max: 31}, // day of month
+	{min: 1, max: 12}, // month
+	{min: 0, max: 7},  // day of week, 0 and 7 are Sunday
+}
+
+// CronSchedule is a parsed five-field cron expression: minute hour day-of-month month day-of-week.
+// Fields accept "*", values, ranges "a-b", lists "a,b" and steps "*/n" or "a-b/n". As in cron, a
+// day matches when either day field matches if both are restricted, a day field starting with "*"
+// such as "*/2" doesn't count as restricted.
+type CronSchedule struct {
+	minute     uint64
+	hour       uint64
+	dom        uint64
+	month      uint64
+	dow        uint64
+	domStar    bool
+	dowStar    bool
+	expression string
+}
+
+func ParseCron(expression string) (*CronSchedule, error) {
+	parts := strings.Fields(expression)
+	if len(parts) != len(cronFields) {
+		return nil, errors.New("cron expression must have 5 fields")
+	}
+	var bits [5]uint64
+	for i, part := range parts {
+		value, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, errors.New("invalid cron field " + part + ": " + err.Error())
+		}
+		bits[i] = value
+	}
+	// fold Sunday written as 7 into 0
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+	return &CronSchedule{
+		minute:     bits[0],
+		hour:       bits[1],
+		dom:        bits[2],
+		month:      bits[3],
+		dow:        bits[4],
+		domStar:    strings.HasPrefix(parts[2], "*"),
+		dowStar:    strings.HasPrefix(parts[4], "*"),
+		expression: expression,
+	}, nil
+}
+
+func parseCronField(field string, bounds cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			rangePart = item[:i]
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return 0, errors.New("invalid step")
+			}
+		}
+
+		start, end := bounds.min, bounds.max
+		if rangePart != "*" {
+			var err error
+			if i := strings.Index(rangePart, "-"); i >= 0 {
+				start, err = strconv.Atoi(rangePart[:i])
+				if err != nil {
+					return 0, errors.New("invalid range")
+				}
+				end, err = strconv.Atoi(rangePart[i+1:])
+				if err != nil {
+					return 0, errors.New("invalid range")
+				}
+			} else {
+				start, err = strconv.Atoi(rangePart)
+				if err != nil {
+					return 0, errors.New("invalid value")
+				}
+				end = start
+				if step > 1 {
+					end = bounds.max
+				}
+			}
+		}
+		if start < bounds.min || end > bounds.max || start > end {
+			return 0, errors.New("value out of range")
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first matching minute strictly after t in the location of t, or the zero
+// time when nothing matches within five years
+func (schedule *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+	for t.Before(limit) {
+		if schedule.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !schedule.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if schedule.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if schedule.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (schedule *CronSchedule) matchDay(t time.Time) bool {
+	domMatch := schedule.dom&(1<<uint(t.Day())) != 0
+	dowMatch := schedule.dow&(1<<uint(t.Weekday())) != 0
+	if schedule.domStar || schedule.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func (schedule *CronSchedule) String() string {
+	return schedule.expression
+}
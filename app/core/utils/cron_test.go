@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronRejects(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1-x * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+	} {
+		if _, err := ParseCron(expression); err == nil {
+			t.Errorf("%q was accepted", expression)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// a Thursday
+	from := time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)
+	for _, test := range []struct {
+		expression string
+		from       time.Time
+		want       time.Time
+	}{
+		{"* * * * *", from, time.Date(2026, 1, 15, 10, 31, 0, 0, time.UTC)},
+		{"* * * * *", from.Add(45 * time.Second), time.Date(2026, 1, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2026, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 * * * *", from, time.Date(2026, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"5,50 9-11 * * *", from, time.Date(2026, 1, 15, 10, 50, 0, 0, time.UTC)},
+		{"0 12-18/3 * * *", from, time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)},
+		{"0 12-18/3 * * *", time.Date(2026, 1, 15, 15, 0, 0, 0, time.UTC), time.Date(2026, 1, 15, 18, 0, 0, 0, time.UTC)},
+		{"0 9 * * *", from, time.Date(2026, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", from, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2026, 1, 31, 10, 30, 0, 0, time.UTC), time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * 12 *", from, time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{"* * * * *", time.Date(2026, 12, 31, 23, 59, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", from, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// day of week, Sunday as 0 or 7
+		{"0 8 * * 1", from, time.Date(2026, 1, 19, 8, 0, 0, 0, time.UTC)},
+		{"0 8 * * 0", from, time.Date(2026, 1, 18, 8, 0, 0, 0, time.UTC)},
+		{"0 8 * * 7", from, time.Date(2026, 1, 18, 8, 0, 0, 0, time.UTC)},
+		{"0 8 * * 1-5", from, time.Date(2026, 1, 16, 8, 0, 0, 0, time.UTC)},
+		// both day fields restricted, either matches
+		{"0 8 20 * 1", from, time.Date(2026, 1, 19, 8, 0, 0, 0, time.UTC)},
+		{"0 8 16 * 1", from, time.Date(2026, 1, 16, 8, 0, 0, 0, time.UTC)},
+		{"0 8 1-31/2 * 1", from, time.Date(2026, 1, 17, 8, 0, 0, 0, time.UTC)},
+		// a day field starting with * restricts nothing on its own, both have to match
+		{"0 8 */2 * 1", from, time.Date(2026, 1, 19, 8, 0, 0, 0, time.UTC)},
+		{"0 8 17 * */2", from, time.Date(2026, 1, 17, 8, 0, 0, 0, time.UTC)},
+		{"0 8 16 * */2", from, time.Date(2026, 4, 16, 8, 0, 0, 0, time.UTC)},
+		// never matches
+		{"0 0 31 2 *", from, time.Time{}},
+		{"0 0 30 2 *", from, time.Time{}},
+	} {
+		schedule, err := ParseCron(test.expression)
+		if err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+			continue
+		}
+		if next := schedule.Next(test.from); !next.Equal(test.want) {
+			t.Errorf("%q after %s: %s, want %s", test.expression, test.from, next, test.want)
+		}
+	}
+}
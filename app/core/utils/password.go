@@ -1,8 +1,13 @@
 package utils
 
 import (
+	"errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
+	"strconv"
+	"strings"
+	"um/app/core/constant"
+	"unicode"
 )
 
 func HashPassword(password string) string {
@@ -17,3 +22,23 @@ func ComparePasswordAndHashedPassword(password, hashedPassword string) error {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	return err
 }
+
+// CheckPasswordPolicy rejects passwords users choose themselves that are too short, too long for
+// bcrypt, without both letters and digits or containing the username
+func CheckPasswordPolicy(password string, username string) error {
+	if len(password) < constant.PasswordMinLength {
+		return errors.New("password must have at least " + strconv.Itoa(constant.PasswordMinLength) + " characters")
+	}
+	if len(password) > constant.PasswordMaxLength {
+		return errors.New("password must have at most " + strconv.Itoa(constant.PasswordMaxLength) + " bytes")
+	}
+	hasLetter := strings.IndexFunc(password, unicode.IsLetter) >= 0
+	hasDigit := strings.IndexFunc(password, unicode.IsDigit) >= 0
+	if !hasLetter || !hasDigit {
+		return errors.New("password must have letters and digits")
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return errors.New("password must not contain the username")
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// scimSchemaPrefix is stripped from fully qualified attribute names such as
+// "urn:ietf:params:scim:schemas:core:2.0:User:userName"
+const scimSchemaPrefix = "urn:ietf:params:scim:schemas:core:2.0:"
+
+// ScimFilter is a parsed SCIM filter (RFC 7644 section 3.4.2.2). Op is "and", "or" and "not"
+// with Filters, or a comparison "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le" and "pr" on
+// Attribute. Attributes are lower case, value paths such as emails[type eq "work"] are flattened
+// into "emails.type".
+type ScimFilter struct {
+	Op        string
+	Attribute string
+	Value     interface{}
+	Filters   []*ScimFilter
+}
+
+var scimComparisons = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+type scimParser struct {
+	tokens []string
+	pos    int
+}
+
+func ParseScimFilter(filter string) (*ScimFilter, error) {
+	tokens, err := scimTokens(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty filter")
+	}
+	parser := &scimParser{tokens: tokens}
+	result, err := parser.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(parser.tokens) {
+		return nil, errors.New("unexpected " + parser.tokens[parser.pos])
+	}
+	return result, nil
+}
+
+// ScimAttribute normalizes an attribute path: lower case without the core schema prefix
+func ScimAttribute(path string) string {
+	path = strings.ToLower(path)
+	lowerPrefix := strings.ToLower(scimSchemaPrefix)
+	if strings.HasPrefix(path, lowerPrefix) {
+		path = path[len(lowerPrefix):]
+		if index := strings.Index(path, ":"); index >= 0 {
+			path = path[index+1:]
+		}
+	}
+	return path
+}
+
+func (parser *scimParser) next() string {
+	if parser.pos >= len(parser.tokens) {
+		return ""
+	}
+	token := parser.tokens[parser.pos]
+	parser.pos++
+	return token
+}
+
+func (parser *scimParser) peek() string {
+	if parser.pos >= len(parser.tokens) {
+		return ""
+	}
+	return strings.ToLower(parser.tokens[parser.pos])
+}
+
+func (parser *scimParser) parseOr(prefix string) (*ScimFilter, error) {
+	left, err := parser.parseAnd(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for parser.peek() == "or" {
+		parser.next()
+		right, err := parser.parseAnd(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = &ScimFilter{Op: "or", Filters: []*ScimFilter{left, right}}
+	}
+	return left, nil
+}
+
+func (parser *scimParser) parseAnd(prefix string) (*ScimFilter, error) {
+	left, err := parser.parseUnary(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for parser.peek() == "and" {
+		parser.next()
+		right, err := parser.parseUnary(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = &ScimFilter{Op: "and", Filters: []*ScimFilter{left, right}}
+	}
+	return left, nil
+}
+
+func (parser *scimParser) parseUnary(prefix string) (*ScimFilter, error) {
+	switch parser.peek() {
+	case "not":
+		parser.next()
+		if parser.next() != "(" {
+			return nil, errors.New("expected ( after not")
+		}
+		inner, err := parser.parseGroup(prefix, ")")
+		if err != nil {
+			return nil, err
+		}
+		return &ScimFilter{Op: "not", Filters: []*ScimFilter{inner}}, nil
+	case "(":
+		parser.next()
+		return parser.parseGroup(prefix, ")")
+	case "":
+		return nil, errors.New("unexpected end of filter")
+	}
+
+	token := parser.next()
+	if !scimAttributePath(token) {
+		return nil, errors.New("invalid attribute " + token)
+	}
+	attribute := ScimAttribute(token)
+	if prefix != "" {
+		attribute = prefix + "." + attribute
+	}
+	op := parser.peek()
+	if op == "[" {
+		parser.next()
+		inner, err := parser.parseGroup(attribute, "]")
+		if err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+	parser.next()
+	if op == "pr" {
+		return &ScimFilter{Op: op, Attribute: attribute}, nil
+	}
+	if !scimComparisons[op] {
+		return nil, errors.New("invalid operator " + op)
+	}
+	value, err := scimValue(parser.next())
+	if err != nil {
+		return nil, err
+	}
+	return &ScimFilter{Op: op, Attribute: attribute, Value: value}, nil
+}
+
+// scimAttributePath checks the characters of an attribute path, a schema URN, names and
+// sub-attributes such as members.$ref
+func scimAttributePath(token string) bool {
+	if token == "" || !(unicode.IsLetter(rune(token[0])) || token[0] == '$') {
+		return false
+	}
+	for _, c := range token {
+		if c > unicode.MaxASCII || !(unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("-_.:$", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (parser *scimParser) parseGroup(prefix string, closing string) (*ScimFilter, error) {
+	inner, err := parser.parseOr(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if parser.next() != closing {
+		return nil, errors.New("expected " + closing)
+	}
+	return inner, nil
+}
+
+func scimValue(token string) (interface{}, error) {
+	switch strings.ToLower(token) {
+	case "":
+		return nil, errors.New("missing value")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if strings.HasPrefix(token, "\"") {
+		var value string
+		err := json.Unmarshal([]byte(token), &value)
+		if err != nil {
+			return nil, errors.New("invalid string " + token)
+		}
+		return value, nil
+	}
+	number, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return nil, errors.New("invalid value " + token)
+	}
+	return number, nil
+}
+
+func scimTokens(filter string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(filter); {
+		c := filter[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(filter) && filter[end] != '"' {
+				if filter[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(filter) {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, filter[i:end+1])
+			i = end + 1
+		default:
+			end := i
+			for end < len(filter) && !strings.ContainsRune(" \t\n\r()[]\"", rune(filter[end])) {
+				end++
+			}
+			tokens = append(tokens, filter[i:end])
+			i = end
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// scimFilterString writes a filter as an s-expression to compare parse trees
+func scimFilterString(filter *ScimFilter) string {
+	if len(filter.Filters) > 0 {
+		var parts []string
+		for _, inner := range filter.Filters {
+			parts = append(parts, scimFilterString(inner))
+		}
+		return "(" + filter.Op + " " + strings.Join(parts, " ") + ")"
+	}
+	if filter.Op == "pr" {
+		return "(pr " + filter.Attribute + ")"
+	}
+	return fmt.Sprintf("(%s %s %#v)", filter.Op, filter.Attribute, filter.Value)
+}
+
+func TestParseScimFilter(t *testing.T) {
+	for _, test := range []struct {
+		filter string
+		want   string
+	}{
+		{`userName eq "jane"`, `(eq username "jane")`},
+		{`USERNAME Eq "Jane"`, `(eq username "Jane")`},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "jane"`, `(eq username "jane")`},
+		{`name.familyName co "O'Brien"`, `(co name.familyname "O'Brien")`},
+		{`title pr`, `(pr title)`},
+		{`members[$ref pr]`, `(pr members.$ref)`},
+		{`active eq true`, `(eq active true)`},
+		{`active ne false`, `(ne active false)`},
+		{`nickName eq null`, `(eq nickname <nil>)`},
+		{`meta.version gt 2.5`, `(gt meta.version 2.5)`},
+		{`userName eq "say \"hi\" (now) and [then]"`, `(eq username "say \"hi\" (now) and [then]")`},
+		{`userName sw "j" and active eq true`, `(and (sw username "j") (eq active true))`},
+		{`userName sw "j" or userName ew "e"`, `(or (sw username "j") (ew username "e"))`},
+		// and binds tighter than or
+		{`a eq 1 or b eq 2 and c eq 3`, `(or (eq a 1) (and (eq b 2) (eq c 3)))`},
+		{`(a eq 1 or b eq 2) and c eq 3`, `(and (or (eq a 1) (eq b 2)) (eq c 3))`},
+		{`a eq 1 and b eq 2 and c eq 3`, `(and (and (eq a 1) (eq b 2)) (eq c 3))`},
+		{`not (userName eq "jane")`, `(not (eq username "jane"))`},
+		{`not (a pr) and b pr`, `(and (not (pr a)) (pr b))`},
+		{`emails[type eq "work" and value co "@acme"]`, `(and (eq emails.type "work") (co emails.value "@acme"))`},
+		{`members[value eq "1"] or title pr`, `(or (eq members.value "1") (pr title))`},
+	} {
+		filter, err := ParseScimFilter(test.filter)
+		if err != nil {
+			t.Errorf("%s: %v", test.filter, err)
+			continue
+		}
+		if got := scimFilterString(filter); got != test.want {
+			t.Errorf("%s: parsed %s, want %s", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestParseScimFilterRejects(t *testing.T) {
+	for _, filter := range []string{
+		``,
+		`   `,
+		`userName`,
+		`userName eq`,
+		`userName like "jane"`,
+		`userName eq jane`,
+		`userName eq "jane`,
+		`userName eq "jane" and`,
+		`userName eq "jane" or or title pr`,
+		`userName eq "jane" title pr`,
+		`(userName eq "jane"`,
+		`userName eq "jane")`,
+		`not userName eq "jane"`,
+		`not (userName eq "jane"`,
+		`emails[type eq "work"`,
+		`emails[type eq "work")`,
+		`"userName" eq "jane"`,
+		`() eq "x"`,
+		`user*name eq "x"`,
+	} {
+		if result, err := ParseScimFilter(filter); err == nil {
+			t.Errorf("%q was accepted as %s", filter, scimFilterString(result))
+		}
+	}
+}
@@ -3,6 +3,8 @@ package utils
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"time"
 )
 
@@ -38,3 +40,19 @@ func GenerateRefId(length int) string {
 	}
 	return string(buffer)
 }
+
+// GenerateSecret returns prefix followed by size random bytes in hex
+func GenerateSecret(prefix string, size int) (string, error) {
+	buffer := make([]byte, size)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(buffer), nil
+}
+
+// HashToken returns the SHA-256 of a random token in hex, tokens are looked up by their hash
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ApiKey authenticates a user without a session, only the SHA-256 of the key is kept
+type ApiKey struct {
+	Id           primitive.ObjectID `bson:"_id" json:"id"`
+	UserId       primitive.ObjectID `bson:"userId" json:"userId"`
+	ClientId     string             `bson:"clientId" json:"clientId"`
+	Name         string             `bson:"name" json:"name"`
+	KeyHash      string             `bson:"keyHash" json:"-"`
+	Prefix       string             `bson:"prefix" json:"prefix"`
+	Scopes       []string           `bson:"scopes" json:"scopes"`
+	AllowedIps   []string           `bson:"allowedIps" json:"allowedIps"`
+	ExpireDate   time.Time          `bson:"expireDate" json:"expireDate"`
+	LastUsedDate *time.Time         `bson:"lastUsedDate" json:"lastUsedDate"`
+	LastUsedIp   string             `bson:"lastUsedIp" json:"lastUsedIp"`
+	RevokedDate  *time.Time         `bson:"revokedDate" json:"revokedDate"`
+	CreatedDate  time.Time          `bson:"createdDate" json:"createdDate"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// AttributeSchema defines a custom profile attribute of the users of a client, the values are kept
+// in User.Attributes under its key
+type AttributeSchema struct {
+	Id       primitive.ObjectID `bson:"_id" json:"id"`
+	ClientId string             `bson:"clientId" json:"clientId"`
+	Key      string             `bson:"key" json:"key"`
+	Label    string             `bson:"label" json:"label"`
+	Type     string             `bson:"type" json:"type"`
+	Required bool               `bson:"required" json:"required"`
+	Unique   bool               `bson:"unique" json:"unique"`
+	// Pattern and Enum only apply to string attributes
+	Pattern string   `bson:"pattern,omitempty" json:"pattern,omitempty"`
+	Enum    []string `bson:"enum,omitempty" json:"enum,omitempty"`
+	// Editable attributes can be changed by the user through /user/info, others only by an ADMIN
+	Editable bool `bson:"editable" json:"editable"`
+	// Claim adds the attribute to the access token, the ID token and userinfo
+	Claim       bool               `bson:"claim" json:"claim"`
+	CreatedBy   primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	CreatedDate time.Time          `bson:"createdDate" json:"createdDate"`
+	UpdatedBy   primitive.ObjectID `bson:"updatedBy" json:"updatedBy"`
+	UpdatedDate time.Time          `bson:"updatedDate" json:"updatedDate"`
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type AuditChange struct {
+	From json.RawMessage `bson:"from" json:"from"`
+	To   json.RawMessage `bson:"to" json:"to"`
+}
+
+type AuditEvent struct {
+	Id             primitive.ObjectID     `bson:"_id" json:"id"`
+	Seq            int64                  `bson:"seq" json:"seq"`
+	ClientId       string                 `bson:"clientId" json:"clientId"`
+	ActorId        string                 `bson:"actorId" json:"actorId"`
+	ImpersonatorId string                 `bson:"impersonatorId" json:"impersonatorId,omitempty"`
+	Action         string                 `bson:"action" json:"action"`
+	TargetType     string                 `bson:"targetType" json:"targetType"`
+	TargetId       string                 `bson:"targetId" json:"targetId"`
+	Diff           map[string]AuditChange `bson:"diff" json:"diff"`
+	PayloadHash    string                 `bson:"payloadHash" json:"payloadHash"`
+	Redacted       bool                   `bson:"redacted" json:"redacted"`
+	// RedactedSeqs lists the events an AUDIT_REDACT event redacts
+	RedactedSeqs []int64   `bson:"redactedSeqs,omitempty" json:"redactedSeqs,omitempty"`
+	Ip           string    `bson:"ip" json:"ip"`
+	UserAgent    string    `bson:"userAgent" json:"userAgent"`
+	RequestId    string    `bson:"requestId" json:"requestId"`
+	CreatedDate  time.Time `bson:"createdDate" json:"createdDate"`
+	PrevHash     string    `bson:"prevHash" json:"prevHash"`
+	Hash         string    `bson:"hash" json:"hash"`
+}
+
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Checked  int64  `json:"checked"`
+	BrokenAt int64  `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
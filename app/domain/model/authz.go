@@ -0,0 +1,17 @@
+package model
+
+type AuthzDecision struct {
+	Allow    bool   `json:"allow"`
+	Reason   string `json:"reason"`
+	UserId   string `json:"userId,omitempty"`
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+}
+
+type EffectiveGrant struct {
+	Role      string `json:"role"`
+	System    string `json:"system"`
+	Source    string `json:"source"`
+	GroupId   string `json:"groupId,omitempty"`
+	GroupName string `json:"groupName,omitempty"`
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Event is the envelope stored in the outbox and published to consumers, Data holds one of
+// the typed payloads below encoded as JSON
+type Event struct {
+	Id            primitive.ObjectID `bson:"_id" json:"id"`
+	Type          string             `bson:"type" json:"type"`
+	Version       int                `bson:"version" json:"version"`
+	ClientId      string             `bson:"clientId" json:"clientId"`
+	Data          json.RawMessage    `bson:"data" json:"data"`
+	OccurredDate  time.Time          `bson:"occurredDate" json:"occurredDate"`
+	PublishedDate *time.Time         `bson:"publishedDate" json:"-"`
+	Attempts      int                `bson:"attempts" json:"-"`
+	// LastError is why the last publish failed, DeadLetterDate is set when the relay gave up on the event
+	LastError      string     `bson:"lastError,omitempty" json:"-"`
+	DeadLetterDate *time.Time `bson:"deadLetterDate,omitempty" json:"-"`
+}
+
+type UserEventData struct {
+	UserId         string `json:"userId"`
+	ClientId       string `json:"clientId"`
+	Username       string `json:"username"`
+	Role           string `json:"role"`
+	Status         string `json:"status"`
+	PreviousRole   string `json:"previousRole,omitempty"`
+	PreviousStatus string `json:"previousStatus,omitempty"`
+	ActorId        string `json:"actorId,omitempty"`
+}
+
+type SessionEventData struct {
+	SessionId string `json:"sessionId"`
+	UserId    string `json:"userId"`
+	ClientId  string `json:"clientId"`
+	System    string `json:"system"`
+	ActorId   string `json:"actorId,omitempty"`
+}
+
+type SystemEventData struct {
+	SystemId   string `json:"systemId"`
+	ClientId   string `json:"clientId"`
+	SystemCode string `json:"systemCode"`
+	SystemName string `json:"systemName"`
+	Host       string `json:"host"`
+	ActorId    string `json:"actorId,omitempty"`
+}
+
+// StreamMessage is an event read back from the stream together with the id needed to acknowledge it
+type StreamMessage struct {
+	StreamId string
+	Event    Event
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type Grant struct {
+	Role   string `bson:"role" json:"role"`
+	System string `bson:"system" json:"system"`
+}
+
+type Group struct {
+	Id          primitive.ObjectID   `bson:"_id" json:"id"`
+	ClientId    string               `bson:"clientId" json:"clientId"`
+	Name        string               `bson:"name" json:"name"`
+	Description string               `bson:"description" json:"description"`
+	Members     []primitive.ObjectID `bson:"members" json:"members"`
+	Grants      []Grant              `bson:"grants" json:"grants"`
+	ExternalId  string               `bson:"externalId,omitempty" json:"externalId,omitempty"`
+	CreatedBy   primitive.ObjectID   `bson:"createdBy" json:"createdBy"`
+	CreatedDate time.Time            `bson:"createdDate" json:"createdDate"`
+	UpdatedBy   primitive.ObjectID   `bson:"updatedBy" json:"updatedBy"`
+	UpdatedDate time.Time            `bson:"updatedDate" json:"updatedDate"`
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type LoginHistory struct {
+	Id            primitive.ObjectID `bson:"_id" json:"id"`
+	UserId        string             `bson:"userId" json:"userId"`
+	Username      string             `bson:"username" json:"username"`
+	ClientId      string             `bson:"clientId" json:"clientId"`
+	Event         string             `bson:"event" json:"event"`
+	Success       bool               `bson:"success" json:"success"`
+	FailureReason string             `bson:"failureReason" json:"failureReason,omitempty"`
+	System        string             `bson:"system" json:"system"`
+	SessionId     string             `bson:"sessionId" json:"-"`
+	Ip            string             `bson:"ip" json:"ip"`
+	UserAgent     string             `bson:"userAgent" json:"userAgent"`
+	CreatedDate   time.Time          `bson:"createdDate" json:"createdDate"`
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ClaimMapping names the ID token claims read into a user, an empty name uses the standard claim
+type ClaimMapping struct {
+	Username  string `bson:"username" json:"username"`
+	Email     string `bson:"email" json:"email"`
+	FirstName string `bson:"firstName" json:"firstName"`
+	LastName  string `bson:"lastName" json:"lastName"`
+}
+
+type IdentityProvider struct {
+	Id                primitive.ObjectID `bson:"_id" json:"id"`
+	ClientId          string             `bson:"clientId" json:"clientId"`
+	Name              string             `bson:"name" json:"name"`
+	Issuer            string             `bson:"issuer" json:"issuer"`
+	OAuthClientId     string             `bson:"oauthClientId" json:"oauthClientId"`
+	OAuthClientSecret string             `bson:"oauthClientSecret" json:"-"`
+	Scopes            []string           `bson:"scopes" json:"scopes"`
+	ClaimMapping      ClaimMapping       `bson:"claimMapping" json:"claimMapping"`
+	AutoProvision     bool               `bson:"autoProvision" json:"autoProvision"`
+	LinkByEmail       bool               `bson:"linkByEmail" json:"linkByEmail"`
+	RedirectUris      []string           `bson:"redirectUris" json:"redirectUris"`
+	Active            bool               `bson:"active" json:"active"`
+	CreatedBy         primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	CreatedDate       time.Time          `bson:"createdDate" json:"createdDate"`
+	UpdatedBy         primitive.ObjectID `bson:"updatedBy" json:"updatedBy"`
+	UpdatedDate       time.Time          `bson:"updatedDate" json:"updatedDate"`
+}
+
+// IdpState is what a federated login keeps between the redirect to the provider and its callback
+type IdpState struct {
+	ProviderId   string `json:"providerId"`
+	System       string `json:"system"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"`
+	RedirectUri  string `json:"redirectUri"`
+}
+
+type ClientSetting struct {
+	Id                    primitive.ObjectID `bson:"_id" json:"id"`
+	ClientId              string             `bson:"clientId" json:"clientId"`
+	PasswordLoginDisabled bool               `bson:"passwordLoginDisabled" json:"passwordLoginDisabled"`
+	PasswordlessEnabled   bool               `bson:"passwordlessEnabled" json:"passwordlessEnabled"`
+	RegistrationEnabled   bool               `bson:"registrationEnabled" json:"registrationEnabled"`
+	RegistrationCode      string             `bson:"registrationCode,omitempty" json:"registrationCode,omitempty"`
+	ApprovalRequired      bool               `bson:"approvalRequired" json:"approvalRequired"`
+	InactivityDays        int                `bson:"inactivityDays" json:"inactivityDays"`
+	InactivityWarningDays int                `bson:"inactivityWarningDays" json:"inactivityWarningDays"`
+	UpdatedBy             primitive.ObjectID `bson:"updatedBy" json:"updatedBy"`
+	UpdatedDate           time.Time          `bson:"updatedDate" json:"updatedDate"`
+}
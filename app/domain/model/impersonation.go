@@ -0,0 +1,22 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type ImpersonationLog struct {
+	Id          primitive.ObjectID `bson:"_id" json:"id"`
+	SessionId   string             `bson:"sessionId" json:"sessionId"`
+	ActorId     string             `bson:"actorId" json:"actorId"`
+	UserId      string             `bson:"userId" json:"userId"`
+	ClientId    string             `bson:"clientId" json:"clientId"`
+	Action      string             `bson:"action" json:"action"`
+	Reason      string             `bson:"reason" json:"reason"`
+	Method      string             `bson:"method" json:"method"`
+	Path        string             `bson:"path" json:"path"`
+	StatusCode  int                `bson:"statusCode" json:"statusCode"`
+	Ip          string             `bson:"ip" json:"ip"`
+	UserAgent   string             `bson:"userAgent" json:"userAgent"`
+	CreatedDate time.Time          `bson:"createdDate" json:"createdDate"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Invitation lets a PENDING user set their own password, only the SHA-256 of its token is kept
+type Invitation struct {
+	Id           primitive.ObjectID `bson:"_id" json:"id"`
+	UserId       primitive.ObjectID `bson:"userId" json:"userId"`
+	ClientId     string             `bson:"clientId" json:"clientId"`
+	Username     string             `bson:"username" json:"username"`
+	Email        string             `bson:"email" json:"email"`
+	System       string             `bson:"system" json:"system"`
+	RedirectUri  string             `bson:"redirectUri" json:"redirectUri"`
+	TokenHash    string             `bson:"tokenHash" json:"-"`
+	ExpireDate   time.Time          `bson:"expireDate" json:"expireDate"`
+	SentDate     time.Time          `bson:"sentDate" json:"sentDate"`
+	AcceptedDate *time.Time         `bson:"acceptedDate" json:"acceptedDate"`
+	RevokedDate  *time.Time         `bson:"revokedDate" json:"revokedDate"`
+	CreatedBy    primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	CreatedDate  time.Time          `bson:"createdDate" json:"createdDate"`
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Job calls Path with Method on every system with SystemCode whenever Cron matches in Timezone
+type Job struct {
+	Id          primitive.ObjectID `bson:"_id" json:"id"`
+	Name        string             `bson:"name" json:"name"`
+	Cron        string             `bson:"cron" json:"cron"`
+	Timezone    string             `bson:"timezone" json:"timezone"`
+	SystemCode  string             `bson:"systemCode" json:"systemCode"`
+	Path        string             `bson:"path" json:"path"`
+	Method      string             `bson:"method" json:"method"`
+	Payload     json.RawMessage    `bson:"payload" json:"payload,omitempty"`
+	Retries     int                `bson:"retries" json:"retries"`
+	Active      bool               `bson:"active" json:"active"`
+	NextRunDate time.Time          `bson:"nextRunDate" json:"nextRunDate"`
+	LastRunDate *time.Time         `bson:"lastRunDate" json:"lastRunDate"`
+	CreatedBy   primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	CreatedDate time.Time          `bson:"createdDate" json:"createdDate"`
+	UpdatedBy   primitive.ObjectID `bson:"updatedBy" json:"updatedBy"`
+	UpdatedDate time.Time          `bson:"updatedDate" json:"updatedDate"`
+}
+
+type JobHostResult struct {
+	SystemId   primitive.ObjectID `bson:"systemId" json:"systemId"`
+	ClientId   string             `bson:"clientId" json:"clientId"`
+	Url        string             `bson:"url" json:"url"`
+	StatusCode int                `bson:"statusCode" json:"statusCode"`
+	Attempts   int                `bson:"attempts" json:"attempts"`
+	Success    bool               `bson:"success" json:"success"`
+	Error      string             `bson:"error" json:"error,omitempty"`
+	Duration   int64              `bson:"duration" json:"duration"`
+}
+
+type JobRun struct {
+	Id           primitive.ObjectID `bson:"_id" json:"id"`
+	JobId        primitive.ObjectID `bson:"jobId" json:"jobId"`
+	Trigger      string             `bson:"trigger" json:"trigger"`
+	Status       string             `bson:"status" json:"status"`
+	Results      []JobHostResult    `bson:"results" json:"results"`
+	StartedDate  time.Time          `bson:"startedDate" json:"startedDate"`
+	FinishedDate time.Time          `bson:"finishedDate" json:"finishedDate"`
+}
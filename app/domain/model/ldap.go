@@ -0,0 +1,39 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// LdapAttributes names the directory attributes synced into a user
+type LdapAttributes struct {
+	FirstName string `bson:"firstName" json:"firstName"`
+	LastName  string `bson:"lastName" json:"lastName"`
+	Email     string `bson:"email" json:"email"`
+	Phone     string `bson:"phone" json:"phone"`
+	Groups    string `bson:"groups" json:"groups"`
+}
+
+// LdapGroupRole grants Role to the members of the group with distinguished name Group
+type LdapGroupRole struct {
+	Group string `bson:"group" json:"group"`
+	Role  string `bson:"role" json:"role"`
+}
+
+type LdapConfig struct {
+	Id                 primitive.ObjectID `bson:"_id" json:"id"`
+	ClientId           string             `bson:"clientId" json:"clientId"`
+	Url                string             `bson:"url" json:"url"`
+	StartTls           bool               `bson:"startTls" json:"startTls"`
+	InsecureSkipVerify bool               `bson:"insecureSkipVerify" json:"insecureSkipVerify"`
+	BindDn             string             `bson:"bindDn" json:"bindDn"`
+	BindPassword       string             `bson:"bindPassword" json:"-"`
+	BaseDn             string             `bson:"baseDn" json:"baseDn"`
+	UserFilter         string             `bson:"userFilter" json:"userFilter"`
+	Attributes         LdapAttributes     `bson:"attributes" json:"attributes"`
+	GroupRoles         []LdapGroupRole    `bson:"groupRoles" json:"groupRoles"`
+	DefaultRole        string             `bson:"defaultRole" json:"defaultRole"`
+	Enabled            bool               `bson:"enabled" json:"enabled"`
+	UpdatedBy          primitive.ObjectID `bson:"updatedBy" json:"updatedBy"`
+	UpdatedDate        time.Time          `bson:"updatedDate" json:"updatedDate"`
+}
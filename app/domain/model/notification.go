@@ -0,0 +1,14 @@
+package model
+
+// Notification is a message to a user, delivered by email or SMS through NOTIFY_URL
+type Notification struct {
+	Purpose  string `json:"purpose"`
+	Channel  string `json:"channel"`
+	To       string `json:"to"`
+	Subject  string `json:"subject"`
+	Message  string `json:"message"`
+	Code     string `json:"code,omitempty"`
+	Link     string `json:"link,omitempty"`
+	UserId   string `json:"userId"`
+	ClientId string `json:"clientId"`
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// AuthCode is an authorization code waiting to be exchanged at the token endpoint
+type AuthCode struct {
+	SystemId      string    `json:"systemId"`
+	OAuthClientId string    `json:"oauthClientId"`
+	RedirectUri   string    `json:"redirectUri"`
+	UserId        string    `json:"userId"`
+	Scope         string    `json:"scope"`
+	Nonce         string    `json:"nonce"`
+	CodeChallenge string    `json:"codeChallenge"`
+	AuthTime      time.Time `json:"authTime"`
+}
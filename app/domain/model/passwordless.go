@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// PasswordlessChallenge is a code or link sent to a user, kept until it is used or expires
+type PasswordlessChallenge struct {
+	UserId     string    `json:"userId"`
+	ClientId   string    `json:"clientId"`
+	System     string    `json:"system"`
+	Method     string    `json:"method"`
+	CodeHash   string    `json:"codeHash"`
+	ExpireDate time.Time `json:"expireDate"`
+}
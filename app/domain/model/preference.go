@@ -0,0 +1,31 @@
+package model
+
+import (
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Preference is the JSON value a user keeps in a namespace. Namespaces "<systemCode>.<name>" belong
+// to one system, the others are shared by every system of the client.
+type Preference struct {
+	Id          primitive.ObjectID `bson:"_id" json:"-"`
+	UserId      primitive.ObjectID `bson:"userId" json:"-"`
+	ClientId    string             `bson:"clientId" json:"-"`
+	Namespace   string             `bson:"namespace" json:"namespace"`
+	Value       json.RawMessage    `bson:"value" json:"value"`
+	CreatedDate time.Time          `bson:"createdDate" json:"createdDate"`
+	UpdatedDate time.Time          `bson:"updatedDate" json:"updatedDate"`
+}
+
+// PreferenceSchema is the JSON schema the values of a namespace are checked against in a client
+type PreferenceSchema struct {
+	Id          primitive.ObjectID `bson:"_id" json:"id"`
+	ClientId    string             `bson:"clientId" json:"clientId"`
+	Namespace   string             `bson:"namespace" json:"namespace"`
+	Schema      json.RawMessage    `bson:"schema" json:"schema"`
+	CreatedBy   primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	CreatedDate time.Time          `bson:"createdDate" json:"createdDate"`
+	UpdatedBy   primitive.ObjectID `bson:"updatedBy" json:"updatedBy"`
+	UpdatedDate time.Time          `bson:"updatedDate" json:"updatedDate"`
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ScimToken authenticates the SCIM client of a client, only the SHA-256 of the token is kept
+type ScimToken struct {
+	Id           primitive.ObjectID `bson:"_id" json:"id"`
+	ClientId     string             `bson:"clientId" json:"clientId"`
+	Name         string             `bson:"name" json:"name"`
+	TokenHash    string             `bson:"tokenHash" json:"-"`
+	Prefix       string             `bson:"prefix" json:"prefix"`
+	LastUsedDate *time.Time         `bson:"lastUsedDate" json:"lastUsedDate"`
+	CreatedBy    primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	CreatedDate  time.Time          `bson:"createdDate" json:"createdDate"`
+}
+
+type ScimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type ScimMultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type ScimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created"`
+	LastModified string `json:"lastModified"`
+	Location     string `json:"location"`
+}
+
+// ScimUser is the SCIM representation of a user, used for requests and responses
+type ScimUser struct {
+	Schemas      []string         `json:"schemas"`
+	Id           string           `json:"id,omitempty"`
+	ExternalId   string           `json:"externalId,omitempty"`
+	UserName     string           `json:"userName"`
+	Name         ScimName         `json:"name"`
+	DisplayName  string           `json:"displayName,omitempty"`
+	Emails       []ScimMultiValue `json:"emails,omitempty"`
+	PhoneNumbers []ScimMultiValue `json:"phoneNumbers,omitempty"`
+	Active       *bool            `json:"active,omitempty"`
+	Password     string           `json:"password,omitempty"`
+	Groups       []ScimMultiValue `json:"groups,omitempty"`
+	Meta         *ScimMeta        `json:"meta,omitempty"`
+}
+
+type ScimGroup struct {
+	Schemas     []string         `json:"schemas"`
+	Id          string           `json:"id,omitempty"`
+	ExternalId  string           `json:"externalId,omitempty"`
+	DisplayName string           `json:"displayName"`
+	Members     []ScimMultiValue `json:"members"`
+	Meta        *ScimMeta        `json:"meta,omitempty"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// ActiveSession is a session of a user kept in Redis, with the login that opened it when still known
+type ActiveSession struct {
+	Id         string     `json:"-"`
+	System     string     `json:"system,omitempty"`
+	Ip         string     `json:"ip,omitempty"`
+	UserAgent  string     `json:"userAgent,omitempty"`
+	LoginDate  *time.Time `json:"loginDate,omitempty"`
+	ExpireDate time.Time  `json:"expireDate"`
+}
@@ -6,13 +6,19 @@ import (
 )
 
 type System struct {
-	Id          primitive.ObjectID `bson:"_id" json:"id"`
-	ClientId    string             `bson:"clientId" json:"clientId"`
-	SystemName  string             `bson:"systemName" json:"systemName"`
-	SystemCode  string             `bson:"systemCode" json:"systemCode"`
-	Host        string             `bson:"host" json:"host"`
-	CreatedBy   primitive.ObjectID `bson:"createdBy" json:"-"`
-	CreatedDate time.Time          `bson:"createdDate" json:"-"`
-	UpdatedBy   primitive.ObjectID `bson:"updatedBy" json:"-"`
-	UpdatedDate time.Time          `bson:"updatedDate" json:"-"`
+	Id                     primitive.ObjectID `bson:"_id" json:"id"`
+	ClientId               string             `bson:"clientId" json:"clientId"`
+	SystemName             string             `bson:"systemName" json:"systemName"`
+	SystemCode             string             `bson:"systemCode" json:"systemCode"`
+	Host                   string             `bson:"host" json:"host"`
+	OAuthClientId          string             `bson:"oauthClientId,omitempty" json:"oauthClientId,omitempty"`
+	OAuthClientSecret      string             `bson:"oauthClientSecret,omitempty" json:"-"`
+	CredentialsRotatedDate *time.Time         `bson:"credentialsRotatedDate,omitempty" json:"credentialsRotatedDate,omitempty"`
+	Scopes                 []string           `bson:"scopes" json:"scopes"`
+	RedirectUris           []string           `bson:"redirectUris" json:"redirectUris"`
+	PublicClient           bool               `bson:"publicClient" json:"publicClient"`
+	CreatedBy              primitive.ObjectID `bson:"createdBy" json:"-"`
+	CreatedDate            time.Time          `bson:"createdDate" json:"-"`
+	UpdatedBy              primitive.ObjectID `bson:"updatedBy" json:"-"`
+	UpdatedDate            time.Time          `bson:"updatedDate" json:"-"`
 }
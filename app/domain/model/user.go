@@ -6,18 +6,45 @@ import (
 )
 
 type User struct {
-	Id          primitive.ObjectID `bson:"_id" json:"id"`
-	FirstName   string             `bson:"firstName" json:"firstName"`
-	LastName    string             `bson:"lastName" json:"lastName"`
-	Username    string             `bson:"username" json:"username"`
-	ClientId    string             `bson:"clientId" json:"clientId"`
-	Password    string             `bson:"password" json:"-"`
-	Role        string             `bson:"role" json:"role"`
-	Status      string             `bson:"status" json:"status"`
-	Phone       string             `bson:"phone" json:"phone"`
-	Email       string             `bson:"email" json:"email"`
-	CreatedBy   primitive.ObjectID `bson:"createdBy" json:"createdBy"`
-	CreatedDate time.Time          `bson:"createdDate" json:"createdDate"`
-	UpdatedBy   primitive.ObjectID `bson:"updatedBy" json:"updatedBy"`
-	UpdatedDate time.Time          `bson:"updatedDate" json:"updatedDate"`
+	Id            primitive.ObjectID `bson:"_id" json:"id"`
+	FirstName     string             `bson:"firstName" json:"firstName"`
+	LastName      string             `bson:"lastName" json:"lastName"`
+	Username      string             `bson:"username" json:"username"`
+	ClientId      string             `bson:"clientId" json:"clientId"`
+	Password      string             `bson:"password" json:"-"`
+	Role          string             `bson:"role" json:"role"`
+	Status        string             `bson:"status" json:"status"`
+	Phone         string             `bson:"phone" json:"phone"`
+	Email         string             `bson:"email" json:"email"`
+	EmailVerified bool               `bson:"emailVerified" json:"emailVerified"`
+	PhoneVerified bool               `bson:"phoneVerified" json:"phoneVerified"`
+	ValidFrom     *time.Time         `bson:"validFrom,omitempty" json:"validFrom,omitempty"`
+	ValidUntil    *time.Time         `bson:"validUntil,omitempty" json:"validUntil,omitempty"`
+	LastLoginDate *time.Time         `bson:"lastLoginDate,omitempty" json:"lastLoginDate,omitempty"`
+	// ActivatedDate is when an ADMIN last made the user ACTIVE again, it restarts the inactivity period
+	ActivatedDate        *time.Time `bson:"activatedDate,omitempty" json:"activatedDate,omitempty"`
+	InactivityWarnedDate *time.Time `bson:"inactivityWarnedDate,omitempty" json:"inactivityWarnedDate,omitempty"`
+	Source               string     `bson:"source,omitempty" json:"source,omitempty"`
+	ExternalId           string     `bson:"externalId,omitempty" json:"externalId,omitempty"`
+	// Avatar is the version of the avatar thumbnails in the blob store, AvatarUrl a signed URL to one
+	Avatar    string `bson:"avatar,omitempty" json:"-"`
+	AvatarUrl string `bson:"-" json:"avatarUrl,omitempty"`
+	// Attributes holds the values of the custom attributes defined for the client, by key
+	Attributes map[string]interface{} `bson:"attributes,omitempty" json:"attributes,omitempty"`
+	// ErasedDate is when the personal data of the user was erased, the record stays for its references
+	ErasedDate     *time.Time           `bson:"erasedDate,omitempty" json:"erasedDate,omitempty"`
+	CreatedBy      primitive.ObjectID   `bson:"createdBy" json:"createdBy"`
+	CreatedDate    time.Time            `bson:"createdDate" json:"createdDate"`
+	UpdatedBy      primitive.ObjectID   `bson:"updatedBy" json:"updatedBy"`
+	UpdatedDate    time.Time            `bson:"updatedDate" json:"updatedDate"`
+	Identities     []UserIdentity       `bson:"identities,omitempty" json:"identities,omitempty"`
+	Webauthn       []WebauthnCredential `bson:"webauthn,omitempty" json:"webauthn,omitempty"`
+	ImpersonatedBy string               `bson:"-" json:"impersonatedBy,omitempty"`
+}
+
+// UserIdentity links a user to the subject of an external identity provider
+type UserIdentity struct {
+	ProviderId string    `bson:"providerId" json:"providerId"`
+	Subject    string    `bson:"subject" json:"subject"`
+	LinkedDate time.Time `bson:"linkedDate" json:"linkedDate"`
 }
@@ -0,0 +1,11 @@
+package model
+
+// VerificationChallenge is a code or link sent to prove a user owns an email or phone, kept until it
+// is used or expires
+type VerificationChallenge struct {
+	UserId   string `json:"userId"`
+	Channel  string `json:"channel"`
+	Address  string `json:"address"`
+	Method   string `json:"method"`
+	CodeHash string `json:"codeHash"`
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"github.com/go-webauthn/webauthn/webauthn"
+	"time"
+)
+
+// WebauthnCredential is a passkey or security key registered by a user, its id is the base64url
+// credential id
+type WebauthnCredential struct {
+	Id              string     `bson:"id" json:"id"`
+	Name            string     `bson:"name" json:"name"`
+	PublicKey       []byte     `bson:"publicKey" json:"-"`
+	AttestationType string     `bson:"attestationType" json:"-"`
+	Transports      []string   `bson:"transports" json:"transports"`
+	Aaguid          []byte     `bson:"aaguid" json:"-"`
+	SignCount       uint32     `bson:"signCount" json:"-"`
+	BackupEligible  bool       `bson:"backupEligible" json:"backupEligible"`
+	BackupState     bool       `bson:"backupState" json:"backupState"`
+	CreatedDate     time.Time  `bson:"createdDate" json:"createdDate"`
+	LastUsedDate    *time.Time `bson:"lastUsedDate" json:"lastUsedDate"`
+}
+
+// WebauthnChallenge keeps a registration or login ceremony between its begin and finish requests
+type WebauthnChallenge struct {
+	Ceremony string               `json:"ceremony"`
+	UserId   string               `json:"userId,omitempty"`
+	System   string               `json:"system,omitempty"`
+	Session  webauthn.SessionData `json:"session"`
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Webhook posts the events it subscribes to to Path on the host of its system
+type Webhook struct {
+	Id          primitive.ObjectID `bson:"_id" json:"id"`
+	SystemId    primitive.ObjectID `bson:"systemId" json:"systemId"`
+	ClientId    string             `bson:"clientId" json:"clientId"`
+	Path        string             `bson:"path" json:"path"`
+	Events      []string           `bson:"events" json:"events"`
+	Secret      string             `bson:"secret" json:"-"`
+	Active      bool               `bson:"active" json:"active"`
+	CreatedBy   primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	CreatedDate time.Time          `bson:"createdDate" json:"createdDate"`
+	UpdatedBy   primitive.ObjectID `bson:"updatedBy" json:"updatedBy"`
+	UpdatedDate time.Time          `bson:"updatedDate" json:"updatedDate"`
+}
+
+type WebhookAttempt struct {
+	Date       time.Time `bson:"date" json:"date"`
+	Url        string    `bson:"url" json:"url"`
+	StatusCode int       `bson:"statusCode" json:"statusCode"`
+	Error      string    `bson:"error" json:"error,omitempty"`
+	Duration   int64     `bson:"duration" json:"duration"`
+}
+
+// WebhookDelivery is one event queued for one webhook, Payload is the event envelope posted as body
+type WebhookDelivery struct {
+	Id              primitive.ObjectID `bson:"_id" json:"id"`
+	WebhookId       primitive.ObjectID `bson:"webhookId" json:"webhookId"`
+	SystemId        primitive.ObjectID `bson:"systemId" json:"systemId"`
+	ClientId        string             `bson:"clientId" json:"clientId"`
+	EventId         string             `bson:"eventId" json:"eventId"`
+	EventType       string             `bson:"eventType" json:"eventType"`
+	Payload         json.RawMessage    `bson:"payload" json:"payload"`
+	Status          string             `bson:"status" json:"status"`
+	RetryCount      int                `bson:"retryCount" json:"retryCount"`
+	Attempts        []WebhookAttempt   `bson:"attempts" json:"attempts"`
+	NextAttemptDate time.Time          `bson:"nextAttemptDate" json:"nextAttemptDate"`
+	CreatedDate     time.Time          `bson:"createdDate" json:"createdDate"`
+	UpdatedDate     time.Time          `bson:"updatedDate" json:"updatedDate"`
+	// UserId is the user the event is about, so erasing them finds the payloads naming them
+	UserId string `bson:"userId,omitempty" json:"-"`
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/db"
+)
+
+type apiKeyEntity struct {
+	apiKeyRepo *mongo.Collection
+}
+
+type IApiKey interface {
+	CreateIndex() (string, error)
+	GetApiKeysByUserId(userId string) ([]model.ApiKey, error)
+	GetApiKeyByHash(keyHash string) (*model.ApiKey, error)
+	CreateApiKey(form request.ApiKey, keyHash string, prefix string) (*model.ApiKey, error)
+	RevokeApiKey(id string, userId string) (*model.ApiKey, error)
+	TouchApiKey(id primitive.ObjectID, ip string) error
+	RemoveApiKeysByUserId(userId string) error
+}
+
+func NewApiKeyEntity(resource *db.Resource) IApiKey {
+	apiKeyRepo := resource.UmDb.Collection("api_keys")
+	var entity IApiKey = &apiKeyEntity{apiKeyRepo: apiKeyRepo}
+	_, err := entity.CreateIndex()
+	if err != nil {
+		logrus.Error(err)
+	}
+	return entity
+}
+
+func (entity *apiKeyEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mods := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"keyHash": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdDate", Value: -1}},
+		},
+	}
+	ind, err := entity.apiKeyRepo.Indexes().CreateMany(ctx, mods)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(ind, ","), nil
+}
+
+func (entity *apiKeyEntity) GetApiKeysByUserId(userId string) ([]model.ApiKey, error) {
+	logrus.Info("GetApiKeysByUserId")
+	var items []model.ApiKey
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(userId)
+	cursor, err := entity.apiKeyRepo.Find(ctx, bson.M{"userId": objId}, options.Find().SetSort(bson.M{"createdDate": -1}))
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.ApiKey
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.ApiKey{}
+	}
+	return items, nil
+}
+
+func (entity *apiKeyEntity) GetApiKeyByHash(keyHash string) (*model.ApiKey, error) {
+	logrus.Info("GetApiKeyByHash")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.ApiKey
+	err := entity.apiKeyRepo.FindOne(ctx, bson.M{"keyHash": keyHash}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *apiKeyEntity) CreateApiKey(form request.ApiKey, keyHash string, prefix string) (*model.ApiKey, error) {
+	logrus.Info("CreateApiKey")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	userId, _ := primitive.ObjectIDFromHex(form.UserId)
+	scopes := form.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	allowedIps := form.AllowedIps
+	if allowedIps == nil {
+		allowedIps = []string{}
+	}
+	item := model.ApiKey{
+		Id:          primitive.NewObjectID(),
+		UserId:      userId,
+		ClientId:    form.ClientId,
+		Name:        form.Name,
+		KeyHash:     keyHash,
+		Prefix:      prefix,
+		Scopes:      scopes,
+		AllowedIps:  allowedIps,
+		ExpireDate:  form.ExpireDate,
+		CreatedDate: time.Now(),
+	}
+	_, err := entity.apiKeyRepo.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// RevokeApiKey marks a key of the user as revoked, the key is kept for its history
+func (entity *apiKeyEntity) RevokeApiKey(id string, userId string) (*model.ApiKey, error) {
+	logrus.Info("RevokeApiKey")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	userObjId, _ := primitive.ObjectIDFromHex(userId)
+	var item model.ApiKey
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	filter := bson.M{"_id": objId, "userId": userObjId, "revokedDate": nil}
+	err := entity.apiKeyRepo.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"revokedDate": time.Now()}}, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *apiKeyEntity) TouchApiKey(id primitive.ObjectID, ip string) error {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	update := bson.M{"$set": bson.M{"lastUsedDate": time.Now(), "lastUsedIp": ip}}
+	_, err := entity.apiKeyRepo.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// RemoveApiKeysByUserId deletes the keys of a user, revoked ones included, when their data is erased
+func (entity *apiKeyEntity) RemoveApiKeysByUserId(userId string) error {
+	logrus.Info("RemoveApiKeysByUserId")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(userId)
+	_, err := entity.apiKeyRepo.DeleteMany(ctx, bson.M{"userId": objId})
+	return err
+}
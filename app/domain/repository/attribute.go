@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/db"
+)
+
+type attributeEntity struct {
+	attributeRepo *mongo.Collection
+}
+
+type IAttribute interface {
+	CreateIndex() (string, error)
+	GetAttributeSchemas(clientId string) ([]model.AttributeSchema, error)
+	GetAttributeSchemaById(id string, clientId string) (*model.AttributeSchema, error)
+	CountAttributeSchemas(clientId string) (int64, error)
+	CreateAttributeSchema(form request.AttributeSchema) (*model.AttributeSchema, error)
+	UpdateAttributeSchemaById(id string, clientId string, form request.UpdateAttributeSchema) (*model.AttributeSchema, error)
+	RemoveAttributeSchemaById(id string, clientId string) (*model.AttributeSchema, error)
+}
+
+func NewAttributeEntity(resource *db.Resource) IAttribute {
+	attributeRepo := resource.UmDb.Collection("attribute_schemas")
+	var entity IAttribute = &attributeEntity{attributeRepo: attributeRepo}
+	_, err := entity.CreateIndex()
+	if err != nil {
+		logrus.Error(err)
+	}
+	return entity
+}
+
+func (entity *attributeEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mod := mongo.IndexModel{
+		Keys:    bson.D{{Key: "clientId", Value: 1}, {Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	ind, err := entity.attributeRepo.Indexes().CreateOne(ctx, mod)
+	return ind, err
+}
+
+func (entity *attributeEntity) GetAttributeSchemas(clientId string) ([]model.AttributeSchema, error) {
+	logrus.Info("GetAttributeSchemas")
+	var items []model.AttributeSchema
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	cursor, err := entity.attributeRepo.Find(ctx, bson.M{"clientId": clientId}, options.Find().SetSort(bson.M{"key": 1}))
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.AttributeSchema
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.AttributeSchema{}
+	}
+	return items, nil
+}
+
+func (entity *attributeEntity) GetAttributeSchemaById(id string, clientId string) (*model.AttributeSchema, error) {
+	logrus.Info("GetAttributeSchemaById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.AttributeSchema
+	objId, _ := primitive.ObjectIDFromHex(id)
+	err := entity.attributeRepo.FindOne(ctx, bson.M{"_id": objId, "clientId": clientId}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *attributeEntity) CountAttributeSchemas(clientId string) (int64, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	return entity.attributeRepo.CountDocuments(ctx, bson.M{"clientId": clientId})
+}
+
+func (entity *attributeEntity) CreateAttributeSchema(form request.AttributeSchema) (*model.AttributeSchema, error) {
+	logrus.Info("CreateAttributeSchema")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	createdBy, _ := primitive.ObjectIDFromHex(form.CreatedBy)
+	item := model.AttributeSchema{
+		Id:          primitive.NewObjectID(),
+		ClientId:    form.ClientId,
+		Key:         form.Key,
+		Label:       form.Label,
+		Type:        form.Type,
+		Required:    form.Required,
+		Unique:      form.Unique,
+		Pattern:     form.Pattern,
+		Enum:        form.Enum,
+		Editable:    form.Editable,
+		Claim:       form.Claim,
+		CreatedBy:   createdBy,
+		CreatedDate: time.Now(),
+		UpdatedBy:   createdBy,
+		UpdatedDate: time.Now(),
+	}
+	_, err := entity.attributeRepo.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *attributeEntity) UpdateAttributeSchemaById(id string, clientId string, form request.UpdateAttributeSchema) (*model.AttributeSchema, error) {
+	logrus.Info("UpdateAttributeSchemaById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	updatedBy, _ := primitive.ObjectIDFromHex(form.UpdatedBy)
+	update := bson.M{
+		"label":       form.Label,
+		"required":    form.Required,
+		"unique":      form.Unique,
+		"pattern":     form.Pattern,
+		"enum":        form.Enum,
+		"editable":    form.Editable,
+		"claim":       form.Claim,
+		"updatedBy":   updatedBy,
+		"updatedDate": time.Now(),
+	}
+	var item model.AttributeSchema
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	err := entity.attributeRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, bson.M{"$set": update}, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *attributeEntity) RemoveAttributeSchemaById(id string, clientId string) (*model.AttributeSchema, error) {
+	logrus.Info("RemoveAttributeSchemaById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.AttributeSchema
+	objId, _ := primitive.ObjectIDFromHex(id)
+	err := entity.attributeRepo.FindOneAndDelete(ctx, bson.M{"_id": objId, "clientId": clientId}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
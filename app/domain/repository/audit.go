@@ -0,0 +1,453 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/db"
+)
+
+// auditHeadId is the document of audit_head holding the seq and hash of the last event
+const auditHeadId = "head"
+
+// auditVerifyBatch is the number of events VerifyChain reads per query
+const auditVerifyBatch = 1000
+
+type auditEntity struct {
+	client    *mongo.Client
+	auditRepo *mongo.Collection
+	headRepo  *mongo.Collection
+	headReady atomic.Bool
+	// appendMutex serialises the appends of the process where transactions aren't supported
+	appendMutex sync.Mutex
+}
+
+type auditHead struct {
+	Id   string `bson:"_id"`
+	Seq  int64  `bson:"seq"`
+	Hash string `bson:"hash"`
+}
+
+type IAudit interface {
+	CreateIndex() (string, error)
+	CreateEvent(item model.AuditEvent) (*model.AuditEvent, error)
+	GetEvents(form request.GetAuditEvents) ([]model.AuditEvent, error)
+	VerifyChain() (*model.AuditVerification, error)
+	GetEventsByUserId(userId string, targetIds []string) ([]model.AuditEvent, error)
+	RedactEvents(targetIds []string, redaction model.AuditEvent) (int64, error)
+}
+
+func NewAuditEntity(resource *db.Resource) IAudit {
+	auditRepo := resource.UmDb.Collection("audit_events")
+	headRepo := resource.UmDb.Collection("audit_head")
+	var entity IAudit = &auditEntity{client: resource.UmDb.Client(), auditRepo: auditRepo, headRepo: headRepo}
+	_, _ = entity.CreateIndex()
+	return entity
+}
+
+func (entity *auditEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mods := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"seq": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "clientId", Value: 1}, {Key: "createdDate", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "targetId", Value: 1}, {Key: "createdDate", Value: -1}},
+		},
+	}
+	ind, err := entity.auditRepo.Indexes().CreateMany(ctx, mods)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(ind, ","), nil
+}
+
+// CreateEvent appends the event to the hash chain. The head is moved in the transaction inserting
+// the event, so concurrent writers wait for each other on it and none is turned away. Standalone
+// servers can't run transactions, there the appends of the process are serialised instead.
+func (entity *auditEntity) CreateEvent(item model.AuditEvent) (*model.AuditEvent, error) {
+	logrus.Info("CreateEvent")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+
+	payloadHash, err := auditPayloadHash(item.Diff)
+	if err != nil {
+		return nil, err
+	}
+	item.PayloadHash = payloadHash
+	err = entity.initHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := entity.client.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return entity.appendEvent(sc, item)
+	})
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == errCodeIllegalOperation {
+		logrus.Warning("transactions are not supported, appending audit events one at a time")
+		entity.appendMutex.Lock()
+		defer entity.appendMutex.Unlock()
+		return entity.appendEvent(ctx, item)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.(*model.AuditEvent), nil
+}
+
+// appendEvent takes the next seq from the head, which holds off other transactions until this one
+// ends, inserts the event and moves the hash of the head to it
+func (entity *auditEntity) appendEvent(ctx context.Context, item model.AuditEvent) (*model.AuditEvent, error) {
+	var head auditHead
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	err := entity.headRepo.FindOneAndUpdate(ctx, bson.M{"_id": auditHeadId}, bson.M{"$inc": bson.M{"seq": 1}}, opts).Decode(&head)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Id = primitive.NewObjectID()
+	item.Seq = head.Seq + 1
+	item.PrevHash = head.Hash
+	item.CreatedDate = time.Now().UTC().Truncate(time.Millisecond)
+	item.Hash = auditHash(item)
+	_, err = entity.auditRepo.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	_, err = entity.headRepo.UpdateOne(ctx, bson.M{"_id": auditHeadId}, bson.M{"$set": bson.M{"hash": item.Hash}})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// initHead creates the head from the last event, for logs started before the head existed
+func (entity *auditEntity) initHead(ctx context.Context) error {
+	if entity.headReady.Load() {
+		return nil
+	}
+	var last model.AuditEvent
+	opts := options.FindOne().SetSort(bson.M{"seq": -1})
+	err := entity.auditRepo.FindOne(ctx, bson.M{}, opts).Decode(&last)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+	update := bson.M{"$setOnInsert": bson.M{"seq": last.Seq, "hash": last.Hash}}
+	_, err = entity.headRepo.UpdateOne(ctx, bson.M{"_id": auditHeadId}, update, options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	entity.headReady.Store(true)
+	return nil
+}
+
+func (entity *auditEntity) GetEvents(form request.GetAuditEvents) ([]model.AuditEvent, error) {
+	logrus.Info("GetEvents")
+	var items []model.AuditEvent
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+
+	var queries = bson.M{}
+	if form.ClientId != "" {
+		queries["clientId"] = form.ClientId
+	}
+	if form.ActorId != "" {
+		queries["$or"] = []bson.M{{"actorId": form.ActorId}, {"impersonatorId": form.ActorId}}
+	}
+	if form.TargetType != "" {
+		queries["targetType"] = form.TargetType
+	}
+	if form.TargetId != "" {
+		queries["targetId"] = form.TargetId
+	}
+	if form.Action != "" {
+		queries["action"] = form.Action
+	}
+	if form.RequestId != "" {
+		queries["requestId"] = form.RequestId
+	}
+	dateQuery := bson.M{}
+	if !form.From.IsZero() {
+		dateQuery["$gte"] = form.From
+	}
+	if !form.To.IsZero() {
+		dateQuery["$lte"] = form.To
+	}
+	if len(dateQuery) > 0 {
+		queries["createdDate"] = dateQuery
+	}
+
+	limit := form.Limit
+	if limit == 0 {
+		limit = 100
+	}
+	opts := options.Find().SetSort(bson.M{"seq": -1}).SetLimit(limit).SetSkip(form.Offset)
+	cursor, err := entity.auditRepo.Find(ctx, queries, opts)
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.AuditEvent
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.AuditEvent{}
+	}
+	return items, nil
+}
+
+// VerifyChain walks the whole log in order and recomputes every link of the chain. The log is read
+// in batches, each with its own deadline, so a long log doesn't run out of time.
+func (entity *auditEntity) VerifyChain() (*model.AuditVerification, error) {
+	logrus.Info("VerifyChain")
+	verifier := newAuditVerifier()
+	for {
+		items, err := entity.eventsAfter(verifier.prevSeq, auditVerifyBatch)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if !verifier.check(item) {
+				return verifier.result, nil
+			}
+		}
+		if len(items) < auditVerifyBatch {
+			return verifier.finish(), nil
+		}
+	}
+}
+
+// auditVerifier follows the chain one event at a time. A redacted event has to be listed by a later
+// AUDIT_REDACT event, otherwise the diff could have been emptied without a trace.
+type auditVerifier struct {
+	result     *model.AuditVerification
+	prevSeq    int64
+	prevHash   string
+	unrecorded map[int64]bool
+}
+
+func newAuditVerifier() *auditVerifier {
+	return &auditVerifier{result: &model.AuditVerification{Valid: true}, unrecorded: map[int64]bool{}}
+}
+
+// check verifies the next event of the chain and returns false when the chain breaks at it
+func (verifier *auditVerifier) check(item model.AuditEvent) bool {
+	verifier.result.Checked++
+	reason := auditBreak(item, verifier.prevSeq, verifier.prevHash)
+	if reason != "" {
+		verifier.result.Valid = false
+		verifier.result.BrokenAt = item.Seq
+		verifier.result.Reason = reason
+		return false
+	}
+	if item.Redacted {
+		verifier.unrecorded[item.Seq] = true
+	}
+	if item.Action == constant.AuditRedact {
+		for _, seq := range item.RedactedSeqs {
+			if seq < item.Seq {
+				delete(verifier.unrecorded, seq)
+			}
+		}
+	}
+	verifier.prevHash = item.Hash
+	verifier.prevSeq = item.Seq
+	return true
+}
+
+// finish fails the chain at the first redacted event no AUDIT_REDACT event lists
+func (verifier *auditVerifier) finish() *model.AuditVerification {
+	for seq := range verifier.unrecorded {
+		if verifier.result.Valid || seq < verifier.result.BrokenAt {
+			verifier.result.Valid = false
+			verifier.result.BrokenAt = seq
+			verifier.result.Reason = "redaction not recorded"
+		}
+	}
+	return verifier.result
+}
+
+// auditBreak tells why item doesn't follow the event with prevSeq and prevHash, or returns "" when it
+// does. The redacted flag isn't hashed, so a redacted event must have an empty diff, otherwise the flag
+// could hide a rewritten payload.
+func auditBreak(item model.AuditEvent, prevSeq int64, prevHash string) string {
+	if item.Seq != prevSeq+1 {
+		return "sequence gap"
+	}
+	if item.PrevHash != prevHash {
+		return "previous hash mismatch"
+	}
+	if item.Hash != auditHash(item) {
+		return "event hash mismatch"
+	}
+	if item.Redacted {
+		if len(item.Diff) > 0 {
+			return "redacted event has a payload"
+		}
+		return ""
+	}
+	payloadHash, _ := auditPayloadHash(item.Diff)
+	if payloadHash != item.PayloadHash {
+		return "payload hash mismatch"
+	}
+	return ""
+}
+
+// eventsAfter returns at most limit events following seq, in order
+func (entity *auditEntity) eventsAfter(seq int64, limit int64) ([]model.AuditEvent, error) {
+	var items []model.AuditEvent
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"seq": 1}).SetLimit(limit)
+	cursor, err := entity.auditRepo.Find(ctx, bson.M{"seq": bson.M{"$gt": seq}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &items)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetEventsByUserId returns the events a user made, or that targeted them or one of targetIds, in order
+func (entity *auditEntity) GetEventsByUserId(userId string, targetIds []string) ([]model.AuditEvent, error) {
+	logrus.Info("GetEventsByUserId")
+	var items []model.AuditEvent
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	filter := bson.M{"$or": []bson.M{
+		{"actorId": userId},
+		{"impersonatorId": userId},
+		{"targetId": bson.M{"$in": append([]string{userId}, targetIds...)}},
+	}}
+	cursor, err := entity.auditRepo.Find(ctx, filter, options.Find().SetSort(bson.M{"seq": 1}))
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.AuditEvent
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.AuditEvent{}
+	}
+	return items, nil
+}
+
+// RedactEvents empties the diff of the events of the targets. The payload hash stays, so the chain
+// still verifies. The redaction event listing their seqs is appended first, so a redacted event is
+// never left without one; when the update fails, calling it again lists the events again.
+func (entity *auditEntity) RedactEvents(targetIds []string, redaction model.AuditEvent) (int64, error) {
+	logrus.Info("RedactEvents")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	filter := bson.M{"targetId": bson.M{"$in": targetIds}, "redacted": false, "action": bson.M{"$ne": constant.AuditRedact}}
+	cursor, err := entity.auditRepo.Find(ctx, filter, options.Find().SetSort(bson.M{"seq": 1}).SetProjection(bson.M{"seq": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var items []model.AuditEvent
+	err = cursor.All(ctx, &items)
+	if err != nil {
+		return 0, err
+	}
+	if len(items) == 0 {
+		return 0, nil
+	}
+	seqs := make([]int64, 0, len(items))
+	for _, item := range items {
+		seqs = append(seqs, item.Seq)
+	}
+	redaction.Action = constant.AuditRedact
+	redaction.RedactedSeqs = seqs
+	_, err = entity.CreateEvent(redaction)
+	if err != nil {
+		return 0, err
+	}
+	update := bson.M{"$set": bson.M{"diff": bson.M{}, "redacted": true}}
+	result, err := entity.auditRepo.UpdateMany(ctx, bson.M{"seq": bson.M{"$in": seqs}}, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// auditPayloadHash hashes the diff separately so it can be redacted without breaking the chain
+func auditPayloadHash(diff map[string]model.AuditChange) (string, error) {
+	payload, err := json.Marshal(diff)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func auditHash(item model.AuditEvent) string {
+	fields := []string{
+		item.PrevHash,
+		strconv.FormatInt(item.Seq, 10),
+		item.CreatedDate.UTC().Format(time.RFC3339Nano),
+		item.ClientId,
+		item.ActorId,
+		item.ImpersonatorId,
+		item.Action,
+		item.TargetType,
+		item.TargetId,
+		item.PayloadHash,
+		item.Ip,
+		item.UserAgent,
+		item.RequestId,
+	}
+	// only hashed when present, so the events written before the field existed keep their hash
+	if len(item.RedactedSeqs) > 0 {
+		seqs := make([]string, 0, len(item.RedactedSeqs))
+		for _, seq := range item.RedactedSeqs {
+			seqs = append(seqs, strconv.FormatInt(seq, 10))
+		}
+		fields = append(fields, strings.Join(seqs, ","))
+	}
+	payload, _ := json.Marshal(fields)
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"um/app/core/constant"
+	"um/app/domain/model"
+)
+
+// auditChain links events the way appendEvent does
+func auditChain(t *testing.T, diffs ...map[string]model.AuditChange) []model.AuditEvent {
+	t.Helper()
+	var items []model.AuditEvent
+	prevHash := ""
+	for i, diff := range diffs {
+		payloadHash, err := auditPayloadHash(diff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item := model.AuditEvent{
+			Seq:         int64(i + 1),
+			ClientId:    "ACME",
+			Action:      "USER_UPDATE",
+			TargetId:    "user-1",
+			Diff:        diff,
+			PayloadHash: payloadHash,
+			PrevHash:    prevHash,
+			CreatedDate: time.Now().UTC().Truncate(time.Millisecond),
+		}
+		item.Hash = auditHash(item)
+		prevHash = item.Hash
+		items = append(items, item)
+	}
+	return items
+}
+
+func verifyAuditChain(items []model.AuditEvent) string {
+	verifier := newAuditVerifier()
+	for _, item := range items {
+		if !verifier.check(item) {
+			return verifier.result.Reason
+		}
+	}
+	return verifier.finish().Reason
+}
+
+// recordRedaction appends the AUDIT_REDACT event RedactEvents writes for seqs
+func recordRedaction(items []model.AuditEvent, seqs ...int64) []model.AuditEvent {
+	last := items[len(items)-1]
+	redaction := model.AuditEvent{
+		Seq:          last.Seq + 1,
+		ClientId:     "ACME",
+		Action:       constant.AuditRedact,
+		TargetId:     "user-1",
+		Diff:         map[string]model.AuditChange{},
+		RedactedSeqs: seqs,
+		PrevHash:     last.Hash,
+		CreatedDate:  time.Now().UTC().Truncate(time.Millisecond),
+	}
+	redaction.PayloadHash, _ = auditPayloadHash(redaction.Diff)
+	redaction.Hash = auditHash(redaction)
+	return append(items, redaction)
+}
+
+func TestAuditBreakRedaction(t *testing.T) {
+	change := map[string]model.AuditChange{"email": {From: json.RawMessage(`"a@example.com"`), To: json.RawMessage(`"b@example.com"`)}}
+	forged := map[string]model.AuditChange{"email": {From: json.RawMessage(`"a@example.com"`), To: json.RawMessage(`"evil@example.com"`)}}
+
+	items := auditChain(t, change, change)
+	if reason := verifyAuditChain(items); reason != "" {
+		t.Fatalf("intact chain broke: %s", reason)
+	}
+
+	items[0].Diff = forged
+	if reason := verifyAuditChain(items); reason != "payload hash mismatch" {
+		t.Fatalf("rewritten diff gave %q", reason)
+	}
+
+	// redaction as RedactEvents does it
+	items = recordRedaction(items, 1)
+	items[0].Diff = map[string]model.AuditChange{}
+	items[0].Redacted = true
+	if reason := verifyAuditChain(items); reason != "" {
+		t.Fatalf("redacted chain broke: %s", reason)
+	}
+
+	items[0].Diff = forged
+	if reason := verifyAuditChain(items); reason != "redacted event has a payload" {
+		t.Fatalf("rewritten diff behind the redacted flag gave %q", reason)
+	}
+}
+
+func TestAuditBreakUnrecordedRedaction(t *testing.T) {
+	change := map[string]model.AuditChange{"email": {From: json.RawMessage(`"a@example.com"`), To: json.RawMessage(`"b@example.com"`)}}
+
+	for _, test := range []struct {
+		name   string
+		record []int64
+		reason string
+	}{
+		{"recorded", []int64{1, 2}, ""},
+		{"no redaction event", nil, "redaction not recorded"},
+		{"redaction event missing one", []int64{1}, "redaction not recorded"},
+	} {
+		items := auditChain(t, change, change, change)
+		if test.record != nil {
+			items = recordRedaction(items, test.record...)
+		}
+		items[0].Diff, items[0].Redacted = map[string]model.AuditChange{}, true
+		items[1].Diff, items[1].Redacted = map[string]model.AuditChange{}, true
+		if reason := verifyAuditChain(items); reason != test.reason {
+			t.Errorf("%s: gave %q, want %q", test.name, reason, test.reason)
+		}
+	}
+
+	// a redaction event only records the events before it
+	items := recordRedaction(auditChain(t, change, change), 4)
+	items = append(items, auditChain(t, change)...)
+	items[3].Seq, items[3].PrevHash = 4, items[2].Hash
+	items[3].Hash = auditHash(items[3])
+	items[3].Diff, items[3].Redacted = map[string]model.AuditChange{}, true
+	if reason := verifyAuditChain(items); reason != "redaction not recorded" {
+		t.Errorf("redaction listed in advance gave %q", reason)
+	}
+
+	items = recordRedaction(auditChain(t, change, change), 1)
+	items[2].RedactedSeqs = []int64{1, 2}
+	if reason := verifyAuditChain(items); reason != "event hash mismatch" {
+		t.Errorf("rewritten list of redacted seqs gave %q", reason)
+	}
+}
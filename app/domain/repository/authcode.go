@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"time"
+	"um/app/domain/model"
+	"um/db"
+)
+
+type authCodeEntity struct {
+	rdb *redis.Client
+}
+
+type IAuthCode interface {
+	CreateAuthCode(code string, item model.AuthCode, expiration time.Duration) error
+	ConsumeAuthCode(code string) (*model.AuthCode, error)
+}
+
+func NewAuthCodeEntity(resource *db.Resource) IAuthCode {
+	var entity IAuthCode = &authCodeEntity{rdb: resource.RdDB}
+	return entity
+}
+
+func (entity *authCodeEntity) CreateAuthCode(code string, item model.AuthCode, expiration time.Duration) error {
+	logrus.Info("CreateAuthCode")
+	payload, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return entity.rdb.Set(context.Background(), "oidc:code:"+code, payload, expiration).Err()
+}
+
+// ConsumeAuthCode reads and deletes a code in one transaction, so a code can be exchanged once
+func (entity *authCodeEntity) ConsumeAuthCode(code string) (*model.AuthCode, error) {
+	logrus.Info("ConsumeAuthCode")
+	ctx := context.Background()
+	key := "oidc:code:" + code
+	var get *redis.StringCmd
+	_, err := entity.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var item model.AuthCode
+	err = json.Unmarshal([]byte(get.Val()), &item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
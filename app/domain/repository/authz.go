@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"time"
+	"um/app/domain/model"
+	"um/db"
+)
+
+const authzVersionKey = "authz:version"
+
+type authzEntity struct {
+	rdb *redis.Client
+}
+
+type IAuthz interface {
+	GetDecision(userId string, key string) (*model.AuthzDecision, error)
+	SetDecision(userId string, key string, decision model.AuthzDecision, expiration time.Duration) error
+	InvalidateUser(userId string) error
+	InvalidateAll() error
+}
+
+func NewAuthzEntity(resource *db.Resource) IAuthz {
+	var entity IAuthz = &authzEntity{rdb: resource.RdDB}
+	return entity
+}
+
+// decisionKey builds the cache key from the global and per user versions, so bumping
+// either version makes every previously cached decision unreachable
+func (entity *authzEntity) decisionKey(userId string, key string) (string, error) {
+	versions, err := entity.rdb.MGet(context.Background(), authzVersionKey, authzVersionKey+":"+userId).Result()
+	if err != nil {
+		return "", err
+	}
+	global, user := "0", "0"
+	if value, ok := versions[0].(string); ok {
+		global = value
+	}
+	if value, ok := versions[1].(string); ok {
+		user = value
+	}
+	return "authz:decision:" + userId + ":" + global + ":" + user + ":" + key, nil
+}
+
+func (entity *authzEntity) GetDecision(userId string, key string) (*model.AuthzDecision, error) {
+	logrus.Info("GetDecision")
+	cacheKey, err := entity.decisionKey(userId, key)
+	if err != nil {
+		return nil, err
+	}
+	result, err := entity.rdb.Get(context.Background(), cacheKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	var decision model.AuthzDecision
+	err = json.Unmarshal([]byte(result), &decision)
+	if err != nil {
+		return nil, err
+	}
+	return &decision, nil
+}
+
+func (entity *authzEntity) SetDecision(userId string, key string, decision model.AuthzDecision, expiration time.Duration) error {
+	logrus.Info("SetDecision")
+	cacheKey, err := entity.decisionKey(userId, key)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(decision)
+	if err != nil {
+		return err
+	}
+	return entity.rdb.Set(context.Background(), cacheKey, value, expiration).Err()
+}
+
+func (entity *authzEntity) InvalidateUser(userId string) error {
+	logrus.Info("InvalidateUser")
+	return entity.rdb.Incr(context.Background(), authzVersionKey+":"+userId).Err()
+}
+
+func (entity *authzEntity) InvalidateAll() error {
+	logrus.Info("InvalidateAll")
+	return entity.rdb.Incr(context.Background(), authzVersionKey).Err()
+}
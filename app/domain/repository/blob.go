@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidBlobKey is returned for keys that are empty, absolute or climb out of the store
+var ErrInvalidBlobKey = errors.New("invalid blob key")
+
+// IBlobStore keeps files by slash separated keys. Keys sharing a prefix ending with "/" can be
+// removed together, which maps onto a folder on disk or a key prefix of S3-compatible storage.
+type IBlobStore interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	RemovePrefix(prefix string) error
+}
+
+type localBlobStore struct {
+	root string
+}
+
+// NewLocalBlobStore stores blobs as files under root, "data/blobs" when empty
+func NewLocalBlobStore(root string) IBlobStore {
+	if root == "" {
+		root = "data/blobs"
+	}
+	err := os.MkdirAll(root, 0o750)
+	if err != nil {
+		logrus.Error(err)
+	}
+	return &localBlobStore{root: root}
+}
+
+func (store *localBlobStore) file(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || strings.HasPrefix(key, "/") || clean != "/"+strings.TrimSuffix(key, "/") {
+		return "", ErrInvalidBlobKey
+	}
+	return filepath.Join(store.root, filepath.FromSlash(clean)), nil
+}
+
+// Put writes a blob through a temporary file, so readers never see it half written
+func (store *localBlobStore) Put(key string, data []byte) error {
+	file, err := store.file(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0o750)
+	if err != nil {
+		return err
+	}
+	temp := file + ".tmp"
+	err = os.WriteFile(temp, data, 0o640)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp, file)
+}
+
+// Get reads a blob, the error wraps os.ErrNotExist when there is none
+func (store *localBlobStore) Get(key string) ([]byte, error) {
+	file, err := store.file(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(file)
+}
+
+func (store *localBlobStore) RemovePrefix(prefix string) error {
+	if !strings.HasSuffix(prefix, "/") {
+		return ErrInvalidBlobKey
+	}
+	dir, err := store.file(prefix)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
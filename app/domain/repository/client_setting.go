@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/db"
+)
+
+type clientSettingEntity struct {
+	clientSettingRepo *mongo.Collection
+}
+
+type IClientSetting interface {
+	CreateIndex() (string, error)
+	GetClientSetting(clientId string) (*model.ClientSetting, error)
+	GetClientSettingByRegistrationCode(code string) (*model.ClientSetting, error)
+	GetInactivityPolicies() ([]model.ClientSetting, error)
+	UpdateClientSetting(clientId string, form request.ClientSetting) (*model.ClientSetting, error)
+}
+
+func NewClientSettingEntity(resource *db.Resource) IClientSetting {
+	clientSettingRepo := resource.UmDb.Collection("client_settings")
+	var entity IClientSetting = &clientSettingEntity{clientSettingRepo: clientSettingRepo}
+	_, err := entity.CreateIndex()
+	if err != nil {
+		logrus.Error(err)
+	}
+	return entity
+}
+
+func (entity *clientSettingEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mods := []mongo.IndexModel{
+		{
+			Keys: bson.M{
+				"clientId": 1,
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.M{"registrationCode": 1},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"registrationCode": bson.M{"$gt": ""}}),
+		},
+	}
+	ind, err := entity.clientSettingRepo.Indexes().CreateMany(ctx, mods)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(ind, ","), nil
+}
+
+// GetClientSetting returns the defaults for a client that never saved its settings
+func (entity *clientSettingEntity) GetClientSetting(clientId string) (*model.ClientSetting, error) {
+	logrus.Info("GetClientSetting")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.ClientSetting
+	err := entity.clientSettingRepo.FindOne(ctx, bson.M{"clientId": clientId}).Decode(&item)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &model.ClientSetting{ClientId: clientId}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetClientSettingByRegistrationCode finds the client a registration code lets users sign up to
+func (entity *clientSettingEntity) GetClientSettingByRegistrationCode(code string) (*model.ClientSetting, error) {
+	logrus.Info("GetClientSettingByRegistrationCode")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.ClientSetting
+	filter := bson.M{"registrationCode": code, "registrationEnabled": true}
+	err := entity.clientSettingRepo.FindOne(ctx, filter).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetInactivityPolicies lists the settings of the clients that disable inactive users
+func (entity *clientSettingEntity) GetInactivityPolicies() ([]model.ClientSetting, error) {
+	logrus.Info("GetInactivityPolicies")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	cursor, err := entity.clientSettingRepo.Find(ctx, bson.M{"inactivityDays": bson.M{"$gt": 0}})
+	if err != nil {
+		return nil, err
+	}
+	var items []model.ClientSetting
+	err = cursor.All(ctx, &items)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (entity *clientSettingEntity) UpdateClientSetting(clientId string, form request.ClientSetting) (*model.ClientSetting, error) {
+	logrus.Info("UpdateClientSetting")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	updatedBy, _ := primitive.ObjectIDFromHex(form.UpdatedBy)
+
+	var item model.ClientSetting
+	isReturnNewDoc := options.After
+	upsert := true
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+		Upsert:         &upsert,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"passwordLoginDisabled": form.PasswordLoginDisabled,
+			"passwordlessEnabled":   form.PasswordlessEnabled,
+			"registrationEnabled":   form.RegistrationEnabled,
+			"registrationCode":      form.RegistrationCode,
+			"approvalRequired":      form.ApprovalRequired,
+			"inactivityDays":        form.InactivityDays,
+			"inactivityWarningDays": form.InactivityWarningDays,
+			"updatedBy":             updatedBy,
+			"updatedDate":           time.Now(),
+		},
+		"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+	}
+	err := entity.clientSettingRepo.FindOneAndUpdate(ctx, bson.M{"clientId": clientId}, update, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
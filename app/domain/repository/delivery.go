@@ -0,0 +1,279 @@
+package repository
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/db"
+)
+
+const errCodeDuplicateKey = 11000
+
+type deliveryEntity struct {
+	deliveryRepo *mongo.Collection
+}
+
+type IDelivery interface {
+	CreateIndex() (string, error)
+	CreateDeliveries(event model.Event, webhooks []model.Webhook) error
+	GetDueDeliveries(limit int64) ([]model.WebhookDelivery, error)
+	GetDeliveries(form request.GetWebhookDeliveries) ([]model.WebhookDelivery, error)
+	RecordAttempt(id primitive.ObjectID, attempt model.WebhookAttempt, status string, retryCount int, nextAttemptDate time.Time) error
+	Redeliver(id string, systemId string) (*model.WebhookDelivery, error)
+	RemoveDeliveriesBySystemId(systemId string) error
+	ScrubUserDeliveries(userId string, username string) error
+}
+
+func NewDeliveryEntity(resource *db.Resource) IDelivery {
+	deliveryRepo := resource.UmDb.Collection("webhook_deliveries")
+	var entity IDelivery = &deliveryEntity{deliveryRepo: deliveryRepo}
+	_, err := entity.CreateIndex()
+	if err != nil {
+		logrus.Error(err)
+	}
+	return entity
+}
+
+// CreateIndex also makes a delivery unique per webhook and event, so fanning an event out twice is harmless
+func (entity *deliveryEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mods := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "webhookId", Value: 1}, {Key: "eventId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptDate", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "systemId", Value: 1}, {Key: "createdDate", Value: -1}},
+		},
+		{
+			Keys:    bson.M{"userId": 1},
+			Options: options.Index().SetSparse(true),
+		},
+	}
+	ind, err := entity.deliveryRepo.Indexes().CreateMany(ctx, mods)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(ind, ","), nil
+}
+
+func (entity *deliveryEntity) CreateDeliveries(event model.Event, webhooks []model.Webhook) error {
+	logrus.Info("CreateDeliveries")
+	if len(webhooks) == 0 {
+		return nil
+	}
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var subject struct {
+		UserId string `json:"userId"`
+	}
+	_ = json.Unmarshal(event.Data, &subject)
+	now := time.Now()
+	var docs []interface{}
+	for _, webhook := range webhooks {
+		docs = append(docs, model.WebhookDelivery{
+			Id:              primitive.NewObjectID(),
+			WebhookId:       webhook.Id,
+			SystemId:        webhook.SystemId,
+			ClientId:        webhook.ClientId,
+			EventId:         event.Id.Hex(),
+			EventType:       event.Type,
+			UserId:          subject.UserId,
+			Payload:         payload,
+			Status:          constant.DeliveryPending,
+			Attempts:        []model.WebhookAttempt{},
+			NextAttemptDate: now,
+			CreatedDate:     now,
+			UpdatedDate:     now,
+		})
+	}
+	_, err = entity.deliveryRepo.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil && !isDuplicateOnly(err) {
+		return err
+	}
+	return nil
+}
+
+// GetDueDeliveries returns pending and failed deliveries whose next attempt is due, oldest first
+func (entity *deliveryEntity) GetDueDeliveries(limit int64) ([]model.WebhookDelivery, error) {
+	filter := bson.M{
+		"status":          bson.M{"$in": []string{constant.DeliveryPending, constant.DeliveryFailed}},
+		"nextAttemptDate": bson.M{"$lte": time.Now()},
+	}
+	opts := options.Find().SetSort(bson.M{"nextAttemptDate": 1}).SetLimit(limit)
+	return entity.find(filter, opts)
+}
+
+func (entity *deliveryEntity) GetDeliveries(form request.GetWebhookDeliveries) ([]model.WebhookDelivery, error) {
+	logrus.Info("GetDeliveries")
+	systemId, _ := primitive.ObjectIDFromHex(form.SystemId)
+	var queries = bson.M{"systemId": systemId}
+	if form.WebhookId != "" {
+		queries["webhookId"], _ = primitive.ObjectIDFromHex(form.WebhookId)
+	}
+	if form.EventId != "" {
+		queries["eventId"] = form.EventId
+	}
+	if form.Status != "" {
+		queries["status"] = form.Status
+	}
+	limit := form.Limit
+	if limit == 0 {
+		limit = 50
+	}
+	opts := options.Find().SetSort(bson.M{"createdDate": -1}).SetLimit(limit).SetSkip(form.Offset)
+	return entity.find(queries, opts)
+}
+
+func (entity *deliveryEntity) find(filter bson.M, opts *options.FindOptions) ([]model.WebhookDelivery, error) {
+	var items []model.WebhookDelivery
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	cursor, err := entity.deliveryRepo.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.WebhookDelivery
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.WebhookDelivery{}
+	}
+	return items, nil
+}
+
+func (entity *deliveryEntity) RecordAttempt(id primitive.ObjectID, attempt model.WebhookAttempt, status string, retryCount int, nextAttemptDate time.Time) error {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	update := bson.M{
+		"$push": bson.M{"attempts": attempt},
+		"$set": bson.M{
+			"status":          status,
+			"retryCount":      retryCount,
+			"nextAttemptDate": nextAttemptDate,
+			"updatedDate":     time.Now(),
+		},
+	}
+	_, err := entity.deliveryRepo.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// Redeliver queues a delivery again right away with a fresh retry budget, its attempt log is kept
+func (entity *deliveryEntity) Redeliver(id string, systemId string) (*model.WebhookDelivery, error) {
+	logrus.Info("Redeliver")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	sysId, _ := primitive.ObjectIDFromHex(systemId)
+
+	var item model.WebhookDelivery
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	update := bson.M{"$set": bson.M{
+		"status":          constant.DeliveryPending,
+		"retryCount":      0,
+		"nextAttemptDate": time.Now(),
+		"updatedDate":     time.Now(),
+	}}
+	err := entity.deliveryRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "systemId": sysId}, update, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *deliveryEntity) RemoveDeliveriesBySystemId(systemId string) error {
+	logrus.Info("RemoveDeliveriesBySystemId")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	sysId, _ := primitive.ObjectIDFromHex(systemId)
+	_, err := entity.deliveryRepo.DeleteMany(ctx, bson.M{"systemId": sysId})
+	return err
+}
+
+// ScrubUserDeliveries replaces the username in the payloads of the deliveries about a user, the
+// deliveries are kept for their attempt log
+func (entity *deliveryEntity) ScrubUserDeliveries(userId string, username string) error {
+	logrus.Info("ScrubUserDeliveries")
+	items, err := entity.find(bson.M{"userId": userId}, options.Find())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	for _, item := range items {
+		payload, changed := scrubUsername(item.Payload, username)
+		if !changed {
+			continue
+		}
+		_, err = entity.deliveryRepo.UpdateOne(ctx, bson.M{"_id": item.Id}, bson.M{"$set": bson.M{"payload": payload}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scrubUsername replaces the username in the data of an event envelope, it reports false when the data
+// names no username or already this one
+func scrubUsername(payload json.RawMessage, username string) (json.RawMessage, bool) {
+	var event model.Event
+	var data map[string]interface{}
+	if json.Unmarshal(payload, &event) != nil || json.Unmarshal(event.Data, &data) != nil {
+		return nil, false
+	}
+	if previous, ok := data["username"]; !ok || previous == username {
+		return nil, false
+	}
+	data["username"] = username
+	event.Data, _ = json.Marshal(data)
+	scrubbed, err := json.Marshal(event)
+	if err != nil {
+		return nil, false
+	}
+	return scrubbed, true
+}
+
+// isDuplicateOnly reports whether every write error of an unordered insert is a duplicate key
+func isDuplicateOnly(err error) bool {
+	bulkErr, ok := err.(mongo.BulkWriteException)
+	if !ok {
+		return false
+	}
+	if bulkErr.WriteConcernError != nil {
+		return false
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != errCodeDuplicateKey {
+			return false
+		}
+	}
+	return true
+}
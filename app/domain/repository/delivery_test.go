@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"encoding/json"
+	"testing"
+
+	"um/app/core/constant"
+	"um/app/domain/model"
+)
+
+func TestScrubUsername(t *testing.T) {
+	userEvent, _ := newEvent(constant.EventUserUpdated, "ACME", model.UserEventData{UserId: "user-1", ClientId: "ACME", Username: "jane", Role: constant.USER})
+	sessionEvent, _ := newEvent(constant.EventSessionCreated, "ACME", model.SessionEventData{SessionId: "session-1", UserId: "user-1", ClientId: "ACME"})
+	erasedEvent, _ := newEvent(constant.EventUserErased, "ACME", model.UserEventData{UserId: "user-1", ClientId: "ACME", Username: "erased-user-1"})
+	for _, test := range []struct {
+		name    string
+		event   model.Event
+		changed bool
+	}{
+		{"user event", userEvent, true},
+		{"event without a username", sessionEvent, false},
+		{"event already erased", erasedEvent, false},
+	} {
+		payload, _ := json.Marshal(test.event)
+		scrubbed, changed := scrubUsername(payload, "erased-user-1")
+		if changed != test.changed {
+			t.Errorf("%s: changed %v, want %v", test.name, changed, test.changed)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		var event model.Event
+		var data model.UserEventData
+		if json.Unmarshal(scrubbed, &event) != nil || json.Unmarshal(event.Data, &data) != nil {
+			t.Fatalf("%s: scrubbed an unreadable payload %s", test.name, scrubbed)
+		}
+		if data.Username != "erased-user-1" {
+			t.Errorf("%s: username %q, want erased-user-1", test.name, data.Username)
+		}
+		if event.Id != test.event.Id || event.Type != test.event.Type || data.UserId != "user-1" || data.Role != constant.USER {
+			t.Errorf("%s: changed more than the username: %s", test.name, scrubbed)
+		}
+	}
+
+	if _, changed := scrubUsername(json.RawMessage(`not json`), "erased-user-1"); changed {
+		t.Error("changed a payload that isn't JSON")
+	}
+}
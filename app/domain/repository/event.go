@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/db"
+)
+
+// errCodeIllegalOperation is returned by standalone servers that do not support transactions
+const errCodeIllegalOperation = 20
+
+const outboxRetention = 7 * 24 * time.Hour
+
+type eventEntity struct {
+	outbox *outbox
+}
+
+type IEvent interface {
+	CreateIndex() (string, error)
+	CreateEvent(eventType string, clientId string, data interface{}) (*model.Event, error)
+	GetPendingEvents(limit int64) ([]model.Event, error)
+	MarkPublished(id primitive.ObjectID) error
+	MarkFailed(id primitive.ObjectID, reason string) error
+	MarkDeadLetter(id primitive.ObjectID) error
+}
+
+func NewEventEntity(resource *db.Resource) IEvent {
+	var entity IEvent = &eventEntity{outbox: newOutbox(resource)}
+	_, _ = entity.CreateIndex()
+	return entity
+}
+
+func (entity *eventEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mods := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "publishedDate", Value: 1}, {Key: "_id", Value: 1}},
+		},
+		{
+			Keys:    bson.M{"expireDate": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+	ind, err := entity.outbox.outboxRepo.Indexes().CreateMany(ctx, mods)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(ind, ","), nil
+}
+
+// CreateEvent stores an event that is not tied to a Mongo write, such as a session change in Redis
+func (entity *eventEntity) CreateEvent(eventType string, clientId string, data interface{}) (*model.Event, error) {
+	logrus.Info("CreateEvent")
+	item, err := newEvent(eventType, clientId, data)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	_, err = entity.outbox.outboxRepo.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *eventEntity) GetPendingEvents(limit int64) ([]model.Event, error) {
+	var items []model.Event
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit)
+	cursor, err := entity.outbox.outboxRepo.Find(ctx, bson.M{"publishedDate": nil, "deadLetterDate": nil}, opts)
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.Event
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.Event{}
+	}
+	return items, nil
+}
+
+func (entity *eventEntity) MarkPublished(id primitive.ObjectID) error {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"publishedDate": now, "expireDate": now.Add(outboxRetention)}}
+	_, err := entity.outbox.outboxRepo.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+func (entity *eventEntity) MarkFailed(id primitive.ObjectID, reason string) error {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	update := bson.M{"$inc": bson.M{"attempts": 1}, "$set": bson.M{"lastError": reason}}
+	_, err := entity.outbox.outboxRepo.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// MarkDeadLetter takes an event out of the relay. It is kept without expiry, unsetting
+// deadLetterDate queues it again.
+func (entity *eventEntity) MarkDeadLetter(id primitive.ObjectID) error {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	_, err := entity.outbox.outboxRepo.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"deadLetterDate": time.Now()}})
+	return err
+}
+
+func newEvent(eventType string, clientId string, data interface{}) (model.Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return model.Event{}, err
+	}
+	return model.Event{
+		Id:           primitive.NewObjectID(),
+		Type:         eventType,
+		Version:      constant.EventVersion,
+		ClientId:     clientId,
+		Data:         payload,
+		OccurredDate: time.Now(),
+	}, nil
+}
+
+// outbox lets an entity commit its own write and the events describing it atomically
+type outbox struct {
+	client     *mongo.Client
+	outboxRepo *mongo.Collection
+}
+
+func newOutbox(resource *db.Resource) *outbox {
+	return &outbox{
+		client:     resource.UmDb.Client(),
+		outboxRepo: resource.UmDb.Collection("outbox_events"),
+	}
+}
+
+// write runs fn and stores the events it returns in one transaction. Standalone servers cannot
+// run transactions, so there the events are stored right after fn succeeds instead.
+func (o *outbox) write(fn func(ctx context.Context) ([]model.Event, error)) error {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+
+	session, err := o.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, o.run(sc, fn)
+	})
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == errCodeIllegalOperation {
+		logrus.Warning("transactions are not supported, writing outbox events without a transaction")
+		return o.run(ctx, fn)
+	}
+	return err
+}
+
+func (o *outbox) run(ctx context.Context, fn func(ctx context.Context) ([]model.Event, error)) error {
+	events, err := fn(ctx)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	var docs []interface{}
+	for _, event := range events {
+		docs = append(docs, event)
+	}
+	_, err = o.outboxRepo.InsertMany(ctx, docs)
+	return err
+}
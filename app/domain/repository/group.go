@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/db"
+)
+
+type groupEntity struct {
+	groupRepo *mongo.Collection
+}
+
+type IGroup interface {
+	CreateIndex() (string, error)
+	GetGroupsByClientId(clientId string) ([]model.Group, error)
+	GetGroupsByMemberId(userId string) ([]model.Group, error)
+	GetGroupById(id string, clientId string) (*model.Group, error)
+	CreateGroup(form request.Group) (*model.Group, error)
+	UpdateGroupById(id string, clientId string, form request.UpdateGroup) (*model.Group, error)
+	RemoveGroupById(id string, clientId string) (*model.Group, error)
+	AddMembers(id string, clientId string, form request.GroupMembers) (*model.Group, error)
+	RemoveMember(id string, clientId string, userId string, updatedBy string) (*model.Group, error)
+	RemoveMemberFromAll(userId string) error
+	GetGroupsByScimFilter(clientId string, filter *utils.ScimFilter, startIndex int64, count int64) ([]model.Group, int64, error)
+	CreateScimGroup(form request.ScimGroupForm) (*model.Group, error)
+	ReplaceScimGroup(id string, clientId string, form request.ScimGroupForm) (*model.Group, error)
+}
+
+func NewGroupEntity(resource *db.Resource) IGroup {
+	groupRepo := resource.UmDb.Collection("groups")
+	var entity IGroup = &groupEntity{groupRepo: groupRepo}
+	_, _ = entity.CreateIndex()
+	return entity
+}
+
+func (entity *groupEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mod := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "clientId", Value: 1},
+			{Key: "name", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}
+	ind, err := entity.groupRepo.Indexes().CreateOne(ctx, mod)
+	return ind, err
+}
+
+func (entity *groupEntity) find(filter bson.M) ([]model.Group, error) {
+	var items []model.Group
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	cursor, err := entity.groupRepo.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.Group
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.Group{}
+	}
+	return items, nil
+}
+
+func (entity *groupEntity) GetGroupsByClientId(clientId string) ([]model.Group, error) {
+	logrus.Info("GetGroupsByClientId")
+	return entity.find(bson.M{"clientId": clientId})
+}
+
+func (entity *groupEntity) GetGroupsByMemberId(userId string) ([]model.Group, error) {
+	logrus.Info("GetGroupsByMemberId")
+	objId, _ := primitive.ObjectIDFromHex(userId)
+	return entity.find(bson.M{"members": objId})
+}
+
+func (entity *groupEntity) GetGroupById(id string, clientId string) (*model.Group, error) {
+	logrus.Info("GetGroupById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.Group
+	objId, _ := primitive.ObjectIDFromHex(id)
+	err := entity.groupRepo.FindOne(ctx, bson.M{"_id": objId, "clientId": clientId}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *groupEntity) CreateGroup(form request.Group) (*model.Group, error) {
+	logrus.Info("CreateGroup")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+
+	createdBy, _ := primitive.ObjectIDFromHex(form.CreatedBy)
+	item := model.Group{
+		Id:          primitive.NewObjectID(),
+		ClientId:    form.ClientId,
+		Name:        form.Name,
+		Description: form.Description,
+		Members:     []primitive.ObjectID{},
+		Grants:      toGrants(form.Grants),
+		CreatedBy:   createdBy,
+		CreatedDate: time.Now(),
+		UpdatedBy:   createdBy,
+		UpdatedDate: time.Now(),
+	}
+	_, err := entity.groupRepo.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *groupEntity) UpdateGroupById(id string, clientId string, form request.UpdateGroup) (*model.Group, error) {
+	logrus.Info("UpdateGroupById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	updatedBy, _ := primitive.ObjectIDFromHex(form.UpdatedBy)
+
+	var item model.Group
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	// members are left to AddMembers and RemoveMember, so a concurrent change to them isn't lost
+	update := bson.M{"$set": bson.M{
+		"name":        form.Name,
+		"description": form.Description,
+		"grants":      toGrants(form.Grants),
+		"updatedBy":   updatedBy,
+		"updatedDate": time.Now(),
+	}}
+	err := entity.groupRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, update, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *groupEntity) RemoveGroupById(id string, clientId string) (*model.Group, error) {
+	logrus.Info("RemoveGroupById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.Group
+	objId, _ := primitive.ObjectIDFromHex(id)
+	err := entity.groupRepo.FindOne(ctx, bson.M{"_id": objId, "clientId": clientId}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	_, err = entity.groupRepo.DeleteOne(ctx, bson.M{"_id": objId, "clientId": clientId})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *groupEntity) AddMembers(id string, clientId string, form request.GroupMembers) (*model.Group, error) {
+	logrus.Info("AddMembers")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	var members []primitive.ObjectID
+	for _, userId := range form.UserIds {
+		memberId, err := primitive.ObjectIDFromHex(userId)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, memberId)
+	}
+	updatedBy, _ := primitive.ObjectIDFromHex(form.UpdatedBy)
+
+	var item model.Group
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	update := bson.M{
+		"$addToSet": bson.M{"members": bson.M{"$each": members}},
+		"$set":      bson.M{"updatedBy": updatedBy, "updatedDate": time.Now()},
+	}
+	err := entity.groupRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, update, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *groupEntity) RemoveMember(id string, clientId string, userId string, updatedBy string) (*model.Group, error) {
+	logrus.Info("RemoveMember")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	memberId, _ := primitive.ObjectIDFromHex(userId)
+	updatedById, _ := primitive.ObjectIDFromHex(updatedBy)
+
+	var item model.Group
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	update := bson.M{
+		"$pull": bson.M{"members": memberId},
+		"$set":  bson.M{"updatedBy": updatedById, "updatedDate": time.Now()},
+	}
+	err := entity.groupRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, update, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *groupEntity) RemoveMemberFromAll(userId string) error {
+	logrus.Info("RemoveMemberFromAll")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	memberId, _ := primitive.ObjectIDFromHex(userId)
+	_, err := entity.groupRepo.UpdateMany(ctx, bson.M{"members": memberId}, bson.M{"$pull": bson.M{"members": memberId}})
+	return err
+}
+
+func (entity *groupEntity) GetGroupsByScimFilter(clientId string, filter *utils.ScimFilter, startIndex int64, count int64) ([]model.Group, int64, error) {
+	logrus.Info("GetGroupsByScimFilter")
+	return scimFind[model.Group](entity.groupRepo, clientId, filter, scimGroupAttributes, startIndex, count)
+}
+
+// CreateScimGroup creates a group without grants, they are managed in um-api
+func (entity *groupEntity) CreateScimGroup(form request.ScimGroupForm) (*model.Group, error) {
+	logrus.Info("CreateScimGroup")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	members, err := toMemberIds(form.Members)
+	if err != nil {
+		return nil, err
+	}
+	item := model.Group{
+		Id:          primitive.NewObjectID(),
+		ClientId:    form.ClientId,
+		Name:        form.Name,
+		Members:     members,
+		Grants:      []model.Grant{},
+		ExternalId:  form.ExternalId,
+		CreatedDate: time.Now(),
+		UpdatedDate: time.Now(),
+	}
+	_, err = entity.groupRepo.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// ReplaceScimGroup sets the name and members of a group and keeps its description and grants
+func (entity *groupEntity) ReplaceScimGroup(id string, clientId string, form request.ScimGroupForm) (*model.Group, error) {
+	logrus.Info("ReplaceScimGroup")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	members, err := toMemberIds(form.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	var item model.Group
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	update := bson.M{"$set": bson.M{
+		"name":        form.Name,
+		"externalId":  form.ExternalId,
+		"members":     members,
+		"updatedDate": time.Now(),
+	}}
+	err = entity.groupRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, update, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func toMemberIds(userIds []string) ([]primitive.ObjectID, error) {
+	members := []primitive.ObjectID{}
+	for _, userId := range userIds {
+		memberId, err := primitive.ObjectIDFromHex(userId)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, memberId)
+	}
+	return members, nil
+}
+
+func toGrants(grants []request.Grant) []model.Grant {
+	items := []model.Grant{}
+	for _, grant := range grants {
+		items = append(items, model.Grant{Role: grant.Role, System: grant.System})
+	}
+	return items
+}
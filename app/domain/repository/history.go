@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+	"um/app/core/config"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/db"
+)
+
+type loginHistoryEntity struct {
+	loginHistoryRepo *mongo.Collection
+}
+
+type ILoginHistory interface {
+	CreateIndex() (string, error)
+	CreateLoginHistory(item model.LoginHistory) (*model.LoginHistory, error)
+	GetLoginHistories(form request.GetLoginHistories) ([]model.LoginHistory, error)
+	GetLoginHistoriesByUserId(userId string) ([]model.LoginHistory, error)
+	AnonymizeLoginHistories(userId string) error
+}
+
+func NewLoginHistoryEntity(resource *db.Resource) ILoginHistory {
+	loginHistoryRepo := resource.UmDb.Collection("login_histories")
+	var entity ILoginHistory = &loginHistoryEntity{loginHistoryRepo: loginHistoryRepo}
+	_, err := entity.CreateIndex()
+	if err != nil {
+		logrus.Error(err)
+	}
+	return entity
+}
+
+// CreateIndex also installs the TTL index that enforces the retention period
+func (entity *loginHistoryEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mods := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"createdDate": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32(config.LoginHistoryRetention.Seconds())),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdDate", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "clientId", Value: 1}, {Key: "createdDate", Value: -1}},
+		},
+	}
+	ind, err := entity.loginHistoryRepo.Indexes().CreateMany(ctx, mods)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(ind, ","), nil
+}
+
+func (entity *loginHistoryEntity) CreateLoginHistory(item model.LoginHistory) (*model.LoginHistory, error) {
+	logrus.Info("CreateLoginHistory")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	item.Id = primitive.NewObjectID()
+	item.CreatedDate = time.Now()
+	_, err := entity.loginHistoryRepo.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *loginHistoryEntity) GetLoginHistories(form request.GetLoginHistories) ([]model.LoginHistory, error) {
+	logrus.Info("GetLoginHistories")
+	var items []model.LoginHistory
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+
+	var queries = bson.M{}
+	if form.ClientId != "" {
+		queries["clientId"] = form.ClientId
+	}
+	if form.UserId != "" {
+		queries["userId"] = form.UserId
+	}
+	if form.Event != "" {
+		queries["event"] = form.Event
+	}
+	if form.Success != nil {
+		queries["success"] = *form.Success
+	}
+	dateQuery := bson.M{}
+	if !form.From.IsZero() {
+		dateQuery["$gte"] = form.From
+	}
+	if !form.To.IsZero() {
+		dateQuery["$lte"] = form.To
+	}
+	if len(dateQuery) > 0 {
+		queries["createdDate"] = dateQuery
+	}
+
+	limit := form.Limit
+	if limit == 0 {
+		limit = 50
+	}
+	opts := options.Find().SetSort(bson.M{"createdDate": -1}).SetLimit(limit).SetSkip(form.Offset)
+	cursor, err := entity.loginHistoryRepo.Find(ctx, queries, opts)
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.LoginHistory
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.LoginHistory{}
+	}
+	return items, nil
+}
+
+// GetLoginHistoriesByUserId returns every event of a user still within the retention period
+func (entity *loginHistoryEntity) GetLoginHistoriesByUserId(userId string) ([]model.LoginHistory, error) {
+	logrus.Info("GetLoginHistoriesByUserId")
+	var items []model.LoginHistory
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	cursor, err := entity.loginHistoryRepo.Find(ctx, bson.M{"userId": userId}, options.Find().SetSort(bson.M{"createdDate": -1}))
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.LoginHistory
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.LoginHistory{}
+	}
+	return items, nil
+}
+
+// AnonymizeLoginHistories blanks the username, IP and user agent of the events of a user, the events
+// stay for the counts of the security reports until the retention period ends
+func (entity *loginHistoryEntity) AnonymizeLoginHistories(userId string) error {
+	logrus.Info("AnonymizeLoginHistories")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	update := bson.M{"$set": bson.M{"username": "", "ip": "", "userAgent": ""}}
+	_, err := entity.loginHistoryRepo.UpdateMany(ctx, bson.M{"userId": userId}, update)
+	return err
+}
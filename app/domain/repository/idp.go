@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/db"
+)
+
+type idpEntity struct {
+	idpRepo *mongo.Collection
+}
+
+type IIdentityProvider interface {
+	CreateIndex() (string, error)
+	GetProvidersByClientId(clientId string) ([]model.IdentityProvider, error)
+	GetActiveProvidersByClientId(clientId string) ([]model.IdentityProvider, error)
+	GetProviderById(id string, clientId string) (*model.IdentityProvider, error)
+	GetActiveProviderById(id string) (*model.IdentityProvider, error)
+	CreateProvider(form request.IdentityProvider) (*model.IdentityProvider, error)
+	UpdateProviderById(id string, clientId string, form request.UpdateIdentityProvider) (*model.IdentityProvider, error)
+	RemoveProviderById(id string, clientId string) (*model.IdentityProvider, error)
+}
+
+func NewIdentityProviderEntity(resource *db.Resource) IIdentityProvider {
+	idpRepo := resource.UmDb.Collection("identity_providers")
+	var entity IIdentityProvider = &idpEntity{idpRepo: idpRepo}
+	_, err := entity.CreateIndex()
+	if err != nil {
+		logrus.Error(err)
+	}
+	return entity
+}
+
+func (entity *idpEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mod := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "clientId", Value: 1},
+			{Key: "name", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}
+	ind, err := entity.idpRepo.Indexes().CreateOne(ctx, mod)
+	return ind, err
+}
+
+func (entity *idpEntity) find(filter bson.M) ([]model.IdentityProvider, error) {
+	var items []model.IdentityProvider
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	cursor, err := entity.idpRepo.Find(ctx, filter, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.IdentityProvider
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.IdentityProvider{}
+	}
+	return items, nil
+}
+
+func (entity *idpEntity) GetProvidersByClientId(clientId string) ([]model.IdentityProvider, error) {
+	logrus.Info("GetProvidersByClientId")
+	return entity.find(bson.M{"clientId": clientId})
+}
+
+func (entity *idpEntity) GetActiveProvidersByClientId(clientId string) ([]model.IdentityProvider, error) {
+	logrus.Info("GetActiveProvidersByClientId")
+	return entity.find(bson.M{"clientId": clientId, "active": true})
+}
+
+func (entity *idpEntity) GetProviderById(id string, clientId string) (*model.IdentityProvider, error) {
+	logrus.Info("GetProviderById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.IdentityProvider
+	objId, _ := primitive.ObjectIDFromHex(id)
+	err := entity.idpRepo.FindOne(ctx, bson.M{"_id": objId, "clientId": clientId}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *idpEntity) GetActiveProviderById(id string) (*model.IdentityProvider, error) {
+	logrus.Info("GetActiveProviderById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.IdentityProvider
+	objId, _ := primitive.ObjectIDFromHex(id)
+	err := entity.idpRepo.FindOne(ctx, bson.M{"_id": objId, "active": true}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *idpEntity) CreateProvider(form request.IdentityProvider) (*model.IdentityProvider, error) {
+	logrus.Info("CreateProvider")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+
+	createdBy, _ := primitive.ObjectIDFromHex(form.CreatedBy)
+	item := model.IdentityProvider{
+		Id:                primitive.NewObjectID(),
+		ClientId:          form.ClientId,
+		Name:              form.Name,
+		Issuer:            form.Issuer,
+		OAuthClientId:     form.OAuthClientId,
+		OAuthClientSecret: form.OAuthClientSecret,
+		Scopes:            idpScopes(form.Scopes),
+		ClaimMapping:      toClaimMapping(form.ClaimMapping),
+		AutoProvision:     form.AutoProvision,
+		LinkByEmail:       form.LinkByEmail,
+		RedirectUris:      idpRedirectUris(form.RedirectUris),
+		Active:            true,
+		CreatedBy:         createdBy,
+		CreatedDate:       time.Now(),
+		UpdatedBy:         createdBy,
+		UpdatedDate:       time.Now(),
+	}
+	_, err := entity.idpRepo.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *idpEntity) UpdateProviderById(id string, clientId string, form request.UpdateIdentityProvider) (*model.IdentityProvider, error) {
+	logrus.Info("UpdateProviderById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	item, err := entity.GetProviderById(id, clientId)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Name = form.Name
+	item.Issuer = form.Issuer
+	item.OAuthClientId = form.OAuthClientId
+	if form.OAuthClientSecret != "" {
+		item.OAuthClientSecret = form.OAuthClientSecret
+	}
+	item.Scopes = idpScopes(form.Scopes)
+	item.ClaimMapping = toClaimMapping(form.ClaimMapping)
+	item.AutoProvision = form.AutoProvision
+	item.LinkByEmail = form.LinkByEmail
+	item.RedirectUris = idpRedirectUris(form.RedirectUris)
+	item.Active = form.Active
+	item.UpdatedBy, _ = primitive.ObjectIDFromHex(form.UpdatedBy)
+	item.UpdatedDate = time.Now()
+
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	err = entity.idpRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, bson.M{"$set": item}, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (entity *idpEntity) RemoveProviderById(id string, clientId string) (*model.IdentityProvider, error) {
+	logrus.Info("RemoveProviderById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.IdentityProvider
+	objId, _ := primitive.ObjectIDFromHex(id)
+	err := entity.idpRepo.FindOneAndDelete(ctx, bson.M{"_id": objId, "clientId": clientId}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// idpScopes always asks for openid, without it the provider returns no ID token
+func idpScopes(scopes []string) []string {
+	items := []string{"openid"}
+	for _, scope := range scopes {
+		if scope != "openid" {
+			items = append(items, scope)
+		}
+	}
+	if len(items) == 1 {
+		items = append(items, "profile", "email")
+	}
+	return items
+}
+
+func idpRedirectUris(redirectUris []string) []string {
+	if redirectUris == nil {
+		return []string{}
+	}
+	return redirectUris
+}
+
+func toClaimMapping(mapping request.ClaimMapping) model.ClaimMapping {
+	return model.ClaimMapping{
+		Username:  mapping.Username,
+		Email:     mapping.Email,
+		FirstName: mapping.FirstName,
+		LastName:  mapping.LastName,
+	}
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"time"
+	"um/app/domain/model"
+	"um/db"
+)
+
+type idpStateEntity struct {
+	rdb *redis.Client
+}
+
+type IIdpState interface {
+	CreateIdpState(state string, item model.IdpState, expiration time.Duration) error
+	ConsumeIdpState(state string) (*model.IdpState, error)
+}
+
+func NewIdpStateEntity(resource *db.Resource) IIdpState {
+	var entity IIdpState = &idpStateEntity{rdb: resource.RdDB}
+	return entity
+}
+
+func (entity *idpStateEntity) CreateIdpState(state string, item model.IdpState, expiration time.Duration) error {
+	logrus.Info("CreateIdpState")
+	payload, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return entity.rdb.Set(context.Background(), "idp:state:"+state, payload, expiration).Err()
+}
+
+// ConsumeIdpState reads and deletes a state in one transaction, so a callback can't be replayed
+func (entity *idpStateEntity) ConsumeIdpState(state string) (*model.IdpState, error) {
+	logrus.Info("ConsumeIdpState")
+	ctx := context.Background()
+	key := "idp:state:" + state
+	var get *redis.StringCmd
+	_, err := entity.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var item model.IdpState
+	err = json.Unmarshal([]byte(get.Val()), &item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/db"
+)
+
+type impersonationEntity struct {
+	impersonationRepo *mongo.Collection
+}
+
+type IImpersonation interface {
+	CreateLog(item model.ImpersonationLog) (*model.ImpersonationLog, error)
+	GetLogsByUserId(userId string) ([]model.ImpersonationLog, error)
+	AnonymizeLogs(actorId string) error
+}
+
+func NewImpersonationEntity(resource *db.Resource) IImpersonation {
+	impersonationRepo := resource.UmDb.Collection("impersonation_logs")
+	var entity IImpersonation = &impersonationEntity{impersonationRepo: impersonationRepo}
+	return entity
+}
+
+func (entity *impersonationEntity) CreateLog(item model.ImpersonationLog) (*model.ImpersonationLog, error) {
+	logrus.Info("CreateLog")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	item.Id = primitive.NewObjectID()
+	item.CreatedDate = time.Now()
+	_, err := entity.impersonationRepo.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetLogsByUserId returns the logs where the user was either the impersonator or the impersonated user
+func (entity *impersonationEntity) GetLogsByUserId(userId string) ([]model.ImpersonationLog, error) {
+	logrus.Info("GetLogsByUserId")
+	var items []model.ImpersonationLog
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	opts := options.Find().SetSort(bson.M{"createdDate": -1})
+	cursor, err := entity.impersonationRepo.Find(ctx, bson.M{"$or": []bson.M{{"actorId": userId}, {"userId": userId}}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.ImpersonationLog
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.ImpersonationLog{}
+	}
+	return items, nil
+}
+
+// AnonymizeLogs blanks the IP and user agent of the requests an impersonator made, which are theirs
+func (entity *impersonationEntity) AnonymizeLogs(actorId string) error {
+	logrus.Info("AnonymizeLogs")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	update := bson.M{"$set": bson.M{"ip": "", "userAgent": ""}}
+	_, err := entity.impersonationRepo.UpdateMany(ctx, bson.M{"actorId": actorId}, update)
+	return err
+}
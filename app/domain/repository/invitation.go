@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/db"
+)
+
+type invitationEntity struct {
+	invitationRepo *mongo.Collection
+}
+
+type IInvitation interface {
+	CreateIndex() (string, error)
+	GetPendingInvitations(clientId string) ([]model.Invitation, error)
+	GetPendingInvitation(id string, clientId string) (*model.Invitation, error)
+	GetInvitationByHash(tokenHash string) (*model.Invitation, error)
+	CreateInvitation(item model.Invitation) (*model.Invitation, error)
+	RenewInvitation(id string, clientId string, tokenHash string, expireDate time.Time) (*model.Invitation, error)
+	RevokeInvitation(id string, clientId string) (*model.Invitation, error)
+	AcceptInvitation(tokenHash string) (*model.Invitation, error)
+	GetInvitationsByUserId(userId string) ([]model.Invitation, error)
+	RemoveInvitationsByUserId(userId string) error
+}
+
+func NewInvitationEntity(resource *db.Resource) IInvitation {
+	invitationRepo := resource.UmDb.Collection("invitations")
+	var entity IInvitation = &invitationEntity{invitationRepo: invitationRepo}
+	_, err := entity.CreateIndex()
+	if err != nil {
+		logrus.Error(err)
+	}
+	return entity
+}
+
+func (entity *invitationEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mods := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"tokenHash": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "clientId", Value: 1}, {Key: "createdDate", Value: -1}},
+		},
+	}
+	ind, err := entity.invitationRepo.Indexes().CreateMany(ctx, mods)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(ind, ","), nil
+}
+
+// GetPendingInvitations lists the invitations of a client neither accepted nor revoked, expired ones
+// included so they can be resent
+func (entity *invitationEntity) GetPendingInvitations(clientId string) ([]model.Invitation, error) {
+	logrus.Info("GetPendingInvitations")
+	var items []model.Invitation
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	filter := bson.M{"clientId": clientId, "acceptedDate": nil, "revokedDate": nil}
+	cursor, err := entity.invitationRepo.Find(ctx, filter, options.Find().SetSort(bson.M{"createdDate": -1}))
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.Invitation
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.Invitation{}
+	}
+	return items, nil
+}
+
+func (entity *invitationEntity) GetPendingInvitation(id string, clientId string) (*model.Invitation, error) {
+	logrus.Info("GetPendingInvitation")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	var item model.Invitation
+	filter := bson.M{"_id": objId, "clientId": clientId, "acceptedDate": nil, "revokedDate": nil}
+	err := entity.invitationRepo.FindOne(ctx, filter).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *invitationEntity) GetInvitationByHash(tokenHash string) (*model.Invitation, error) {
+	logrus.Info("GetInvitationByHash")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.Invitation
+	err := entity.invitationRepo.FindOne(ctx, bson.M{"tokenHash": tokenHash}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *invitationEntity) CreateInvitation(item model.Invitation) (*model.Invitation, error) {
+	logrus.Info("CreateInvitation")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	item.Id = primitive.NewObjectID()
+	item.SentDate = time.Now()
+	item.CreatedDate = time.Now()
+	_, err := entity.invitationRepo.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// RenewInvitation replaces the token of a pending invitation, the previous link stops working
+func (entity *invitationEntity) RenewInvitation(id string, clientId string, tokenHash string, expireDate time.Time) (*model.Invitation, error) {
+	logrus.Info("RenewInvitation")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	var item model.Invitation
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	filter := bson.M{"_id": objId, "clientId": clientId, "acceptedDate": nil, "revokedDate": nil}
+	update := bson.M{"$set": bson.M{"tokenHash": tokenHash, "expireDate": expireDate, "sentDate": time.Now()}}
+	err := entity.invitationRepo.FindOneAndUpdate(ctx, filter, update, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// RevokeInvitation marks a pending invitation as revoked, the invitation is kept for its history
+func (entity *invitationEntity) RevokeInvitation(id string, clientId string) (*model.Invitation, error) {
+	logrus.Info("RevokeInvitation")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	var item model.Invitation
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	filter := bson.M{"_id": objId, "clientId": clientId, "acceptedDate": nil, "revokedDate": nil}
+	err := entity.invitationRepo.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"revokedDate": time.Now()}}, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// AcceptInvitation marks the pending, unexpired invitation of a token as accepted, so a token is only
+// used once
+func (entity *invitationEntity) AcceptInvitation(tokenHash string) (*model.Invitation, error) {
+	logrus.Info("AcceptInvitation")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.Invitation
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	filter := bson.M{
+		"tokenHash":    tokenHash,
+		"acceptedDate": nil,
+		"revokedDate":  nil,
+		"expireDate":   bson.M{"$gt": time.Now()},
+	}
+	err := entity.invitationRepo.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"acceptedDate": time.Now()}}, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *invitationEntity) GetInvitationsByUserId(userId string) ([]model.Invitation, error) {
+	logrus.Info("GetInvitationsByUserId")
+	var items []model.Invitation
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(userId)
+	cursor, err := entity.invitationRepo.Find(ctx, bson.M{"userId": objId}, options.Find().SetSort(bson.M{"createdDate": -1}))
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.Invitation
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.Invitation{}
+	}
+	return items, nil
+}
+
+func (entity *invitationEntity) RemoveInvitationsByUserId(userId string) error {
+	logrus.Info("RemoveInvitationsByUserId")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(userId)
+	_, err := entity.invitationRepo.DeleteMany(ctx, bson.M{"userId": objId})
+	return err
+}
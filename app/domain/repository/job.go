@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/http"
+	"time"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/db"
+)
+
+type jobEntity struct {
+	jobRepo *mongo.Collection
+}
+
+type IJob interface {
+	CreateIndex() (string, error)
+	GetJobs() ([]model.Job, error)
+	GetDueJobs(now time.Time) ([]model.Job, error)
+	GetJobById(id string) (*model.Job, error)
+	CreateJob(form request.Job, nextRunDate time.Time) (*model.Job, error)
+	UpdateJobById(id string, form request.UpdateJob, nextRunDate time.Time) (*model.Job, error)
+	UpdateNextRunById(id primitive.ObjectID, lastRunDate time.Time, nextRunDate time.Time) error
+	RemoveJobById(id string) (*model.Job, error)
+}
+
+func NewJobEntity(resource *db.Resource) IJob {
+	jobRepo := resource.UmDb.Collection("jobs")
+	var entity IJob = &jobEntity{jobRepo: jobRepo}
+	_, _ = entity.CreateIndex()
+	return entity
+}
+
+func (entity *jobEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mod := mongo.IndexModel{
+		Keys: bson.D{{Key: "active", Value: 1}, {Key: "nextRunDate", Value: 1}},
+	}
+	ind, err := entity.jobRepo.Indexes().CreateOne(ctx, mod)
+	return ind, err
+}
+
+func (entity *jobEntity) find(filter bson.M) ([]model.Job, error) {
+	var items []model.Job
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	cursor, err := entity.jobRepo.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.Job
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.Job{}
+	}
+	return items, nil
+}
+
+func (entity *jobEntity) GetJobs() ([]model.Job, error) {
+	logrus.Info("GetJobs")
+	return entity.find(bson.M{})
+}
+
+// GetDueJobs returns the active jobs whose next run is not after now, jobs that can never run
+// again keep a zero next run date and are skipped
+func (entity *jobEntity) GetDueJobs(now time.Time) ([]model.Job, error) {
+	return entity.find(bson.M{
+		"active":      true,
+		"nextRunDate": bson.M{"$gt": time.Time{}, "$lte": now},
+	})
+}
+
+func (entity *jobEntity) GetJobById(id string) (*model.Job, error) {
+	logrus.Info("GetJobById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.Job
+	objId, _ := primitive.ObjectIDFromHex(id)
+	err := entity.jobRepo.FindOne(ctx, bson.M{"_id": objId}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *jobEntity) CreateJob(form request.Job, nextRunDate time.Time) (*model.Job, error) {
+	logrus.Info("CreateJob")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+
+	createdBy, _ := primitive.ObjectIDFromHex(form.CreatedBy)
+	active := true
+	if form.Active != nil {
+		active = *form.Active
+	}
+	item := model.Job{
+		Id:          primitive.NewObjectID(),
+		Name:        form.Name,
+		Cron:        form.Cron,
+		Timezone:    form.Timezone,
+		SystemCode:  form.SystemCode,
+		Path:        form.Path,
+		Method:      jobMethod(form.Method),
+		Payload:     form.Payload,
+		Retries:     form.Retries,
+		Active:      active,
+		NextRunDate: nextRunDate,
+		CreatedBy:   createdBy,
+		CreatedDate: time.Now(),
+		UpdatedBy:   createdBy,
+		UpdatedDate: time.Now(),
+	}
+	_, err := entity.jobRepo.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *jobEntity) UpdateJobById(id string, form request.UpdateJob, nextRunDate time.Time) (*model.Job, error) {
+	logrus.Info("UpdateJobById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	updatedBy, _ := primitive.ObjectIDFromHex(form.UpdatedBy)
+
+	update := bson.M{
+		"name":        form.Name,
+		"cron":        form.Cron,
+		"timezone":    form.Timezone,
+		"systemCode":  form.SystemCode,
+		"path":        form.Path,
+		"method":      jobMethod(form.Method),
+		"payload":     form.Payload,
+		"retries":     form.Retries,
+		"nextRunDate": nextRunDate,
+		"updatedBy":   updatedBy,
+		"updatedDate": time.Now(),
+	}
+	if form.Active != nil {
+		update["active"] = *form.Active
+	}
+
+	var item model.Job
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	err := entity.jobRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId}, bson.M{"$set": update}, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *jobEntity) UpdateNextRunById(id primitive.ObjectID, lastRunDate time.Time, nextRunDate time.Time) error {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	update := bson.M{"$set": bson.M{"lastRunDate": lastRunDate, "nextRunDate": nextRunDate}}
+	_, err := entity.jobRepo.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+func (entity *jobEntity) RemoveJobById(id string) (*model.Job, error) {
+	logrus.Info("RemoveJobById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.Job
+	objId, _ := primitive.ObjectIDFromHex(id)
+	err := entity.jobRepo.FindOneAndDelete(ctx, bson.M{"_id": objId}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func jobMethod(method string) string {
+	if method == "" {
+		return http.MethodPost
+	}
+	return method
+}
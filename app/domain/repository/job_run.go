@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"um/app/core/config"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/db"
+)
+
+type jobRunEntity struct {
+	jobRunRepo *mongo.Collection
+}
+
+type IJobRun interface {
+	CreateIndex() (string, error)
+	CreateJobRun(item model.JobRun) (*model.JobRun, error)
+	GetJobRunsByJobId(jobId string, form request.GetJobRuns) ([]model.JobRun, error)
+	RemoveJobRunsByJobId(jobId string) error
+}
+
+func NewJobRunEntity(resource *db.Resource) IJobRun {
+	jobRunRepo := resource.UmDb.Collection("job_runs")
+	var entity IJobRun = &jobRunEntity{jobRunRepo: jobRunRepo}
+	_, err := entity.CreateIndex()
+	if err != nil {
+		logrus.Error(err)
+	}
+	return entity
+}
+
+// CreateIndex also installs the TTL index that enforces the retention period
+func (entity *jobRunEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mods := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"startedDate": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32(config.JobRunRetention.Seconds())),
+		},
+		{
+			Keys: bson.D{{Key: "jobId", Value: 1}, {Key: "startedDate", Value: -1}},
+		},
+	}
+	ind, err := entity.jobRunRepo.Indexes().CreateMany(ctx, mods)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(ind, ","), nil
+}
+
+func (entity *jobRunEntity) CreateJobRun(item model.JobRun) (*model.JobRun, error) {
+	logrus.Info("CreateJobRun")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	item.Id = primitive.NewObjectID()
+	_, err := entity.jobRunRepo.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *jobRunEntity) GetJobRunsByJobId(jobId string, form request.GetJobRuns) ([]model.JobRun, error) {
+	logrus.Info("GetJobRunsByJobId")
+	var items []model.JobRun
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(jobId)
+	limit := form.Limit
+	if limit == 0 {
+		limit = 50
+	}
+	opts := options.Find().SetSort(bson.M{"startedDate": -1}).SetLimit(limit).SetSkip(form.Offset)
+	cursor, err := entity.jobRunRepo.Find(ctx, bson.M{"jobId": objId}, opts)
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.JobRun
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.JobRun{}
+	}
+	return items, nil
+}
+
+func (entity *jobRunEntity) RemoveJobRunsByJobId(jobId string) error {
+	logrus.Info("RemoveJobRunsByJobId")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(jobId)
+	_, err := entity.jobRunRepo.DeleteMany(ctx, bson.M{"jobId": objId})
+	return err
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/db"
+)
+
+type ldapConfigEntity struct {
+	ldapConfigRepo *mongo.Collection
+}
+
+type ILdapConfig interface {
+	CreateIndex() (string, error)
+	GetLdapConfig(clientId string) (*model.LdapConfig, error)
+	UpdateLdapConfig(clientId string, form request.LdapConfig) (*model.LdapConfig, error)
+	RemoveLdapConfig(clientId string) (*model.LdapConfig, error)
+}
+
+func NewLdapConfigEntity(resource *db.Resource) ILdapConfig {
+	ldapConfigRepo := resource.UmDb.Collection("ldap_configs")
+	var entity ILdapConfig = &ldapConfigEntity{ldapConfigRepo: ldapConfigRepo}
+	_, err := entity.CreateIndex()
+	if err != nil {
+		logrus.Error(err)
+	}
+	return entity
+}
+
+func (entity *ldapConfigEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mod := mongo.IndexModel{
+		Keys: bson.M{
+			"clientId": 1,
+		},
+		Options: options.Index().SetUnique(true),
+	}
+	ind, err := entity.ldapConfigRepo.Indexes().CreateOne(ctx, mod)
+	return ind, err
+}
+
+func (entity *ldapConfigEntity) GetLdapConfig(clientId string) (*model.LdapConfig, error) {
+	logrus.Info("GetLdapConfig")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.LdapConfig
+	err := entity.ldapConfigRepo.FindOne(ctx, bson.M{"clientId": clientId}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *ldapConfigEntity) UpdateLdapConfig(clientId string, form request.LdapConfig) (*model.LdapConfig, error) {
+	logrus.Info("UpdateLdapConfig")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+
+	item, err := entity.GetLdapConfig(clientId)
+	if err != nil {
+		item = &model.LdapConfig{Id: primitive.NewObjectID(), ClientId: clientId}
+	}
+	item.Url = form.Url
+	item.StartTls = form.StartTls
+	item.InsecureSkipVerify = form.InsecureSkipVerify
+	item.BindDn = form.BindDn
+	if form.BindPassword != "" || form.BindDn == "" {
+		item.BindPassword = form.BindPassword
+	}
+	item.BaseDn = form.BaseDn
+	item.UserFilter = form.UserFilter
+	if item.UserFilter == "" {
+		item.UserFilter = constant.LdapDefaultUserFilter
+	}
+	item.Attributes = toLdapAttributes(form.Attributes)
+	item.GroupRoles = []model.LdapGroupRole{}
+	for _, groupRole := range form.GroupRoles {
+		item.GroupRoles = append(item.GroupRoles, model.LdapGroupRole{Group: groupRole.Group, Role: groupRole.Role})
+	}
+	item.DefaultRole = form.DefaultRole
+	item.Enabled = form.Enabled
+	item.UpdatedBy, _ = primitive.ObjectIDFromHex(form.UpdatedBy)
+	item.UpdatedDate = time.Now()
+
+	isReturnNewDoc := options.After
+	upsert := true
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+		Upsert:         &upsert,
+	}
+	err = entity.ldapConfigRepo.FindOneAndUpdate(ctx, bson.M{"clientId": clientId}, bson.M{"$set": item}, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (entity *ldapConfigEntity) RemoveLdapConfig(clientId string) (*model.LdapConfig, error) {
+	logrus.Info("RemoveLdapConfig")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.LdapConfig
+	err := entity.ldapConfigRepo.FindOneAndDelete(ctx, bson.M{"clientId": clientId}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// toLdapAttributes fills in the Active Directory attribute names
+func toLdapAttributes(form request.LdapAttributes) model.LdapAttributes {
+	return model.LdapAttributes{
+		FirstName: attributeName(form.FirstName, "givenName"),
+		LastName:  attributeName(form.LastName, "sn"),
+		Email:     attributeName(form.Email, "mail"),
+		Phone:     attributeName(form.Phone, "telephoneNumber"),
+		Groups:    attributeName(form.Groups, "memberOf"),
+	}
+}
+
+func attributeName(name string, fallback string) string {
+	if name == "" {
+		return fallback
+	}
+	return name
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"time"
+	"um/db"
+)
+
+// releaseLockScript deletes the lock only when it is still held by the caller
+var releaseLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// extendLockScript resets the expiration only when the lock is still held by the caller
+var extendLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+type lockEntity struct {
+	rdb *redis.Client
+}
+
+type ILock interface {
+	Acquire(key string, expiration time.Duration) (string, error)
+	Release(key string, token string) error
+	Extend(key string, token string, expiration time.Duration) (bool, error)
+}
+
+func NewLockEntity(resource *db.Resource) ILock {
+	var entity ILock = &lockEntity{rdb: resource.RdDB}
+	return entity
+}
+
+// Acquire returns a token identifying the holder, or an empty token when the lock is taken
+func (entity *lockEntity) Acquire(key string, expiration time.Duration) (string, error) {
+	token := uuid.New().String()
+	ok, err := entity.rdb.SetNX(context.Background(), "lock:"+key, token, expiration).Result()
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", nil
+	}
+	return token, nil
+}
+
+func (entity *lockEntity) Release(key string, token string) error {
+	return releaseLockScript.Run(context.Background(), entity.rdb, []string{"lock:" + key}, token).Err()
+}
+
+// Extend gives a held lock expiration from now on, it returns false when the lock was lost
+func (entity *lockEntity) Extend(key string, token string, expiration time.Duration) (bool, error) {
+	held, err := extendLockScript.Run(context.Background(), entity.rdb, []string{"lock:" + key}, token, expiration.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return held == 1, nil
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"time"
+	"um/app/domain/model"
+	"um/db"
+)
+
+type passwordlessEntity struct {
+	rdb *redis.Client
+}
+
+type IPasswordless interface {
+	CreateChallenge(id string, item model.PasswordlessChallenge, expiration time.Duration) error
+	GetChallenge(id string) (*model.PasswordlessChallenge, error)
+	ConsumeChallenge(id string) (*model.PasswordlessChallenge, error)
+	CountAttempt(id string, expiration time.Duration) (int64, error)
+	StartCooldown(userId string, expiration time.Duration) (bool, error)
+}
+
+func NewPasswordlessEntity(resource *db.Resource) IPasswordless {
+	var entity IPasswordless = &passwordlessEntity{rdb: resource.RdDB}
+	return entity
+}
+
+func (entity *passwordlessEntity) CreateChallenge(id string, item model.PasswordlessChallenge, expiration time.Duration) error {
+	logrus.Info("CreateChallenge")
+	payload, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return entity.rdb.Set(context.Background(), "passwordless:challenge:"+id, payload, expiration).Err()
+}
+
+func (entity *passwordlessEntity) GetChallenge(id string) (*model.PasswordlessChallenge, error) {
+	logrus.Info("GetChallenge")
+	payload, err := entity.rdb.Get(context.Background(), "passwordless:challenge:"+id).Result()
+	if err != nil {
+		return nil, err
+	}
+	var item model.PasswordlessChallenge
+	err = json.Unmarshal([]byte(payload), &item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// ConsumeChallenge reads and deletes a challenge in one transaction, so it can be used once
+func (entity *passwordlessEntity) ConsumeChallenge(id string) (*model.PasswordlessChallenge, error) {
+	logrus.Info("ConsumeChallenge")
+	ctx := context.Background()
+	key := "passwordless:challenge:" + id
+	var get *redis.StringCmd
+	_, err := entity.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var item model.PasswordlessChallenge
+	err = json.Unmarshal([]byte(get.Val()), &item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// CountAttempt counts a wrong code for a challenge and returns the number of attempts so far
+func (entity *passwordlessEntity) CountAttempt(id string, expiration time.Duration) (int64, error) {
+	ctx := context.Background()
+	key := "passwordless:attempts:" + id
+	var incr *redis.IntCmd
+	_, err := entity.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, expiration)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// StartCooldown returns false while a previous challenge of the user is too recent to send another
+func (entity *passwordlessEntity) StartCooldown(userId string, expiration time.Duration) (bool, error) {
+	return entity.rdb.SetNX(context.Background(), "passwordless:cooldown:"+userId, 1, expiration).Result()
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/db"
+)
+
+type preferenceEntity struct {
+	preferenceRepo *mongo.Collection
+}
+
+type IPreference interface {
+	CreateIndex() (string, error)
+	GetPreferences(userId string) ([]model.Preference, error)
+	GetPreference(userId string, namespace string) (*model.Preference, error)
+	CountPreferences(userId string) (int64, error)
+	SavePreference(userId string, clientId string, namespace string, value json.RawMessage) (*model.Preference, error)
+	RemovePreference(userId string, namespace string) (*model.Preference, error)
+	RemovePreferences(userId string) error
+}
+
+func NewPreferenceEntity(resource *db.Resource) IPreference {
+	preferenceRepo := resource.UmDb.Collection("preferences")
+	var entity IPreference = &preferenceEntity{preferenceRepo: preferenceRepo}
+	_, err := entity.CreateIndex()
+	if err != nil {
+		logrus.Error(err)
+	}
+	return entity
+}
+
+func (entity *preferenceEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mod := mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "namespace", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	ind, err := entity.preferenceRepo.Indexes().CreateOne(ctx, mod)
+	return ind, err
+}
+
+func (entity *preferenceEntity) GetPreferences(userId string) ([]model.Preference, error) {
+	logrus.Info("GetPreferences")
+	var items []model.Preference
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(userId)
+	cursor, err := entity.preferenceRepo.Find(ctx, bson.M{"userId": objId}, options.Find().SetSort(bson.M{"namespace": 1}))
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.Preference
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.Preference{}
+	}
+	return items, nil
+}
+
+func (entity *preferenceEntity) GetPreference(userId string, namespace string) (*model.Preference, error) {
+	logrus.Info("GetPreference")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.Preference
+	objId, _ := primitive.ObjectIDFromHex(userId)
+	err := entity.preferenceRepo.FindOne(ctx, bson.M{"userId": objId, "namespace": namespace}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *preferenceEntity) CountPreferences(userId string) (int64, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(userId)
+	return entity.preferenceRepo.CountDocuments(ctx, bson.M{"userId": objId})
+}
+
+// SavePreference replaces the value of a namespace, creating it when the user has none yet
+func (entity *preferenceEntity) SavePreference(userId string, clientId string, namespace string, value json.RawMessage) (*model.Preference, error) {
+	logrus.Info("SavePreference")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(userId)
+	var item model.Preference
+	isReturnNewDoc := options.After
+	upsert := true
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+		Upsert:         &upsert,
+	}
+	update := bson.M{
+		"$set":         bson.M{"clientId": clientId, "value": value, "updatedDate": time.Now()},
+		"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "createdDate": time.Now()},
+	}
+	err := entity.preferenceRepo.FindOneAndUpdate(ctx, bson.M{"userId": objId, "namespace": namespace}, update, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *preferenceEntity) RemovePreference(userId string, namespace string) (*model.Preference, error) {
+	logrus.Info("RemovePreference")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.Preference
+	objId, _ := primitive.ObjectIDFromHex(userId)
+	err := entity.preferenceRepo.FindOneAndDelete(ctx, bson.M{"userId": objId, "namespace": namespace}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *preferenceEntity) RemovePreferences(userId string) error {
+	logrus.Info("RemovePreferences")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(userId)
+	_, err := entity.preferenceRepo.DeleteMany(ctx, bson.M{"userId": objId})
+	return err
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/db"
+)
+
+type preferenceSchemaEntity struct {
+	preferenceSchemaRepo *mongo.Collection
+}
+
+type IPreferenceSchema interface {
+	CreateIndex() (string, error)
+	GetPreferenceSchemas(clientId string) ([]model.PreferenceSchema, error)
+	GetPreferenceSchema(clientId string, namespace string) (*model.PreferenceSchema, error)
+	SavePreferenceSchema(clientId string, namespace string, schema json.RawMessage, updatedBy string) (*model.PreferenceSchema, error)
+	RemovePreferenceSchema(clientId string, namespace string) (*model.PreferenceSchema, error)
+}
+
+func NewPreferenceSchemaEntity(resource *db.Resource) IPreferenceSchema {
+	preferenceSchemaRepo := resource.UmDb.Collection("preference_schemas")
+	var entity IPreferenceSchema = &preferenceSchemaEntity{preferenceSchemaRepo: preferenceSchemaRepo}
+	_, err := entity.CreateIndex()
+	if err != nil {
+		logrus.Error(err)
+	}
+	return entity
+}
+
+func (entity *preferenceSchemaEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mod := mongo.IndexModel{
+		Keys:    bson.D{{Key: "clientId", Value: 1}, {Key: "namespace", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	ind, err := entity.preferenceSchemaRepo.Indexes().CreateOne(ctx, mod)
+	return ind, err
+}
+
+func (entity *preferenceSchemaEntity) GetPreferenceSchemas(clientId string) ([]model.PreferenceSchema, error) {
+	logrus.Info("GetPreferenceSchemas")
+	var items []model.PreferenceSchema
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	cursor, err := entity.preferenceSchemaRepo.Find(ctx, bson.M{"clientId": clientId}, options.Find().SetSort(bson.M{"namespace": 1}))
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.PreferenceSchema
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.PreferenceSchema{}
+	}
+	return items, nil
+}
+
+func (entity *preferenceSchemaEntity) GetPreferenceSchema(clientId string, namespace string) (*model.PreferenceSchema, error) {
+	logrus.Info("GetPreferenceSchema")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.PreferenceSchema
+	err := entity.preferenceSchemaRepo.FindOne(ctx, bson.M{"clientId": clientId, "namespace": namespace}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *preferenceSchemaEntity) SavePreferenceSchema(clientId string, namespace string, schema json.RawMessage, updatedBy string) (*model.PreferenceSchema, error) {
+	logrus.Info("SavePreferenceSchema")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	updatedById, _ := primitive.ObjectIDFromHex(updatedBy)
+	var item model.PreferenceSchema
+	isReturnNewDoc := options.After
+	upsert := true
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+		Upsert:         &upsert,
+	}
+	update := bson.M{
+		"$set": bson.M{"schema": schema, "updatedBy": updatedById, "updatedDate": time.Now()},
+		"$setOnInsert": bson.M{
+			"_id":         primitive.NewObjectID(),
+			"createdBy":   updatedById,
+			"createdDate": time.Now(),
+		},
+	}
+	err := entity.preferenceSchemaRepo.FindOneAndUpdate(ctx, bson.M{"clientId": clientId, "namespace": namespace}, update, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *preferenceSchemaEntity) RemovePreferenceSchema(clientId string, namespace string) (*model.PreferenceSchema, error) {
+	logrus.Info("RemovePreferenceSchema")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.PreferenceSchema
+	err := entity.preferenceSchemaRepo.FindOneAndDelete(ctx, bson.M{"clientId": clientId, "namespace": namespace}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
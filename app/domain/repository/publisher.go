@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/db"
+)
+
+type streamPublisher struct {
+	rdb *redis.Client
+}
+
+type IPublisher interface {
+	Publish(event model.Event) error
+}
+
+func NewStreamPublisher(resource *db.Resource) IPublisher {
+	var publisher IPublisher = &streamPublisher{rdb: resource.RdDB}
+	return publisher
+}
+
+func (publisher *streamPublisher) Publish(event model.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return publisher.rdb.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: constant.EventStream,
+		MaxLen: constant.EventStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"id":    event.Id.Hex(),
+			"type":  event.Type,
+			"event": string(payload),
+		},
+	}).Err()
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"time"
+	"um/db"
+)
+
+type rateLimitEntity struct {
+	rdb *redis.Client
+}
+
+type IRateLimit interface {
+	Hit(key string, window time.Duration) (int64, error)
+}
+
+func NewRateLimitEntity(resource *db.Resource) IRateLimit {
+	var entity IRateLimit = &rateLimitEntity{rdb: resource.RdDB}
+	return entity
+}
+
+// Hit counts a request of key in a fixed window starting with its first request
+func (entity *rateLimitEntity) Hit(key string, window time.Duration) (int64, error) {
+	ctx := context.Background()
+	key = "ratelimit:" + key
+	count, err := entity.rdb.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		err = entity.rdb.Expire(ctx, key, window).Err()
+	}
+	return count, err
+}
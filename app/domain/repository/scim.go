@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"time"
+	"um/app/core/constant"
+	"um/app/core/utils"
+)
+
+// ErrScimFilter is wrapped by errors of filters that can't be translated into a query
+var ErrScimFilter = errors.New("invalid filter")
+
+const (
+	scimString   = "string"
+	scimExact    = "exact"
+	scimDate     = "date"
+	scimObjectId = "objectId"
+	scimActive   = "active"
+	scimIgnored  = "ignored"
+)
+
+type scimAttribute struct {
+	field string
+	kind  string
+}
+
+var scimUserAttributes = map[string]scimAttribute{
+	"id":                   {field: "_id", kind: scimObjectId},
+	"externalid":           {field: "externalId", kind: scimExact},
+	"username":             {field: "username", kind: scimString},
+	"name.givenname":       {field: "firstName", kind: scimString},
+	"name.familyname":      {field: "lastName", kind: scimString},
+	"emails":               {field: "email", kind: scimString},
+	"emails.value":         {field: "email", kind: scimString},
+	"emails.type":          {kind: scimIgnored},
+	"emails.primary":       {kind: scimIgnored},
+	"phonenumbers":         {field: "phone", kind: scimString},
+	"phonenumbers.value":   {field: "phone", kind: scimString},
+	"phonenumbers.type":    {kind: scimIgnored},
+	"phonenumbers.primary": {kind: scimIgnored},
+	"active":               {field: "status", kind: scimActive},
+	"meta.created":         {field: "createdDate", kind: scimDate},
+	"meta.lastmodified":    {field: "updatedDate", kind: scimDate},
+	"meta.resourcetype":    {kind: scimIgnored},
+}
+
+var scimGroupAttributes = map[string]scimAttribute{
+	"id":                {field: "_id", kind: scimObjectId},
+	"externalid":        {field: "externalId", kind: scimExact},
+	"displayname":       {field: "name", kind: scimString},
+	"members":           {field: "members", kind: scimObjectId},
+	"members.value":     {field: "members", kind: scimObjectId},
+	"meta.created":      {field: "createdDate", kind: scimDate},
+	"meta.lastmodified": {field: "updatedDate", kind: scimDate},
+	"meta.resourcetype": {kind: scimIgnored},
+}
+
+// scimQuery translates a SCIM filter into a Mongo query. Strings compare case insensitively as
+// SCIM attributes are not case exact by default. Sub-attributes that have no field, such as the
+// type of an email, match every document.
+func scimQuery(filter *utils.ScimFilter, attributes map[string]scimAttribute) (bson.M, error) {
+	if filter == nil {
+		return bson.M{}, nil
+	}
+	switch filter.Op {
+	case "and", "or":
+		var items []bson.M
+		for _, child := range filter.Filters {
+			item, err := scimQuery(child, attributes)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return bson.M{"$" + filter.Op: items}, nil
+	case "not":
+		item, err := scimQuery(filter.Filters[0], attributes)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$nor": []bson.M{item}}, nil
+	}
+
+	attribute, ok := attributes[filter.Attribute]
+	if !ok {
+		return nil, errors.Join(ErrScimFilter, errors.New("unsupported attribute "+filter.Attribute))
+	}
+	if attribute.kind == scimIgnored {
+		return bson.M{}, nil
+	}
+	if filter.Op == "pr" {
+		return bson.M{attribute.field: bson.M{"$exists": true, "$nin": bson.A{nil, "", bson.A{}}}}, nil
+	}
+
+	switch attribute.kind {
+	case scimActive:
+		active, ok := filter.Value.(bool)
+		if !ok || (filter.Op != "eq" && filter.Op != "ne") {
+			return nil, errors.Join(ErrScimFilter, errors.New("active takes eq or ne with a boolean"))
+		}
+		if active == (filter.Op == "eq") {
+			return bson.M{attribute.field: constant.ACTIVE}, nil
+		}
+		return bson.M{attribute.field: bson.M{"$ne": constant.ACTIVE}}, nil
+	case scimObjectId:
+		value, _ := filter.Value.(string)
+		objId, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			// an id that isn't an ObjectID matches nothing
+			objId = primitive.NilObjectID
+		}
+		switch filter.Op {
+		case "eq":
+			return bson.M{attribute.field: objId}, nil
+		case "ne":
+			return bson.M{attribute.field: bson.M{"$ne": objId}}, nil
+		}
+		return nil, errors.Join(ErrScimFilter, errors.New(filter.Attribute+" takes eq or ne"))
+	case scimDate:
+		value, _ := filter.Value.(string)
+		date, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, errors.Join(ErrScimFilter, errors.New("invalid date "+value))
+		}
+		return scimCompare(attribute.field, filter.Op, date)
+	}
+
+	value, ok := filter.Value.(string)
+	if !ok {
+		return nil, errors.Join(ErrScimFilter, errors.New(filter.Attribute+" takes a string"))
+	}
+	if attribute.kind == scimExact {
+		return scimCompare(attribute.field, filter.Op, value)
+	}
+	quoted := regexp.QuoteMeta(value)
+	patterns := map[string]string{"eq": "^" + quoted + "$", "ne": "^" + quoted + "$", "co": quoted, "sw": "^" + quoted, "ew": quoted + "$"}
+	pattern, ok := patterns[filter.Op]
+	if !ok {
+		return scimCompare(attribute.field, filter.Op, value)
+	}
+	regex := primitive.Regex{Pattern: pattern, Options: "i"}
+	if filter.Op == "ne" {
+		return bson.M{attribute.field: bson.M{"$not": regex}}, nil
+	}
+	return bson.M{attribute.field: regex}, nil
+}
+
+func scimCompare(field string, op string, value interface{}) (bson.M, error) {
+	operators := map[string]string{"eq": "$eq", "ne": "$ne", "gt": "$gt", "ge": "$gte", "lt": "$lt", "le": "$lte"}
+	operator, ok := operators[op]
+	if !ok {
+		return nil, errors.Join(ErrScimFilter, errors.New("operator "+op+" is not supported on "+field))
+	}
+	return bson.M{field: bson.M{operator: value}}, nil
+}
+
+// scimFind runs a SCIM query of a client with paging, startIndex is 1-based as in SCIM
+func scimFind[T any](collection *mongo.Collection, clientId string, filter *utils.ScimFilter, attributes map[string]scimAttribute, startIndex int64, count int64) ([]T, int64, error) {
+	query, err := scimQuery(filter, attributes)
+	if err != nil {
+		return nil, 0, err
+	}
+	query = bson.M{"$and": []bson.M{{"clientId": clientId}, query}}
+
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	total, err := collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	items := []T{}
+	if count == 0 {
+		return items, total, nil
+	}
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetSkip(startIndex - 1).SetLimit(count)
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	for cursor.Next(ctx) {
+		var item T
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	return items, total, nil
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/db"
+)
+
+type scimTokenEntity struct {
+	scimTokenRepo *mongo.Collection
+}
+
+type IScimToken interface {
+	CreateIndex() (string, error)
+	GetTokensByClientId(clientId string) ([]model.ScimToken, error)
+	GetTokenByHash(tokenHash string) (*model.ScimToken, error)
+	CreateToken(form request.ScimToken, tokenHash string, prefix string) (*model.ScimToken, error)
+	RemoveTokenById(id string, clientId string) (*model.ScimToken, error)
+	TouchToken(id primitive.ObjectID) error
+}
+
+func NewScimTokenEntity(resource *db.Resource) IScimToken {
+	scimTokenRepo := resource.UmDb.Collection("scim_tokens")
+	var entity IScimToken = &scimTokenEntity{scimTokenRepo: scimTokenRepo}
+	_, err := entity.CreateIndex()
+	if err != nil {
+		logrus.Error(err)
+	}
+	return entity
+}
+
+func (entity *scimTokenEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mod := mongo.IndexModel{
+		Keys: bson.M{
+			"tokenHash": 1,
+		},
+		Options: options.Index().SetUnique(true),
+	}
+	ind, err := entity.scimTokenRepo.Indexes().CreateOne(ctx, mod)
+	return ind, err
+}
+
+func (entity *scimTokenEntity) GetTokensByClientId(clientId string) ([]model.ScimToken, error) {
+	logrus.Info("GetTokensByClientId")
+	var items []model.ScimToken
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	cursor, err := entity.scimTokenRepo.Find(ctx, bson.M{"clientId": clientId}, options.Find().SetSort(bson.M{"createdDate": -1}))
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.ScimToken
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.ScimToken{}
+	}
+	return items, nil
+}
+
+func (entity *scimTokenEntity) GetTokenByHash(tokenHash string) (*model.ScimToken, error) {
+	logrus.Info("GetTokenByHash")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.ScimToken
+	err := entity.scimTokenRepo.FindOne(ctx, bson.M{"tokenHash": tokenHash}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *scimTokenEntity) CreateToken(form request.ScimToken, tokenHash string, prefix string) (*model.ScimToken, error) {
+	logrus.Info("CreateToken")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	createdBy, _ := primitive.ObjectIDFromHex(form.CreatedBy)
+	item := model.ScimToken{
+		Id:          primitive.NewObjectID(),
+		ClientId:    form.ClientId,
+		Name:        form.Name,
+		TokenHash:   tokenHash,
+		Prefix:      prefix,
+		CreatedBy:   createdBy,
+		CreatedDate: time.Now(),
+	}
+	_, err := entity.scimTokenRepo.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *scimTokenEntity) RemoveTokenById(id string, clientId string) (*model.ScimToken, error) {
+	logrus.Info("RemoveTokenById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.ScimToken
+	objId, _ := primitive.ObjectIDFromHex(id)
+	err := entity.scimTokenRepo.FindOneAndDelete(ctx, bson.M{"_id": objId, "clientId": clientId}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *scimTokenEntity) TouchToken(id primitive.ObjectID) error {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	_, err := entity.scimTokenRepo.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"lastUsedDate": time.Now()}})
+	return err
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"time"
+	"um/app/core/config"
+	"um/app/domain/model"
 	"um/db"
 )
 
@@ -18,8 +20,13 @@ type ISession interface {
 	UpdateSessionExpireById(sessionId string, expiration time.Duration) error
 	RemoveSessionById(sessionId string) error
 	GetSessionById(sessionId string) (string, error)
+	RemoveSessionsByUserId(userId string) error
+	GetSessionsByUserId(userId string) ([]model.ActiveSession, error)
 }
 
+// userSessionsKey is a set of the sessions of a user, it lives as long as the longest session could
+const userSessionsKey = "user:sessions:"
+
 func NewSessionEntity(resource *db.Resource) ISession {
 	var entity ISession = &sessionEntity{rdb: resource.RdDB}
 	return entity
@@ -29,7 +36,13 @@ func (entity *sessionEntity) CreateSession(userId string, expiration time.Durati
 	logrus.Info("CreateSession")
 	id := uuid.New()
 	sessionId := id.String()
-	err := entity.rdb.Set(context.Background(), sessionId, userId, expiration).Err()
+	ctx := context.Background()
+	_, err := entity.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, sessionId, userId, expiration)
+		pipe.SAdd(ctx, userSessionsKey+userId, sessionId)
+		pipe.Expire(ctx, userSessionsKey+userId, config.AccessTokenTime)
+		return nil
+	})
 	if err != nil {
 		return "", err
 	}
@@ -38,10 +51,16 @@ func (entity *sessionEntity) CreateSession(userId string, expiration time.Durati
 
 func (entity *sessionEntity) UpdateSessionExpireById(sessionId string, expiration time.Duration) error {
 	logrus.Info("UpdateSessionExpireById")
-	err := entity.rdb.Expire(context.Background(), sessionId, expiration).Err()
+	ctx := context.Background()
+	userId, err := entity.rdb.Get(ctx, sessionId).Result()
 	if err != nil {
 		return err
 	}
+	_, err = entity.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Expire(ctx, sessionId, expiration)
+		pipe.Expire(ctx, userSessionsKey+userId, config.AccessTokenTime)
+		return nil
+	})
 	return err
 }
 
@@ -54,6 +73,46 @@ func (entity *sessionEntity) GetSessionById(sessionId string) (string, error) {
 	return result, nil
 }
 
+// RemoveSessionsByUserId signs a user out everywhere
+func (entity *sessionEntity) RemoveSessionsByUserId(userId string) error {
+	logrus.Info("RemoveSessionsByUserId")
+	ctx := context.Background()
+	sessionIds, err := entity.rdb.SMembers(ctx, userSessionsKey+userId).Result()
+	if err != nil {
+		return err
+	}
+	return entity.rdb.Del(ctx, append(sessionIds, userSessionsKey+userId)...).Err()
+}
+
+// GetSessionsByUserId lists the sessions of a user that haven't expired yet
+func (entity *sessionEntity) GetSessionsByUserId(userId string) ([]model.ActiveSession, error) {
+	logrus.Info("GetSessionsByUserId")
+	ctx := context.Background()
+	sessionIds, err := entity.rdb.SMembers(ctx, userSessionsKey+userId).Result()
+	if err != nil {
+		return nil, err
+	}
+	ttls := make([]*redis.DurationCmd, len(sessionIds))
+	_, err = entity.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, sessionId := range sessionIds {
+			ttls[i] = pipe.TTL(ctx, sessionId)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	items := []model.ActiveSession{}
+	now := time.Now()
+	for i, sessionId := range sessionIds {
+		// a negative TTL is a session that expired or has no expiry, neither is an active session
+		if ttls[i].Val() > 0 {
+			items = append(items, model.ActiveSession{Id: sessionId, ExpireDate: now.Add(ttls[i].Val())})
+		}
+	}
+	return items, nil
+}
+
 func (entity *sessionEntity) RemoveSessionById(sessionId string) error {
 	logrus.Info("RemoveSessionById")
 	_, err := entity.rdb.Del(context.Background(), sessionId).Result()
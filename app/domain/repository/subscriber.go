@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/db"
+)
+
+const subscriberBlockTime = 2 * time.Second
+
+type streamSubscriber struct {
+	rdb *redis.Client
+}
+
+type ISubscriber interface {
+	Subscribe(group string) error
+	Read(group string, consumer string, count int64, pending bool) ([]model.StreamMessage, error)
+	Ack(group string, streamIds ...string) error
+}
+
+func NewStreamSubscriber(resource *db.Resource) ISubscriber {
+	var subscriber ISubscriber = &streamSubscriber{rdb: resource.RdDB}
+	return subscriber
+}
+
+// Subscribe creates the consumer group at the end of the stream unless it already exists
+func (subscriber *streamSubscriber) Subscribe(group string) error {
+	err := subscriber.rdb.XGroupCreateMkStream(context.Background(), constant.EventStream, group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// Read returns new messages for the consumer, or with pending the messages it read before
+// but never acknowledged. Malformed messages are acknowledged and dropped. A group deleted
+// since Subscribe is created again.
+func (subscriber *streamSubscriber) Read(group string, consumer string, count int64, pending bool) ([]model.StreamMessage, error) {
+	start := ">"
+	block := subscriberBlockTime
+	if pending {
+		start = "0"
+		block = -1
+	}
+	streams, err := subscriber.rdb.XReadGroup(context.Background(), &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{constant.EventStream, start},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return []model.StreamMessage{}, nil
+	}
+	if err != nil && strings.HasPrefix(err.Error(), "NOGROUP") {
+		// the stream or the group was deleted since Subscribe, start again at the end of the stream
+		logrus.Warning("consumer group " + group + " is gone, creating it again")
+		return []model.StreamMessage{}, subscriber.Subscribe(group)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := []model.StreamMessage{}
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			var event model.Event
+			payload, _ := message.Values["event"].(string)
+			err = json.Unmarshal([]byte(payload), &event)
+			if err != nil {
+				logrus.Error(err)
+				_ = subscriber.Ack(group, message.ID)
+				continue
+			}
+			items = append(items, model.StreamMessage{StreamId: message.ID, Event: event})
+		}
+	}
+	return items, nil
+}
+
+func (subscriber *streamSubscriber) Ack(group string, streamIds ...string) error {
+	if len(streamIds) == 0 {
+		return nil
+	}
+	return subscriber.rdb.XAck(context.Background(), constant.EventStream, group, streamIds...).Err()
+}
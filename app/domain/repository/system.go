@@ -1,12 +1,14 @@
 package repository
 
 import (
+	"context"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"time"
+	"um/app/core/constant"
 	"um/app/core/utils"
 	"um/app/domain/model"
 	"um/app/featues/request"
@@ -15,9 +17,11 @@ import (
 
 type systemEntity struct {
 	systemRepo *mongo.Collection
+	outbox     *outbox
 }
 
 type ISystem interface {
+	CreateIndex() (string, error)
 	GetSystems(form request.GetSystems) ([]model.System, error)
 	GetSystemsByClientId(clientId string) ([]model.System, error)
 	GetSystemsByCode(systemCode string) ([]model.System, error)
@@ -26,14 +30,33 @@ type ISystem interface {
 	CreateSystem(form request.System) (*model.System, error)
 	RemoveSystemById(id string) (*model.System, error)
 	UpdateSystemById(id string, form request.UpdateSystem) (*model.System, error)
+	GetSystemByOAuthClientId(oauthClientId string) (*model.System, error)
+	UpdateCredentialsById(id string, oauthClientId string, hashedSecret string, updatedBy string) (*model.System, error)
+	UpdateScopesById(id string, form request.SystemScopes) (*model.System, error)
+	UpdateRedirectUrisById(id string, form request.SystemRedirectUris) (*model.System, error)
 }
 
 func NewSystemEntity(resource *db.Resource) ISystem {
 	systemRepo := resource.UmDb.Collection("systems")
-	var entity ISystem = &systemEntity{systemRepo: systemRepo}
+	var entity ISystem = &systemEntity{systemRepo: systemRepo, outbox: newOutbox(resource)}
+	_, err := entity.CreateIndex()
+	if err != nil {
+		logrus.Error(err)
+	}
 	return entity
 }
 
+func (entity systemEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mod := mongo.IndexModel{
+		Keys:    bson.M{"oauthClientId": 1},
+		Options: options.Index().SetUnique(true).SetSparse(true),
+	}
+	ind, err := entity.systemRepo.Indexes().CreateOne(ctx, mod)
+	return ind, err
+}
+
 func (entity systemEntity) GetSystems(form request.GetSystems) (items []model.System, err error) {
 	logrus.Info("GetSystems")
 	ctx, cancel := utils.InitContext()
@@ -130,7 +153,8 @@ func (entity systemEntity) GetSystemById(id string) (*model.System, error) {
 	ctx, cancel := utils.InitContext()
 	defer cancel()
 	var item model.System
-	err := entity.systemRepo.FindOne(ctx, bson.M{"_id": id}).Decode(&item)
+	objId, _ := primitive.ObjectIDFromHex(id)
+	err := entity.systemRepo.FindOne(ctx, bson.M{"_id": objId}).Decode(&item)
 	if err != nil {
 		return nil, err
 	}
@@ -139,9 +163,6 @@ func (entity systemEntity) GetSystemById(id string) (*model.System, error) {
 
 func (entity systemEntity) CreateSystem(form request.System) (*model.System, error) {
 	logrus.Info("CreateSystem")
-	ctx, cancel := utils.InitContext()
-	defer cancel()
-
 	var id = primitive.NewObjectID()
 	createdBy, _ := primitive.ObjectIDFromHex(form.CreatedBy)
 	item := model.System{
@@ -155,7 +176,13 @@ func (entity systemEntity) CreateSystem(form request.System) (*model.System, err
 		UpdatedBy:   createdBy,
 		UpdatedDate: time.Now(),
 	}
-	_, err := entity.systemRepo.InsertOne(ctx, item)
+	err := entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		_, err := entity.systemRepo.InsertOne(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		return systemEvents(constant.EventSystemCreated, &item, form.CreatedBy)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -172,7 +199,13 @@ func (entity systemEntity) RemoveSystemById(id string) (*model.System, error) {
 	if err != nil {
 		return nil, err
 	}
-	_, err = entity.systemRepo.DeleteOne(ctx, bson.M{"_id": objId})
+	err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		_, err := entity.systemRepo.DeleteOne(ctx, bson.M{"_id": objId})
+		if err != nil {
+			return nil, err
+		}
+		return systemEvents(constant.EventSystemDeleted, &item, "")
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -181,8 +214,6 @@ func (entity systemEntity) RemoveSystemById(id string) (*model.System, error) {
 
 func (entity systemEntity) UpdateSystemById(id string, form request.UpdateSystem) (*model.System, error) {
 	logrus.Info("UpdateSystemById")
-	ctx, cancel := utils.InitContext()
-	defer cancel()
 	objId, _ := primitive.ObjectIDFromHex(id)
 	item, err := entity.GetSystemById(id)
 	if err != nil {
@@ -198,9 +229,115 @@ func (entity systemEntity) UpdateSystemById(id string, form request.UpdateSystem
 	opts := &options.FindOneAndUpdateOptions{
 		ReturnDocument: &isReturnNewDoc,
 	}
-	err = entity.systemRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId}, bson.M{"$set": item}, opts).Decode(&item)
+	err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		err := entity.systemRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId}, bson.M{"$set": item}, opts).Decode(&item)
+		if err != nil {
+			return nil, err
+		}
+		return systemEvents(constant.EventSystemUpdated, item, form.UpdatedBy)
+	})
 	if err != nil {
 		return nil, err
 	}
 	return item, nil
 }
+
+func (entity systemEntity) GetSystemByOAuthClientId(oauthClientId string) (*model.System, error) {
+	logrus.Info("GetSystemByOAuthClientId")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.System
+	err := entity.systemRepo.FindOne(ctx, bson.M{"oauthClientId": oauthClientId}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity systemEntity) UpdateCredentialsById(id string, oauthClientId string, hashedSecret string, updatedBy string) (*model.System, error) {
+	logrus.Info("UpdateCredentialsById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	updatedById, _ := primitive.ObjectIDFromHex(updatedBy)
+
+	var item model.System
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	now := time.Now()
+	update := bson.M{"$set": bson.M{
+		"oauthClientId":          oauthClientId,
+		"oauthClientSecret":      hashedSecret,
+		"credentialsRotatedDate": now,
+		"updatedBy":              updatedById,
+		"updatedDate":            now,
+	}}
+	err := entity.systemRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId}, update, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity systemEntity) UpdateScopesById(id string, form request.SystemScopes) (*model.System, error) {
+	logrus.Info("UpdateScopesById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	updatedBy, _ := primitive.ObjectIDFromHex(form.UpdatedBy)
+
+	var item model.System
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	update := bson.M{"$set": bson.M{"scopes": form.Scopes, "updatedBy": updatedBy, "updatedDate": time.Now()}}
+	err := entity.systemRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId}, update, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity systemEntity) UpdateRedirectUrisById(id string, form request.SystemRedirectUris) (*model.System, error) {
+	logrus.Info("UpdateRedirectUrisById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	updatedBy, _ := primitive.ObjectIDFromHex(form.UpdatedBy)
+
+	var item model.System
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	update := bson.M{"$set": bson.M{
+		"redirectUris": form.RedirectUris,
+		"publicClient": form.PublicClient,
+		"updatedBy":    updatedBy,
+		"updatedDate":  time.Now(),
+	}}
+	err := entity.systemRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId}, update, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func systemEvents(eventType string, item *model.System, actorId string) ([]model.Event, error) {
+	data := model.SystemEventData{
+		SystemId:   item.Id.Hex(),
+		ClientId:   item.ClientId,
+		SystemCode: item.SystemCode,
+		SystemName: item.SystemName,
+		Host:       item.Host,
+		ActorId:    actorId,
+	}
+	event, err := newEvent(eventType, item.ClientId, data)
+	if err != nil {
+		return nil, err
+	}
+	return []model.Event{event}, nil
+}
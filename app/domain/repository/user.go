@@ -1,12 +1,14 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
 	"strings"
 	"time"
 	"um/app/core/constant"
@@ -17,20 +19,48 @@ import (
 )
 
 type userEntity struct {
-	userRepo *mongo.Collection
+	userRepo           *mongo.Collection
+	attributeValueRepo *mongo.Collection
+	outbox             *outbox
 }
 
 type IUser interface {
 	CreateIndex() (string, error)
 	GetUsers() ([]model.User, error)
-	GetUserAll(clientId string) ([]model.User, error)
+	GetUserAll(clientId string, attributes map[string]interface{}) ([]model.User, error)
+	IsAttributeTaken(clientId string, key string, value interface{}, excludeId string) (bool, error)
+	IndexAttributeValues(clientId string, key string) error
+	ReleaseAttributeValues(clientId string, key string) error
+	RemoveAttribute(clientId string, key string) error
+	GetPendingRegistrations(clientId string) ([]model.User, error)
+	GetExpiringUsers(clientId string, until time.Time) ([]model.User, error)
+	ExpireUsers(now time.Time, limit int64) ([]model.User, error)
+	TouchLastLogin(id string) error
+	GetDormantUsers(clientId string, cutoff time.Time) ([]model.User, error)
+	MarkInactivityWarned(id string) error
+	DisableDormantUser(id string, cutoff time.Time) (*model.User, error)
 	GetUserByUsername(username string) (*model.User, error)
 	GetUserById(id string) (*model.User, error)
 	GetUserByClientId(id string, clientId string) (*model.User, error)
+	GetUsersByEmail(email string, clientId string) ([]model.User, error)
+	GetUserByIdentity(providerId string, subject string) (*model.User, error)
+	LinkIdentity(id string, identity model.UserIdentity) (*model.User, error)
+	AddWebauthnCredential(id string, credential model.WebauthnCredential) (*model.User, error)
+	RemoveWebauthnCredential(id string, credentialId string) (*model.User, error)
+	TouchWebauthnCredential(id string, credentialId string, signCount uint32, backupState bool) error
+	SetContactVerified(id string, channel string, address string) (*model.User, error)
+	SetAvatar(id string, avatar string) (*model.User, error)
+	EraseUser(id string, clientId string, erasedBy string) (*model.User, error)
+	AcceptInvitation(id string, email string, form request.AcceptInvite) (*model.User, error)
+	SyncDirectoryUser(form request.DirectoryUser) (*model.User, error)
+	GetUsersByScimFilter(clientId string, filter *utils.ScimFilter, startIndex int64, count int64) ([]model.User, int64, error)
+	CreateScimUser(form request.ScimUserForm) (*model.User, error)
+	ReplaceScimUser(id string, clientId string, form request.ScimUserForm) (*model.User, error)
 	CreateUser(form request.User, role string) (*model.User, error)
 	RemoveUserById(id string, clientId string) (*model.User, error)
 	UpdateUserById(id string, clientId string, form request.UpdateUser) (*model.User, error)
 	UpdateStatusById(id string, clientId string, form request.UpdateStatus) (*model.User, error)
+	UpdateValidityById(id string, clientId string, form request.UpdateValidity) (*model.User, error)
 	UpdateRoleById(id string, clientId string, form request.UpdateRole) (*model.User, error)
 	ChangePassword(id string, clientId string, form request.ChangePassword) (*model.User, error)
 	SetPassword(id string, clientId string, form request.SetPassword) (*model.User, error)
@@ -39,7 +69,8 @@ type IUser interface {
 
 func NewUserEntity(resource *db.Resource) IUser {
 	userRepo := resource.UmDb.Collection("users")
-	var entity IUser = &userEntity{userRepo: userRepo}
+	attributeValueRepo := resource.UmDb.Collection("attribute_values")
+	var entity IUser = &userEntity{userRepo: userRepo, attributeValueRepo: attributeValueRepo, outbox: newOutbox(resource)}
 	_, _ = entity.CreateIndex()
 	return entity
 }
@@ -47,14 +78,47 @@ func NewUserEntity(resource *db.Resource) IUser {
 func (entity *userEntity) CreateIndex() (string, error) {
 	ctx, cancel := utils.InitContext()
 	defer cancel()
-	mod := mongo.IndexModel{
-		Keys: bson.M{
-			"username": 1,
+	mods := []mongo.IndexModel{
+		{
+			Keys: bson.M{
+				"username": 1,
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "identities.providerId", Value: 1}, {Key: "identities.subject", Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+		{
+			Keys: bson.D{{Key: "clientId", Value: 1}, {Key: "email", Value: 1}},
+		},
+		{
+			Keys:    bson.M{"webauthn.id": 1},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "validUntil", Value: 1}, {Key: "status", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"validUntil": bson.M{"$exists": true}}),
 		},
-		Options: options.Index().SetUnique(true),
 	}
-	ind, err := entity.userRepo.Indexes().CreateOne(ctx, mod)
-	return ind, err
+	ind, err := entity.userRepo.Indexes().CreateMany(ctx, mods)
+	if err != nil {
+		return "", err
+	}
+	valueMods := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "clientId", Value: 1}, {Key: "key", Value: 1}, {Key: "value", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.M{"userId": 1},
+		},
+	}
+	valueInd, err := entity.attributeValueRepo.Indexes().CreateMany(ctx, valueMods)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(append(ind, valueInd...), ","), nil
 }
 
 func (entity *userEntity) GetUsers() ([]model.User, error) {
@@ -82,12 +146,147 @@ func (entity *userEntity) GetUsers() ([]model.User, error) {
 	return usersList, nil
 }
 
-func (entity *userEntity) GetUserAll(clientId string) ([]model.User, error) {
+// GetUserAll lists the users of a client, only those whose custom attributes equal every value of
+// attributes when given
+func (entity *userEntity) GetUserAll(clientId string, attributes map[string]interface{}) ([]model.User, error) {
 	logrus.Info("GetUserAll")
 	var usersList []model.User
 	ctx, cancel := utils.InitContext()
 	defer cancel()
-	cursor, err := entity.userRepo.Find(ctx, bson.M{"clientId": clientId, "role": bson.M{"$ne": constant.SUPER}})
+	filter := bson.M{"clientId": clientId, "role": bson.M{"$ne": constant.SUPER}}
+	for key, value := range attributes {
+		filter["attributes."+key] = value
+	}
+	cursor, err := entity.userRepo.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var user model.User
+		err = cursor.Decode(&user)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			usersList = append(usersList, user)
+		}
+	}
+	if usersList == nil {
+		usersList = []model.User{}
+	}
+	return usersList, nil
+}
+
+// IsAttributeTaken tells whether another user of the client holds value for the unique custom
+// attribute key. It gives an early error, the unique index of attribute_values is what refuses a
+// value saved by two users at the same time.
+func (entity *userEntity) IsAttributeTaken(clientId string, key string, value interface{}, excludeId string) (bool, error) {
+	logrus.Info("IsAttributeTaken")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	filter := bson.M{"clientId": clientId, "key": key, "value": value}
+	if excludeId != "" {
+		objId, _ := primitive.ObjectIDFromHex(excludeId)
+		filter["userId"] = bson.M{"$ne": objId}
+	}
+	count, err := entity.attributeValueRepo.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// claimAttributes records the values of the unique attributes of a user in attribute_values, in the
+// transaction of the user write. A value another user of the client holds fails on the unique index
+// and aborts the write. The values the user no longer has are released.
+func (entity *userEntity) claimAttributes(ctx context.Context, clientId string, userId primitive.ObjectID, attributes map[string]interface{}, uniqueKeys []string) error {
+	held := bson.A{}
+	for _, key := range uniqueKeys {
+		value, ok := attributes[key]
+		if !ok {
+			continue
+		}
+		filter := bson.M{"clientId": clientId, "key": key, "value": value}
+		claim := bson.M{"clientId": clientId, "key": key, "value": value, "userId": userId}
+		_, err := entity.attributeValueRepo.UpdateOne(ctx, claim, bson.M{"$setOnInsert": bson.M{"createdDate": time.Now()}}, options.Update().SetUpsert(true))
+		if mongo.IsDuplicateKeyError(err) {
+			return errors.New("attribute " + key + " is already used")
+		}
+		if err != nil {
+			return err
+		}
+		held = append(held, filter)
+	}
+	release := bson.M{"userId": userId}
+	if len(held) > 0 {
+		release["$nor"] = held
+	}
+	_, err := entity.attributeValueRepo.DeleteMany(ctx, release)
+	return err
+}
+
+// IndexAttributeValues claims the stored values of an attribute that became unique. Nothing is kept
+// when two users of the client share a value.
+func (entity *userEntity) IndexAttributeValues(clientId string, key string) error {
+	logrus.Info("IndexAttributeValues")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	filter := bson.M{"clientId": clientId, "attributes." + key: bson.M{"$exists": true}}
+	cursor, err := entity.userRepo.Find(ctx, filter, options.Find().SetProjection(bson.M{"attributes." + key: 1}))
+	if err != nil {
+		return err
+	}
+	var users []model.User
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		claim := bson.M{"clientId": clientId, "key": key, "value": user.Attributes[key], "userId": user.Id, "createdDate": time.Now()}
+		_, err = entity.attributeValueRepo.InsertOne(ctx, claim)
+		if err != nil {
+			_, _ = entity.attributeValueRepo.DeleteMany(ctx, bson.M{"clientId": clientId, "key": key})
+			if mongo.IsDuplicateKeyError(err) {
+				return errors.New("users of the client share values of attribute " + key)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ReleaseAttributeValues forgets the claimed values of an attribute that is no longer unique
+func (entity *userEntity) ReleaseAttributeValues(clientId string, key string) error {
+	logrus.Info("ReleaseAttributeValues")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	_, err := entity.attributeValueRepo.DeleteMany(ctx, bson.M{"clientId": clientId, "key": key})
+	return err
+}
+
+// RemoveAttribute drops the values of a deleted custom attribute from the users of the client
+func (entity *userEntity) RemoveAttribute(clientId string, key string) error {
+	logrus.Info("RemoveAttribute")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	filter := bson.M{"clientId": clientId, "attributes." + key: bson.M{"$exists": true}}
+	_, err := entity.userRepo.UpdateMany(ctx, filter, bson.M{"$unset": bson.M{"attributes." + key: ""}})
+	if err != nil {
+		return err
+	}
+	_, err = entity.attributeValueRepo.DeleteMany(ctx, bson.M{"clientId": clientId, "key": key})
+	return err
+}
+
+// GetPendingRegistrations lists the users who signed up to a client and wait for an ADMIN to approve
+// them
+func (entity *userEntity) GetPendingRegistrations(clientId string) ([]model.User, error) {
+	logrus.Info("GetPendingRegistrations")
+	var usersList []model.User
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	filter := bson.M{"clientId": clientId, "status": constant.PENDING, "source": constant.SourceRegistration}
+	cursor, err := entity.userRepo.Find(ctx, filter, options.Find().SetSort(bson.M{"createdDate": 1}))
 	if err != nil {
 		return nil, err
 	}
@@ -107,6 +306,77 @@ func (entity *userEntity) GetUserAll(clientId string) ([]model.User, error) {
 	return usersList, nil
 }
 
+// GetExpiringUsers lists the ACTIVE users of a client whose validUntil is before until, soonest first
+func (entity *userEntity) GetExpiringUsers(clientId string, until time.Time) ([]model.User, error) {
+	logrus.Info("GetExpiringUsers")
+	var usersList []model.User
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	filter := bson.M{"clientId": clientId, "status": constant.ACTIVE, "validUntil": bson.M{"$lte": until}}
+	cursor, err := entity.userRepo.Find(ctx, filter, options.Find().SetSort(bson.M{"validUntil": 1}))
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var user model.User
+		err = cursor.Decode(&user)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			usersList = append(usersList, user)
+		}
+	}
+	if usersList == nil {
+		usersList = []model.User{}
+	}
+	return usersList, nil
+}
+
+// ExpireUsers turns up to limit ACTIVE users past their validUntil to EXPIRED and returns them
+func (entity *userEntity) ExpireUsers(now time.Time, limit int64) ([]model.User, error) {
+	logrus.Info("ExpireUsers")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	filter := bson.M{"status": constant.ACTIVE, "validUntil": bson.M{"$lte": now}}
+	cursor, err := entity.userRepo.Find(ctx, filter, options.Find().SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	var candidates []model.User
+	err = cursor.All(ctx, &candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	var expired []model.User
+	for _, previous := range candidates {
+		previous := previous
+		var user model.User
+		update := bson.M{"$set": bson.M{"status": constant.EXPIRED, "updatedDate": now}}
+		err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+			// the user may have been changed since it was found
+			err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": previous.Id, "status": constant.ACTIVE, "validUntil": bson.M{"$lte": now}}, update, opts).Decode(&user)
+			if err != nil {
+				return nil, err
+			}
+			return userEvents(constant.EventUserExpired, &user, &previous, "")
+		})
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired = append(expired, user)
+	}
+	return expired, nil
+}
+
 func (entity *userEntity) GetUserByUsername(username string) (*model.User, error) {
 	logrus.Info("GetUserByUsername")
 	ctx, cancel := utils.InitContext()
@@ -121,29 +391,51 @@ func (entity *userEntity) GetUserByUsername(username string) (*model.User, error
 
 func (entity *userEntity) CreateUser(form request.User, role string) (*model.User, error) {
 	logrus.Info("CreateUser")
-	ctx, cancel := utils.InitContext()
-	defer cancel()
-
 	var userId = primitive.NewObjectID()
 	var createdBy = userId
 	if form.CreatedBy != "" {
 		createdBy, _ = primitive.ObjectIDFromHex(form.CreatedBy)
 	}
+	status := form.Status
+	if status == "" {
+		status = constant.ACTIVE
+	}
+	// invited users have no password until they accept
+	password := ""
+	if form.Password != "" {
+		password = utils.HashPassword(form.Password)
+	}
 	user := model.User{
 		Id:          userId,
 		FirstName:   form.FirstName,
 		LastName:    form.LastName,
 		Username:    form.Username,
 		ClientId:    form.ClientId,
-		Password:    utils.HashPassword(form.Password),
+		Password:    password,
+		Phone:       form.Phone,
+		Email:       form.Email,
 		Role:        role,
-		Status:      constant.ACTIVE,
+		Status:      status,
+		Source:      form.Source,
+		ValidFrom:   form.ValidFrom,
+		ValidUntil:  form.ValidUntil,
+		Attributes:  form.Attributes,
 		CreatedBy:   createdBy,
 		CreatedDate: time.Now(),
 		UpdatedBy:   createdBy,
 		UpdatedDate: time.Now(),
 	}
-	_, err := entity.userRepo.InsertOne(ctx, user)
+	err := entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		_, err := entity.userRepo.InsertOne(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		err = entity.claimAttributes(ctx, form.ClientId, userId, form.Attributes, form.UniqueAttributes)
+		if err != nil {
+			return nil, err
+		}
+		return userEvents(constant.EventUserCreated, &user, nil, form.CreatedBy)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -176,6 +468,281 @@ func (entity *userEntity) GetUserByClientId(id string, clientId string) (*model.
 	return &user, nil
 }
 
+func (entity *userEntity) GetUsersByEmail(email string, clientId string) ([]model.User, error) {
+	logrus.Info("GetUsersByEmail")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var usersList []model.User
+	filter := bson.M{
+		"email":    primitive.Regex{Pattern: "^" + regexp.QuoteMeta(strings.TrimSpace(email)) + "$", Options: "i"},
+		"clientId": clientId,
+	}
+	cursor, err := entity.userRepo.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var user model.User
+		err = cursor.Decode(&user)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			usersList = append(usersList, user)
+		}
+	}
+	if usersList == nil {
+		usersList = []model.User{}
+	}
+	return usersList, nil
+}
+
+func (entity *userEntity) GetUserByIdentity(providerId string, subject string) (*model.User, error) {
+	logrus.Info("GetUserByIdentity")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var user model.User
+	filter := bson.M{"identities": bson.M{"$elemMatch": bson.M{"providerId": providerId, "subject": subject}}}
+	err := entity.userRepo.FindOne(ctx, filter).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (entity *userEntity) LinkIdentity(id string, identity model.UserIdentity) (*model.User, error) {
+	logrus.Info("LinkIdentity")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	var user model.User
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	update := bson.M{
+		"$push": bson.M{"identities": identity},
+		"$set":  bson.M{"updatedDate": time.Now()},
+	}
+	err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId}, update, opts).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (entity *userEntity) AddWebauthnCredential(id string, credential model.WebauthnCredential) (*model.User, error) {
+	logrus.Info("AddWebauthnCredential")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	var user model.User
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	update := bson.M{
+		"$push": bson.M{"webauthn": credential},
+		"$set":  bson.M{"updatedDate": time.Now()},
+	}
+	err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId}, update, opts).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (entity *userEntity) RemoveWebauthnCredential(id string, credentialId string) (*model.User, error) {
+	logrus.Info("RemoveWebauthnCredential")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	var user model.User
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	filter := bson.M{"_id": objId, "webauthn.id": credentialId}
+	update := bson.M{
+		"$pull": bson.M{"webauthn": bson.M{"id": credentialId}},
+		"$set":  bson.M{"updatedDate": time.Now()},
+	}
+	err := entity.userRepo.FindOneAndUpdate(ctx, filter, update, opts).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// TouchWebauthnCredential keeps the signature counter of a credential after a login
+func (entity *userEntity) TouchWebauthnCredential(id string, credentialId string, signCount uint32, backupState bool) error {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	filter := bson.M{"_id": objId, "webauthn.id": credentialId}
+	update := bson.M{"$set": bson.M{
+		"webauthn.$.signCount":    signCount,
+		"webauthn.$.backupState":  backupState,
+		"webauthn.$.lastUsedDate": time.Now(),
+	}}
+	_, err := entity.userRepo.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// SyncDirectoryUser creates or updates a user from its directory entry. Directory users have no
+// local password, and keep the status set in um-api.
+func (entity *userEntity) SyncDirectoryUser(form request.DirectoryUser) (*model.User, error) {
+	logrus.Info("SyncDirectoryUser")
+	user, err := entity.GetUserByUsername(form.Username)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		userId := primitive.NewObjectID()
+		user = &model.User{
+			Id:          userId,
+			FirstName:   form.FirstName,
+			LastName:    form.LastName,
+			Username:    strings.TrimSpace(form.Username),
+			ClientId:    form.ClientId,
+			Role:        form.Role,
+			Status:      constant.ACTIVE,
+			Phone:       form.Phone,
+			Email:       form.Email,
+			Source:      form.Source,
+			CreatedBy:   userId,
+			CreatedDate: time.Now(),
+			UpdatedBy:   userId,
+			UpdatedDate: time.Now(),
+		}
+		err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+			_, err := entity.userRepo.InsertOne(ctx, user)
+			if err != nil {
+				return nil, err
+			}
+			return userEvents(constant.EventUserCreated, user, nil, "")
+		})
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Source != form.Source || user.ClientId != form.ClientId {
+		return nil, errors.New("username is taken by another user")
+	}
+	if user.FirstName == form.FirstName && user.LastName == form.LastName && user.Email == form.Email &&
+		user.Phone == form.Phone && user.Role == form.Role {
+		return user, nil
+	}
+
+	previous := *user
+	user.FirstName = form.FirstName
+	user.LastName = form.LastName
+	setContact(user, form.Email, form.Phone)
+	user.Role = form.Role
+	user.UpdatedDate = time.Now()
+	eventType := constant.EventUserUpdated
+	if previous.Role != user.Role {
+		eventType = constant.EventUserRoleChanged
+	}
+
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": user.Id}, bson.M{"$set": user}, opts).Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+		return userEvents(eventType, user, &previous, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (entity *userEntity) GetUsersByScimFilter(clientId string, filter *utils.ScimFilter, startIndex int64, count int64) ([]model.User, int64, error) {
+	logrus.Info("GetUsersByScimFilter")
+	return scimFind[model.User](entity.userRepo, clientId, filter, scimUserAttributes, startIndex, count)
+}
+
+func (entity *userEntity) CreateScimUser(form request.ScimUserForm) (*model.User, error) {
+	logrus.Info("CreateScimUser")
+	userId := primitive.NewObjectID()
+	user := model.User{
+		Id:          userId,
+		FirstName:   form.FirstName,
+		LastName:    form.LastName,
+		Username:    strings.TrimSpace(form.Username),
+		ClientId:    form.ClientId,
+		Password:    utils.HashPassword(form.Password),
+		Role:        constant.USER,
+		Status:      scimStatus(form.Active),
+		Phone:       form.Phone,
+		Email:       form.Email,
+		ExternalId:  form.ExternalId,
+		CreatedBy:   userId,
+		CreatedDate: time.Now(),
+		UpdatedBy:   userId,
+		UpdatedDate: time.Now(),
+	}
+	err := entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		_, err := entity.userRepo.InsertOne(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		return userEvents(constant.EventUserCreated, &user, nil, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ReplaceScimUser sets every field SCIM manages, the password only changes when one is given
+func (entity *userEntity) ReplaceScimUser(id string, clientId string, form request.ScimUserForm) (*model.User, error) {
+	logrus.Info("ReplaceScimUser")
+	objId, _ := primitive.ObjectIDFromHex(id)
+	user, err := entity.GetUserByClientId(id, clientId)
+	if err != nil {
+		return nil, err
+	}
+	previous := *user
+
+	user.Username = strings.TrimSpace(form.Username)
+	user.FirstName = form.FirstName
+	user.LastName = form.LastName
+	setContact(user, form.Email, form.Phone)
+	user.ExternalId = form.ExternalId
+	setStatus(user, scimStatus(form.Active))
+	if form.Password != "" {
+		user.Password = utils.HashPassword(form.Password)
+	}
+	user.UpdatedDate = time.Now()
+	eventType := constant.EventUserUpdated
+	if previous.Status != user.Status {
+		eventType = statusEventType(previous.Status, user.Status)
+	}
+
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, bson.M{"$set": user}, opts).Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+		return userEvents(eventType, user, &previous, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
 func (entity *userEntity) RemoveUserById(id string, clientId string) (*model.User, error) {
 	logrus.Info("RemoveUserById")
 	ctx, cancel := utils.InitContext()
@@ -186,7 +753,17 @@ func (entity *userEntity) RemoveUserById(id string, clientId string) (*model.Use
 	if err != nil {
 		return nil, err
 	}
-	_, err = entity.userRepo.DeleteOne(ctx, bson.M{"_id": objId, "clientId": clientId})
+	err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		_, err := entity.userRepo.DeleteOne(ctx, bson.M{"_id": objId, "clientId": clientId})
+		if err != nil {
+			return nil, err
+		}
+		_, err = entity.attributeValueRepo.DeleteMany(ctx, bson.M{"userId": objId})
+		if err != nil {
+			return nil, err
+		}
+		return userEvents(constant.EventUserDeleted, &user, nil, "")
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -195,8 +772,6 @@ func (entity *userEntity) RemoveUserById(id string, clientId string) (*model.Use
 
 func (entity *userEntity) UpdateUserById(id string, clientId string, form request.UpdateUser) (*model.User, error) {
 	logrus.Info("UpdateUserById")
-	ctx, cancel := utils.InitContext()
-	defer cancel()
 	objId, _ := primitive.ObjectIDFromHex(id)
 	user, err := entity.GetUserById(id)
 	if err != nil {
@@ -205,8 +780,15 @@ func (entity *userEntity) UpdateUserById(id string, clientId string, form reques
 
 	user.FirstName = form.FirstName
 	user.LastName = form.LastName
-	user.Email = form.Email
-	user.Phone = form.Phone
+	setContact(user, form.Email, form.Phone)
+	update := bson.M{"$set": user}
+	if form.Attributes != nil {
+		user.Attributes = form.Attributes
+		// an empty map is left out of $set, so clearing the attributes needs an $unset
+		if len(form.Attributes) == 0 {
+			update["$unset"] = bson.M{"attributes": ""}
+		}
+	}
 	user.UpdatedBy, _ = primitive.ObjectIDFromHex(form.UpdatedBy)
 	user.UpdatedDate = time.Now()
 
@@ -214,7 +796,19 @@ func (entity *userEntity) UpdateUserById(id string, clientId string, form reques
 	opts := &options.FindOneAndUpdateOptions{
 		ReturnDocument: &isReturnNewDoc,
 	}
-	err = entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, bson.M{"$set": user}, opts).Decode(&user)
+	err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, update, opts).Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+		if form.Attributes != nil {
+			err = entity.claimAttributes(ctx, clientId, objId, form.Attributes, form.UniqueAttributes)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return userEvents(constant.EventUserUpdated, user, nil, form.UpdatedBy)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -223,14 +817,13 @@ func (entity *userEntity) UpdateUserById(id string, clientId string, form reques
 
 func (entity *userEntity) UpdateStatusById(id string, clientId string, form request.UpdateStatus) (*model.User, error) {
 	logrus.Info("UpdateStatusById")
-	ctx, cancel := utils.InitContext()
-	defer cancel()
 	objId, _ := primitive.ObjectIDFromHex(id)
 	user, err := entity.GetUserById(id)
 	if err != nil {
 		return nil, err
 	}
-	user.Status = form.Status
+	previous := *user
+	setStatus(user, form.Status)
 	user.UpdatedBy, _ = primitive.ObjectIDFromHex(form.UpdatedBy)
 	user.UpdatedDate = time.Now()
 
@@ -238,22 +831,80 @@ func (entity *userEntity) UpdateStatusById(id string, clientId string, form requ
 	opts := &options.FindOneAndUpdateOptions{
 		ReturnDocument: &isReturnNewDoc,
 	}
-	err = entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, bson.M{"$set": user}, opts).Decode(&user)
+	err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, bson.M{"$set": user}, opts).Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+		return userEvents(statusEventType(previous.Status, user.Status), user, &previous, form.UpdatedBy)
+	})
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
+// UpdateValidityById sets or clears the validity window of a user. An EXPIRED user whose new window
+// hasn't ended is ACTIVE again.
+func (entity *userEntity) UpdateValidityById(id string, clientId string, form request.UpdateValidity) (*model.User, error) {
+	logrus.Info("UpdateValidityById")
+	objId, _ := primitive.ObjectIDFromHex(id)
+	previous, err := entity.GetUserByClientId(id, clientId)
+	if err != nil {
+		return nil, err
+	}
+	updatedBy, _ := primitive.ObjectIDFromHex(form.UpdatedBy)
+	set := bson.M{"updatedBy": updatedBy, "updatedDate": time.Now()}
+	unset := bson.M{}
+	if form.ValidFrom != nil {
+		set["validFrom"] = form.ValidFrom
+	} else {
+		unset["validFrom"] = ""
+	}
+	if form.ValidUntil != nil {
+		set["validUntil"] = form.ValidUntil
+	} else {
+		unset["validUntil"] = ""
+	}
+	if previous.Status == constant.EXPIRED && (form.ValidUntil == nil || form.ValidUntil.After(time.Now())) {
+		set["status"] = constant.ACTIVE
+		set["activatedDate"] = time.Now()
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var user model.User
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, update, opts).Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+		eventType := constant.EventUserUpdated
+		if user.Status != previous.Status {
+			eventType = statusEventType(previous.Status, user.Status)
+		}
+		return userEvents(eventType, &user, previous, form.UpdatedBy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (entity *userEntity) UpdateRoleById(id string, clientId string, form request.UpdateRole) (*model.User, error) {
 	logrus.Info("UpdateRoleById")
-	ctx, cancel := utils.InitContext()
-	defer cancel()
 	objId, _ := primitive.ObjectIDFromHex(id)
 	user, err := entity.GetUserById(id)
 	if err != nil {
 		return nil, err
 	}
+	previous := *user
 
 	user.Role = form.Role
 	user.UpdatedBy, _ = primitive.ObjectIDFromHex(form.UpdatedBy)
@@ -263,7 +914,13 @@ func (entity *userEntity) UpdateRoleById(id string, clientId string, form reques
 	opts := &options.FindOneAndUpdateOptions{
 		ReturnDocument: &isReturnNewDoc,
 	}
-	err = entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, bson.M{"$set": user}, opts).Decode(&user)
+	err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, bson.M{"$set": user}, opts).Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+		return userEvents(constant.EventUserRoleChanged, user, &previous, form.UpdatedBy)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -272,8 +929,6 @@ func (entity *userEntity) UpdateRoleById(id string, clientId string, form reques
 
 func (entity *userEntity) ChangePassword(id string, clientId string, form request.ChangePassword) (*model.User, error) {
 	logrus.Info("ChangePassword")
-	ctx, cancel := utils.InitContext()
-	defer cancel()
 	objId, _ := primitive.ObjectIDFromHex(id)
 	user, err := entity.GetUserById(id)
 	if err != nil {
@@ -286,7 +941,13 @@ func (entity *userEntity) ChangePassword(id string, clientId string, form reques
 	opts := &options.FindOneAndUpdateOptions{
 		ReturnDocument: &isReturnNewDoc,
 	}
-	err = entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, bson.M{"$set": user}, opts).Decode(&user)
+	err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, bson.M{"$set": user}, opts).Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+		return userEvents(constant.EventUserPasswordChanged, user, nil, id)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -295,8 +956,6 @@ func (entity *userEntity) ChangePassword(id string, clientId string, form reques
 
 func (entity *userEntity) SetPassword(id string, clientId string, form request.SetPassword) (*model.User, error) {
 	logrus.Info("SetPassword")
-	ctx, cancel := utils.InitContext()
-	defer cancel()
 	objId, _ := primitive.ObjectIDFromHex(id)
 	user, err := entity.GetUserById(id)
 	if err != nil {
@@ -309,7 +968,13 @@ func (entity *userEntity) SetPassword(id string, clientId string, form request.S
 	opts := &options.FindOneAndUpdateOptions{
 		ReturnDocument: &isReturnNewDoc,
 	}
-	err = entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, bson.M{"$set": user}, opts).Decode(&user)
+	err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, bson.M{"$set": user}, opts).Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+		return userEvents(constant.EventUserPasswordChanged, user, nil, id)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -340,3 +1005,305 @@ func (entity *userEntity) ValidateUserRole(role string, id string) error {
 		return nil
 	}
 }
+
+func scimStatus(active bool) string {
+	if active {
+		return constant.ACTIVE
+	}
+	return constant.INACTIVE
+}
+
+func statusEventType(previous string, status string) string {
+	if previous != status && status == constant.ACTIVE {
+		return constant.EventUserActivated
+	}
+	if previous != status && status == constant.INACTIVE {
+		return constant.EventUserDeactivated
+	}
+	if previous != status && status == constant.EXPIRED {
+		return constant.EventUserExpired
+	}
+	return constant.EventUserStatusChanged
+}
+
+// SetContactVerified marks the email or phone of a user as verified, unless it changed since address
+// was sent a code
+func (entity *userEntity) SetContactVerified(id string, channel string, address string) (*model.User, error) {
+	logrus.Info("SetContactVerified")
+	objId, _ := primitive.ObjectIDFromHex(id)
+	field := "email"
+	if channel == constant.ChannelSms {
+		field = "phone"
+	}
+	var user model.User
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	update := bson.M{"$set": bson.M{field + "Verified": true, "updatedDate": time.Now()}}
+	err := entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, field: address}, update, opts).Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+		return userEvents(constant.EventUserUpdated, &user, nil, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetAvatar points a user to a new version of their avatar, an empty version removes it
+func (entity *userEntity) SetAvatar(id string, avatar string) (*model.User, error) {
+	logrus.Info("SetAvatar")
+	objId, _ := primitive.ObjectIDFromHex(id)
+	var user model.User
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	update := bson.M{"$set": bson.M{"avatar": avatar, "updatedDate": time.Now()}}
+	if avatar == "" {
+		update = bson.M{"$unset": bson.M{"avatar": ""}, "$set": bson.M{"updatedDate": time.Now()}}
+	}
+	err := entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId}, update, opts).Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+		return userEvents(constant.EventUserUpdated, &user, nil, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// EraseUser blanks the personal data of a user and leaves an INACTIVE record that can't sign in, so
+// the createdBy and updatedBy of other documents and the audit log still point to a user
+func (entity *userEntity) EraseUser(id string, clientId string, erasedBy string) (*model.User, error) {
+	logrus.Info("EraseUser")
+	objId, _ := primitive.ObjectIDFromHex(id)
+	updatedBy, _ := primitive.ObjectIDFromHex(erasedBy)
+	var user model.User
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"firstName":     "",
+			"lastName":      "",
+			"username":      "erased-" + id,
+			"password":      "",
+			"phone":         "",
+			"email":         "",
+			"emailVerified": false,
+			"phoneVerified": false,
+			"status":        constant.INACTIVE,
+			"erasedDate":    now,
+			"updatedBy":     updatedBy,
+			"updatedDate":   now,
+		},
+		"$unset": bson.M{
+			"validFrom":            "",
+			"validUntil":           "",
+			"lastLoginDate":        "",
+			"activatedDate":        "",
+			"inactivityWarnedDate": "",
+			"source":               "",
+			"externalId":           "",
+			"avatar":               "",
+			"attributes":           "",
+			"identities":           "",
+			"webauthn":             "",
+		},
+	}
+	err := entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "clientId": clientId}, update, opts).Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+		_, err = entity.attributeValueRepo.DeleteMany(ctx, bson.M{"userId": objId})
+		if err != nil {
+			return nil, err
+		}
+		return userEvents(constant.EventUserErased, &user, nil, erasedBy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// AcceptInvitation sets the password and profile of a PENDING user and activates them. The email the
+// invitation was sent to is verified by the acceptance, unless it changed since.
+func (entity *userEntity) AcceptInvitation(id string, email string, form request.AcceptInvite) (*model.User, error) {
+	logrus.Info("AcceptInvitation")
+	objId, _ := primitive.ObjectIDFromHex(id)
+	previous, err := entity.GetUserById(id)
+	if err != nil {
+		return nil, err
+	}
+	var user model.User
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	update := bson.M{"$set": bson.M{
+		"password":      utils.HashPassword(form.Password),
+		"firstName":     form.FirstName,
+		"lastName":      form.LastName,
+		"phone":         form.Phone,
+		"phoneVerified": previous.PhoneVerified && previous.Phone == form.Phone,
+		"emailVerified": previous.Email == email,
+		"status":        constant.ACTIVE,
+		"activatedDate": time.Now(),
+		"updatedBy":     objId,
+		"updatedDate":   time.Now(),
+	}}
+	err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		err := entity.userRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "status": constant.PENDING}, update, opts).Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+		return userEvents(constant.EventUserActivated, &user, previous, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// setStatus changes the status of a user, becoming ACTIVE again restarts their inactivity period
+func setStatus(user *model.User, status string) {
+	if user.Status != constant.ACTIVE && status == constant.ACTIVE {
+		now := time.Now()
+		user.ActivatedDate = &now
+	}
+	user.Status = status
+}
+
+// TouchLastLogin records a sign-in or a keep-alive of a user and withdraws an inactivity warning
+func (entity *userEntity) TouchLastLogin(id string) error {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	update := bson.M{"$set": bson.M{"lastLoginDate": time.Now()}, "$unset": bson.M{"inactivityWarnedDate": ""}}
+	_, err := entity.userRepo.UpdateOne(ctx, bson.M{"_id": objId}, update)
+	return err
+}
+
+// dormantFilter matches ACTIVE users other than SUPER who didn't sign in since cutoff, counting from
+// their creation or their last activation when they never did since
+func dormantFilter(cutoff time.Time) bson.M {
+	return bson.M{
+		"status": constant.ACTIVE,
+		"role":   bson.M{"$ne": constant.SUPER},
+		"$expr": bson.M{"$lte": bson.A{
+			bson.M{"$max": bson.A{"$lastLoginDate", "$activatedDate", "$createdDate"}},
+			cutoff,
+		}},
+	}
+}
+
+// GetDormantUsers lists the users of a client without a sign-in since cutoff, those who never signed
+// in first
+func (entity *userEntity) GetDormantUsers(clientId string, cutoff time.Time) ([]model.User, error) {
+	logrus.Info("GetDormantUsers")
+	var usersList []model.User
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	filter := dormantFilter(cutoff)
+	filter["clientId"] = clientId
+	opts := options.Find().SetSort(bson.D{{Key: "lastLoginDate", Value: 1}, {Key: "createdDate", Value: 1}})
+	cursor, err := entity.userRepo.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var user model.User
+		err = cursor.Decode(&user)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			usersList = append(usersList, user)
+		}
+	}
+	if usersList == nil {
+		usersList = []model.User{}
+	}
+	return usersList, nil
+}
+
+func (entity *userEntity) MarkInactivityWarned(id string) error {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	_, err := entity.userRepo.UpdateOne(ctx, bson.M{"_id": objId}, bson.M{"$set": bson.M{"inactivityWarnedDate": time.Now()}})
+	return err
+}
+
+// DisableDormantUser turns a user INACTIVE unless they signed in since cutoff in the meantime
+func (entity *userEntity) DisableDormantUser(id string, cutoff time.Time) (*model.User, error) {
+	logrus.Info("DisableDormantUser")
+	objId, _ := primitive.ObjectIDFromHex(id)
+	previous, err := entity.GetUserById(id)
+	if err != nil {
+		return nil, err
+	}
+	filter := dormantFilter(cutoff)
+	filter["_id"] = objId
+	update := bson.M{"$set": bson.M{"status": constant.INACTIVE, "updatedDate": time.Now()}}
+	var user model.User
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	err = entity.outbox.write(func(ctx context.Context) ([]model.Event, error) {
+		err := entity.userRepo.FindOneAndUpdate(ctx, filter, update, opts).Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+		return userEvents(constant.EventUserDeactivated, &user, previous, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// setContact changes the email and phone of a user, an address that changes is no longer verified
+func setContact(user *model.User, email string, phone string) {
+	if user.Email != email {
+		user.Email = email
+		user.EmailVerified = false
+	}
+	if user.Phone != phone {
+		user.Phone = phone
+		user.PhoneVerified = false
+	}
+}
+
+func userEvents(eventType string, user *model.User, previous *model.User, actorId string) ([]model.Event, error) {
+	data := model.UserEventData{
+		UserId:   user.Id.Hex(),
+		ClientId: user.ClientId,
+		Username: user.Username,
+		Role:     user.Role,
+		Status:   user.Status,
+		ActorId:  actorId,
+	}
+	if previous != nil {
+		data.PreviousRole = previous.Role
+		data.PreviousStatus = previous.Status
+	}
+	event, err := newEvent(eventType, user.ClientId, data)
+	if err != nil {
+		return nil, err
+	}
+	return []model.Event{event}, nil
+}
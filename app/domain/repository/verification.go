@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"time"
+	"um/app/domain/model"
+	"um/db"
+)
+
+type verificationEntity struct {
+	rdb *redis.Client
+}
+
+type IVerification interface {
+	CreateVerification(id string, item model.VerificationChallenge, expiration time.Duration) error
+	GetVerification(id string) (*model.VerificationChallenge, error)
+	ConsumeVerification(id string) (*model.VerificationChallenge, error)
+	CountAttempt(id string, expiration time.Duration) (int64, error)
+	StartCooldown(userId string, expiration time.Duration) (bool, error)
+}
+
+func NewVerificationEntity(resource *db.Resource) IVerification {
+	var entity IVerification = &verificationEntity{rdb: resource.RdDB}
+	return entity
+}
+
+func (entity *verificationEntity) CreateVerification(id string, item model.VerificationChallenge, expiration time.Duration) error {
+	logrus.Info("CreateVerification")
+	payload, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return entity.rdb.Set(context.Background(), "verification:challenge:"+id, payload, expiration).Err()
+}
+
+func (entity *verificationEntity) GetVerification(id string) (*model.VerificationChallenge, error) {
+	logrus.Info("GetVerification")
+	payload, err := entity.rdb.Get(context.Background(), "verification:challenge:"+id).Result()
+	if err != nil {
+		return nil, err
+	}
+	var item model.VerificationChallenge
+	err = json.Unmarshal([]byte(payload), &item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// ConsumeVerification reads and deletes a challenge in one transaction, so it can be used once
+func (entity *verificationEntity) ConsumeVerification(id string) (*model.VerificationChallenge, error) {
+	logrus.Info("ConsumeVerification")
+	ctx := context.Background()
+	key := "verification:challenge:" + id
+	var get *redis.StringCmd
+	_, err := entity.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var item model.VerificationChallenge
+	err = json.Unmarshal([]byte(get.Val()), &item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// CountAttempt counts a wrong code for a challenge and returns the number of attempts so far
+func (entity *verificationEntity) CountAttempt(id string, expiration time.Duration) (int64, error) {
+	ctx := context.Background()
+	key := "verification:attempts:" + id
+	var incr *redis.IntCmd
+	_, err := entity.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, expiration)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// StartCooldown returns false while a previous challenge of the user is too recent to send another
+func (entity *verificationEntity) StartCooldown(userId string, expiration time.Duration) (bool, error) {
+	return entity.rdb.SetNX(context.Background(), "verification:cooldown:"+userId, 1, expiration).Result()
+}
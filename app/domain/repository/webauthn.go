@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"time"
+	"um/app/domain/model"
+	"um/db"
+)
+
+type webauthnEntity struct {
+	rdb *redis.Client
+}
+
+type IWebauthn interface {
+	CreateWebauthnChallenge(id string, item model.WebauthnChallenge, expiration time.Duration) error
+	ConsumeWebauthnChallenge(id string) (*model.WebauthnChallenge, error)
+}
+
+func NewWebauthnEntity(resource *db.Resource) IWebauthn {
+	var entity IWebauthn = &webauthnEntity{rdb: resource.RdDB}
+	return entity
+}
+
+func (entity *webauthnEntity) CreateWebauthnChallenge(id string, item model.WebauthnChallenge, expiration time.Duration) error {
+	logrus.Info("CreateWebauthnChallenge")
+	payload, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return entity.rdb.Set(context.Background(), "webauthn:challenge:"+id, payload, expiration).Err()
+}
+
+// ConsumeWebauthnChallenge reads and deletes a challenge in one transaction, so it can be used once
+func (entity *webauthnEntity) ConsumeWebauthnChallenge(id string) (*model.WebauthnChallenge, error) {
+	logrus.Info("ConsumeWebauthnChallenge")
+	ctx := context.Background()
+	key := "webauthn:challenge:" + id
+	var get *redis.StringCmd
+	_, err := entity.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var item model.WebauthnChallenge
+	err = json.Unmarshal([]byte(get.Val()), &item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/db"
+)
+
+type webhookEntity struct {
+	webhookRepo *mongo.Collection
+}
+
+type IWebhook interface {
+	CreateIndex() (string, error)
+	GetWebhooksBySystemId(systemId string) ([]model.Webhook, error)
+	GetWebhookById(id string, systemId string) (*model.Webhook, error)
+	GetSubscribedWebhooks(clientId string, eventType string) ([]model.Webhook, error)
+	CreateWebhook(system *model.System, secret string, form request.Webhook) (*model.Webhook, error)
+	UpdateWebhookById(id string, systemId string, form request.UpdateWebhook) (*model.Webhook, error)
+	UpdateSecretById(id string, systemId string, secret string, updatedBy string) (*model.Webhook, error)
+	RemoveWebhookById(id string, systemId string) (*model.Webhook, error)
+	RemoveWebhooksBySystemId(systemId string) error
+}
+
+func NewWebhookEntity(resource *db.Resource) IWebhook {
+	webhookRepo := resource.UmDb.Collection("webhooks")
+	var entity IWebhook = &webhookEntity{webhookRepo: webhookRepo}
+	_, err := entity.CreateIndex()
+	if err != nil {
+		logrus.Error(err)
+	}
+	return entity
+}
+
+func (entity *webhookEntity) CreateIndex() (string, error) {
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	mods := []mongo.IndexModel{
+		{
+			Keys: bson.M{"systemId": 1},
+		},
+		{
+			Keys: bson.D{{Key: "clientId", Value: 1}, {Key: "active", Value: 1}, {Key: "events", Value: 1}},
+		},
+	}
+	ind, err := entity.webhookRepo.Indexes().CreateMany(ctx, mods)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(ind, ","), nil
+}
+
+func (entity *webhookEntity) find(filter bson.M) ([]model.Webhook, error) {
+	var items []model.Webhook
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	cursor, err := entity.webhookRepo.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(ctx) {
+		var item model.Webhook
+		err = cursor.Decode(&item)
+		if err != nil {
+			logrus.Error(err)
+			logrus.Info(cursor.Current)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if items == nil {
+		items = []model.Webhook{}
+	}
+	return items, nil
+}
+
+func (entity *webhookEntity) GetWebhooksBySystemId(systemId string) ([]model.Webhook, error) {
+	logrus.Info("GetWebhooksBySystemId")
+	objId, _ := primitive.ObjectIDFromHex(systemId)
+	return entity.find(bson.M{"systemId": objId})
+}
+
+func (entity *webhookEntity) GetWebhookById(id string, systemId string) (*model.Webhook, error) {
+	logrus.Info("GetWebhookById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.Webhook
+	objId, _ := primitive.ObjectIDFromHex(id)
+	sysId, _ := primitive.ObjectIDFromHex(systemId)
+	err := entity.webhookRepo.FindOne(ctx, bson.M{"_id": objId, "systemId": sysId}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetSubscribedWebhooks returns the active webhooks of a client that subscribe to eventType
+func (entity *webhookEntity) GetSubscribedWebhooks(clientId string, eventType string) ([]model.Webhook, error) {
+	logrus.Info("GetSubscribedWebhooks")
+	return entity.find(bson.M{
+		"clientId": clientId,
+		"active":   true,
+		"events":   bson.M{"$in": []string{eventType, constant.WebhookAllEvents}},
+	})
+}
+
+func (entity *webhookEntity) CreateWebhook(system *model.System, secret string, form request.Webhook) (*model.Webhook, error) {
+	logrus.Info("CreateWebhook")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+
+	createdBy, _ := primitive.ObjectIDFromHex(form.CreatedBy)
+	active := true
+	if form.Active != nil {
+		active = *form.Active
+	}
+	item := model.Webhook{
+		Id:          primitive.NewObjectID(),
+		SystemId:    system.Id,
+		ClientId:    system.ClientId,
+		Path:        form.Path,
+		Events:      form.Events,
+		Secret:      secret,
+		Active:      active,
+		CreatedBy:   createdBy,
+		CreatedDate: time.Now(),
+		UpdatedBy:   createdBy,
+		UpdatedDate: time.Now(),
+	}
+	_, err := entity.webhookRepo.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *webhookEntity) UpdateWebhookById(id string, systemId string, form request.UpdateWebhook) (*model.Webhook, error) {
+	logrus.Info("UpdateWebhookById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	sysId, _ := primitive.ObjectIDFromHex(systemId)
+	updatedBy, _ := primitive.ObjectIDFromHex(form.UpdatedBy)
+
+	update := bson.M{
+		"path":        form.Path,
+		"events":      form.Events,
+		"updatedBy":   updatedBy,
+		"updatedDate": time.Now(),
+	}
+	if form.Active != nil {
+		update["active"] = *form.Active
+	}
+
+	var item model.Webhook
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	err := entity.webhookRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "systemId": sysId}, bson.M{"$set": update}, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *webhookEntity) UpdateSecretById(id string, systemId string, secret string, updatedBy string) (*model.Webhook, error) {
+	logrus.Info("UpdateSecretById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	objId, _ := primitive.ObjectIDFromHex(id)
+	sysId, _ := primitive.ObjectIDFromHex(systemId)
+	updatedById, _ := primitive.ObjectIDFromHex(updatedBy)
+
+	var item model.Webhook
+	isReturnNewDoc := options.After
+	opts := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &isReturnNewDoc,
+	}
+	update := bson.M{"$set": bson.M{"secret": secret, "updatedBy": updatedById, "updatedDate": time.Now()}}
+	err := entity.webhookRepo.FindOneAndUpdate(ctx, bson.M{"_id": objId, "systemId": sysId}, update, opts).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *webhookEntity) RemoveWebhookById(id string, systemId string) (*model.Webhook, error) {
+	logrus.Info("RemoveWebhookById")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	var item model.Webhook
+	objId, _ := primitive.ObjectIDFromHex(id)
+	sysId, _ := primitive.ObjectIDFromHex(systemId)
+	err := entity.webhookRepo.FindOneAndDelete(ctx, bson.M{"_id": objId, "systemId": sysId}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (entity *webhookEntity) RemoveWebhooksBySystemId(systemId string) error {
+	logrus.Info("RemoveWebhooksBySystemId")
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	sysId, _ := primitive.ObjectIDFromHex(systemId)
+	_, err := entity.webhookRepo.DeleteMany(ctx, bson.M{"systemId": sysId})
+	return err
+}
@@ -0,0 +1,243 @@
+package usecase
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+// ResolveApiKey authenticates a request with an X-API-Key header as the owner of the key, so that
+// RequireAuthenticated and RequireSession accept it without an access token. Requests without the
+// header are left to them.
+func ResolveApiKey(apiKeyEntity repository.IApiKey, userEntity repository.IUser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(constant.ApiKeyHeader)
+		if key == "" {
+			return
+		}
+		apiKey, err := apiKeyEntity.GetApiKeyByHash(utils.HashToken(key))
+		if err != nil || apiKey.RevokedDate != nil || time.Now().After(apiKey.ExpireDate) {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+			return
+		}
+		ip := ctx.ClientIP()
+		if !apiKeyAllowsIp(apiKey.AllowedIps, ip) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "api key not allowed from " + ip})
+			return
+		}
+		area, access := apiKeyAccess(ctx)
+		if area == "" {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "api keys can't be used on this endpoint"})
+			return
+		}
+		if !apiKeyAllowsScope(apiKey.Scopes, area, access) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "api key is missing scope " + area + ":" + access})
+			return
+		}
+		user, err := userEntity.GetUserById(apiKey.UserId.Hex())
+		if err != nil || !isUserActive(user) {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+			return
+		}
+		if apiKey.LastUsedDate == nil || time.Since(*apiKey.LastUsedDate) > config.ApiKeyTouchTime || apiKey.LastUsedIp != ip {
+			err = apiKeyEntity.TouchApiKey(apiKey.Id, ip)
+			if err != nil {
+				logrus.Error(err)
+			}
+		}
+
+		ctx.Set(middlewares.ApiKeyId, apiKey.Id.Hex())
+		ctx.Set(middlewares.UserId, user.Id.Hex())
+		ctx.Set(middlewares.Role, user.Role)
+		ctx.Set(middlewares.ClientId, user.ClientId)
+
+		logrus.Info("ApiKeyId: " + apiKey.Id.Hex())
+		logrus.Info("UserId: " + user.Id.Hex())
+		logrus.Info("Role: " + user.Role)
+		logrus.Info("ClientId: " + user.ClientId)
+	}
+}
+
+func GetApiKeys(apiKeyEntity repository.IApiKey) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		result, err := apiKeyEntity.GetApiKeysByUserId(ctx.GetString(middlewares.UserId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// AddApiKey issues a key for the signed-in user, it is only returned here
+func AddApiKey(apiKeyEntity repository.IApiKey, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.ApiKey{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		err = validateApiKey(req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		key, err := utils.GenerateSecret(constant.ApiKeyPrefix, 32)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.UserId = ctx.GetString(middlewares.UserId)
+		req.ClientId = ctx.GetString(middlewares.ClientId)
+		prefix := key[:len(constant.ApiKeyPrefix)+6]
+		result, err := apiKeyEntity.CreateApiKey(req, utils.HashToken(key), prefix)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditApiKeyCreate, constant.TargetApiKey, result.Id.Hex(), result.ClientId, nil, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"apiKey": result,
+			"key":    key,
+		})
+	}
+}
+
+func RevokeApiKey(apiKeyEntity repository.IApiKey, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		result, err := apiKeyEntity.RevokeApiKey(id, ctx.GetString(middlewares.UserId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditApiKeyRevoke, constant.TargetApiKey, id, result.ClientId, nil, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func GetUserApiKeys(apiKeyEntity repository.IApiKey, userEntity repository.IUser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		_, err := userEntity.GetUserByClientId(id, ctx.GetString(middlewares.ClientId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result, err := apiKeyEntity.GetApiKeysByUserId(id)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// RevokeUserApiKey lets an admin revoke a key of a user of the client
+func RevokeUserApiKey(apiKeyEntity repository.IApiKey, userEntity repository.IUser, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		keyId := ctx.Param("keyId")
+		_, err := userEntity.GetUserByClientId(id, ctx.GetString(middlewares.ClientId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result, err := apiKeyEntity.RevokeApiKey(keyId, id)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditApiKeyRevoke, constant.TargetApiKey, keyId, result.ClientId, nil, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func validateApiKey(req request.ApiKey) error {
+	if !req.ExpireDate.After(time.Now()) {
+		return errors.New("expireDate must be in the future")
+	}
+	if req.ExpireDate.After(time.Now().Add(config.ApiKeyMaxTime)) {
+		return errors.New("expireDate can't be more than " + config.ApiKeyMaxTime.String() + " away")
+	}
+	for _, scope := range req.Scopes {
+		area, access, _ := strings.Cut(scope, ":")
+		if !containsString(constant.ApiKeyAreas, area) || (access != constant.ApiKeyRead && access != constant.ApiKeyWrite) {
+			return errors.New("invalid scope " + scope)
+		}
+	}
+	for _, allowedIp := range req.AllowedIps {
+		if _, _, err := net.ParseCIDR(allowedIp); err == nil {
+			continue
+		}
+		if net.ParseIP(allowedIp) == nil {
+			return errors.New("invalid ip " + allowedIp)
+		}
+	}
+	return nil
+}
+
+// apiKeyAccess returns the area of the route, the first segment of its path, and the access the
+// request needs. The area is empty on routes API keys can't be used on.
+func apiKeyAccess(ctx *gin.Context) (string, string) {
+	path := strings.TrimPrefix(ctx.FullPath(), oidcBasePath+"/")
+	area, _, _ := strings.Cut(path, "/")
+	if !containsString(constant.ApiKeyAreas, area) {
+		return "", ""
+	}
+	if ctx.Request.Method == http.MethodGet || ctx.Request.Method == http.MethodHead {
+		return area, constant.ApiKeyRead
+	}
+	return area, constant.ApiKeyWrite
+}
+
+// apiKeyAllowsScope checks the scopes of a key, write includes read and no scopes allow everything
+func apiKeyAllowsScope(scopes []string, area string, access string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, scope := range scopes {
+		if scope == area+":"+constant.ApiKeyWrite || scope == area+":"+access {
+			return true
+		}
+	}
+	return false
+}
+
+func apiKeyAllowsIp(allowedIps []string, ip string) bool {
+	if len(allowedIps) == 0 {
+		return true
+	}
+	address := net.ParseIP(ip)
+	if address == nil {
+		return false
+	}
+	for _, allowedIp := range allowedIps {
+		if _, network, err := net.ParseCIDR(allowedIp); err == nil {
+			if network.Contains(address) {
+				return true
+			}
+		} else if allowed := net.ParseIP(allowedIp); allowed != nil && allowed.Equal(address) {
+			return true
+		}
+	}
+	return false
+}
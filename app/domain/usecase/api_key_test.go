@@ -0,0 +1,127 @@
+package usecase
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+	"um/app/featues/request"
+)
+
+func TestApiKeyAccess(t *testing.T) {
+	router := gin.New()
+	access := func(ctx *gin.Context) {
+		area, access := apiKeyAccess(ctx)
+		ctx.String(http.StatusOK, area+":"+access)
+	}
+	for _, path := range []string{"/user/profile", "/admin/user/:id", "/super/user/:id", "/system", "/job/:id", "/authz/check", "/auth/login", "/scim/v2/Users", "/oauth/token"} {
+		router.Any(oidcBasePath+path, access)
+	}
+	router.GET("/user/profile", access)
+
+	for _, test := range []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodGet, "/user/profile", "user:read"},
+		{http.MethodHead, "/user/profile", "user:read"},
+		{http.MethodPut, "/user/profile", "user:write"},
+		{http.MethodGet, "/admin/user/1", "admin:read"},
+		{http.MethodDelete, "/admin/user/1", "admin:write"},
+		{http.MethodPost, "/system", "system:write"},
+		{http.MethodPatch, "/job/1", "job:write"},
+		{http.MethodPost, "/authz/check", "authz:write"},
+		{http.MethodGet, "/super/user/1", ":"},
+		{http.MethodDelete, "/super/user/1", ":"},
+		{http.MethodPost, "/auth/login", ":"},
+		{http.MethodGet, "/scim/v2/Users", ":"},
+		{http.MethodPost, "/oauth/token", ":"},
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(test.method, oidcBasePath+test.path, nil))
+		if got := recorder.Body.String(); got != test.want {
+			t.Errorf("%s %s: %q, want %q", test.method, test.path, got, test.want)
+		}
+	}
+
+	// only routes under the API base path have an area
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user/profile", nil))
+	if got := recorder.Body.String(); got != ":" {
+		t.Errorf("route outside the API: %q, want no area", got)
+	}
+}
+
+func TestApiKeyAllowsScope(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		scopes []string
+		area   string
+		access string
+		allow  bool
+	}{
+		{"no scopes", nil, "admin", constant.ApiKeyWrite, true},
+		{"read scope on a read", []string{"admin:read"}, "admin", constant.ApiKeyRead, true},
+		{"read scope on a write", []string{"admin:read"}, "admin", constant.ApiKeyWrite, false},
+		{"write scope on a read", []string{"admin:write"}, "admin", constant.ApiKeyRead, true},
+		{"write scope on a write", []string{"admin:write"}, "admin", constant.ApiKeyWrite, true},
+		{"scope of another area", []string{"user:write"}, "admin", constant.ApiKeyRead, false},
+		{"one of several scopes", []string{"user:read", "authz:write"}, "authz", constant.ApiKeyWrite, true},
+		{"scope in another case", []string{"Admin:Read"}, "admin", constant.ApiKeyRead, false},
+		{"area without access", []string{"admin"}, "admin", constant.ApiKeyRead, false},
+	} {
+		if allow := apiKeyAllowsScope(test.scopes, test.area, test.access); allow != test.allow {
+			t.Errorf("%s: %v, want %v", test.name, allow, test.allow)
+		}
+	}
+}
+
+func TestApiKeyAllowsIp(t *testing.T) {
+	allowedIps := []string{"192.0.2.10", "198.51.100.0/24", "2001:db8::/32"}
+	for _, test := range []struct {
+		name       string
+		allowedIps []string
+		ip         string
+		allow      bool
+	}{
+		{"no restriction", nil, "203.0.113.7", true},
+		{"exact address", allowedIps, "192.0.2.10", true},
+		{"next to the exact address", allowedIps, "192.0.2.11", false},
+		{"inside the network", allowedIps, "198.51.100.200", true},
+		{"outside the network", allowedIps, "198.51.101.1", false},
+		{"IPv6 inside the network", allowedIps, "2001:db8::1", true},
+		{"IPv6 outside the network", allowedIps, "2001:db9::1", false},
+		{"IPv4 mapped IPv6", allowedIps, "::ffff:192.0.2.10", true},
+		{"not an address", allowedIps, "localhost", false},
+		{"no address", allowedIps, "", false},
+		{"unparsable entry", []string{"192.0.2.0/33"}, "192.0.2.1", false},
+	} {
+		if allow := apiKeyAllowsIp(test.allowedIps, test.ip); allow != test.allow {
+			t.Errorf("%s: %v, want %v", test.name, allow, test.allow)
+		}
+	}
+}
+
+func TestValidateApiKeyScopes(t *testing.T) {
+	for _, test := range []struct {
+		scope string
+		valid bool
+	}{
+		{"admin:read", true},
+		{"authz:write", true},
+		{"super:read", false},
+		{"super:write", false},
+		{"scim:read", false},
+		{"admin:delete", false},
+		{"admin", false},
+	} {
+		req := request.ApiKey{ExpireDate: time.Now().Add(time.Hour), Scopes: []string{test.scope}}
+		if err := validateApiKey(req); (err == nil) != test.valid {
+			t.Errorf("%s: %v, want valid %v", test.scope, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package usecase
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"time"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+var attributeKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+func GetAttributeSchemas(attributeEntity repository.IAttribute) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		clientId := ctx.GetString(middlewares.ClientId)
+		result, err := attributeEntity.GetAttributeSchemas(clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func AddAttributeSchema(attributeEntity repository.IAttribute, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.AttributeSchema{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !attributeKeyPattern.MatchString(req.Key) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "key must start with a letter and only have letters, digits and _"})
+			return
+		}
+		err = checkAttributeRules(req.Type, req.Pattern, req.Enum)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		clientId := ctx.GetString(middlewares.ClientId)
+		count, err := attributeEntity.CountAttributeSchemas(clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if count >= constant.AttributeLimit {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "too many attributes"})
+			return
+		}
+
+		req.ClientId = clientId
+		req.CreatedBy = ctx.GetString(middlewares.UserId)
+		result, err := attributeEntity.CreateAttributeSchema(req)
+		if mongo.IsDuplicateKeyError(err) {
+			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "attribute key is taken"})
+			return
+		}
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditAttributeCreate, constant.TargetAttribute, result.Id.Hex(), clientId, nil, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// UpdateAttributeSchemaById changes the rules of an attribute, they apply to the values written from
+// now on, stored values aren't checked again but for being unique
+func UpdateAttributeSchemaById(attributeEntity repository.IAttribute, userEntity repository.IUser, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.UpdateAttributeSchema{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		id := ctx.Param("id")
+		clientId := ctx.GetString(middlewares.ClientId)
+		before, err := attributeEntity.GetAttributeSchemaById(id, clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		err = checkAttributeRules(before.Type, req.Pattern, req.Enum)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// an attribute becoming unique claims the values already stored, one that no longer is
+		// releases them
+		indexed := req.Unique && !before.Unique
+		if indexed {
+			err = userEntity.IndexAttributeValues(clientId, before.Key)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		req.UpdatedBy = ctx.GetString(middlewares.UserId)
+		result, err := attributeEntity.UpdateAttributeSchemaById(id, clientId, req)
+		if err != nil {
+			if indexed {
+				_ = userEntity.ReleaseAttributeValues(clientId, before.Key)
+			}
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if before.Unique && !req.Unique {
+			err = userEntity.ReleaseAttributeValues(clientId, before.Key)
+			if err != nil {
+				logrus.Error(err)
+			}
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditAttributeUpdate, constant.TargetAttribute, id, clientId, before, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// DeleteAttributeSchemaById removes an attribute and its values from every user of the client
+func DeleteAttributeSchemaById(attributeEntity repository.IAttribute, userEntity repository.IUser, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		clientId := ctx.GetString(middlewares.ClientId)
+		result, err := attributeEntity.RemoveAttributeSchemaById(id, clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		err = userEntity.RemoveAttribute(clientId, result.Key)
+		if err != nil {
+			logrus.Error(err)
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditAttributeDelete, constant.TargetAttribute, id, clientId, result, nil) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// checkAttributeRules makes sure the pattern compiles and that pattern and enum are only set on
+// string attributes
+func checkAttributeRules(attributeType string, pattern string, enum []string) error {
+	if attributeType != constant.AttributeString && (pattern != "" || len(enum) > 0) {
+		return errors.New("pattern and enum only apply to string attributes")
+	}
+	if pattern != "" {
+		_, err := regexp.Compile(pattern)
+		if err != nil {
+			return errors.New("invalid pattern: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// validateAttributes checks the attribute values of a user against the schemas of the client and
+// returns the keys of the unique ones, which the repository claims when it saves the user. Through
+// /user/info (self) the attributes that aren't editable keep their current value, and required ones
+// are left to the ADMIN.
+func validateAttributes(
+	attributeEntity repository.IAttribute,
+	userEntity repository.IUser,
+	clientId string,
+	userId string,
+	values map[string]interface{},
+	current map[string]interface{},
+	self bool,
+) ([]string, error) {
+	schemas, err := attributeEntity.GetAttributeSchemas(clientId)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, schema := range schemas {
+		known[schema.Key] = true
+	}
+	for key := range values {
+		if !known[key] {
+			return nil, errors.New("unknown attribute " + key)
+		}
+	}
+
+	uniqueKeys := []string{}
+	for _, schema := range schemas {
+		if schema.Unique {
+			uniqueKeys = append(uniqueKeys, schema.Key)
+		}
+		value, ok := values[schema.Key]
+		if ok && value == nil {
+			delete(values, schema.Key)
+			ok = false
+		}
+		if self && !schema.Editable {
+			previous, found := current[schema.Key]
+			if ok && (!found || !reflect.DeepEqual(value, previous)) {
+				return nil, errors.New("attribute " + schema.Key + " can't be changed")
+			}
+			if found {
+				values[schema.Key] = previous
+			}
+			continue
+		}
+		if !ok {
+			if schema.Required {
+				return nil, errors.New("attribute " + schema.Key + " is required")
+			}
+			continue
+		}
+		err = checkAttributeValue(schema, value)
+		if err != nil {
+			return nil, err
+		}
+		if schema.Unique {
+			taken, err := userEntity.IsAttributeTaken(clientId, schema.Key, value, userId)
+			if err != nil {
+				return nil, err
+			}
+			if taken {
+				return nil, errors.New("attribute " + schema.Key + " is already used")
+			}
+		}
+	}
+	return uniqueKeys, nil
+}
+
+func checkAttributeValue(schema model.AttributeSchema, value interface{}) error {
+	invalid := errors.New("attribute " + schema.Key + " must be a " + schema.Type)
+	switch schema.Type {
+	case constant.AttributeNumber:
+		if _, ok := value.(float64); !ok {
+			return invalid
+		}
+	case constant.AttributeBoolean:
+		if _, ok := value.(bool); !ok {
+			return invalid
+		}
+	case constant.AttributeDate:
+		text, ok := value.(string)
+		if !ok {
+			return invalid
+		}
+		_, err := time.Parse(constant.AttributeDateLayout, text)
+		if err != nil {
+			return errors.New("attribute " + schema.Key + " must be a date as " + constant.AttributeDateLayout)
+		}
+	default:
+		text, ok := value.(string)
+		if !ok {
+			return invalid
+		}
+		if schema.Pattern != "" {
+			// the pattern has to match the whole value
+			matched, err := regexp.MatchString("^(?:"+schema.Pattern+")$", text)
+			if err != nil || !matched {
+				return errors.New("attribute " + schema.Key + " doesn't match its pattern")
+			}
+		}
+		if len(schema.Enum) > 0 && !containsString(schema.Enum, text) {
+			return errors.New("attribute " + schema.Key + " must be one of its enum values")
+		}
+	}
+	return nil
+}
+
+// attributeFilter turns the attributes[key]=value query of a listing into values of the attribute
+// types
+func attributeFilter(attributeEntity repository.IAttribute, clientId string, query map[string]string) (map[string]interface{}, error) {
+	if len(query) == 0 {
+		return nil, nil
+	}
+	schemas, err := attributeEntity.GetAttributeSchemas(clientId)
+	if err != nil {
+		return nil, err
+	}
+	types := map[string]string{}
+	for _, schema := range schemas {
+		types[schema.Key] = schema.Type
+	}
+	filter := map[string]interface{}{}
+	for key, text := range query {
+		attributeType, ok := types[key]
+		if !ok {
+			return nil, errors.New("unknown attribute " + key)
+		}
+		switch attributeType {
+		case constant.AttributeNumber:
+			number, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, errors.New("attribute " + key + " must be a number")
+			}
+			filter[key] = number
+		case constant.AttributeBoolean:
+			flag, err := strconv.ParseBool(text)
+			if err != nil {
+				return nil, errors.New("attribute " + key + " must be a boolean")
+			}
+			filter[key] = flag
+		default:
+			filter[key] = text
+		}
+	}
+	return filter, nil
+}
+
+// attributeClaims picks the attributes of a user that the client emits as claims, a token is still
+// issued without them when the schemas can't be read
+func attributeClaims(attributeEntity repository.IAttribute, user *model.User) map[string]interface{} {
+	if len(user.Attributes) == 0 {
+		return nil
+	}
+	schemas, err := attributeEntity.GetAttributeSchemas(user.ClientId)
+	if err != nil {
+		logrus.Error(err)
+		return nil
+	}
+	claims := map[string]interface{}{}
+	for _, schema := range schemas {
+		value, ok := user.Attributes[schema.Key]
+		if schema.Claim && ok {
+			claims[schema.Key] = value
+		}
+	}
+	if len(claims) == 0 {
+		return nil
+	}
+	return claims
+}
@@ -0,0 +1,328 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+// IsAttributeTaken looks at the values stored on the users, as attribute_values holds them
+func (fake *fakeUsers) IsAttributeTaken(clientId string, key string, value interface{}, excludeId string) (bool, error) {
+	_, err := fake.find(func(user *model.User) bool {
+		stored, ok := user.Attributes[key]
+		return user.ClientId == clientId && user.Id.Hex() != excludeId && ok && reflect.DeepEqual(stored, value)
+	})
+	return err == nil, nil
+}
+
+func (fake *fakeUsers) GetUserAll(clientId string, attributes map[string]interface{}) ([]model.User, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	users := []model.User{}
+	for _, user := range fake.users {
+		matched := user.ClientId == clientId && user.Role != constant.SUPER
+		for key, value := range attributes {
+			stored, ok := user.Attributes[key]
+			matched = matched && ok && reflect.DeepEqual(stored, value)
+		}
+		if matched {
+			users = append(users, *fake.copyOf(user))
+		}
+	}
+	return users, nil
+}
+
+func (fake *fakeAttributes) GetAttributeSchemaById(id string, clientId string) (*model.AttributeSchema, error) {
+	for _, schema := range fake.schemas {
+		if schema.Id.Hex() == id && schema.ClientId == clientId {
+			return &schema, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (fake *fakeAttributes) UpdateAttributeSchemaById(id string, clientId string, form request.UpdateAttributeSchema) (*model.AttributeSchema, error) {
+	for i, schema := range fake.schemas {
+		if schema.Id.Hex() == id && schema.ClientId == clientId {
+			fake.schemas[i].Unique = form.Unique
+			fake.schemas[i].Pattern = form.Pattern
+			fake.schemas[i].Enum = form.Enum
+			return &fake.schemas[i], nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+// fakeAttributeValues records the attributes whose values are claimed or released
+type fakeAttributeValues struct {
+	*fakeUsers
+	indexed  []string
+	released []string
+}
+
+func (fake *fakeAttributeValues) IndexAttributeValues(clientId string, key string) error {
+	seen := map[interface{}]bool{}
+	for _, user := range fake.users {
+		value, ok := user.Attributes[key]
+		if !ok || user.ClientId != clientId {
+			continue
+		}
+		if seen[value] {
+			return errors.New("users of the client share values of attribute " + key)
+		}
+		seen[value] = true
+	}
+	fake.indexed = append(fake.indexed, key)
+	return nil
+}
+
+func (fake *fakeAttributeValues) ReleaseAttributeValues(clientId string, key string) error {
+	fake.released = append(fake.released, key)
+	return nil
+}
+
+func attributeSchemas() []model.AttributeSchema {
+	return []model.AttributeSchema{
+		{ClientId: "ACM", Key: "branch", Type: constant.AttributeString, Required: true, Pattern: "[A-Z]{3}", Enum: []string{"BKK", "CNX", "cnx"}, Editable: true},
+		{ClientId: "ACM", Key: "employeeNo", Type: constant.AttributeString, Unique: true, Pattern: `E\d{4}`},
+		{ClientId: "ACM", Key: "level", Type: constant.AttributeNumber, Editable: true},
+		{ClientId: "ACM", Key: "manager", Type: constant.AttributeBoolean, Editable: true},
+		{ClientId: "ACM", Key: "hired", Type: constant.AttributeDate, Editable: true},
+		{ClientId: "ACM", Key: "badge", Type: constant.AttributeNumber, Unique: true, Editable: true},
+	}
+}
+
+func TestCheckAttributeValue(t *testing.T) {
+	schemas := map[string]model.AttributeSchema{}
+	for _, schema := range attributeSchemas() {
+		schemas[schema.Key] = schema
+	}
+	for _, test := range []struct {
+		key   string
+		value interface{}
+		valid bool
+	}{
+		{"level", float64(3), true},
+		{"level", "3", false},
+		{"level", true, false},
+		{"manager", false, true},
+		{"manager", "true", false},
+		{"manager", float64(1), false},
+		{"hired", "2024-02-29", true},
+		{"hired", "2023-02-29", false},
+		{"hired", "2024-2-1", false},
+		{"hired", "2024-02-01T00:00:00Z", false},
+		{"hired", float64(20240201), false},
+		{"employeeNo", "E1024", true},
+		// the pattern has to match the whole value
+		{"employeeNo", "E10245", false},
+		{"employeeNo", "xE1024", false},
+		{"employeeNo", "e1024", false},
+		{"employeeNo", float64(1024), false},
+		{"branch", "BKK", true},
+		{"branch", "CNX", true},
+		// the value has to be in the enum and match the pattern
+		{"branch", "HKT", false},
+		{"branch", "cnx", false},
+		{"branch", "bkk", false},
+	} {
+		err := checkAttributeValue(schemas[test.key], test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("%s %#v: %v, want valid %v", test.key, test.value, err, test.valid)
+		}
+	}
+}
+
+func TestCheckAttributeRules(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		attributeType string
+		pattern       string
+		enum          []string
+		valid         bool
+	}{
+		{"string with a pattern and an enum", constant.AttributeString, "[A-Z]{3}", []string{"BKK"}, true},
+		{"number without rules", constant.AttributeNumber, "", nil, true},
+		{"number with a pattern", constant.AttributeNumber, `\d+`, nil, false},
+		{"date with an enum", constant.AttributeDate, "", []string{"2024-01-01"}, false},
+		{"pattern that doesn't compile", constant.AttributeString, "[A-Z", nil, false},
+	} {
+		err := checkAttributeRules(test.attributeType, test.pattern, test.enum)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestValidateAttributes(t *testing.T) {
+	attributes := &fakeAttributes{schemas: attributeSchemas()}
+	jane := &model.User{Id: primitive.NewObjectID(), ClientId: "ACM", Attributes: map[string]interface{}{"branch": "BKK", "employeeNo": "E1024", "badge": float64(7)}}
+	john := &model.User{Id: primitive.NewObjectID(), ClientId: "ACM", Attributes: map[string]interface{}{"branch": "CNX", "employeeNo": "E2048"}}
+	jim := &model.User{Id: primitive.NewObjectID(), ClientId: "GLB", Attributes: map[string]interface{}{"employeeNo": "E4096"}}
+	users := newFakeUsers(jane, john, jim)
+
+	for _, test := range []struct {
+		name    string
+		userId  string
+		values  map[string]interface{}
+		current map[string]interface{}
+		self    bool
+		err     string
+		want    map[string]interface{}
+	}{
+		{"valid values", "", map[string]interface{}{"branch": "CNX", "level": float64(2), "employeeNo": "E4096"}, nil, false, "",
+			map[string]interface{}{"branch": "CNX", "level": float64(2), "employeeNo": "E4096"}},
+		{"unknown attribute", "", map[string]interface{}{"branch": "CNX", "team": "red"}, nil, false, "unknown attribute team", nil},
+		{"missing required attribute", "", map[string]interface{}{"level": float64(2)}, nil, false, "attribute branch is required", nil},
+		{"null required attribute", "", map[string]interface{}{"branch": nil}, nil, false, "attribute branch is required", nil},
+		{"null removes a value", "", map[string]interface{}{"branch": "CNX", "level": nil}, nil, false, "",
+			map[string]interface{}{"branch": "CNX"}},
+		{"invalid type", "", map[string]interface{}{"branch": "CNX", "level": "2"}, nil, false, "attribute level must be a number", nil},
+		{"unique value of another user", "", map[string]interface{}{"branch": "CNX", "employeeNo": "E2048"}, nil, false, "attribute employeeNo is already used", nil},
+		{"unique number of another user", "", map[string]interface{}{"branch": "CNX", "badge": float64(7)}, nil, false, "attribute badge is already used", nil},
+		{"unique value kept by its user", john.Id.Hex(), map[string]interface{}{"branch": "CNX", "employeeNo": "E2048"}, nil, false, "",
+			map[string]interface{}{"branch": "CNX", "employeeNo": "E2048"}},
+		{"unique value of another client", "", map[string]interface{}{"branch": "CNX", "employeeNo": "E4096"}, nil, false, "",
+			map[string]interface{}{"branch": "CNX", "employeeNo": "E4096"}},
+		{"self keeps a value it can't edit", jane.Id.Hex(), map[string]interface{}{"branch": "CNX"}, jane.Attributes, true, "",
+			map[string]interface{}{"branch": "CNX", "employeeNo": "E1024"}},
+		{"self changes a value it can't edit", jane.Id.Hex(), map[string]interface{}{"branch": "CNX", "employeeNo": "E9999"}, jane.Attributes, true, "attribute employeeNo can't be changed", nil},
+		{"self sets a value it can't edit", jane.Id.Hex(), map[string]interface{}{"branch": "CNX", "employeeNo": "E9999"}, map[string]interface{}{}, true, "attribute employeeNo can't be changed", nil},
+	} {
+		values := map[string]interface{}{}
+		for key, value := range test.values {
+			values[key] = value
+		}
+		uniqueKeys, err := validateAttributes(attributes, users, "ACM", test.userId, values, test.current, test.self)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: %v, want %s", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(values, test.want) {
+			t.Errorf("%s: values %v, want %v", test.name, values, test.want)
+		}
+		// the repository claims the unique keys present in the values
+		sort.Strings(uniqueKeys)
+		if strings.Join(uniqueKeys, ",") != "badge,employeeNo" {
+			t.Errorf("%s: unique keys %v, want badge and employeeNo", test.name, uniqueKeys)
+		}
+	}
+}
+
+func TestGetUsersByAttributes(t *testing.T) {
+	attributes := &fakeAttributes{schemas: attributeSchemas()}
+	jane := &model.User{Id: primitive.NewObjectID(), Username: "jane", ClientId: "ACM", Role: constant.USER, Attributes: map[string]interface{}{"branch": "BKK", "level": float64(3), "manager": true}}
+	john := &model.User{Id: primitive.NewObjectID(), Username: "john", ClientId: "ACM", Role: constant.USER, Attributes: map[string]interface{}{"branch": "BKK", "level": float64(2), "manager": false}}
+	joan := &model.User{Id: primitive.NewObjectID(), Username: "joan", ClientId: "ACM", Role: constant.ADMIN, Attributes: map[string]interface{}{"branch": "CNX", "level": float64(3)}}
+	jim := &model.User{Id: primitive.NewObjectID(), Username: "jim", ClientId: "GLB", Role: constant.USER, Attributes: map[string]interface{}{"branch": "BKK"}}
+	router := gin.New()
+	router.GET("/admin/user", func(ctx *gin.Context) {
+		ctx.Set(middlewares.ClientId, "ACM")
+	}, GetUsersByClientId(newFakeUsers(jane, john, joan, jim), attributes))
+
+	for _, test := range []struct {
+		query  string
+		status int
+		want   string
+	}{
+		{"", http.StatusOK, "jane,joan,john"},
+		{"attributes[branch]=BKK", http.StatusOK, "jane,john"},
+		{"attributes[level]=3", http.StatusOK, "jane,joan"},
+		{"attributes[level]=3.0", http.StatusOK, "jane,joan"},
+		{"attributes[manager]=true", http.StatusOK, "jane"},
+		{"attributes[manager]=false&attributes[branch]=BKK", http.StatusOK, "john"},
+		{"attributes[branch]=BKK&attributes[level]=3", http.StatusOK, "jane"},
+		{"attributes[branch]=HKT", http.StatusOK, ""},
+		{"attributes[level]=three", http.StatusBadRequest, ""},
+		{"attributes[manager]=maybe", http.StatusBadRequest, ""},
+		{"attributes[team]=red", http.StatusBadRequest, ""},
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/user?"+test.query, nil))
+		if recorder.Code != test.status {
+			t.Errorf("%q: answered %d %s, want %d", test.query, recorder.Code, recorder.Body.String(), test.status)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		var users []model.User
+		_ = json.Unmarshal(recorder.Body.Bytes(), &users)
+		names := []string{}
+		for _, user := range users {
+			names = append(names, user.Username)
+		}
+		sort.Strings(names)
+		if got := strings.Join(names, ","); got != test.want {
+			t.Errorf("%q: listed %s, want %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestUpdateAttributeSchemaUnique(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		key      string
+		unique   bool
+		status   int
+		indexed  string
+		released string
+	}{
+		{"becomes unique", "level", true, http.StatusOK, "level", ""},
+		{"becomes unique with shared values", "branch", true, http.StatusConflict, "", ""},
+		{"stays unique", "employeeNo", true, http.StatusOK, "", ""},
+		{"no longer unique", "employeeNo", false, http.StatusOK, "", "employeeNo"},
+		{"stays not unique", "manager", false, http.StatusOK, "", ""},
+	} {
+		schemas := attributeSchemas()
+		var schema model.AttributeSchema
+		for i := range schemas {
+			schemas[i].Id = primitive.NewObjectID()
+			if schemas[i].Key == test.key {
+				schema = schemas[i]
+			}
+		}
+		attributes := &fakeAttributes{schemas: schemas}
+		users := &fakeAttributeValues{fakeUsers: newFakeUsers(
+			&model.User{Id: primitive.NewObjectID(), ClientId: "ACM", Attributes: map[string]interface{}{"branch": "BKK", "level": float64(1)}},
+			&model.User{Id: primitive.NewObjectID(), ClientId: "ACM", Attributes: map[string]interface{}{"branch": "BKK", "level": float64(2)}},
+		)}
+		router := gin.New()
+		router.PUT("/admin/attribute/:id", func(ctx *gin.Context) {
+			ctx.Set(middlewares.ClientId, "ACM")
+		}, UpdateAttributeSchemaById(attributes, users, &fakeAudit{}))
+
+		status, body := serveJson(t, router, http.MethodPut, "/admin/attribute/"+schema.Id.Hex(), gin.H{"unique": test.unique, "pattern": schema.Pattern, "enum": schema.Enum})
+		if status != test.status {
+			t.Errorf("%s: answered %d %v, want %d", test.name, status, body, test.status)
+		}
+		if got := strings.Join(users.indexed, ","); got != test.indexed {
+			t.Errorf("%s: claimed the values of %q, want %q", test.name, got, test.indexed)
+		}
+		if got := strings.Join(users.released, ","); got != test.released {
+			t.Errorf("%s: released the values of %q, want %q", test.name, got, test.released)
+		}
+		if updated, _ := attributes.GetAttributeSchemaById(schema.Id.Hex(), "ACM"); updated.Unique != (test.unique && test.status == http.StatusOK || schema.Unique && test.status != http.StatusOK) {
+			t.Errorf("%s: unique %v", test.name, updated.Unique)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+// auditIgnoredFields are bookkeeping fields that change on every write and carry no information
+var auditIgnoredFields = map[string]bool{
+	"updatedBy":   true,
+	"updatedDate": true,
+}
+
+func GetAuditEvents(auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.GetAuditEvents{}
+		err := ctx.ShouldBindQuery(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result, err := auditEntity.GetEvents(req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func GetClientAuditEvents(auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.GetAuditEvents{}
+		err := ctx.ShouldBindQuery(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.ClientId = ctx.GetString(middlewares.ClientId)
+		result, err := auditEntity.GetEvents(req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func VerifyAuditChain(auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		result, err := auditEntity.VerifyChain()
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// recordAudit appends an event for a mutation that already succeeded. The mutation isn't undone
+// when the event can't be written, the request answers 500 so the caller knows the log misses it.
+func recordAudit(
+	ctx *gin.Context,
+	auditEntity repository.IAudit,
+	action string,
+	targetType string,
+	targetId string,
+	clientId string,
+	before interface{},
+	after interface{},
+) bool {
+	err := appendAudit(ctx, auditEntity, action, targetType, targetId, clientId, before, after)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// appendAudit is recordAudit for helpers answering through their own error path. The event of a
+// failure is logged in full so it can be found later.
+func appendAudit(
+	ctx *gin.Context,
+	auditEntity repository.IAudit,
+	action string,
+	targetType string,
+	targetId string,
+	clientId string,
+	before interface{},
+	after interface{},
+) error {
+	item := newAuditEvent(ctx, action, targetType, targetId, clientId)
+	item.Diff = auditDiff(before, after)
+	_, err := auditEntity.CreateEvent(item)
+	if err != nil {
+		logrus.WithField("event", item).Error("audit event lost: " + err.Error())
+		return errors.New("the change is saved but its audit event is not: " + err.Error())
+	}
+	return nil
+}
+
+// newAuditEvent fills the actor and request of an event from the request context
+func newAuditEvent(ctx *gin.Context, action string, targetType string, targetId string, clientId string) model.AuditEvent {
+	return model.AuditEvent{
+		ClientId:       clientId,
+		ActorId:        ctx.GetString(middlewares.UserId),
+		ImpersonatorId: ctx.GetString(middlewares.Actor),
+		Action:         action,
+		TargetType:     targetType,
+		TargetId:       targetId,
+		Diff:           map[string]model.AuditChange{},
+		Ip:             ctx.ClientIP(),
+		UserAgent:      ctx.Request.UserAgent(),
+		RequestId:      ctx.GetString(middlewares.RequestId),
+	}
+}
+
+// auditDiff compares the JSON representation of two documents, which keeps fields hidden
+// from the API such as password out of the log
+func auditDiff(before interface{}, after interface{}) map[string]model.AuditChange {
+	beforeFields := auditFields(before)
+	afterFields := auditFields(after)
+	diff := map[string]model.AuditChange{}
+	for key, value := range beforeFields {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		to, ok := afterFields[key]
+		if !ok {
+			to = json.RawMessage("null")
+		}
+		if !bytes.Equal(value, to) {
+			diff[key] = model.AuditChange{From: value, To: to}
+		}
+	}
+	for key, value := range afterFields {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		if _, ok := beforeFields[key]; !ok {
+			diff[key] = model.AuditChange{From: json.RawMessage("null"), To: value}
+		}
+	}
+	return diff
+}
+
+func auditFields(item interface{}) map[string]json.RawMessage {
+	fields := map[string]json.RawMessage{}
+	if item == nil {
+		return fields
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		logrus.Error(err)
+		return fields
+	}
+	if string(data) == "null" {
+		return fields
+	}
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		logrus.Error(err)
+	}
+	return fields
+}
@@ -0,0 +1,37 @@
+package usecase
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+)
+
+func TestRecordAuditFailure(t *testing.T) {
+	audit := &fakeAudit{}
+	router := gin.New()
+	router.POST("/change", func(ctx *gin.Context) {
+		if !recordAudit(ctx, audit, constant.AuditUserUpdate, constant.TargetUser, "user-1", "ACME", gin.H{"name": "a"}, gin.H{"name": "b"}) {
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"name": "b"})
+	})
+
+	code, body := serveJson(t, router, http.MethodPost, "/change", nil)
+	if code != http.StatusOK || len(audit.items) != 1 {
+		t.Fatalf("answered %d %v with %d events", code, body, len(audit.items))
+	}
+	if change := audit.items[0].Diff["name"]; string(change.From) != `"a"` || string(change.To) != `"b"` {
+		t.Fatalf("diff is %+v", audit.items[0].Diff)
+	}
+
+	audit.err = errors.New("no primary")
+	code, body = serveJson(t, router, http.MethodPost, "/change", nil)
+	message, _ := body["error"].(string)
+	if code != http.StatusInternalServerError || !strings.Contains(message, "audit event") {
+		t.Fatalf("answered %d %v when the event can't be written", code, body)
+	}
+}
@@ -3,68 +3,237 @@ package usecase
 import (
 	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/sirupsen/logrus"
 	"net/http"
 	"time"
 	"um/app/core/config"
+	"um/app/core/constant"
 	"um/app/core/utils"
+	"um/app/domain/model"
 	"um/app/domain/repository"
 	"um/app/featues/request"
 	"um/middlewares"
 )
 
-func RequireSession(sessionEntity repository.ISession) gin.HandlerFunc {
+// RequireSession checks the session of the access token and that its user is still within their
+// validity window. A request authenticated by an API key has no session, ResolveApiKey already
+// checked its user.
+func RequireSession(sessionEntity repository.ISession, userEntity repository.IUser) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		if ctx.GetString(middlewares.ApiKeyId) != "" {
+			return
+		}
 		sessionId := ctx.GetString(middlewares.SessionId)
 		userId, err := sessionEntity.GetSessionById(sessionId)
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session invalid"})
 			return
 		}
+		user, err := userEntity.GetUserById(userId)
+		if err != nil || !withinValidity(user, time.Now()) {
+			_ = sessionEntity.RemoveSessionById(sessionId)
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session invalid"})
+			return
+		}
 		ctx.Set(middlewares.UserId, userId)
 		logrus.Info("UserId: " + userId)
 		return
 	}
 }
 
-func Login(userEntity repository.IUser, sessionEntity repository.ISession) gin.HandlerFunc {
+func Login(
+	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
+	sessionEntity repository.ISession,
+	authenticators AuthenticatorChain,
+	clientSettingEntity repository.IClientSetting,
+	loginHistoryEntity repository.ILoginHistory,
+	eventEntity repository.IEvent,
+	relyingParty *webauthn.WebAuthn,
+	webauthnEntity repository.IWebauthn,
+) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		req := request.Login{}
 		if err := ctx.ShouldBind(&req); err != nil {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		user, err := userEntity.GetUserByUsername(req.Username)
-		if (user == nil) || utils.ComparePasswordAndHashedPassword(req.Password, user.Password) != nil {
-			err = errors.New("wrong username or password")
+		user, err := authenticate(ctx, userEntity, authenticators, clientSettingEntity, loginHistoryEntity, req)
+		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
+		completeLogin(ctx, userEntity, attributeEntity, sessionEntity, loginHistoryEntity, eventEntity, relyingParty, webauthnEntity, user, req.System)
+	}
+}
 
-		expireDate := time.Now().Add(config.AccessTokenTime)
+// authenticate checks a username and password with the authenticator chain, a failure is recorded
+// in the login history. Clients signing in through an identity provider can turn password login
+// off, except for SUPER users.
+func authenticate(
+	ctx *gin.Context,
+	userEntity repository.IUser,
+	authenticators AuthenticatorChain,
+	clientSettingEntity repository.IClientSetting,
+	loginHistoryEntity repository.ILoginHistory,
+	req request.Login,
+) (*model.User, error) {
+	history := model.LoginHistory{
+		Event:    constant.LoginEventLogin,
+		Username: req.Username,
+		ClientId: req.ClientId,
+		System:   req.System,
+	}
+	user, _ := userEntity.GetUserByUsername(req.Username)
+	if user != nil {
+		history.UserId = user.Id.Hex()
+		history.ClientId = user.ClientId
+	}
+	user, err := authenticators.Authenticate(req, user)
+	if err != nil {
+		switch {
+		case !errors.Is(err, errNotHandled) && !errors.Is(err, errWrongCredentials):
+			history.FailureReason = constant.LoginFailureDirectory
+		case history.UserId == "":
+			history.FailureReason = constant.LoginFailureUserNotFound
+			err = errWrongCredentials
+		default:
+			history.FailureReason = constant.LoginFailureWrongPassword
+			err = errWrongCredentials
+		}
+		recordLoginHistory(ctx, loginHistoryEntity, history)
+		return nil, err
+	}
+	history.UserId = user.Id.Hex()
+	history.ClientId = user.ClientId
+	if user.Status != constant.ACTIVE {
+		history.FailureReason = constant.LoginFailureUserInactive
+		recordLoginHistory(ctx, loginHistoryEntity, history)
+		return nil, errors.New("user is not active")
+	}
+	if !withinValidity(user, time.Now()) {
+		history.FailureReason = constant.LoginFailureOutsideValidity
+		recordLoginHistory(ctx, loginHistoryEntity, history)
+		return nil, errors.New("account is not valid at this time")
+	}
+	if user.Role != constant.SUPER {
+		setting, err := clientSettingEntity.GetClientSetting(user.ClientId)
+		if err != nil || setting.PasswordLoginDisabled {
+			history.FailureReason = constant.LoginFailurePasswordDisabled
+			recordLoginHistory(ctx, loginHistoryEntity, history)
+			return nil, errors.New("password login is disabled, sign in with your identity provider")
+		}
+	}
+	return user, nil
+}
 
-		sessionId, err := sessionEntity.CreateSession(user.Id.Hex(), config.AccessTokenTime)
+// completeLogin answers a login with an access token. Users with a passkey get a WebAuthn challenge
+// instead, which confirms the login on /auth/webauthn/login/finish.
+func completeLogin(
+	ctx *gin.Context,
+	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
+	sessionEntity repository.ISession,
+	loginHistoryEntity repository.ILoginHistory,
+	eventEntity repository.IEvent,
+	relyingParty *webauthn.WebAuthn,
+	webauthnEntity repository.IWebauthn,
+	user *model.User,
+	system string,
+) {
+	if len(user.Webauthn) > 0 {
+		result, err := beginWebauthnMfa(relyingParty, webauthnEntity, user, system)
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		param := &middlewares.TokenParam{
-			SessionId:      sessionId,
-			Role:           user.Role,
-			System:         req.System,
-			ClientId:       user.ClientId,
-			ExpirationTime: expireDate,
-		}
-		token := middlewares.GenerateJwtToken(param)
-		result := gin.H{
-			"accessToken": token,
-		}
 		ctx.JSON(http.StatusOK, result)
+		return
+	}
+	token, err := loginToken(ctx, userEntity, attributeEntity, sessionEntity, loginHistoryEntity, eventEntity, user, system)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"accessToken": token,
+	})
+}
+
+// loginToken opens a session for an authenticated user and signs its access token, the path shared
+// by every way of signing in
+func loginToken(
+	ctx *gin.Context,
+	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
+	sessionEntity repository.ISession,
+	loginHistoryEntity repository.ILoginHistory,
+	eventEntity repository.IEvent,
+	user *model.User,
+	system string,
+) (string, error) {
+	sessionId, err := startSession(ctx, userEntity, sessionEntity, loginHistoryEntity, eventEntity, user, system)
+	if err != nil {
+		return "", err
+	}
+	param := &middlewares.TokenParam{
+		SessionId:      sessionId,
+		Role:           user.Role,
+		System:         system,
+		ClientId:       user.ClientId,
+		Attributes:     attributeClaims(attributeEntity, user),
+		ExpirationTime: time.Now().Add(sessionTime(user, config.AccessTokenTime)),
+	}
+	return middlewares.GenerateJwtToken(param), nil
+}
+
+// startSession opens a session for an authenticated user and records the login and its date
+func startSession(
+	ctx *gin.Context,
+	userEntity repository.IUser,
+	sessionEntity repository.ISession,
+	loginHistoryEntity repository.ILoginHistory,
+	eventEntity repository.IEvent,
+	user *model.User,
+	system string,
+) (string, error) {
+	history := model.LoginHistory{
+		Event:    constant.LoginEventLogin,
+		UserId:   user.Id.Hex(),
+		Username: user.Username,
+		ClientId: user.ClientId,
+		System:   system,
 	}
+	expiration := sessionTime(user, config.AccessTokenTime)
+	if expiration <= 0 {
+		history.FailureReason = constant.LoginFailureOutsideValidity
+		recordLoginHistory(ctx, loginHistoryEntity, history)
+		return "", errors.New("account is not valid at this time")
+	}
+	sessionId, err := sessionEntity.CreateSession(user.Id.Hex(), expiration)
+	if err != nil {
+		history.FailureReason = constant.LoginFailureSession
+		recordLoginHistory(ctx, loginHistoryEntity, history)
+		return "", err
+	}
+	history.Success = true
+	history.SessionId = sessionId
+	recordLoginHistory(ctx, loginHistoryEntity, history)
+	err = userEntity.TouchLastLogin(user.Id.Hex())
+	if err != nil {
+		logrus.Error(err)
+	}
+	publishEvent(eventEntity, constant.EventSessionCreated, user.ClientId, model.SessionEventData{
+		SessionId: sessionId,
+		UserId:    user.Id.Hex(),
+		ClientId:  user.ClientId,
+		System:    system,
+	})
+	return sessionId, nil
 }
 
-func KeepAlive(userEntity repository.IUser, sessionEntity repository.ISession) gin.HandlerFunc {
+func KeepAlive(userEntity repository.IUser, attributeEntity repository.IAttribute, sessionEntity repository.ISession, loginHistoryEntity repository.ILoginHistory) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		sessionId := ctx.GetString(middlewares.SessionId)
 		userId := ctx.GetString(middlewares.UserId)
@@ -75,19 +244,52 @@ func KeepAlive(userEntity repository.IUser, sessionEntity repository.ISession) g
 			return
 		}
 
-		expireDate := time.Now().Add(config.AccessTokenTime)
-		err = sessionEntity.UpdateSessionExpireById(sessionId, config.AccessTokenTime)
+		system := ctx.GetString(middlewares.System)
+		history := model.LoginHistory{
+			Event:     constant.LoginEventKeepAlive,
+			UserId:    userId,
+			Username:  user.Username,
+			ClientId:  user.ClientId,
+			System:    system,
+			SessionId: sessionId,
+		}
+
+		if !isUserActive(user) {
+			_ = sessionEntity.RemoveSessionById(sessionId)
+			history.FailureReason = constant.LoginFailureUserInactive
+			recordLoginHistory(ctx, loginHistoryEntity, history)
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user is not active"})
+			return
+		}
+		expiration := sessionTime(user, config.AccessTokenTime)
+		if expiration <= 0 {
+			_ = sessionEntity.RemoveSessionById(sessionId)
+			history.FailureReason = constant.LoginFailureOutsideValidity
+			recordLoginHistory(ctx, loginHistoryEntity, history)
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "account is not valid at this time"})
+			return
+		}
+		expireDate := time.Now().Add(expiration)
+		err = sessionEntity.UpdateSessionExpireById(sessionId, expiration)
 		if err != nil {
+			history.FailureReason = constant.LoginFailureSession
+			recordLoginHistory(ctx, loginHistoryEntity, history)
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		history.Success = true
+		recordLoginHistory(ctx, loginHistoryEntity, history)
+		err = userEntity.TouchLastLogin(userId)
+		if err != nil {
+			logrus.Error(err)
+		}
 
-		system := ctx.GetString(middlewares.System)
 		param := &middlewares.TokenParam{
 			SessionId:      sessionId,
 			Role:           user.Role,
 			System:         system,
 			ClientId:       user.ClientId,
+			Attributes:     attributeClaims(attributeEntity, user),
 			ExpirationTime: expireDate,
 		}
 		token := middlewares.GenerateJwtToken(param)
@@ -98,10 +300,25 @@ func KeepAlive(userEntity repository.IUser, sessionEntity repository.ISession) g
 	}
 }
 
-func Logout(sessionEntity repository.ISession) gin.HandlerFunc {
+func Logout(sessionEntity repository.ISession, loginHistoryEntity repository.ILoginHistory, eventEntity repository.IEvent) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		sessionId := ctx.GetString(middlewares.SessionId)
 		_ = sessionEntity.RemoveSessionById(sessionId)
+		recordLoginHistory(ctx, loginHistoryEntity, model.LoginHistory{
+			Event:     constant.LoginEventLogout,
+			UserId:    ctx.GetString(middlewares.UserId),
+			ClientId:  ctx.GetString(middlewares.ClientId),
+			System:    ctx.GetString(middlewares.System),
+			SessionId: sessionId,
+			Success:   true,
+		})
+		publishEvent(eventEntity, constant.EventSessionRevoked, ctx.GetString(middlewares.ClientId), model.SessionEventData{
+			SessionId: sessionId,
+			UserId:    ctx.GetString(middlewares.UserId),
+			ClientId:  ctx.GetString(middlewares.ClientId),
+			System:    ctx.GetString(middlewares.System),
+			ActorId:   ctx.GetString(middlewares.Actor),
+		})
 		result := gin.H{
 			"message": "success",
 		}
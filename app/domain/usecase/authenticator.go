@@ -0,0 +1,149 @@
+package usecase
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+var (
+	// errNotHandled makes the chain ask the next authenticator
+	errNotHandled = errors.New("not handled")
+	// errWrongCredentials is a wrong password or an unknown user
+	errWrongCredentials = errors.New("wrong username or password")
+)
+
+// Authenticator checks the credentials of a login. user is the um-api user with the username, nil
+// when there is none. It returns errNotHandled for a login it doesn't know how to check.
+type Authenticator interface {
+	Authenticate(req request.Login, user *model.User) (*model.User, error)
+}
+
+// AuthenticatorChain asks each authenticator in order until one handles the login
+type AuthenticatorChain []Authenticator
+
+func NewAuthenticatorChain(authenticators ...Authenticator) AuthenticatorChain {
+	return authenticators
+}
+
+func (chain AuthenticatorChain) Authenticate(req request.Login, user *model.User) (*model.User, error) {
+	for _, authenticator := range chain {
+		result, err := authenticator.Authenticate(req, user)
+		if errors.Is(err, errNotHandled) {
+			continue
+		}
+		return result, err
+	}
+	return nil, errNotHandled
+}
+
+type localAuthenticator struct{}
+
+// NewLocalAuthenticator checks the bcrypt password of local and self-registered users, and of SUPER
+// users synced from a directory
+func NewLocalAuthenticator() Authenticator {
+	return &localAuthenticator{}
+}
+
+func (authenticator *localAuthenticator) Authenticate(req request.Login, user *model.User) (*model.User, error) {
+	if user == nil || (user.Source == constant.SourceLdap && user.Role != constant.SUPER) {
+		return nil, errNotHandled
+	}
+	if utils.ComparePasswordAndHashedPassword(req.Password, user.Password) != nil {
+		return nil, errWrongCredentials
+	}
+	return user, nil
+}
+
+type ldapAuthenticator struct {
+	userEntity       repository.IUser
+	ldapConfigEntity repository.ILdapConfig
+}
+
+// NewLdapAuthenticator binds to the directory of the client. It handles users synced from the
+// directory, and unknown usernames when the login names a client with a directory. SUPER users
+// always sign in with their local password.
+func NewLdapAuthenticator(userEntity repository.IUser, ldapConfigEntity repository.ILdapConfig) Authenticator {
+	return &ldapAuthenticator{userEntity: userEntity, ldapConfigEntity: ldapConfigEntity}
+}
+
+func (authenticator *ldapAuthenticator) Authenticate(req request.Login, user *model.User) (*model.User, error) {
+	clientId := req.ClientId
+	if user != nil {
+		if user.Source != constant.SourceLdap || user.Role == constant.SUPER {
+			return nil, errNotHandled
+		}
+		clientId = user.ClientId
+	}
+	if clientId == "" {
+		return nil, errNotHandled
+	}
+	ldapConfig, err := authenticator.ldapConfigEntity.GetLdapConfig(clientId)
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && !ldapConfig.Enabled) {
+		if user != nil {
+			// the directory was removed, its users can't sign in until it's back
+			return nil, errors.New("directory of " + clientId + " is not configured")
+		}
+		return nil, errNotHandled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := ldapConfig.Attributes
+	entry, err := middlewares.LdapAuthenticate(middlewares.LdapParam{
+		Url:                ldapConfig.Url,
+		StartTls:           ldapConfig.StartTls,
+		InsecureSkipVerify: ldapConfig.InsecureSkipVerify,
+		BindDn:             ldapConfig.BindDn,
+		BindPassword:       ldapConfig.BindPassword,
+		BaseDn:             ldapConfig.BaseDn,
+		UserFilter:         ldapConfig.UserFilter,
+		Attributes:         []string{attributes.FirstName, attributes.LastName, attributes.Email, attributes.Phone, attributes.Groups},
+		Timeout:            config.LdapTimeout,
+	}, req.Username, req.Password)
+	if errors.Is(err, middlewares.ErrLdapInvalidCredentials) {
+		return nil, errWrongCredentials
+	}
+	if err != nil {
+		logrus.Error(err)
+		return nil, errors.New("directory is unavailable")
+	}
+
+	role := ldapRole(ldapConfig, entry.Values(attributes.Groups))
+	if role == "" {
+		return nil, errors.New("user is not in a group allowed to sign in")
+	}
+	return authenticator.userEntity.SyncDirectoryUser(request.DirectoryUser{
+		Username:  req.Username,
+		FirstName: entry.Attribute(attributes.FirstName),
+		LastName:  entry.Attribute(attributes.LastName),
+		Email:     entry.Attribute(attributes.Email),
+		Phone:     entry.Attribute(attributes.Phone),
+		Role:      role,
+		ClientId:  clientId,
+		Source:    constant.SourceLdap,
+	})
+}
+
+// ldapRole picks the highest role granted by the groups of a user, or the default role when no
+// group is mapped
+func ldapRole(ldapConfig *model.LdapConfig, groups []string) string {
+	role := ldapConfig.DefaultRole
+	for _, groupRole := range ldapConfig.GroupRoles {
+		for _, group := range groups {
+			if strings.EqualFold(group, groupRole.Group) && constant.RoleLevels[groupRole.Role] > constant.RoleLevels[role] {
+				role = groupRole.Role
+			}
+		}
+	}
+	return role
+}
@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+)
+
+// fakeLdapConfigs counts the lookups, a lookup means the login reached the LDAP authenticator
+type fakeLdapConfigs struct {
+	repository.ILdapConfig
+	mu      sync.Mutex
+	configs []model.LdapConfig
+	lookups int
+}
+
+func (fake *fakeLdapConfigs) GetLdapConfig(clientId string) (*model.LdapConfig, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.lookups++
+	for _, ldapConfig := range fake.configs {
+		if ldapConfig.ClientId == clientId {
+			return &ldapConfig, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+// closedLdapUrl is an address nothing listens on, so a bind fails right away
+func closedLdapUrl(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+	return "ldap://" + address
+}
+
+func TestAuthenticatorChainOrder(t *testing.T) {
+	hash := utils.HashPassword("correct horse 42")
+	local := &model.User{Id: primitive.NewObjectID(), Username: "jane", Password: hash, ClientId: "ACM", Role: constant.USER, Status: constant.ACTIVE}
+	synced := &model.User{Id: primitive.NewObjectID(), Username: "john", Password: hash, ClientId: "ACM", Role: constant.USER, Status: constant.ACTIVE, Source: constant.SourceLdap}
+	super := &model.User{Id: primitive.NewObjectID(), Username: "root", Password: hash, ClientId: "ACM", Role: constant.SUPER, Status: constant.ACTIVE, Source: constant.SourceLdap}
+	orphan := &model.User{Id: primitive.NewObjectID(), Username: "jim", Password: hash, ClientId: "OLD", Role: constant.USER, Status: constant.ACTIVE, Source: constant.SourceLdap}
+	directory := errors.New("directory is unavailable")
+
+	for _, test := range []struct {
+		name     string
+		user     *model.User
+		login    request.Login
+		err      error
+		viaLdap  bool
+		accepted bool
+	}{
+		{"local user", local, request.Login{Username: "jane", Password: "correct horse 42"}, nil, false, true},
+		{"local user with a wrong password", local, request.Login{Username: "jane", Password: "wrong password 1"}, errWrongCredentials, false, false},
+		{"directory user", synced, request.Login{Username: "john", Password: "correct horse 42"}, directory, true, false},
+		{"directory user with an empty password", synced, request.Login{Username: "john", Password: ""}, errWrongCredentials, true, false},
+		{"directory user of a removed directory", orphan, request.Login{Username: "jim", Password: "correct horse 42"}, errors.New("directory of OLD is not configured"), true, false},
+		{"SUPER directory user", super, request.Login{Username: "root", Password: "correct horse 42"}, nil, false, true},
+		{"SUPER directory user with a wrong password", super, request.Login{Username: "root", Password: "wrong password 1"}, errWrongCredentials, false, false},
+		{"unknown user of a client with a directory", nil, request.Login{Username: "joan", Password: "correct horse 42", ClientId: "ACM"}, directory, true, false},
+		{"unknown user of a client without one", nil, request.Login{Username: "joan", Password: "correct horse 42", ClientId: "GLB"}, errNotHandled, true, false},
+		{"unknown user without a client", nil, request.Login{Username: "joan", Password: "correct horse 42"}, errNotHandled, false, false},
+	} {
+		ldapConfigs := &fakeLdapConfigs{configs: []model.LdapConfig{{ClientId: "ACM", Url: closedLdapUrl(t), Enabled: true, DefaultRole: constant.USER}}}
+		chain := NewAuthenticatorChain(NewLocalAuthenticator(), NewLdapAuthenticator(newFakeUsers(), ldapConfigs))
+
+		user, err := chain.Authenticate(test.login, test.user)
+		if (err == nil) != (test.err == nil) || (err != nil && err.Error() != test.err.Error()) {
+			t.Errorf("%s: %v, want %v", test.name, err, test.err)
+		}
+		if test.accepted && (user == nil || user.Id != test.user.Id) {
+			t.Errorf("%s: signed in %v, want the user", test.name, user)
+		}
+		if viaLdap := ldapConfigs.lookups > 0; viaLdap != test.viaLdap {
+			t.Errorf("%s: asked the directory %v, want %v", test.name, viaLdap, test.viaLdap)
+		}
+	}
+}
+
+func TestLdapRole(t *testing.T) {
+	ldapConfig := &model.LdapConfig{
+		DefaultRole: constant.USER,
+		GroupRoles: []model.LdapGroupRole{
+			{Group: "cn=staff,dc=acme", Role: constant.USER},
+			{Group: "cn=admins,dc=acme", Role: constant.ADMIN},
+			{Group: "cn=root,dc=acme", Role: constant.SUPER},
+		},
+	}
+	for _, test := range []struct {
+		name        string
+		defaultRole string
+		groups      []string
+		role        string
+	}{
+		{"no group", constant.USER, nil, constant.USER},
+		{"unmapped group", constant.USER, []string{"cn=guests,dc=acme"}, constant.USER},
+		{"mapped group", constant.USER, []string{"cn=admins,dc=acme"}, constant.ADMIN},
+		{"group in another case", constant.USER, []string{"CN=Admins,DC=acme"}, constant.ADMIN},
+		{"highest of several groups", constant.USER, []string{"cn=admins,dc=acme", "cn=root,dc=acme", "cn=staff,dc=acme"}, constant.SUPER},
+		{"group below the default role", constant.ADMIN, []string{"cn=staff,dc=acme"}, constant.ADMIN},
+		{"no default role and no group", "", []string{"cn=guests,dc=acme"}, ""},
+		{"no default role and a mapped group", "", []string{"cn=staff,dc=acme"}, constant.USER},
+	} {
+		ldapConfig.DefaultRole = test.defaultRole
+		if role := ldapRole(ldapConfig, test.groups); role != test.role {
+			t.Errorf("%s: %q, want %q", test.name, role, test.role)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package usecase
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+func CheckAuthorization(
+	userEntity repository.IUser,
+	sessionEntity repository.ISession,
+	systemEntity repository.ISystem,
+	groupEntity repository.IGroup,
+	authzEntity repository.IAuthz,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.AuthzCheck{}
+		if err := ctx.ShouldBind(&req); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Token == "" && req.UserId == "" {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "token or userId is required"})
+			return
+		}
+		result := checkAuthorization(ctx, userEntity, sessionEntity, systemEntity, groupEntity, authzEntity, req)
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func CheckAuthorizationBatch(
+	userEntity repository.IUser,
+	sessionEntity repository.ISession,
+	systemEntity repository.ISystem,
+	groupEntity repository.IGroup,
+	authzEntity repository.IAuthz,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.AuthzCheckBatch{}
+		if err := ctx.ShouldBind(&req); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for _, check := range req.Checks {
+			if check.Token == "" && check.UserId == "" {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "token or userId is required"})
+				return
+			}
+		}
+		var results []model.AuthzDecision
+		for _, check := range req.Checks {
+			results = append(results, checkAuthorization(ctx, userEntity, sessionEntity, systemEntity, groupEntity, authzEntity, check))
+		}
+		ctx.JSON(http.StatusOK, gin.H{"results": results})
+	}
+}
+
+// GetSystemUser returns a user of the calling system's client with the user's effective grants
+func GetSystemUser(userEntity repository.IUser, groupEntity repository.IGroup) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		clientId := ctx.GetString(middlewares.ClientId)
+		user, err := userEntity.GetUserByClientId(ctx.Param("id"), clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		grants, err := effectiveGrants(groupEntity, user)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"user":   user,
+			"grants": grants,
+		})
+	}
+}
+
+func checkAuthorization(
+	ctx *gin.Context,
+	userEntity repository.IUser,
+	sessionEntity repository.ISession,
+	systemEntity repository.ISystem,
+	groupEntity repository.IGroup,
+	authzEntity repository.IAuthz,
+	req request.AuthzCheck,
+) model.AuthzDecision {
+	decision := model.AuthzDecision{Action: req.Action, Resource: req.Resource}
+
+	userId := req.UserId
+	tokenSystem := ""
+	if req.Token != "" {
+		claims, err := middlewares.ParseJwtToken(req.Token)
+		if err != nil {
+			decision.Reason = "subject token invalid"
+			return decision
+		}
+		userId, err = sessionEntity.GetSessionById(claims.ID)
+		if err != nil {
+			decision.Reason = "subject session invalid"
+			return decision
+		}
+		tokenSystem = claims.System
+	}
+	decision.UserId = userId
+
+	callerRole := ctx.GetString(middlewares.Role)
+	callerClientId := ctx.GetString(middlewares.ClientId)
+	// users only check their own permissions, systems and admins check any user of their client
+	if ctx.GetString(middlewares.SystemId) == "" && constant.RoleLevels[callerRole] < constant.RoleLevels[constant.ADMIN] &&
+		userId != ctx.GetString(middlewares.UserId) {
+		decision.Reason = "subject is not the caller"
+		return decision
+	}
+	callerScope := callerClientId
+	if callerRole == constant.SUPER {
+		callerScope = constant.SUPER
+	}
+
+	key := strings.Join([]string{callerScope, req.Action, req.Resource, req.ClientId, tokenSystem}, "|")
+	cached, err := authzEntity.GetDecision(userId, key)
+	if err == nil {
+		cached.UserId = userId
+		return *cached
+	}
+
+	user, err := userEntity.GetUserById(userId)
+	if err != nil {
+		decision.Reason = "subject not found"
+		return decision
+	}
+
+	if callerRole != constant.SUPER && user.ClientId != callerClientId {
+		decision.Reason = "subject outside caller client"
+		return decision
+	}
+
+	grants, err := effectiveGrants(groupEntity, user)
+	if err != nil {
+		logrus.Error(err)
+		decision.Reason = "unable to resolve grants"
+		return decision
+	}
+
+	decision = decideAuthorization(systemEntity, user, grants, tokenSystem, req)
+	decision.UserId = userId
+	err = authzEntity.SetDecision(userId, key, decision, config.AuthzCacheTime)
+	if err != nil {
+		logrus.Error(err)
+	}
+	return decision
+}
+
+// invalidateUser drops the cached decisions of a user. The change is already stored, so a failure is
+// logged and the decisions stay cached until config.AuthzCacheTime passes.
+func invalidateUser(authzEntity repository.IAuthz, userId string) {
+	err := authzEntity.InvalidateUser(userId)
+	if err != nil {
+		logrus.Error(err)
+	}
+}
+
+func invalidateAll(authzEntity repository.IAuthz) {
+	err := authzEntity.InvalidateAll()
+	if err != nil {
+		logrus.Error(err)
+	}
+}
+
+// effectiveGrants returns the union of the user's direct role and the grants of every group the user belongs to
+func effectiveGrants(groupEntity repository.IGroup, user *model.User) ([]model.EffectiveGrant, error) {
+	grants := []model.EffectiveGrant{
+		{Role: user.Role, Source: constant.GrantSourceDirect},
+	}
+	groups, err := groupEntity.GetGroupsByMemberId(user.Id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if group.ClientId != user.ClientId {
+			continue
+		}
+		for _, grant := range group.Grants {
+			grants = append(grants, model.EffectiveGrant{
+				Role:      grant.Role,
+				System:    grant.System,
+				Source:    constant.GrantSourceGroup,
+				GroupId:   group.Id.Hex(),
+				GroupName: group.Name,
+			})
+		}
+	}
+	return grants, nil
+}
+
+func describeGrant(grant model.EffectiveGrant) string {
+	if grant.Source == constant.GrantSourceGroup {
+		return fmt.Sprintf("role %s granted by group %s", grant.Role, grant.GroupName)
+	}
+	return fmt.Sprintf("direct role %s", grant.Role)
+}
+
+func decideAuthorization(systemEntity repository.ISystem, user *model.User, grants []model.EffectiveGrant, tokenSystem string, req request.AuthzCheck) model.AuthzDecision {
+	decision := model.AuthzDecision{Action: req.Action, Resource: req.Resource}
+	if !isUserActive(user) {
+		decision.Reason = "user is not active"
+		return decision
+	}
+
+	clientId := req.ClientId
+	if clientId == "" {
+		clientId = user.ClientId
+	}
+	if clientId != user.ClientId && user.Role != constant.SUPER {
+		decision.Reason = "client scope mismatch"
+		return decision
+	}
+
+	systemCode := strings.SplitN(req.Resource, ":", 2)[0]
+	if systemCode == "" {
+		decision.Reason = "invalid resource"
+		return decision
+	}
+	if _, err := systemEntity.GetSystem(clientId, systemCode); err != nil {
+		decision.Reason = fmt.Sprintf("system %s is not registered for client %s", systemCode, clientId)
+		return decision
+	}
+	if tokenSystem != "" && tokenSystem != systemCode {
+		decision.Reason = fmt.Sprintf("token was issued for system %s", tokenSystem)
+		return decision
+	}
+
+	requiredRole, ok := constant.ActionRoles[req.Action]
+	if !ok {
+		decision.Reason = "unknown action"
+		return decision
+	}
+
+	var best *model.EffectiveGrant
+	for i, grant := range grants {
+		if grant.System != "" && grant.System != systemCode {
+			continue
+		}
+		if best == nil || constant.RoleLevels[grant.Role] > constant.RoleLevels[best.Role] {
+			best = &grants[i]
+		}
+	}
+	if best == nil {
+		decision.Reason = fmt.Sprintf("no grant for system %s", systemCode)
+		return decision
+	}
+	if constant.RoleLevels[best.Role] < constant.RoleLevels[requiredRole] {
+		decision.Reason = fmt.Sprintf("%s is below required role %s", describeGrant(*best), requiredRole)
+		return decision
+	}
+
+	decision.Allow = true
+	decision.Reason = fmt.Sprintf("%s grants %s", describeGrant(*best), req.Action)
+	return decision
+}
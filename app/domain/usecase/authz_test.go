@@ -0,0 +1,76 @@
+package usecase
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/middlewares"
+)
+
+// fakeAuthz never has a cached decision and records the users whose decisions were dropped
+type fakeAuthz struct {
+	repository.IAuthz
+	mu          sync.Mutex
+	invalidated []string
+}
+
+func (fake *fakeAuthz) GetDecision(userId string, key string) (*model.AuthzDecision, error) {
+	return nil, mongo.ErrNoDocuments
+}
+
+func (fake *fakeAuthz) SetDecision(userId string, key string, decision model.AuthzDecision, expiration time.Duration) error {
+	return nil
+}
+
+func (fake *fakeAuthz) InvalidateUser(userId string) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.invalidated = append(fake.invalidated, userId)
+	return nil
+}
+
+func TestCheckAuthorizationSubject(t *testing.T) {
+	caller := &model.User{Id: primitive.NewObjectID(), ClientId: "ACME", Role: constant.USER, Status: constant.ACTIVE}
+	other := &model.User{Id: primitive.NewObjectID(), ClientId: "ACME", Role: constant.USER, Status: constant.ACTIVE}
+	systems := &fakeSystems{systems: []model.System{{Id: primitive.NewObjectID(), ClientId: "ACME", SystemCode: "POS"}}}
+	for _, test := range []struct {
+		name     string
+		role     string
+		systemId string
+		subject  *model.User
+		allow    bool
+	}{
+		{"user checking itself", constant.USER, "", caller, true},
+		{"user checking another user", constant.USER, "", other, false},
+		{"admin checking another user", constant.ADMIN, "", other, true},
+		{"system checking a user", "", primitive.NewObjectID().Hex(), other, true},
+	} {
+		router := gin.New()
+		router.POST("/authz/check", func(ctx *gin.Context) {
+			ctx.Set(middlewares.ClientId, "ACME")
+			if test.systemId != "" {
+				ctx.Set(middlewares.SystemId, test.systemId)
+				return
+			}
+			ctx.Set(middlewares.UserId, caller.Id.Hex())
+			ctx.Set(middlewares.Role, test.role)
+		}, CheckAuthorization(newFakeUsers(caller, other), newFakeSessions(), systems, newFakeGroups(), &fakeAuthz{}))
+
+		code, body := serveJson(t, router, http.MethodPost, "/authz/check", gin.H{
+			"userId":   test.subject.Id.Hex(),
+			"action":   constant.ActionRead,
+			"resource": "POS:orders",
+		})
+		if code != http.StatusOK || body["allow"] != test.allow {
+			t.Errorf("%s: answered %d %v, want allow %v", test.name, code, body, test.allow)
+		}
+	}
+}
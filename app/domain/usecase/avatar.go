@@ -0,0 +1,237 @@
+package usecase
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/middlewares"
+)
+
+// UploadAvatar replaces the avatar of the user with a multipart "avatar" image. The thumbnails of
+// every size are stored under a new version, so the URLs of the previous one stop working.
+func UploadAvatar(userEntity repository.IUser, blobStore repository.IBlobStore, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		// room for the multipart envelope around the largest image
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, constant.AvatarMaxBytes+64<<10)
+		header, err := ctx.FormFile("avatar")
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) || (err == nil && header.Size > constant.AvatarMaxBytes) {
+			ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "avatar is larger than " + strconv.Itoa(constant.AvatarMaxBytes>>20) + " MB"})
+			return
+		}
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "avatar file is required"})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		data, err := io.ReadAll(file)
+		_ = file.Close()
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		thumbnails, err := avatarThumbnails(data)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userId := ctx.GetString(middlewares.UserId)
+		before, err := userEntity.GetUserById(userId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		version := primitive.NewObjectID().Hex()
+		for size, thumbnail := range thumbnails {
+			err = blobStore.Put(avatarKey(version, size), thumbnail)
+			if err != nil {
+				_ = blobStore.RemovePrefix(avatarPrefix(version))
+				ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		result, err := userEntity.SetAvatar(userId, version)
+		if err != nil {
+			_ = blobStore.RemovePrefix(avatarPrefix(version))
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		removeAvatar(blobStore, before.Avatar)
+		if !recordAudit(ctx, auditEntity, constant.AuditUserAvatarUpdate, constant.TargetUser, userId, result.ClientId, nil, nil) {
+			return
+		}
+		setAvatarUrl(result)
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func RemoveAvatar(userEntity repository.IUser, blobStore repository.IBlobStore, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId := ctx.GetString(middlewares.UserId)
+		before, err := userEntity.GetUserById(userId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if before.Avatar == "" {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "user has no avatar"})
+			return
+		}
+		result, err := userEntity.SetAvatar(userId, "")
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		removeAvatar(blobStore, before.Avatar)
+		if !recordAudit(ctx, auditEntity, constant.AuditUserAvatarRemove, constant.TargetUser, userId, result.ClientId, nil, nil) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// ServeAvatar answers the signed URLs of setAvatarUrl. The signature covers the version and the
+// expiry, not the size, so any thumbnail size can be asked for with the same signature.
+func ServeAvatar(blobStore repository.IBlobStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		version := ctx.Param("version")
+		size, err := strconv.Atoi(ctx.Param("size"))
+		if err != nil || !containsInt(constant.AvatarSizes, size) || !primitive.IsValidObjectID(version) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "avatar not found"})
+			return
+		}
+		expires, err := strconv.ParseInt(ctx.Query("expires"), 10, 64)
+		remaining := time.Until(time.Unix(expires, 0))
+		signature := avatarSignature(version, ctx.Query("expires"))
+		if err != nil || remaining <= 0 || !hmac.Equal([]byte(ctx.Query("signature")), []byte(signature)) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid or expired avatar url"})
+			return
+		}
+		data, err := blobStore.Get(avatarKey(version, size))
+		if errors.Is(err, os.ErrNotExist) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "avatar not found"})
+			return
+		}
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(remaining.Seconds())))
+		ctx.Data(http.StatusOK, "image/jpeg", data)
+	}
+}
+
+// avatarThumbnails crops the center square of an image and scales it to every avatar size as JPEG.
+// The pixel count is checked from the header first, so a small file can't expand into a huge image.
+func avatarThumbnails(data []byte) (map[int][]byte, error) {
+	if !containsString(constant.AvatarTypes, http.DetectContentType(data)) {
+		return nil, errors.New("avatar must be a JPEG, PNG or WebP image")
+	}
+	header, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("avatar can't be read: " + err.Error())
+	}
+	if header.Width*header.Height > constant.AvatarMaxPixels {
+		return nil, errors.New("avatar has too many pixels")
+	}
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("avatar can't be read: " + err.Error())
+	}
+
+	bounds := source.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	corner := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+	square := image.Rectangle{Min: corner, Max: corner.Add(image.Pt(side, side))}
+
+	thumbnails := map[int][]byte{}
+	for _, size := range constant.AvatarSizes {
+		thumbnail := image.NewRGBA(image.Rect(0, 0, size, size))
+		// JPEG has no transparency, transparent pixels end up white
+		draw.Draw(thumbnail, thumbnail.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), source, square, draw.Over, nil)
+		var buffer bytes.Buffer
+		err = jpeg.Encode(&buffer, thumbnail, &jpeg.Options{Quality: constant.AvatarQuality})
+		if err != nil {
+			return nil, err
+		}
+		thumbnails[size] = buffer.Bytes()
+	}
+	return thumbnails, nil
+}
+
+// setAvatarUrl fills the signed URL of the avatar of a user. The expiry is rounded up to a period
+// boundary at least a period away, so the URL stays the same, and cacheable, for a while. The base is
+// the configured issuer, a Host header of the request would let the client point signed URLs elsewhere.
+func setAvatarUrl(user *model.User) {
+	if user.Avatar == "" {
+		return
+	}
+	period := int64(config.AvatarUrlTime.Seconds())
+	expires := strconv.FormatInt((time.Now().Unix()/period+2)*period, 10)
+	user.AvatarUrl = oidcIssuer() + "/avatar/" + user.Avatar + "/" + strconv.Itoa(constant.AvatarDefaultSize) +
+		"?expires=" + expires + "&signature=" + avatarSignature(user.Avatar, expires)
+}
+
+func setAvatarUrls(users []model.User) {
+	for i := range users {
+		setAvatarUrl(&users[i])
+	}
+}
+
+func avatarSignature(version string, expires string) string {
+	return challengeSignature(constant.AvatarSignaturePurpose, version+"."+expires)
+}
+
+func avatarPrefix(version string) string {
+	return "avatars/" + version + "/"
+}
+
+func avatarKey(version string, size int) string {
+	return avatarPrefix(version) + strconv.Itoa(size) + ".jpg"
+}
+
+// removeAvatar deletes the thumbnails of a previous avatar version, a failure only leaves files behind
+func removeAvatar(blobStore repository.IBlobStore, version string) {
+	if version == "" {
+		return
+	}
+	err := blobStore.RemovePrefix(avatarPrefix(version))
+	if err != nil {
+		logrus.Error(err)
+	}
+}
+
+func containsInt(items []int, value int) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
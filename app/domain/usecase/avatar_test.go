@@ -0,0 +1,60 @@
+package usecase
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/middlewares"
+)
+
+type fakeBlobs struct {
+	repository.IBlobStore
+	blobs map[string][]byte
+}
+
+func (fake *fakeBlobs) Get(key string) ([]byte, error) {
+	data, ok := fake.blobs[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
+func TestAvatarUrlIgnoresHost(t *testing.T) {
+	issuer := "https://um.example.com/api/um/v1"
+	t.Setenv("OIDC_ISSUER", issuer)
+	user := &model.User{Id: primitive.NewObjectID(), Username: "jane", ClientId: "ACME", Role: constant.USER, Status: constant.ACTIVE, Avatar: primitive.NewObjectID().Hex()}
+	blobs := &fakeBlobs{blobs: map[string][]byte{avatarKey(user.Avatar, constant.AvatarDefaultSize): []byte("jpeg")}}
+	router := gin.New()
+	router.GET("/admin/user/:id", func(ctx *gin.Context) {
+		ctx.Set(middlewares.ClientId, "ACME")
+	}, GetUserById(newFakeUsers(user)))
+	router.GET("/avatar/:version/:size", ServeAvatar(blobs))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/user/"+user.Id.Hex(), nil)
+	req.Host = "evil.example.net"
+	req.Header.Set("X-Forwarded-Proto", "http")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	body := map[string]interface{}{}
+	_ = json.Unmarshal(recorder.Body.Bytes(), &body)
+	avatarUrl, _ := body["avatarUrl"].(string)
+	if !strings.HasPrefix(avatarUrl, issuer+"/avatar/") {
+		t.Fatalf("avatarUrl is %q, want it under %s whatever the Host", avatarUrl, issuer)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(avatarUrl, issuer), nil))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "jpeg" {
+		t.Fatalf("signed URL answered %d %s", recorder.Code, recorder.Body.String())
+	}
+}
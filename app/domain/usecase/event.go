@@ -0,0 +1,15 @@
+package usecase
+
+import (
+	"github.com/sirupsen/logrus"
+	"um/app/domain/repository"
+)
+
+// publishEvent stores an event for changes that live outside Mongo, a failure is logged but
+// never fails the request
+func publishEvent(eventEntity repository.IEvent, eventType string, clientId string, data interface{}) {
+	_, err := eventEntity.CreateEvent(eventType, clientId, data)
+	if err != nil {
+		logrus.Error(err)
+	}
+}
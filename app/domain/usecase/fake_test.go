@@ -0,0 +1,385 @@
+package usecase
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+)
+
+// The fakes keep their documents in memory and implement the methods the tested handlers call, the
+// embedded interface panics on any other method so a test notices a new dependency.
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	if os.Getenv("SECRET_KEY") == "" {
+		_ = os.Setenv("SECRET_KEY", "test-secret")
+	}
+	if os.Getenv("OIDC_PRIVATE_KEY") == "" {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		_ = os.Setenv("OIDC_PRIVATE_KEY", string(pem.EncodeToMemory(block)))
+	}
+}
+
+type fakeUsers struct {
+	repository.IUser
+	mu    sync.Mutex
+	users map[string]*model.User
+}
+
+func newFakeUsers(users ...*model.User) *fakeUsers {
+	fake := &fakeUsers{users: map[string]*model.User{}}
+	for _, user := range users {
+		fake.users[user.Id.Hex()] = user
+	}
+	return fake
+}
+
+func (fake *fakeUsers) copyOf(user *model.User) *model.User {
+	result := *user
+	result.Identities = append([]model.UserIdentity(nil), user.Identities...)
+	result.Webauthn = append([]model.WebauthnCredential(nil), user.Webauthn...)
+	return &result
+}
+
+func (fake *fakeUsers) find(match func(user *model.User) bool) (*model.User, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for _, user := range fake.users {
+		if match(user) {
+			return fake.copyOf(user), nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (fake *fakeUsers) update(id string, change func(user *model.User)) (*model.User, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	user, ok := fake.users[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	change(user)
+	return fake.copyOf(user), nil
+}
+
+func (fake *fakeUsers) GetUserByUsername(username string) (*model.User, error) {
+	return fake.find(func(user *model.User) bool { return user.Username == username })
+}
+
+func (fake *fakeUsers) GetUserById(id string) (*model.User, error) {
+	return fake.find(func(user *model.User) bool { return user.Id.Hex() == id })
+}
+
+func (fake *fakeUsers) GetUserByClientId(id string, clientId string) (*model.User, error) {
+	return fake.find(func(user *model.User) bool { return user.Id.Hex() == id && user.ClientId == clientId })
+}
+
+func (fake *fakeUsers) GetUsersByEmail(email string, clientId string) ([]model.User, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	var users []model.User
+	for _, user := range fake.users {
+		if user.Email == email && user.ClientId == clientId {
+			users = append(users, *fake.copyOf(user))
+		}
+	}
+	return users, nil
+}
+
+func (fake *fakeUsers) GetUserByIdentity(providerId string, subject string) (*model.User, error) {
+	return fake.find(func(user *model.User) bool {
+		for _, identity := range user.Identities {
+			if identity.ProviderId == providerId && identity.Subject == subject {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (fake *fakeUsers) CreateUser(form request.User, role string) (*model.User, error) {
+	status := form.Status
+	if status == "" {
+		status = constant.ACTIVE
+	}
+	password := ""
+	if form.Password != "" {
+		password = utils.HashPassword(form.Password)
+	}
+	user := &model.User{
+		Id:          primitive.NewObjectID(),
+		FirstName:   form.FirstName,
+		LastName:    form.LastName,
+		Username:    form.Username,
+		ClientId:    form.ClientId,
+		Password:    password,
+		Phone:       form.Phone,
+		Email:       form.Email,
+		Role:        role,
+		Status:      status,
+		Source:      form.Source,
+		CreatedDate: time.Now(),
+		UpdatedDate: time.Now(),
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.users[user.Id.Hex()] = user
+	return fake.copyOf(user), nil
+}
+
+func (fake *fakeUsers) UpdateStatusById(id string, clientId string, form request.UpdateStatus) (*model.User, error) {
+	return fake.update(id, func(user *model.User) { user.Status = form.Status })
+}
+
+func (fake *fakeUsers) LinkIdentity(id string, identity model.UserIdentity) (*model.User, error) {
+	return fake.update(id, func(user *model.User) { user.Identities = append(user.Identities, identity) })
+}
+
+func (fake *fakeUsers) AddWebauthnCredential(id string, credential model.WebauthnCredential) (*model.User, error) {
+	return fake.update(id, func(user *model.User) { user.Webauthn = append(user.Webauthn, credential) })
+}
+
+func (fake *fakeUsers) TouchWebauthnCredential(id string, credentialId string, signCount uint32, backupState bool) error {
+	_, err := fake.update(id, func(user *model.User) {
+		for i := range user.Webauthn {
+			if user.Webauthn[i].Id == credentialId {
+				user.Webauthn[i].SignCount = signCount
+				user.Webauthn[i].BackupState = backupState
+			}
+		}
+	})
+	return err
+}
+
+func (fake *fakeUsers) TouchLastLogin(id string) error {
+	_, err := fake.update(id, func(user *model.User) {
+		now := time.Now()
+		user.LastLoginDate = &now
+	})
+	return err
+}
+
+type fakeClientSettings struct {
+	repository.IClientSetting
+	settings []model.ClientSetting
+}
+
+func (fake *fakeClientSettings) GetClientSetting(clientId string) (*model.ClientSetting, error) {
+	for _, setting := range fake.settings {
+		if setting.ClientId == clientId {
+			return &setting, nil
+		}
+	}
+	return &model.ClientSetting{ClientId: clientId}, nil
+}
+
+func (fake *fakeClientSettings) GetClientSettingByRegistrationCode(code string) (*model.ClientSetting, error) {
+	for _, setting := range fake.settings {
+		if setting.RegistrationEnabled && setting.RegistrationCode == code {
+			return &setting, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+type fakeSessions struct {
+	repository.ISession
+	mu       sync.Mutex
+	sessions map[string]string
+}
+
+func newFakeSessions() *fakeSessions {
+	return &fakeSessions{sessions: map[string]string{}}
+}
+
+func (fake *fakeSessions) CreateSession(userId string, expiration time.Duration) (string, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	sessionId := uuid.NewString()
+	fake.sessions[sessionId] = userId
+	return sessionId, nil
+}
+
+func (fake *fakeSessions) GetSessionById(sessionId string) (string, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	userId, ok := fake.sessions[sessionId]
+	if !ok {
+		return "", mongo.ErrNoDocuments
+	}
+	return userId, nil
+}
+
+type fakeHistories struct {
+	repository.ILoginHistory
+	mu    sync.Mutex
+	items []model.LoginHistory
+}
+
+func (fake *fakeHistories) CreateLoginHistory(item model.LoginHistory) (*model.LoginHistory, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.items = append(fake.items, item)
+	return &item, nil
+}
+
+type fakeEvents struct {
+	repository.IEvent
+}
+
+func (fake *fakeEvents) CreateEvent(eventType string, clientId string, data interface{}) (*model.Event, error) {
+	return &model.Event{}, nil
+}
+
+type fakeAudit struct {
+	repository.IAudit
+	mu    sync.Mutex
+	items []model.AuditEvent
+	err   error
+}
+
+func (fake *fakeAudit) CreateEvent(item model.AuditEvent) (*model.AuditEvent, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.err != nil {
+		return nil, fake.err
+	}
+	fake.items = append(fake.items, item)
+	return &item, nil
+}
+
+type fakeAttributes struct {
+	repository.IAttribute
+	schemas []model.AttributeSchema
+}
+
+func (fake *fakeAttributes) GetAttributeSchemas(clientId string) ([]model.AttributeSchema, error) {
+	schemas := []model.AttributeSchema{}
+	for _, schema := range fake.schemas {
+		if schema.ClientId == clientId {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas, nil
+}
+
+type fakeNotifier struct {
+	mu            sync.Mutex
+	notifications []model.Notification
+}
+
+func (fake *fakeNotifier) Notify(notification model.Notification) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.notifications = append(fake.notifications, notification)
+	return nil
+}
+
+type fakeChallenges struct {
+	repository.IWebauthn
+	mu         sync.Mutex
+	challenges map[string]model.WebauthnChallenge
+}
+
+func newFakeChallenges() *fakeChallenges {
+	return &fakeChallenges{challenges: map[string]model.WebauthnChallenge{}}
+}
+
+func (fake *fakeChallenges) CreateWebauthnChallenge(id string, item model.WebauthnChallenge, expiration time.Duration) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.challenges[id] = item
+	return nil
+}
+
+func (fake *fakeChallenges) ConsumeWebauthnChallenge(id string) (*model.WebauthnChallenge, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	item, ok := fake.challenges[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	delete(fake.challenges, id)
+	return &item, nil
+}
+
+// serveJson sends body as JSON to the router and decodes the JSON answer
+func serveJson(t *testing.T, router http.Handler, method string, path string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	result := map[string]interface{}{}
+	_ = json.Unmarshal(recorder.Body.Bytes(), &result)
+	return recorder.Code, result
+}
+
+type fakeSystems struct {
+	repository.ISystem
+	systems []model.System
+}
+
+func (fake *fakeSystems) GetSystemByOAuthClientId(oauthClientId string) (*model.System, error) {
+	for _, system := range fake.systems {
+		if system.OAuthClientId == oauthClientId {
+			return &system, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (fake *fakeSessions) RemoveSessionById(sessionId string) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	delete(fake.sessions, sessionId)
+	return nil
+}
+
+func (fake *fakeUsers) RemoveUserById(id string, clientId string) (*model.User, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	user, ok := fake.users[id]
+	if !ok || user.ClientId != clientId {
+		return nil, mongo.ErrNoDocuments
+	}
+	delete(fake.users, id)
+	return user, nil
+}
+
+func (fake *fakeSystems) GetSystem(clientId string, systemCode string) (*model.System, error) {
+	for _, system := range fake.systems {
+		if system.ClientId == clientId && system.SystemCode == systemCode {
+			return &system, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
@@ -0,0 +1,237 @@
+package usecase
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+func GetGroups(groupEntity repository.IGroup) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		clientId := ctx.GetString(middlewares.ClientId)
+		result, err := groupEntity.GetGroupsByClientId(clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func AddGroup(groupEntity repository.IGroup, systemEntity repository.ISystem, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.Group{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		role := ctx.GetString(middlewares.Role)
+		clientId := ctx.GetString(middlewares.ClientId)
+		err = validateGrants(systemEntity, role, clientId, req.Grants)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		req.ClientId = clientId
+		req.CreatedBy = ctx.GetString(middlewares.UserId)
+		result, err := groupEntity.CreateGroup(req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditGroupCreate, constant.TargetGroup, result.Id.Hex(), result.ClientId, nil, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func GetGroupById(groupEntity repository.IGroup) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		clientId := ctx.GetString(middlewares.ClientId)
+		result, err := groupEntity.GetGroupById(id, clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func UpdateGroupById(groupEntity repository.IGroup, systemEntity repository.ISystem, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.UpdateGroup{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		role := ctx.GetString(middlewares.Role)
+		clientId := ctx.GetString(middlewares.ClientId)
+		err = validateGrants(systemEntity, role, clientId, req.Grants)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		id := ctx.Param("id")
+		req.UpdatedBy = ctx.GetString(middlewares.UserId)
+		before, _ := groupEntity.GetGroupById(id, clientId)
+		result, err := groupEntity.UpdateGroupById(id, clientId, req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		invalidateMembers(authzEntity, result)
+		if !recordAudit(ctx, auditEntity, constant.AuditGroupUpdate, constant.TargetGroup, id, result.ClientId, before, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func DeleteGroupById(groupEntity repository.IGroup, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		clientId := ctx.GetString(middlewares.ClientId)
+		result, err := groupEntity.RemoveGroupById(id, clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		invalidateMembers(authzEntity, result)
+		if !recordAudit(ctx, auditEntity, constant.AuditGroupDelete, constant.TargetGroup, id, result.ClientId, result, nil) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func AddGroupMembers(groupEntity repository.IGroup, userEntity repository.IUser, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.GroupMembers{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		clientId := ctx.GetString(middlewares.ClientId)
+		for _, userId := range req.UserIds {
+			if _, err = userEntity.GetUserByClientId(userId, clientId); err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid user id " + userId})
+				return
+			}
+		}
+
+		id := ctx.Param("id")
+		req.UpdatedBy = ctx.GetString(middlewares.UserId)
+		before, _ := groupEntity.GetGroupById(id, clientId)
+		result, err := groupEntity.AddMembers(id, clientId, req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for _, userId := range req.UserIds {
+			invalidateUser(authzEntity, userId)
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditGroupMemberAdd, constant.TargetGroup, id, result.ClientId, before, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func RemoveGroupMember(groupEntity repository.IGroup, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		memberId := ctx.Param("userId")
+		clientId := ctx.GetString(middlewares.ClientId)
+		userId := ctx.GetString(middlewares.UserId)
+		before, _ := groupEntity.GetGroupById(id, clientId)
+		result, err := groupEntity.RemoveMember(id, clientId, memberId, userId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		invalidateUser(authzEntity, memberId)
+		if !recordAudit(ctx, auditEntity, constant.AuditGroupMemberRemove, constant.TargetGroup, id, result.ClientId, before, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func GetUserPermissions(userEntity repository.IUser, systemEntity repository.ISystem, groupEntity repository.IGroup) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.GetPermissions{}
+		err := ctx.ShouldBindQuery(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		id := ctx.Param("id")
+		clientId := ctx.GetString(middlewares.ClientId)
+		user, err := userEntity.GetUserByClientId(id, clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		grants, err := effectiveGrants(groupEntity, user)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result := gin.H{
+			"userId": id,
+			"grants": grants,
+		}
+		if req.Action != "" && req.Resource != "" {
+			check := request.AuthzCheck{Action: req.Action, Resource: req.Resource}
+			decision := decideAuthorization(systemEntity, user, grants, "", check)
+			decision.UserId = id
+			result["decision"] = decision
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func validateGrants(systemEntity repository.ISystem, role string, clientId string, grants []request.Grant) error {
+	for _, grant := range grants {
+		if _, ok := constant.RoleLevels[grant.Role]; !ok {
+			return errors.New("invalid role " + grant.Role)
+		}
+		if constant.RoleLevels[grant.Role] > constant.RoleLevels[role] {
+			return errors.New("invalid role permission")
+		}
+		if grant.System != "" {
+			if _, err := systemEntity.GetSystem(clientId, grant.System); err != nil {
+				return errors.New("invalid system " + grant.System)
+			}
+		}
+	}
+	return nil
+}
+
+func invalidateMembers(authzEntity repository.IAuthz, group *model.Group) {
+	for _, member := range group.Members {
+		err := authzEntity.InvalidateUser(member.Hex())
+		if err != nil {
+			logrus.Error(err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package usecase
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+type fakeGroups struct {
+	repository.IGroup
+	mu     sync.Mutex
+	groups map[string]*model.Group
+}
+
+func newFakeGroups(groups ...*model.Group) *fakeGroups {
+	fake := &fakeGroups{groups: map[string]*model.Group{}}
+	for _, group := range groups {
+		fake.groups[group.Id.Hex()] = group
+	}
+	return fake
+}
+
+func (fake *fakeGroups) copyOf(group *model.Group) *model.Group {
+	result := *group
+	result.Members = append([]primitive.ObjectID(nil), group.Members...)
+	return &result
+}
+
+func (fake *fakeGroups) GetGroupsByMemberId(userId string) ([]model.Group, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	groups := []model.Group{}
+	for _, group := range fake.groups {
+		for _, member := range group.Members {
+			if member.Hex() == userId {
+				groups = append(groups, *fake.copyOf(group))
+			}
+		}
+	}
+	return groups, nil
+}
+
+func (fake *fakeGroups) GetGroupById(id string, clientId string) (*model.Group, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	group, ok := fake.groups[id]
+	if !ok || group.ClientId != clientId {
+		return nil, mongo.ErrNoDocuments
+	}
+	return fake.copyOf(group), nil
+}
+
+func (fake *fakeGroups) AddMembers(id string, clientId string, form request.GroupMembers) (*model.Group, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	group, ok := fake.groups[id]
+	if !ok || group.ClientId != clientId {
+		return nil, mongo.ErrNoDocuments
+	}
+	for _, userId := range form.UserIds {
+		member, _ := primitive.ObjectIDFromHex(userId)
+		group.Members = append(group.Members, member)
+	}
+	return fake.copyOf(group), nil
+}
+
+func (fake *fakeGroups) RemoveMember(id string, clientId string, userId string, updatedBy string) (*model.Group, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	group, ok := fake.groups[id]
+	if !ok || group.ClientId != clientId {
+		return nil, mongo.ErrNoDocuments
+	}
+	members := []primitive.ObjectID{}
+	for _, member := range group.Members {
+		if member.Hex() != userId {
+			members = append(members, member)
+		}
+	}
+	group.Members = members
+	return fake.copyOf(group), nil
+}
+
+func TestEffectiveGrantsScope(t *testing.T) {
+	user := &model.User{Id: primitive.NewObjectID(), ClientId: "ACME", Role: constant.USER, Status: constant.ACTIVE}
+	systems := &fakeSystems{systems: []model.System{
+		{Id: primitive.NewObjectID(), ClientId: "ACME", SystemCode: "POS"},
+		{Id: primitive.NewObjectID(), ClientId: "ACME", SystemCode: "HR"},
+	}}
+	posAdmins := &model.Group{Id: primitive.NewObjectID(), ClientId: "ACME", Name: "POS admins", Members: []primitive.ObjectID{user.Id},
+		Grants: []model.Grant{{Role: constant.ADMIN, System: "POS"}}}
+	// a group of another client naming the user, as a stale membership would
+	foreign := &model.Group{Id: primitive.NewObjectID(), ClientId: "OTHER", Name: "Everything", Members: []primitive.ObjectID{user.Id},
+		Grants: []model.Grant{{Role: constant.ADMIN}}}
+	grants, err := effectiveGrants(newFakeGroups(posAdmins, foreign), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grants) != 2 || grants[1].GroupId != posAdmins.Id.Hex() {
+		t.Fatalf("grants are %+v, want the direct role and the POS admins group only", grants)
+	}
+
+	for _, test := range []struct {
+		action   string
+		resource string
+		allow    bool
+	}{
+		{constant.ActionDelete, "POS:orders", true},
+		{constant.ActionDelete, "HR:payslips", false},
+		{constant.ActionRead, "HR:payslips", true},
+	} {
+		decision := decideAuthorization(systems, user, grants, "", request.AuthzCheck{Action: test.action, Resource: test.resource})
+		if decision.Allow != test.allow {
+			t.Errorf("%s %s: %+v, want allow %v", test.action, test.resource, decision, test.allow)
+		}
+	}
+}
+
+func TestGroupMembersInvalidateDecisions(t *testing.T) {
+	member := &model.User{Id: primitive.NewObjectID(), ClientId: "ACME", Role: constant.USER, Status: constant.ACTIVE}
+	group := &model.Group{Id: primitive.NewObjectID(), ClientId: "ACME", Name: "Cashiers", Grants: []model.Grant{{Role: constant.USER, System: "POS"}}}
+	groups := newFakeGroups(group)
+	authz := &fakeAuthz{}
+	router := gin.New()
+	admin := func(ctx *gin.Context) {
+		ctx.Set(middlewares.UserId, primitive.NewObjectID().Hex())
+		ctx.Set(middlewares.ClientId, "ACME")
+		ctx.Set(middlewares.Role, constant.ADMIN)
+	}
+	router.POST("/admin/group/:id/members", admin, AddGroupMembers(groups, newFakeUsers(member), authz, &fakeAudit{}))
+	router.DELETE("/admin/group/:id/members/:userId", admin, RemoveGroupMember(groups, authz, &fakeAudit{}))
+
+	code, body := serveJson(t, router, http.MethodPost, "/admin/group/"+group.Id.Hex()+"/members", gin.H{"userIds": []string{member.Id.Hex()}})
+	if code != http.StatusOK || len(authz.invalidated) != 1 || authz.invalidated[0] != member.Id.Hex() {
+		t.Fatalf("add answered %d %v, invalidated %v", code, body, authz.invalidated)
+	}
+	code, body = serveJson(t, router, http.MethodDelete, "/admin/group/"+group.Id.Hex()+"/members/"+member.Id.Hex(), nil)
+	if code != http.StatusOK || len(authz.invalidated) != 2 || authz.invalidated[1] != member.Id.Hex() {
+		t.Fatalf("remove answered %d %v, invalidated %v", code, body, authz.invalidated)
+	}
+}
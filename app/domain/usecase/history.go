@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+func GetUserLoginHistory(loginHistoryEntity repository.ILoginHistory) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.GetLoginHistories{}
+		err := ctx.ShouldBindQuery(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.UserId = ctx.GetString(middlewares.UserId)
+		result, err := loginHistoryEntity.GetLoginHistories(req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func GetClientLoginHistory(loginHistoryEntity repository.ILoginHistory) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.GetLoginHistories{}
+		err := ctx.ShouldBindQuery(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.ClientId = ctx.GetString(middlewares.ClientId)
+		result, err := loginHistoryEntity.GetLoginHistories(req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func recordLoginHistory(ctx *gin.Context, loginHistoryEntity repository.ILoginHistory, item model.LoginHistory) {
+	item.Ip = ctx.ClientIP()
+	item.UserAgent = ctx.Request.UserAgent()
+	_, err := loginHistoryEntity.CreateLoginHistory(item)
+	if err != nil {
+		logrus.Error(err)
+	}
+}
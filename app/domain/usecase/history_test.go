@@ -0,0 +1,109 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+func (fake *fakeHistories) GetLoginHistories(form request.GetLoginHistories) ([]model.LoginHistory, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	items := []model.LoginHistory{}
+	for _, item := range fake.items {
+		if (form.ClientId == "" || item.ClientId == form.ClientId) && (form.UserId == "" || item.UserId == form.UserId) {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// unreachableDirectory fails every login the way an LDAP server that can't be reached does
+type unreachableDirectory struct{}
+
+func (authenticator unreachableDirectory) Authenticate(req request.Login, user *model.User) (*model.User, error) {
+	return nil, errors.New("directory unreachable")
+}
+
+func TestGetClientLoginHistoryScope(t *testing.T) {
+	histories := &fakeHistories{items: []model.LoginHistory{
+		{Id: primitive.NewObjectID(), ClientId: "ACM", Username: "jane", Success: true},
+		{Id: primitive.NewObjectID(), ClientId: "GLB", Username: "john", Success: true},
+	}}
+	router := gin.New()
+	router.GET("/admin/login-history", func(ctx *gin.Context) {
+		ctx.Set(middlewares.UserId, primitive.NewObjectID().Hex())
+		ctx.Set(middlewares.ClientId, "ACM")
+		ctx.Set(middlewares.Role, constant.ADMIN)
+	}, GetClientLoginHistory(histories))
+
+	for _, query := range []string{"", "?clientId=GLB", "?ClientId=GLB", "?clientId=GLB&ClientId=GLB"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/login-history"+query, nil))
+		var items []model.LoginHistory
+		if err := json.Unmarshal(recorder.Body.Bytes(), &items); recorder.Code != http.StatusOK || err != nil {
+			t.Fatalf("%q: answered %d %s", query, recorder.Code, recorder.Body.String())
+		}
+		for _, item := range items {
+			if item.ClientId != "ACM" {
+				t.Errorf("%q: admin of ACM read history of %s", query, item.ClientId)
+			}
+		}
+		if len(items) != 1 {
+			t.Errorf("%q: answered %d events, want the 1 of ACM", query, len(items))
+		}
+	}
+}
+
+func TestLoginFailureReason(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	active := &model.User{Id: primitive.NewObjectID(), ClientId: "ACM", Username: "jane", Password: utils.HashPassword("correct horse 42"), Role: constant.USER, Status: constant.ACTIVE}
+	inactive := &model.User{Id: primitive.NewObjectID(), ClientId: "ACM", Username: "john", Password: utils.HashPassword("correct horse 42"), Role: constant.USER, Status: constant.INACTIVE}
+	expired := &model.User{Id: primitive.NewObjectID(), ClientId: "ACM", Username: "jim", Password: utils.HashPassword("correct horse 42"), Role: constant.USER, Status: constant.ACTIVE, ValidUntil: &past}
+	idpOnly := &model.User{Id: primitive.NewObjectID(), ClientId: "IDP", Username: "joan", Password: utils.HashPassword("correct horse 42"), Role: constant.USER, Status: constant.ACTIVE}
+	settings := &fakeClientSettings{settings: []model.ClientSetting{{ClientId: "IDP", PasswordLoginDisabled: true}}}
+
+	for _, test := range []struct {
+		name     string
+		chain    AuthenticatorChain
+		username string
+		password string
+		reason   string
+	}{
+		{"unknown user", NewAuthenticatorChain(NewLocalAuthenticator()), "nobody", "correct horse 42", constant.LoginFailureUserNotFound},
+		{"wrong password", NewAuthenticatorChain(NewLocalAuthenticator()), "jane", "wrong password 1", constant.LoginFailureWrongPassword},
+		{"inactive user", NewAuthenticatorChain(NewLocalAuthenticator()), "john", "correct horse 42", constant.LoginFailureUserInactive},
+		{"expired user", NewAuthenticatorChain(NewLocalAuthenticator()), "jim", "correct horse 42", constant.LoginFailureOutsideValidity},
+		{"password login disabled", NewAuthenticatorChain(NewLocalAuthenticator()), "joan", "correct horse 42", constant.LoginFailurePasswordDisabled},
+		{"directory unreachable", NewAuthenticatorChain(unreachableDirectory{}), "jane", "correct horse 42", constant.LoginFailureDirectory},
+	} {
+		histories := &fakeHistories{}
+		router := gin.New()
+		router.POST("/auth/login", Login(newFakeUsers(active, inactive, expired, idpOnly), &fakeAttributes{}, newFakeSessions(), test.chain, settings, histories, &fakeEvents{}, nil, nil))
+
+		code, body := serveJson(t, router, http.MethodPost, "/auth/login", gin.H{"username": test.username, "password": test.password, "system": "portal"})
+		if code != http.StatusUnauthorized {
+			t.Errorf("%s: answered %d %v, want %d", test.name, code, body, http.StatusUnauthorized)
+			continue
+		}
+		if len(histories.items) != 1 {
+			t.Errorf("%s: recorded %d login events, want 1", test.name, len(histories.items))
+			continue
+		}
+		item := histories.items[0]
+		if item.Success || item.FailureReason != test.reason {
+			t.Errorf("%s: recorded success %v reason %q, want reason %q", test.name, item.Success, item.FailureReason, test.reason)
+		}
+	}
+}
@@ -0,0 +1,491 @@
+package usecase
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+func GetIdentityProviders(idpEntity repository.IIdentityProvider) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		clientId := ctx.GetString(middlewares.ClientId)
+		result, err := idpEntity.GetProvidersByClientId(clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// AddIdentityProvider reads the discovery document of the issuer first, so a typo in the issuer
+// fails here rather than on the first login
+func AddIdentityProvider(idpEntity repository.IIdentityProvider, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.IdentityProvider{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		_, err = middlewares.DiscoverProvider(req.Issuer, 0)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		req.ClientId = ctx.GetString(middlewares.ClientId)
+		req.CreatedBy = ctx.GetString(middlewares.UserId)
+		result, err := idpEntity.CreateProvider(req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditIdpCreate, constant.TargetIdp, result.Id.Hex(), result.ClientId, nil, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func GetIdentityProviderById(idpEntity repository.IIdentityProvider) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		clientId := ctx.GetString(middlewares.ClientId)
+		result, err := idpEntity.GetProviderById(ctx.Param("id"), clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func UpdateIdentityProviderById(idpEntity repository.IIdentityProvider, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.UpdateIdentityProvider{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		_, err = middlewares.DiscoverProvider(req.Issuer, 0)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		id := ctx.Param("id")
+		clientId := ctx.GetString(middlewares.ClientId)
+		req.UpdatedBy = ctx.GetString(middlewares.UserId)
+		before, _ := idpEntity.GetProviderById(id, clientId)
+		result, err := idpEntity.UpdateProviderById(id, clientId, req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditIdpUpdate, constant.TargetIdp, id, clientId, before, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func DeleteIdentityProviderById(idpEntity repository.IIdentityProvider, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		clientId := ctx.GetString(middlewares.ClientId)
+		result, err := idpEntity.RemoveProviderById(id, clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditIdpDelete, constant.TargetIdp, id, clientId, result, nil) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func GetClientSetting(clientSettingEntity repository.IClientSetting) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		result, err := clientSettingEntity.GetClientSetting(ctx.GetString(middlewares.ClientId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// UpdateClientSetting refuses to turn password login off while the client has no active
+// identity provider, which would lock every non SUPER user out
+func UpdateClientSetting(clientSettingEntity repository.IClientSetting, idpEntity repository.IIdentityProvider, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.ClientSetting{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		clientId := ctx.GetString(middlewares.ClientId)
+		if req.PasswordLoginDisabled && !req.PasswordlessEnabled {
+			providers, err := idpEntity.GetActiveProvidersByClientId(clientId)
+			if err != nil || len(providers) == 0 {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "enable passwordless login or add an active identity provider before disabling password login"})
+				return
+			}
+		}
+
+		if req.RegistrationEnabled && req.RegistrationCode == "" {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "set a registrationCode to enable self-registration"})
+			return
+		}
+
+		req.UpdatedBy = ctx.GetString(middlewares.UserId)
+		before, _ := clientSettingEntity.GetClientSetting(clientId)
+		result, err := clientSettingEntity.UpdateClientSetting(clientId, req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditClientSettings, constant.TargetClient, clientId, clientId, before, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// GetLoginProviders lists the providers a login page of a client can offer
+func GetLoginProviders(idpEntity repository.IIdentityProvider) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.GetLoginProviders{}
+		err := ctx.ShouldBindQuery(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		providers, err := idpEntity.GetActiveProvidersByClientId(req.ClientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result := []gin.H{}
+		for _, provider := range providers {
+			result = append(result, gin.H{"id": provider.Id.Hex(), "name": provider.Name})
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// IdpLogin redirects the browser to the identity provider, with a state, nonce and PKCE challenge
+// kept until the callback
+func IdpLogin(idpEntity repository.IIdentityProvider, idpStateEntity repository.IIdpState) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.IdpLogin{}
+		err := ctx.ShouldBindQuery(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		provider, err := idpEntity.GetActiveProviderById(ctx.Param("id"))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "identity provider not found"})
+			return
+		}
+		if req.RedirectUri != "" && !containsString(provider.RedirectUris, req.RedirectUri) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "redirectUri is not registered for this identity provider"})
+			return
+		}
+		metadata, err := middlewares.DiscoverProvider(provider.Issuer, config.IdpMetadataCacheTime)
+		if err != nil {
+			logrus.Error(err)
+			ctx.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"error": "identity provider is unavailable"})
+			return
+		}
+
+		state, errState := utils.GenerateSecret("", 24)
+		nonce, errNonce := utils.GenerateSecret("", 24)
+		codeVerifier, errVerifier := utils.GenerateSecret("", 32)
+		if err = errors.Join(errState, errNonce, errVerifier); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		err = idpStateEntity.CreateIdpState(state, model.IdpState{
+			ProviderId:   provider.Id.Hex(),
+			System:       req.System,
+			Nonce:        nonce,
+			CodeVerifier: codeVerifier,
+			RedirectUri:  req.RedirectUri,
+		}, config.IdpStateTime)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		sum := sha256.Sum256([]byte(codeVerifier))
+		query := url.Values{}
+		query.Set("response_type", constant.ResponseTypeCode)
+		query.Set("client_id", provider.OAuthClientId)
+		query.Set("redirect_uri", idpCallbackUri(provider.Id.Hex()))
+		query.Set("scope", strings.Join(provider.Scopes, " "))
+		query.Set("state", state)
+		query.Set("nonce", nonce)
+		query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:]))
+		query.Set("code_challenge_method", constant.CodeChallengeS256)
+		separator := "?"
+		if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+			separator = "&"
+		}
+		ctx.Redirect(http.StatusFound, metadata.AuthorizationEndpoint+separator+query.Encode())
+	}
+}
+
+// IdpCallback finishes a federated login. The user is found by the linked identity, then by email
+// when the provider allows linking, and is created when it allows provisioning. The access token
+// goes to the fragment of the redirect URI given at login, or in the body without one. Users with a
+// passkey get the WebAuthn challenge of a second factor there instead, like on /auth/login.
+func IdpCallback(
+	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
+	sessionEntity repository.ISession,
+	idpEntity repository.IIdentityProvider,
+	idpStateEntity repository.IIdpState,
+	loginHistoryEntity repository.ILoginHistory,
+	eventEntity repository.IEvent,
+	auditEntity repository.IAudit,
+	relyingParty *webauthn.WebAuthn,
+	webauthnEntity repository.IWebauthn,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.IdpCallback{}
+		_ = ctx.ShouldBindQuery(&req)
+		state, err := idpStateEntity.ConsumeIdpState(req.State)
+		if err != nil || state.ProviderId != ctx.Param("id") {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "login expired, please try again"})
+			return
+		}
+
+		history := model.LoginHistory{
+			Event:         constant.LoginEventLogin,
+			System:        state.System,
+			FailureReason: constant.LoginFailureIdp,
+		}
+		fail := func(status int, err error) {
+			recordLoginHistory(ctx, loginHistoryEntity, history)
+			idpRespond(ctx, state, status, gin.H{"error": err.Error()})
+		}
+		if req.Error != "" {
+			fail(http.StatusUnauthorized, errors.New(strings.TrimSpace(req.Error+" "+req.ErrorDescription)))
+			return
+		}
+
+		provider, err := idpEntity.GetActiveProviderById(state.ProviderId)
+		if err != nil {
+			fail(http.StatusBadRequest, errors.New("identity provider not found"))
+			return
+		}
+		history.ClientId = provider.ClientId
+		claims, err := verifyIdpLogin(ctx, provider, state, req.Code)
+		if err != nil {
+			logrus.Error(err)
+			fail(http.StatusUnauthorized, errors.New("identity provider login failed"))
+			return
+		}
+		history.Username = idpClaim(claims, provider.ClaimMapping.Username, "preferred_username", "email")
+
+		user, err := resolveIdpUser(ctx, userEntity, auditEntity, provider, claims)
+		if err != nil {
+			history.FailureReason = constant.LoginFailureNotLinked
+			fail(http.StatusUnauthorized, err)
+			return
+		}
+		if !isUserActive(user) {
+			history.UserId = user.Id.Hex()
+			history.Username = user.Username
+			fail(http.StatusUnauthorized, errors.New("user is not active"))
+			return
+		}
+
+		if len(user.Webauthn) > 0 {
+			result, err := beginWebauthnMfa(relyingParty, webauthnEntity, user, state.System)
+			if err != nil {
+				idpRespond(ctx, state, http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			idpRespond(ctx, state, http.StatusOK, result)
+			return
+		}
+		token, err := loginToken(ctx, userEntity, attributeEntity, sessionEntity, loginHistoryEntity, eventEntity, user, state.System)
+		if err != nil {
+			idpRespond(ctx, state, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		idpRespond(ctx, state, http.StatusOK, gin.H{"accessToken": token})
+	}
+}
+
+func verifyIdpLogin(ctx *gin.Context, provider *model.IdentityProvider, state *model.IdpState, code string) (jwt.MapClaims, error) {
+	metadata, err := middlewares.DiscoverProvider(provider.Issuer, config.IdpMetadataCacheTime)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := middlewares.ExchangeIdpCode(
+		metadata,
+		provider.OAuthClientId,
+		provider.OAuthClientSecret,
+		code,
+		idpCallbackUri(provider.Id.Hex()),
+		state.CodeVerifier,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return middlewares.VerifyIdpToken(metadata, idToken, provider.OAuthClientId, state.Nonce)
+}
+
+func resolveIdpUser(
+	ctx *gin.Context,
+	userEntity repository.IUser,
+	auditEntity repository.IAudit,
+	provider *model.IdentityProvider,
+	claims jwt.MapClaims,
+) (*model.User, error) {
+	providerId := provider.Id.Hex()
+	subject, _ := claims["sub"].(string)
+	user, err := userEntity.GetUserByIdentity(providerId, subject)
+	if err == nil {
+		if user.ClientId != provider.ClientId {
+			return nil, errors.New("user belongs to another client")
+		}
+		return user, nil
+	}
+
+	identity := model.UserIdentity{ProviderId: providerId, Subject: subject, LinkedDate: time.Now()}
+	email := idpClaim(claims, provider.ClaimMapping.Email, "email")
+	// whoever controls the address at the provider gets the account, so the provider and um-api must
+	// both have verified it, and accounts with more rights than a USER are never linked this way
+	emailVerified, _ := claims["email_verified"].(bool)
+	if provider.LinkByEmail && email != "" && emailVerified {
+		users, err := userEntity.GetUsersByEmail(email, provider.ClientId)
+		if err != nil {
+			return nil, err
+		}
+		if len(users) > 1 {
+			return nil, errors.New("more than one user has this email")
+		}
+		if len(users) == 1 {
+			if users[0].Role != constant.USER || !users[0].EmailVerified {
+				return nil, errors.New("the user with this email can't be linked automatically, ask an admin")
+			}
+			linked, err := userEntity.LinkIdentity(users[0].Id.Hex(), identity)
+			if err != nil {
+				return nil, err
+			}
+			err = appendAudit(ctx, auditEntity, constant.AuditIdpLink, constant.TargetUser, linked.Id.Hex(), linked.ClientId, nil, identity)
+			if err != nil {
+				return nil, err
+			}
+			return linked, nil
+		}
+	}
+
+	if !provider.AutoProvision {
+		return nil, errors.New("no user is linked to this account")
+	}
+	username := idpClaim(claims, provider.ClaimMapping.Username, "preferred_username", "email")
+	if username == "" {
+		username = providerId + ":" + subject
+	}
+	password, err := utils.GenerateSecret("", 32)
+	if err != nil {
+		return nil, err
+	}
+	created, err := userEntity.CreateUser(request.User{
+		FirstName: idpClaim(claims, provider.ClaimMapping.FirstName, "given_name"),
+		LastName:  idpClaim(claims, provider.ClaimMapping.LastName, "family_name"),
+		Email:     email,
+		Username:  username,
+		Password:  password,
+		ClientId:  provider.ClientId,
+	}, constant.USER)
+	if err != nil {
+		return nil, errors.New("can't create user " + username + ": " + err.Error())
+	}
+	linked, err := userEntity.LinkIdentity(created.Id.Hex(), identity)
+	if err != nil {
+		// an unlinked user would take the username, and every later login would fail to create it
+		_, removeErr := userEntity.RemoveUserById(created.Id.Hex(), created.ClientId)
+		if removeErr != nil {
+			logrus.Error(removeErr)
+		}
+		return nil, err
+	}
+	err = appendAudit(ctx, auditEntity, constant.AuditUserCreate, constant.TargetUser, created.Id.Hex(), created.ClientId, nil, created)
+	if err != nil {
+		return nil, err
+	}
+	err = appendAudit(ctx, auditEntity, constant.AuditIdpLink, constant.TargetUser, linked.Id.Hex(), linked.ClientId, nil, identity)
+	if err != nil {
+		return nil, err
+	}
+	return linked, nil
+}
+
+// idpClaim reads the mapped claim, or the first standard claim present when there's no mapping
+func idpClaim(claims jwt.MapClaims, mapped string, defaults ...string) string {
+	names := defaults
+	if mapped != "" {
+		names = []string{mapped}
+	}
+	for _, name := range names {
+		if value, ok := claims[name].(string); ok && value != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+func idpCallbackUri(providerId string) string {
+	return oidcIssuer() + "/auth/idp/" + providerId + "/callback"
+}
+
+// idpRespond answers in the body, or in the fragment of the redirect URI given at login where values
+// other than strings are JSON
+func idpRespond(ctx *gin.Context, state *model.IdpState, status int, body gin.H) {
+	if state.RedirectUri == "" {
+		ctx.AbortWithStatusJSON(status, body)
+		return
+	}
+	fragment := url.Values{}
+	for key, value := range body {
+		if text, ok := value.(string); ok {
+			fragment.Set(key, text)
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		fragment.Set(key, string(data))
+	}
+	ctx.Redirect(http.StatusFound, state.RedirectUri+"#"+fragment.Encode())
+	ctx.Abort()
+}
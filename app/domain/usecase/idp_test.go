@@ -0,0 +1,477 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+)
+
+const (
+	mockIdpClientId     = "um-test"
+	mockIdpClientSecret = "um-test-secret"
+	mockIdpRedirectUri  = "https://app.example.com/signed-in"
+)
+
+// mockIdp is an OpenID Connect provider serving discovery, a JWKS and a token endpoint. authorize
+// stands for the browser signing in at the provider.
+type mockIdp struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	mu     sync.Mutex
+	grants map[string]mockIdpGrant
+}
+
+type mockIdpGrant struct {
+	codeChallenge string
+	claims        jwt.MapClaims
+}
+
+func newMockIdp(t *testing.T) *mockIdp {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdp{key: key, grants: map[string]mockIdpGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(gin.H{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(gin.H{"keys": []gin.H{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *mockIdp) token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	clientId, secret, ok := r.BasicAuth()
+	if !ok || clientId != mockIdpClientId || secret != mockIdpClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(gin.H{"error": "invalid_client"})
+		return
+	}
+	idp.mu.Lock()
+	grant, ok := idp.grants[r.PostFormValue("code")]
+	delete(idp.grants, r.PostFormValue("code"))
+	idp.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.codeChallenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(gin.H{"error": "invalid_grant"})
+		return
+	}
+	claims := jwt.MapClaims{
+		"iss": idp.URL,
+		"aud": mockIdpClientId,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(5 * time.Minute).Unix(),
+	}
+	for name, value := range grant.claims {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(gin.H{"access_token": "opaque", "token_type": "Bearer", "id_token": idToken})
+}
+
+// authorize reads the redirect of IdpLogin and returns the query of the callback. The ID token gets
+// the nonce of the redirect unless claims sets one.
+func (idp *mockIdp) authorize(t *testing.T, location string, claims jwt.MapClaims) url.Values {
+	t.Helper()
+	if !strings.HasPrefix(location, idp.URL+"/authorize?") {
+		t.Fatalf("login redirected to %s, want the provider", location)
+	}
+	redirect, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := redirect.Query()
+	if query.Get("client_id") != mockIdpClientId || query.Get("code_challenge_method") != constant.CodeChallengeS256 {
+		t.Fatalf("unexpected authorization request %s", location)
+	}
+	grant := mockIdpGrant{codeChallenge: query.Get("code_challenge"), claims: jwt.MapClaims{"nonce": query.Get("nonce")}}
+	for name, value := range claims {
+		grant.claims[name] = value
+	}
+	code := uuid.NewString()
+	idp.mu.Lock()
+	idp.grants[code] = grant
+	idp.mu.Unlock()
+	return url.Values{"code": {code}, "state": {query.Get("state")}}
+}
+
+type fakeProviders struct {
+	repository.IIdentityProvider
+	providers []model.IdentityProvider
+}
+
+func (fake *fakeProviders) GetActiveProviderById(id string) (*model.IdentityProvider, error) {
+	for _, provider := range fake.providers {
+		if provider.Active && provider.Id.Hex() == id {
+			return &provider, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+type fakeIdpStates struct {
+	repository.IIdpState
+	mu     sync.Mutex
+	states map[string]model.IdpState
+}
+
+func newFakeIdpStates() *fakeIdpStates {
+	return &fakeIdpStates{states: map[string]model.IdpState{}}
+}
+
+func (fake *fakeIdpStates) CreateIdpState(state string, item model.IdpState, expiration time.Duration) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.states[state] = item
+	return nil
+}
+
+func (fake *fakeIdpStates) ConsumeIdpState(state string) (*model.IdpState, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	item, ok := fake.states[state]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	delete(fake.states, state)
+	return &item, nil
+}
+
+// unlinkableUsers fails to link any identity, as a lost connection between the two writes would
+type unlinkableUsers struct {
+	*fakeUsers
+}
+
+func (fake *unlinkableUsers) LinkIdentity(id string, identity model.UserIdentity) (*model.User, error) {
+	return nil, errors.New("no primary")
+}
+
+type idpHarness struct {
+	idp        *mockIdp
+	provider   model.IdentityProvider
+	users      *fakeUsers
+	histories  *fakeHistories
+	audit      *fakeAudit
+	challenges *fakeChallenges
+	providers  *fakeProviders
+	states     *fakeIdpStates
+	router     *gin.Engine
+}
+
+func newIdpHarness(t *testing.T, configure func(provider *model.IdentityProvider), users ...*model.User) *idpHarness {
+	t.Helper()
+	idp := newMockIdp(t)
+	harness := &idpHarness{
+		idp: idp,
+		provider: model.IdentityProvider{
+			Id:                primitive.NewObjectID(),
+			ClientId:          "ACME",
+			Name:              "Mock",
+			Issuer:            idp.URL,
+			OAuthClientId:     mockIdpClientId,
+			OAuthClientSecret: mockIdpClientSecret,
+			Scopes:            []string{"openid", "email", "profile"},
+			RedirectUris:      []string{mockIdpRedirectUri},
+			Active:            true,
+		},
+		users:      newFakeUsers(users...),
+		histories:  &fakeHistories{},
+		audit:      &fakeAudit{},
+		challenges: newFakeChallenges(),
+	}
+	if configure != nil {
+		configure(&harness.provider)
+	}
+	harness.providers = &fakeProviders{providers: []model.IdentityProvider{harness.provider}}
+	harness.states = newFakeIdpStates()
+	harness.route(t, harness.users)
+	return harness
+}
+
+// route serves the login and callback of the provider with userEntity keeping the users
+func (harness *idpHarness) route(t *testing.T, userEntity repository.IUser) {
+	t.Helper()
+	relyingParty, err := NewRelyingParty("example.com", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	harness.router = gin.New()
+	harness.router.GET("/auth/idp/:id/login", IdpLogin(harness.providers, harness.states))
+	harness.router.GET("/auth/idp/:id/callback", IdpCallback(userEntity, &fakeAttributes{}, newFakeSessions(), harness.providers, harness.states, harness.histories, &fakeEvents{}, harness.audit, relyingParty, harness.challenges))
+}
+
+// login goes through the provider and returns the query of the callback
+func (harness *idpHarness) login(t *testing.T, redirectUri string, claims jwt.MapClaims) url.Values {
+	t.Helper()
+	query := url.Values{"system": {"portal"}}
+	if redirectUri != "" {
+		query.Set("redirectUri", redirectUri)
+	}
+	recorder := httptest.NewRecorder()
+	harness.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/auth/idp/"+harness.provider.Id.Hex()+"/login?"+query.Encode(), nil))
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("login answered %d %s", recorder.Code, recorder.Body.String())
+	}
+	return harness.idp.authorize(t, recorder.Header().Get("Location"), claims)
+}
+
+func (harness *idpHarness) callback(providerId string, query url.Values) (int, map[string]interface{}, string) {
+	recorder := httptest.NewRecorder()
+	harness.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/auth/idp/"+providerId+"/callback?"+query.Encode(), nil))
+	body := map[string]interface{}{}
+	_ = json.Unmarshal(recorder.Body.Bytes(), &body)
+	return recorder.Code, body, recorder.Header().Get("Location")
+}
+
+func (harness *idpHarness) lastFailure() string {
+	if len(harness.histories.items) == 0 {
+		return ""
+	}
+	return harness.histories.items[len(harness.histories.items)-1].FailureReason
+}
+
+func idpUser(role string, email string, emailVerified bool, identities ...model.UserIdentity) *model.User {
+	return &model.User{
+		Id:            primitive.NewObjectID(),
+		Username:      strings.Split(email, "@")[0],
+		Email:         email,
+		EmailVerified: emailVerified,
+		ClientId:      "ACME",
+		Role:          role,
+		Status:        constant.ACTIVE,
+		Identities:    identities,
+	}
+}
+
+func TestIdpCallbackLinkedIdentity(t *testing.T) {
+	harness := newIdpHarness(t, nil)
+	user := idpUser(constant.USER, "alice@example.com", true, model.UserIdentity{ProviderId: harness.provider.Id.Hex(), Subject: "alice"})
+	harness.users.users[user.Id.Hex()] = user
+
+	code, body, _ := harness.callback(harness.provider.Id.Hex(), harness.login(t, "", jwt.MapClaims{"sub": "alice"}))
+	if code != http.StatusOK || body["accessToken"] == nil {
+		t.Fatalf("callback answered %d %v", code, body)
+	}
+	if last := harness.histories.items[len(harness.histories.items)-1]; !last.Success || last.UserId != user.Id.Hex() {
+		t.Fatalf("login history has %+v, want a success of the user", last)
+	}
+
+	code, _, location := harness.callback(harness.provider.Id.Hex(), harness.login(t, mockIdpRedirectUri, jwt.MapClaims{"sub": "alice"}))
+	if code != http.StatusFound || !strings.HasPrefix(location, mockIdpRedirectUri+"#accessToken=") {
+		t.Fatalf("callback with a redirectUri answered %d to %s", code, location)
+	}
+}
+
+func TestIdpCallbackState(t *testing.T) {
+	harness := newIdpHarness(t, nil)
+	user := idpUser(constant.USER, "alice@example.com", true, model.UserIdentity{ProviderId: harness.provider.Id.Hex(), Subject: "alice"})
+	harness.users.users[user.Id.Hex()] = user
+
+	query := harness.login(t, "", jwt.MapClaims{"sub": "alice"})
+	forged := url.Values{"code": query["code"], "state": {"forged"}}
+	if code, body, _ := harness.callback(harness.provider.Id.Hex(), forged); code != http.StatusBadRequest {
+		t.Fatalf("callback with an unknown state answered %d %v", code, body)
+	}
+	if code, body, _ := harness.callback(harness.provider.Id.Hex(), query); code != http.StatusOK {
+		t.Fatalf("callback answered %d %v", code, body)
+	}
+	if code, body, _ := harness.callback(harness.provider.Id.Hex(), query); code != http.StatusBadRequest {
+		t.Fatalf("replayed callback answered %d %v", code, body)
+	}
+
+	query = harness.login(t, "", jwt.MapClaims{"sub": "alice"})
+	if code, body, _ := harness.callback(primitive.NewObjectID().Hex(), query); code != http.StatusBadRequest {
+		t.Fatalf("callback on another provider answered %d %v", code, body)
+	}
+}
+
+func TestIdpCallbackNonce(t *testing.T) {
+	harness := newIdpHarness(t, nil)
+	user := idpUser(constant.USER, "alice@example.com", true, model.UserIdentity{ProviderId: harness.provider.Id.Hex(), Subject: "alice"})
+	harness.users.users[user.Id.Hex()] = user
+
+	code, body, _ := harness.callback(harness.provider.Id.Hex(), harness.login(t, "", jwt.MapClaims{"sub": "alice", "nonce": "replayed"}))
+	if code != http.StatusUnauthorized || harness.lastFailure() != constant.LoginFailureIdp {
+		t.Fatalf("callback with another nonce answered %d %v, history %q", code, body, harness.lastFailure())
+	}
+}
+
+func TestIdpCallbackLinkByEmail(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		role          string
+		localVerified bool
+		idpVerified   interface{}
+		linked        bool
+	}{
+		{"verified on both sides", constant.USER, true, true, true},
+		{"no email_verified claim", constant.USER, true, nil, false},
+		{"email_verified false", constant.USER, true, false, false},
+		{"email_verified as a string", constant.USER, true, "true", false},
+		{"unverified in um-api", constant.USER, false, true, false},
+		{"admin account", constant.ADMIN, true, true, false},
+		{"super account", constant.SUPER, true, true, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			user := idpUser(test.role, "alice@example.com", test.localVerified)
+			harness := newIdpHarness(t, func(provider *model.IdentityProvider) {
+				provider.LinkByEmail = true
+				provider.AutoProvision = true
+			}, user)
+			claims := jwt.MapClaims{"sub": "alice", "email": "alice@example.com"}
+			if test.idpVerified != nil {
+				claims["email_verified"] = test.idpVerified
+			}
+
+			code, body, _ := harness.callback(harness.provider.Id.Hex(), harness.login(t, "", claims))
+			stored, _ := harness.users.GetUserById(user.Id.Hex())
+			if test.linked {
+				if code != http.StatusOK || len(stored.Identities) != 1 {
+					t.Fatalf("callback answered %d %v with %d identities, want the user linked", code, body, len(stored.Identities))
+				}
+				return
+			}
+			if len(stored.Identities) != 0 {
+				t.Fatalf("user was linked, callback answered %d %v", code, body)
+			}
+			if code == http.StatusOK {
+				for _, other := range harness.users.users {
+					if other.Id != user.Id && other.Role != constant.USER {
+						t.Fatalf("provisioned a %s user", other.Role)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestIdpCallbackProvision(t *testing.T) {
+	harness := newIdpHarness(t, func(provider *model.IdentityProvider) {
+		provider.AutoProvision = true
+	})
+	code, body, _ := harness.callback(harness.provider.Id.Hex(), harness.login(t, "", jwt.MapClaims{
+		"sub":                "bob",
+		"preferred_username": "bob",
+		"email":              "bob@example.com",
+		"given_name":         "Bob",
+	}))
+	if code != http.StatusOK || body["accessToken"] == nil {
+		t.Fatalf("callback answered %d %v", code, body)
+	}
+	created, err := harness.users.GetUserByIdentity(harness.provider.Id.Hex(), "bob")
+	if err != nil {
+		t.Fatal("no user is linked to the subject")
+	}
+	if created.Username != "bob" || created.FirstName != "Bob" || created.Role != constant.USER || created.ClientId != "ACME" {
+		t.Fatalf("provisioned %+v", created)
+	}
+	actions := []string{}
+	for _, item := range harness.audit.items {
+		actions = append(actions, item.Action)
+	}
+	if strings.Join(actions, ",") != constant.AuditUserCreate+","+constant.AuditIdpLink {
+		t.Fatalf("audit log has %v", actions)
+	}
+
+	harness = newIdpHarness(t, nil)
+	code, body, _ = harness.callback(harness.provider.Id.Hex(), harness.login(t, "", jwt.MapClaims{"sub": "carol"}))
+	if code != http.StatusUnauthorized || harness.lastFailure() != constant.LoginFailureNotLinked {
+		t.Fatalf("callback without provisioning answered %d %v, history %q", code, body, harness.lastFailure())
+	}
+}
+
+func TestIdpCallbackProvisionLinkFailure(t *testing.T) {
+	harness := newIdpHarness(t, func(provider *model.IdentityProvider) {
+		provider.AutoProvision = true
+	})
+	harness.route(t, &unlinkableUsers{harness.users})
+	claims := jwt.MapClaims{"sub": "bob", "preferred_username": "bob"}
+	code, body, _ := harness.callback(harness.provider.Id.Hex(), harness.login(t, "", claims))
+	if code == http.StatusOK {
+		t.Fatalf("callback answered %d %v when the identity can't be linked", code, body)
+	}
+	if len(harness.users.users) != 0 || len(harness.audit.items) != 0 {
+		t.Fatalf("left %d users and %d audit events, want the created user removed", len(harness.users.users), len(harness.audit.items))
+	}
+
+	// the username is free again, so the next login provisions the user
+	harness.route(t, harness.users)
+	code, body, _ = harness.callback(harness.provider.Id.Hex(), harness.login(t, "", claims))
+	if code != http.StatusOK || body["accessToken"] == nil {
+		t.Fatalf("next callback answered %d %v", code, body)
+	}
+	if _, err := harness.users.GetUserByIdentity(harness.provider.Id.Hex(), "bob"); err != nil {
+		t.Fatal("no user is linked to the subject")
+	}
+}
+
+func TestIdpCallbackPasskeyUser(t *testing.T) {
+	harness := newIdpHarness(t, nil)
+	user := idpUser(constant.USER, "alice@example.com", true, model.UserIdentity{ProviderId: harness.provider.Id.Hex(), Subject: "alice"})
+	user.Webauthn = []model.WebauthnCredential{{Id: base64.RawURLEncoding.EncodeToString([]byte("credential-1")), Name: "key"}}
+	harness.users.users[user.Id.Hex()] = user
+
+	code, body, _ := harness.callback(harness.provider.Id.Hex(), harness.login(t, "", jwt.MapClaims{"sub": "alice"}))
+	if code != http.StatusOK || body["accessToken"] != nil || body["mfaRequired"] != true {
+		t.Fatalf("callback answered %d %v, want a passkey challenge", code, body)
+	}
+	challenge, err := harness.challenges.ConsumeWebauthnChallenge(body["challengeId"].(string))
+	if err != nil || challenge.Ceremony != constant.WebauthnMfa || challenge.UserId != user.Id.Hex() {
+		t.Fatalf("challenge %+v %v", challenge, err)
+	}
+
+	code, _, location := harness.callback(harness.provider.Id.Hex(), harness.login(t, mockIdpRedirectUri, jwt.MapClaims{"sub": "alice"}))
+	fragment, _ := url.ParseQuery(strings.TrimPrefix(location, mockIdpRedirectUri+"#"))
+	if code != http.StatusFound || fragment.Get("mfaRequired") != "true" || fragment.Get("challengeId") == "" || fragment.Has("accessToken") {
+		t.Fatalf("callback with a redirectUri answered %d to %s", code, location)
+	}
+	var publicKey map[string]interface{}
+	if err := json.Unmarshal([]byte(fragment.Get("publicKey")), &publicKey); err != nil || publicKey["challenge"] == nil {
+		t.Fatalf("publicKey of the fragment is %q", fragment.Get("publicKey"))
+	}
+}
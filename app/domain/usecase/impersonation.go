@@ -0,0 +1,146 @@
+package usecase
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+func Impersonate(
+	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
+	sessionEntity repository.ISession,
+	impersonationEntity repository.IImpersonation,
+	auditEntity repository.IAudit,
+	eventEntity repository.IEvent,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.Impersonate{}
+		if err := ctx.ShouldBind(&req); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		actorId := ctx.GetString(middlewares.UserId)
+		id := ctx.Param("id")
+		if actorId == id {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "can't impersonate self user"})
+			return
+		}
+
+		user, err := userEntity.GetUserById(id)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if user.Role == constant.SUPER {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "can't impersonate super user"})
+			return
+		}
+		if !isUserActive(user) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "user is not active"})
+			return
+		}
+
+		expireDate := time.Now().Add(config.ImpersonationTokenTime)
+		sessionId, err := sessionEntity.CreateSession(user.Id.Hex(), config.ImpersonationTokenTime)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		_, err = impersonationEntity.CreateLog(model.ImpersonationLog{
+			SessionId: sessionId,
+			ActorId:   actorId,
+			UserId:    user.Id.Hex(),
+			ClientId:  user.ClientId,
+			Action:    constant.ImpersonationStart,
+			Reason:    req.Reason,
+			Method:    ctx.Request.Method,
+			Path:      ctx.FullPath(),
+			Ip:        ctx.ClientIP(),
+			UserAgent: ctx.Request.UserAgent(),
+		})
+		if err != nil {
+			_ = sessionEntity.RemoveSessionById(sessionId)
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		param := &middlewares.TokenParam{
+			SessionId:      sessionId,
+			Role:           user.Role,
+			System:         req.System,
+			ClientId:       user.ClientId,
+			ActorId:        actorId,
+			Attributes:     attributeClaims(attributeEntity, user),
+			ExpirationTime: expireDate,
+		}
+		token := middlewares.GenerateJwtToken(param)
+		if !recordAudit(ctx, auditEntity, constant.AuditUserImpersonate, constant.TargetUser, user.Id.Hex(), user.ClientId, nil, nil) {
+			// the token isn't handed out, so the session must not stay open without an audit event
+			err = sessionEntity.RemoveSessionById(sessionId)
+			if err != nil {
+				logrus.Error(err)
+			}
+			return
+		}
+		publishEvent(eventEntity, constant.EventSessionCreated, user.ClientId, model.SessionEventData{
+			SessionId: sessionId,
+			UserId:    user.Id.Hex(),
+			ClientId:  user.ClientId,
+			System:    req.System,
+			ActorId:   actorId,
+		})
+		result := gin.H{
+			"accessToken": token,
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// RecordImpersonation logs every request made with an impersonated session against both the actor and the user
+func RecordImpersonation(impersonationEntity repository.IImpersonation) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		actorId := ctx.GetString(middlewares.Actor)
+		if actorId == "" {
+			return
+		}
+		_, err := impersonationEntity.CreateLog(model.ImpersonationLog{
+			SessionId:  ctx.GetString(middlewares.SessionId),
+			ActorId:    actorId,
+			UserId:     ctx.GetString(middlewares.UserId),
+			ClientId:   ctx.GetString(middlewares.ClientId),
+			Action:     constant.ImpersonationAction,
+			Method:     ctx.Request.Method,
+			Path:       ctx.Request.URL.Path,
+			StatusCode: ctx.Writer.Status(),
+			Ip:         ctx.ClientIP(),
+			UserAgent:  ctx.Request.UserAgent(),
+		})
+		if err != nil {
+			logrus.Error(err)
+		}
+	}
+}
+
+func GetImpersonationLogs(impersonationEntity repository.IImpersonation) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		result, err := impersonationEntity.GetLogsByUserId(id)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,52 @@
+package usecase
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/middlewares"
+)
+
+type fakeImpersonations struct {
+	repository.IImpersonation
+	items []model.ImpersonationLog
+}
+
+func (fake *fakeImpersonations) CreateLog(item model.ImpersonationLog) (*model.ImpersonationLog, error) {
+	fake.items = append(fake.items, item)
+	return &item, nil
+}
+
+func TestImpersonateAuditFailure(t *testing.T) {
+	user := &model.User{Id: primitive.NewObjectID(), Username: "jane", ClientId: "ACME", Role: constant.USER, Status: constant.ACTIVE}
+	for _, test := range []struct {
+		name     string
+		auditErr error
+		status   int
+		sessions int
+	}{
+		{"audited", nil, http.StatusOK, 1},
+		{"audit event lost", errors.New("no primary"), http.StatusInternalServerError, 0},
+	} {
+		sessions := newFakeSessions()
+		router := gin.New()
+		router.POST("/super/user/:id/impersonate", func(ctx *gin.Context) {
+			ctx.Set(middlewares.UserId, primitive.NewObjectID().Hex())
+			ctx.Set(middlewares.Role, constant.SUPER)
+		}, Impersonate(newFakeUsers(user), &fakeAttributes{}, sessions, &fakeImpersonations{}, &fakeAudit{err: test.auditErr}, &fakeEvents{}))
+
+		code, body := serveJson(t, router, http.MethodPost, "/super/user/"+user.Id.Hex()+"/impersonate", gin.H{"system": "POS", "reason": "support ticket 42"})
+		if code != test.status {
+			t.Errorf("%s: answered %d %v, want %d", test.name, code, body, test.status)
+		}
+		if len(sessions.sessions) != test.sessions {
+			t.Errorf("%s: left %d sessions open, want %d", test.name, len(sessions.sessions), test.sessions)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package usecase
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+	"um/app/core/config"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+// GetDormantUsers reports the ACTIVE users of the client who didn't sign in for days, the inactivity
+// period of the client by default
+func GetDormantUsers(userEntity repository.IUser, clientSettingEntity repository.IClientSetting) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.GetDormantUsers{}
+		err := ctx.ShouldBindQuery(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		clientId := ctx.GetString(middlewares.ClientId)
+		days := req.Days
+		if days == 0 {
+			days = config.InactivityReportDays
+			setting, err := clientSettingEntity.GetClientSetting(clientId)
+			if err == nil && setting.InactivityDays > 0 {
+				days = setting.InactivityDays
+			}
+		}
+		result, err := userEntity.GetDormantUsers(clientId, time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		setAvatarUrls(result)
+		ctx.JSON(http.StatusOK, result)
+	}
+}
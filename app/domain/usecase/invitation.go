@@ -0,0 +1,263 @@
+package usecase
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+var errInvitationInvalid = errors.New("invalid or expired invitation")
+
+// InviteUser creates a PENDING user and emails them a link to set their own password
+func InviteUser(
+	invitationEntity repository.IInvitation,
+	userEntity repository.IUser,
+	systemEntity repository.ISystem,
+	notifier Notifier,
+	auditEntity repository.IAudit,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.Invite{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		clientId := ctx.GetString(middlewares.ClientId)
+		system, err := systemEntity.GetSystem(clientId, req.System)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !containsString(system.RedirectUris, req.RedirectUri) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "redirectUri is not registered for " + req.System})
+			return
+		}
+		found, _ := userEntity.GetUserByUsername(req.Username)
+		if found != nil {
+			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "username is taken"})
+			return
+		}
+
+		token, err := utils.GenerateSecret("", 32)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userId := ctx.GetString(middlewares.UserId)
+		user, err := userEntity.CreateUser(request.User{
+			FirstName: req.FirstName,
+			LastName:  req.LastName,
+			Phone:     req.Phone,
+			Email:     req.Email,
+			Username:  req.Username,
+			ClientId:  clientId,
+			CreatedBy: userId,
+			Status:    constant.PENDING,
+		}, constant.USER)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result, err := invitationEntity.CreateInvitation(model.Invitation{
+			UserId:      user.Id,
+			ClientId:    clientId,
+			Username:    user.Username,
+			Email:       req.Email,
+			System:      req.System,
+			RedirectUri: req.RedirectUri,
+			TokenHash:   utils.HashToken(token),
+			ExpireDate:  time.Now().Add(config.InvitationTime),
+			CreatedBy:   user.CreatedBy,
+		})
+		if err != nil {
+			// a PENDING user without an invitation could never sign in, nor be invited again
+			_, removeErr := userEntity.RemoveUserById(user.Id.Hex(), clientId)
+			if removeErr != nil {
+				logrus.Error(removeErr)
+			}
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// audited once both exist, a lost audit event leaves a pending invitation that can be resent
+		if !recordAudit(ctx, auditEntity, constant.AuditUserCreate, constant.TargetUser, user.Id.Hex(), user.ClientId, nil, user) {
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditUserInvite, constant.TargetInvite, result.Id.Hex(), clientId, nil, result) {
+			return
+		}
+
+		// the invitation stays pending when it can't be sent, so it can be resent
+		err = sendInvitation(notifier, result, token)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func GetInvitations(invitationEntity repository.IInvitation) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		clientId := ctx.GetString(middlewares.ClientId)
+		result, err := invitationEntity.GetPendingInvitations(clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// ResendInvitation sends a pending invitation again with a new token and a new expiry, the link sent
+// before stops working
+func ResendInvitation(invitationEntity repository.IInvitation, notifier Notifier, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		clientId := ctx.GetString(middlewares.ClientId)
+		invitation, err := invitationEntity.GetPendingInvitation(id, clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		token, err := utils.GenerateSecret("", 32)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result, err := invitationEntity.RenewInvitation(id, clientId, utils.HashToken(token), time.Now().Add(config.InvitationTime))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditUserInviteResend, constant.TargetInvite, id, clientId, invitation, result) {
+			return
+		}
+
+		err = sendInvitation(notifier, result, token)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// RevokeInvitation revokes a pending invitation and deletes the user it created, which frees the
+// username
+func RevokeInvitation(
+	invitationEntity repository.IInvitation,
+	userEntity repository.IUser,
+	groupEntity repository.IGroup,
+	authzEntity repository.IAuthz,
+	auditEntity repository.IAudit,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		clientId := ctx.GetString(middlewares.ClientId)
+		result, err := invitationEntity.RevokeInvitation(id, clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditUserInviteRevoke, constant.TargetInvite, id, clientId, nil, result) {
+			return
+		}
+
+		userId := result.UserId.Hex()
+		user, err := userEntity.GetUserByClientId(userId, clientId)
+		if err == nil && user.Status == constant.PENDING {
+			removed, err := userEntity.RemoveUserById(userId, clientId)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			_ = groupEntity.RemoveMemberFromAll(userId)
+			invalidateUser(authzEntity, userId)
+			if !recordAudit(ctx, auditEntity, constant.AuditUserDelete, constant.TargetUser, userId, clientId, removed, nil) {
+				return
+			}
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// AcceptInvite lets an invited user set their password and profile with the token of their
+// invitation, and activates them
+func AcceptInvite(invitationEntity repository.IInvitation, userEntity repository.IUser, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.AcceptInvite{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		token, ok := verifySignedToken(constant.NotificationInvitation, req.Token)
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvitationInvalid.Error()})
+			return
+		}
+		invitation, err := invitationEntity.GetInvitationByHash(utils.HashToken(token))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvitationInvalid.Error()})
+			return
+		}
+		err = utils.CheckPasswordPolicy(req.Password, invitation.Username)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		invitation, err = invitationEntity.AcceptInvitation(utils.HashToken(token))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvitationInvalid.Error()})
+			return
+		}
+
+		userId := invitation.UserId.Hex()
+		user, err := userEntity.GetUserById(userId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvitationInvalid.Error()})
+			return
+		}
+		result, err := userEntity.AcceptInvitation(userId, invitation.Email, req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "user is no longer pending"})
+			return
+		}
+		ctx.Set(middlewares.UserId, userId)
+		if !recordAudit(ctx, auditEntity, constant.AuditUserInviteAccept, constant.TargetUser, userId, result.ClientId, user, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func sendInvitation(notifier Notifier, invitation *model.Invitation, token string) error {
+	link, err := signedLink(invitation.RedirectUri, constant.InvitationTokenParam, constant.NotificationInvitation, token)
+	if err != nil {
+		return err
+	}
+	days := strconv.Itoa(int(config.InvitationTime.Hours() / 24))
+	return notifier.Notify(model.Notification{
+		Purpose:  constant.NotificationInvitation,
+		Channel:  constant.ChannelEmail,
+		To:       invitation.Email,
+		Subject:  "You are invited",
+		Message:  "You are invited to sign in as " + invitation.Username + ". Accept with " + link + " within " + days + " days.",
+		Link:     link,
+		UserId:   invitation.UserId.Hex(),
+		ClientId: invitation.ClientId,
+	})
+}
@@ -0,0 +1,77 @@
+package usecase
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/middlewares"
+)
+
+type fakeInvitations struct {
+	repository.IInvitation
+	mu    sync.Mutex
+	items []model.Invitation
+	err   error
+}
+
+func (fake *fakeInvitations) CreateInvitation(item model.Invitation) (*model.Invitation, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.err != nil {
+		return nil, fake.err
+	}
+	item.Id = primitive.NewObjectID()
+	fake.items = append(fake.items, item)
+	return &item, nil
+}
+
+func TestInviteUserLeavesNoOrphan(t *testing.T) {
+	systems := &fakeSystems{systems: []model.System{{
+		Id:           primitive.NewObjectID(),
+		ClientId:     "ACME",
+		SystemCode:   "PORTAL",
+		RedirectUris: []string{"https://portal.example.com/welcome"},
+	}}}
+	invite := gin.H{
+		"username":    "jane",
+		"email":       "jane@example.com",
+		"system":      "PORTAL",
+		"redirectUri": "https://portal.example.com/welcome",
+	}
+	for _, test := range []struct {
+		name          string
+		invitationErr error
+		auditErr      error
+		status        int
+		users         int
+	}{
+		{"invited", nil, nil, http.StatusOK, 1},
+		{"invitation not stored", errors.New("no primary"), nil, http.StatusBadRequest, 0},
+		{"audit event lost", nil, errors.New("no primary"), http.StatusInternalServerError, 1},
+	} {
+		users := newFakeUsers()
+		invitations := &fakeInvitations{err: test.invitationErr}
+		notifier := &fakeNotifier{}
+		router := gin.New()
+		router.POST("/admin/invitation", func(ctx *gin.Context) {
+			ctx.Set(middlewares.UserId, primitive.NewObjectID().Hex())
+			ctx.Set(middlewares.ClientId, "ACME")
+			ctx.Set(middlewares.Role, constant.ADMIN)
+		}, InviteUser(invitations, users, systems, notifier, &fakeAudit{err: test.auditErr}))
+
+		code, body := serveJson(t, router, http.MethodPost, "/admin/invitation", invite)
+		if code != test.status {
+			t.Errorf("%s: answered %d %v, want %d", test.name, code, body, test.status)
+		}
+		if len(users.users) != test.users || len(invitations.items) != test.users {
+			t.Errorf("%s: left %d users and %d invitations, want %d of each", test.name, len(users.users), len(invitations.items), test.users)
+		}
+	}
+}
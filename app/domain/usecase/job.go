@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/worker"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+func GetJobs(jobEntity repository.IJob) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		result, err := jobEntity.GetJobs()
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func AddJob(jobEntity repository.IJob, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.Job{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		nextRunDate, err := worker.NextJobRun(req.Cron, req.Timezone, time.Now())
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		req.CreatedBy = ctx.GetString(middlewares.UserId)
+		result, err := jobEntity.CreateJob(req, nextRunDate)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditJobCreate, constant.TargetJob, result.Id.Hex(), "", nil, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func GetJobById(jobEntity repository.IJob) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		result, err := jobEntity.GetJobById(ctx.Param("id"))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func UpdateJobById(jobEntity repository.IJob, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.UpdateJob{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		nextRunDate, err := worker.NextJobRun(req.Cron, req.Timezone, time.Now())
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		id := ctx.Param("id")
+		req.UpdatedBy = ctx.GetString(middlewares.UserId)
+		before, _ := jobEntity.GetJobById(id)
+		result, err := jobEntity.UpdateJobById(id, req, nextRunDate)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditJobUpdate, constant.TargetJob, id, "", before, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func DeleteJobById(jobEntity repository.IJob, jobRunEntity repository.IJobRun, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		result, err := jobEntity.RemoveJobById(id)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err = jobRunEntity.RemoveJobRunsByJobId(id); err != nil {
+			logrus.Error(err)
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditJobDelete, constant.TargetJob, id, "", result, nil) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// RunJobNow starts a run in the background, its result shows up in the job runs
+func RunJobNow(
+	jobEntity repository.IJob,
+	jobRunEntity repository.IJobRun,
+	systemEntity repository.ISystem,
+	lockEntity repository.ILock,
+	auditEntity repository.IAudit,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		job, err := jobEntity.GetJobById(id)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		go func() {
+			run, err := worker.RunJob(jobEntity, jobRunEntity, systemEntity, lockEntity, id, constant.JobTriggerManual)
+			if err != nil {
+				logrus.Error(err)
+			} else if run == nil {
+				logrus.Warning("job " + id + " is already running")
+			}
+		}()
+		if !recordAudit(ctx, auditEntity, constant.AuditJobRun, constant.TargetJob, id, "", nil, nil) {
+			return
+		}
+		ctx.JSON(http.StatusAccepted, job)
+	}
+}
+
+func GetJobRuns(jobRunEntity repository.IJobRun) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.GetJobRuns{}
+		err := ctx.ShouldBindQuery(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result, err := jobRunEntity.GetJobRunsByJobId(ctx.Param("id"), req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,60 @@
+package usecase
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+func GetLdapConfig(ldapConfigEntity repository.ILdapConfig) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		result, err := ldapConfigEntity.GetLdapConfig(ctx.GetString(middlewares.ClientId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func UpdateLdapConfig(ldapConfigEntity repository.ILdapConfig, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.LdapConfig{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		clientId := ctx.GetString(middlewares.ClientId)
+		req.UpdatedBy = ctx.GetString(middlewares.UserId)
+		before, _ := ldapConfigEntity.GetLdapConfig(clientId)
+		result, err := ldapConfigEntity.UpdateLdapConfig(clientId, req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditLdapUpdate, constant.TargetClient, clientId, clientId, before, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func DeleteLdapConfig(ldapConfigEntity repository.ILdapConfig, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		clientId := ctx.GetString(middlewares.ClientId)
+		result, err := ldapConfigEntity.RemoveLdapConfig(clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditLdapDelete, constant.TargetClient, clientId, clientId, result, nil) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
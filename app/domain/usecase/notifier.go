@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/middlewares"
+)
+
+// Notifier delivers a message to a user by email or SMS
+type Notifier interface {
+	Notify(notification model.Notification) error
+}
+
+type httpNotifier struct {
+	endpoint string
+}
+
+type logNotifier struct{}
+
+// NewNotifier posts notifications as JSON to endpoint, a service sending the email or SMS. Without an
+// endpoint notifications are dropped with a warning, their code or link is never logged.
+func NewNotifier(endpoint string) Notifier {
+	if endpoint == "" {
+		return &logNotifier{}
+	}
+	return &httpNotifier{endpoint: endpoint}
+}
+
+func (notifier *httpNotifier) Notify(notification model.Notification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := utils.InitContext()
+	defer cancel()
+	_, err = middlewares.NotifyMassage(ctx, http.MethodPost, notifier.endpoint, payload)
+	return err
+}
+
+func (notifier *logNotifier) Notify(notification model.Notification) error {
+	logrus.Warn("NOTIFY_URL is not set, " + notification.Purpose + " " + notification.Channel + " to user " + notification.UserId + " was not sent")
+	return nil
+}
+
+// signedLink puts a token signed for purpose in the fragment of redirectUri, which browsers don't
+// send to servers
+func signedLink(redirectUri string, param string, purpose string, challengeId string) (string, error) {
+	link, err := url.Parse(redirectUri)
+	if err != nil {
+		return "", err
+	}
+	link.Fragment = param + "=" + challengeId + "." + challengeSignature(purpose, challengeId)
+	return link.String(), nil
+}
+
+// verifySignedToken returns the challenge of a token from signedLink
+func verifySignedToken(purpose string, token string) (string, bool) {
+	challengeId, signature, _ := strings.Cut(token, ".")
+	return challengeId, hmac.Equal([]byte(signature), []byte(challengeSignature(purpose, challengeId)))
+}
+
+func challengeSignature(purpose string, challengeId string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("SECRET_KEY")))
+	mac.Write([]byte(purpose + ":" + challengeId))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,220 @@
+package usecase
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"time"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+// IssueToken implements the token endpoint of RFC 6749, errors use the error codes of section 5.2
+func IssueToken(
+	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
+	sessionEntity repository.ISession,
+	systemEntity repository.ISystem,
+	authCodeEntity repository.IAuthCode,
+	loginHistoryEntity repository.ILoginHistory,
+	eventEntity repository.IEvent,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Cache-Control", "no-store")
+		ctx.Header("Pragma", "no-cache")
+
+		req := request.OAuthToken{}
+		if err := ctx.ShouldBind(&req); err != nil {
+			oauthError(ctx, http.StatusBadRequest, constant.OAuthInvalidRequest, err.Error())
+			return
+		}
+		switch req.GrantType {
+		case constant.GrantTypeClientCredentials:
+			issueSystemToken(ctx, systemEntity, req)
+		case constant.GrantTypeAuthorizationCode:
+			exchangeAuthCode(ctx, userEntity, attributeEntity, sessionEntity, systemEntity, authCodeEntity, loginHistoryEntity, eventEntity, req)
+		default:
+			oauthError(ctx, http.StatusBadRequest, constant.OAuthUnsupportedGrantType, "grant type "+req.GrantType+" is not supported")
+		}
+	}
+}
+
+// issueSystemToken implements the client_credentials grant
+func issueSystemToken(ctx *gin.Context, systemEntity repository.ISystem, req request.OAuthToken) {
+	clientId, clientSecret, ok := ctx.Request.BasicAuth()
+	if !ok {
+		clientId, clientSecret = req.ClientId, req.ClientSecret
+	}
+	if clientId == "" || clientSecret == "" {
+		oauthError(ctx, http.StatusUnauthorized, constant.OAuthInvalidClient, "missing client credentials")
+		return
+	}
+
+	system, err := systemEntity.GetSystemByOAuthClientId(clientId)
+	if err != nil || utils.ComparePasswordAndHashedPassword(clientSecret, system.OAuthClientSecret) != nil {
+		oauthError(ctx, http.StatusUnauthorized, constant.OAuthInvalidClient, "invalid client credentials")
+		return
+	}
+
+	scopes := system.Scopes
+	if req.Scope != "" {
+		scopes = strings.Fields(req.Scope)
+		for _, scope := range scopes {
+			if !containsString(system.Scopes, scope) {
+				oauthError(ctx, http.StatusBadRequest, constant.OAuthInvalidScope, "scope "+scope+" is not granted")
+				return
+			}
+		}
+	}
+
+	expireDate := time.Now().Add(config.SystemTokenTime)
+	token := middlewares.GenerateSystemToken(&middlewares.SystemTokenParam{
+		SystemId:       system.Id.Hex(),
+		System:         system.SystemCode,
+		ClientId:       system.ClientId,
+		Scopes:         scopes,
+		ExpirationTime: expireDate,
+	})
+	ctx.JSON(http.StatusOK, gin.H{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int64(config.SystemTokenTime.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+// RequireSystem rejects machine tokens of deleted systems, tokens issued before the last
+// credentials rotation and tokens carrying a scope the system no longer has
+func RequireSystem(systemEntity repository.ISystem) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		system, err := systemEntity.GetSystemById(ctx.GetString(middlewares.SystemId))
+		if err != nil || system.CredentialsRotatedDate == nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "system invalid"})
+			return
+		}
+		issuedAt := ctx.GetTime(middlewares.IssuedAt)
+		if issuedAt.Before(system.CredentialsRotatedDate.Truncate(time.Second)) {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+			return
+		}
+		for _, scope := range strings.Fields(ctx.GetString(middlewares.Scope)) {
+			if !containsString(system.Scopes, scope) {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+				return
+			}
+		}
+		return
+	}
+}
+
+// RotateSystemCredentials issues a new client secret, and a client id on first use. The secret is
+// only returned here, and every token issued with the previous one stops working.
+func RotateSystemCredentials(systemEntity repository.ISystem, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		system, err := systemEntity.GetSystemById(id)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		clientId := system.OAuthClientId
+		if clientId == "" {
+			clientId, err = utils.GenerateSecret("sys_", 12)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		clientSecret, err := utils.GenerateSecret("", 32)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userId := ctx.GetString(middlewares.UserId)
+		result, err := systemEntity.UpdateCredentialsById(id, clientId, utils.HashPassword(clientSecret), userId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditSystemCredentials, constant.TargetSystem, id, result.ClientId, system, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"clientId":     clientId,
+			"clientSecret": clientSecret,
+		})
+	}
+}
+
+func UpdateSystemScopes(systemEntity repository.ISystem, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.SystemScopes{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for _, scope := range req.Scopes {
+			if !containsString(constant.Scopes, scope) {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid scope " + scope})
+				return
+			}
+		}
+
+		id := ctx.Param("id")
+		req.UpdatedBy = ctx.GetString(middlewares.UserId)
+		before, _ := systemEntity.GetSystemById(id)
+		result, err := systemEntity.UpdateScopesById(id, req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditSystemScopes, constant.TargetSystem, id, result.ClientId, before, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func UpdateSystemRedirectUris(systemEntity repository.ISystem, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.SystemRedirectUris{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		id := ctx.Param("id")
+		req.UpdatedBy = ctx.GetString(middlewares.UserId)
+		before, _ := systemEntity.GetSystemById(id)
+		result, err := systemEntity.UpdateRedirectUrisById(id, req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditSystemRedirectUris, constant.TargetSystem, id, result.ClientId, before, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func oauthError(ctx *gin.Context, status int, code string, description string) {
+	ctx.AbortWithStatusJSON(status, gin.H{"error": code, "error_description": description})
+}
+
+func containsString(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package usecase
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/middlewares"
+)
+
+func (fake *fakeSystems) GetSystemById(id string) (*model.System, error) {
+	for _, system := range fake.systems {
+		if system.Id.Hex() == id {
+			return &system, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func newCredentialedSystem() model.System {
+	rotated := time.Now().Add(-time.Hour)
+	return model.System{
+		Id:                     primitive.NewObjectID(),
+		ClientId:               "ACM",
+		SystemCode:             "POS",
+		OAuthClientId:          "sys_pos",
+		OAuthClientSecret:      utils.HashPassword("pos-secret"),
+		CredentialsRotatedDate: &rotated,
+		Scopes:                 []string{constant.ScopeAuthzCheck, constant.ScopeUserRead},
+	}
+}
+
+// requestSystemToken runs the client_credentials grant with basic authentication
+func requestSystemToken(router http.Handler, clientId string, secret string, scope string) (int, map[string]interface{}) {
+	form := url.Values{"grant_type": {constant.GrantTypeClientCredentials}}
+	if scope != "" {
+		form.Set("scope", scope)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientId != "" {
+		req.SetBasicAuth(clientId, secret)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	body := map[string]interface{}{}
+	_ = json.Unmarshal(recorder.Body.Bytes(), &body)
+	return recorder.Code, body
+}
+
+func TestIssueSystemToken(t *testing.T) {
+	system := newCredentialedSystem()
+	router := gin.New()
+	router.POST("/oauth/token", IssueToken(nil, nil, nil, &fakeSystems{systems: []model.System{system}}, nil, nil, nil))
+
+	for _, test := range []struct {
+		name     string
+		clientId string
+		secret   string
+		scope    string
+		status   int
+		error    string
+		granted  string
+	}{
+		{"no credentials", "", "", "", http.StatusUnauthorized, constant.OAuthInvalidClient, ""},
+		{"unknown client", "sys_other", "pos-secret", "", http.StatusUnauthorized, constant.OAuthInvalidClient, ""},
+		{"wrong secret", "sys_pos", "wrong-secret", "", http.StatusUnauthorized, constant.OAuthInvalidClient, ""},
+		{"scope not granted", "sys_pos", "pos-secret", constant.ScopeAuthzCheck + " admin", http.StatusBadRequest, constant.OAuthInvalidScope, ""},
+		{"all scopes", "sys_pos", "pos-secret", "", http.StatusOK, "", constant.ScopeAuthzCheck + " " + constant.ScopeUserRead},
+		{"narrowed scope", "sys_pos", "pos-secret", constant.ScopeUserRead, http.StatusOK, "", constant.ScopeUserRead},
+	} {
+		code, body := requestSystemToken(router, test.clientId, test.secret, test.scope)
+		if code != test.status || (test.error != "" && body["error"] != test.error) {
+			t.Errorf("%s: answered %d %v, want %d %s", test.name, code, body, test.status, test.error)
+			continue
+		}
+		if test.status != http.StatusOK {
+			if body["access_token"] != nil {
+				t.Errorf("%s: issued a token", test.name)
+			}
+			continue
+		}
+		if body["scope"] != test.granted {
+			t.Errorf("%s: granted %v, want %q", test.name, body["scope"], test.granted)
+		}
+		claims, err := middlewares.ParseSystemToken(body["access_token"].(string))
+		if err != nil || claims.Subject != middlewares.SystemSubjectPrefix+system.Id.Hex() || claims.Scope != test.granted {
+			t.Errorf("%s: issued claims %+v, %v", test.name, claims, err)
+		}
+	}
+}
+
+func TestRequireSystemRevocation(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		change func(system *model.System)
+		status int
+	}{
+		{"current token", func(system *model.System) {}, http.StatusOK},
+		{"credentials rotated since", func(system *model.System) {
+			rotated := time.Now().Add(time.Hour)
+			system.CredentialsRotatedDate = &rotated
+		}, http.StatusUnauthorized},
+		{"scope taken away since", func(system *model.System) {
+			system.Scopes = []string{constant.ScopeAuthzCheck}
+		}, http.StatusUnauthorized},
+		{"system deleted", func(system *model.System) {
+			system.Id = primitive.NewObjectID()
+		}, http.StatusUnauthorized},
+	} {
+		system := newCredentialedSystem()
+		token := middlewares.GenerateSystemToken(&middlewares.SystemTokenParam{
+			SystemId:       system.Id.Hex(),
+			System:         system.SystemCode,
+			ClientId:       system.ClientId,
+			Scopes:         system.Scopes,
+			ExpirationTime: time.Now().Add(config.SystemTokenTime),
+		})
+		test.change(&system)
+
+		router := gin.New()
+		router.GET("/authz/check", middlewares.RequireSystemAuth(constant.ScopeAuthzCheck), RequireSystem(&fakeSystems{systems: []model.System{system}}), func(ctx *gin.Context) {
+			ctx.JSON(http.StatusOK, gin.H{"systemId": ctx.GetString(middlewares.SystemId)})
+		})
+		req := httptest.NewRequest(http.MethodGet, "/authz/check", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != test.status {
+			t.Errorf("%s: answered %d %s, want %d", test.name, recorder.Code, recorder.Body.String(), test.status)
+		}
+	}
+}
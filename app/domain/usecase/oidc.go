@@ -0,0 +1,425 @@
+package usecase
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/app/featues/view"
+	"um/middlewares"
+)
+
+// oidcBasePath is where the API is mounted
+const oidcBasePath = "/api/um/v1"
+
+// authorizeCsrfCookie holds the token the sign-in page posts back, so another site can't post the
+// form with credentials of its own
+const authorizeCsrfCookie = "um_authorize_csrf"
+
+type loginPage struct {
+	Action     string
+	SystemName string
+	Request    request.Authorize
+	Username   string
+	Error      string
+	CsrfToken  string
+}
+
+// authorizeError is an error of an authorization request, Redirect tells whether it may be sent
+// back to the redirect URI or has to be shown to the user
+type authorizeError struct {
+	Code        string
+	Description string
+	Redirect    bool
+}
+
+func OpenIdConfiguration() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		issuer := oidcIssuer()
+		ctx.JSON(http.StatusOK, gin.H{
+			"issuer":                                issuer,
+			"authorization_endpoint":                issuer + "/oauth/authorize",
+			"token_endpoint":                        issuer + "/oauth/token",
+			"userinfo_endpoint":                     issuer + "/oauth/userinfo",
+			"jwks_uri":                              issuer + "/oauth/jwks",
+			"response_types_supported":              []string{constant.ResponseTypeCode},
+			"grant_types_supported":                 []string{constant.GrantTypeAuthorizationCode, constant.GrantTypeClientCredentials},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"scopes_supported":                      []string{constant.ScopeOpenId, "profile", "email"},
+			"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+			"code_challenge_methods_supported":      []string{constant.CodeChallengeS256},
+			"claims_supported": []string{
+				"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+				"name", "given_name", "family_name", "preferred_username", "email", "email_verified", "role", "clientId",
+			},
+		})
+	}
+}
+
+func GetJwks() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"keys": middlewares.Jwks()})
+	}
+}
+
+// AuthorizePage validates an authorization request and shows the sign-in page
+func AuthorizePage(systemEntity repository.ISystem) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.Authorize{}
+		_ = ctx.ShouldBindQuery(&req)
+		system, authErr := validateAuthorize(systemEntity, req)
+		if authErr != nil {
+			rejectAuthorize(ctx, req, authErr)
+			return
+		}
+		renderLogin(ctx, http.StatusOK, loginPage{SystemName: system.SystemName, Request: req})
+	}
+}
+
+// AuthorizeLogin checks the credentials posted by the sign-in page and redirects back to the
+// system with an authorization code
+func AuthorizeLogin(
+	userEntity repository.IUser,
+	systemEntity repository.ISystem,
+	authCodeEntity repository.IAuthCode,
+	authenticators AuthenticatorChain,
+	clientSettingEntity repository.IClientSetting,
+	loginHistoryEntity repository.ILoginHistory,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.AuthorizeLogin{}
+		_ = ctx.ShouldBind(&req)
+		system, authErr := validateAuthorize(systemEntity, req.Authorize)
+		if authErr != nil {
+			rejectAuthorize(ctx, req.Authorize, authErr)
+			return
+		}
+
+		page := loginPage{SystemName: system.SystemName, Request: req.Authorize, Username: req.Username}
+		if !validAuthorizeCsrf(ctx, req.CsrfToken) {
+			page.Error = "the sign-in page expired, please sign in again"
+			renderLogin(ctx, http.StatusForbidden, page)
+			return
+		}
+		user, err := authenticate(ctx, userEntity, authenticators, clientSettingEntity, loginHistoryEntity, request.Login{
+			Username: req.Username,
+			Password: req.Password,
+			System:   system.SystemCode,
+			ClientId: system.ClientId,
+		})
+		if err == nil && user.ClientId != system.ClientId {
+			err = errors.New("this account can't sign in to " + system.SystemName)
+		}
+		if err == nil && !isUserActive(user) {
+			err = errors.New("user is not active")
+		}
+		if err == nil && len(user.Webauthn) > 0 {
+			recordLoginHistory(ctx, loginHistoryEntity, model.LoginHistory{
+				Event:         constant.LoginEventLogin,
+				UserId:        user.Id.Hex(),
+				Username:      user.Username,
+				ClientId:      user.ClientId,
+				System:        system.SystemCode,
+				FailureReason: constant.LoginFailurePasskeyRequired,
+			})
+			err = errors.New("this account confirms sign-ins with a passkey, which this page doesn't support")
+		}
+		if err != nil {
+			page.Error = err.Error()
+			renderLogin(ctx, http.StatusUnauthorized, page)
+			return
+		}
+
+		code, err := utils.GenerateSecret("", 32)
+		if err == nil {
+			err = authCodeEntity.CreateAuthCode(code, model.AuthCode{
+				SystemId:      system.Id.Hex(),
+				OAuthClientId: system.OAuthClientId,
+				RedirectUri:   req.RedirectUri,
+				UserId:        user.Id.Hex(),
+				Scope:         req.Scope,
+				Nonce:         req.Nonce,
+				CodeChallenge: req.CodeChallenge,
+				AuthTime:      time.Now(),
+			}, config.AuthCodeTime)
+		}
+		if err != nil {
+			logrus.Error(err)
+			rejectAuthorize(ctx, req.Authorize, &authorizeError{Code: constant.OAuthServerError, Redirect: true})
+			return
+		}
+
+		redirect, _ := url.Parse(req.RedirectUri)
+		query := redirect.Query()
+		query.Set("code", code)
+		if req.State != "" {
+			query.Set("state", req.State)
+		}
+		redirect.RawQuery = query.Encode()
+		ctx.Redirect(http.StatusFound, redirect.String())
+	}
+}
+
+// UserInfo returns the claims of the user behind an access token issued by the token endpoint
+func UserInfo(userEntity repository.IUser, attributeEntity repository.IAttribute) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := userEntity.GetUserById(ctx.GetString(middlewares.UserId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_token"})
+			return
+		}
+		claims := userClaims(user, attributeClaims(attributeEntity, user))
+		result := gin.H{
+			"sub":                user.Id.Hex(),
+			"name":               claims.Name,
+			"given_name":         claims.GivenName,
+			"family_name":        claims.FamilyName,
+			"preferred_username": claims.PreferredUsername,
+			"email":              claims.Email,
+			"role":               claims.Role,
+			"clientId":           claims.ClientId,
+		}
+		if claims.EmailVerified != nil {
+			result["email_verified"] = *claims.EmailVerified
+		}
+		if claims.Attributes != nil {
+			result["attributes"] = claims.Attributes
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// exchangeAuthCode implements the authorization_code grant. PKCE is required for every client, and
+// the client secret too unless the system is registered as a public client.
+func exchangeAuthCode(
+	ctx *gin.Context,
+	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
+	sessionEntity repository.ISession,
+	systemEntity repository.ISystem,
+	authCodeEntity repository.IAuthCode,
+	loginHistoryEntity repository.ILoginHistory,
+	eventEntity repository.IEvent,
+	req request.OAuthToken,
+) {
+	clientId, clientSecret, ok := ctx.Request.BasicAuth()
+	if !ok {
+		clientId, clientSecret = req.ClientId, req.ClientSecret
+	}
+	if clientId == "" || req.Code == "" || req.CodeVerifier == "" {
+		oauthError(ctx, http.StatusBadRequest, constant.OAuthInvalidRequest, "client_id, code and code_verifier are required")
+		return
+	}
+	system, err := systemEntity.GetSystemByOAuthClientId(clientId)
+	if err != nil || !authenticateCodeClient(system, clientSecret) {
+		oauthError(ctx, http.StatusUnauthorized, constant.OAuthInvalidClient, "invalid client credentials")
+		return
+	}
+
+	code, err := authCodeEntity.ConsumeAuthCode(req.Code)
+	if err != nil || code.OAuthClientId != clientId || code.SystemId != system.Id.Hex() || code.RedirectUri != req.RedirectUri {
+		oauthError(ctx, http.StatusBadRequest, constant.OAuthInvalidGrant, "invalid authorization code")
+		return
+	}
+	sum := sha256.Sum256([]byte(req.CodeVerifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(code.CodeChallenge)) != 1 {
+		oauthError(ctx, http.StatusBadRequest, constant.OAuthInvalidGrant, "code verifier does not match")
+		return
+	}
+
+	user, err := userEntity.GetUserById(code.UserId)
+	if err != nil || !isUserActive(user) {
+		oauthError(ctx, http.StatusBadRequest, constant.OAuthInvalidGrant, "user is not active")
+		return
+	}
+
+	sessionId, err := startSession(ctx, userEntity, sessionEntity, loginHistoryEntity, eventEntity, user, system.SystemCode)
+	if err != nil {
+		oauthError(ctx, http.StatusInternalServerError, constant.OAuthServerError, err.Error())
+		return
+	}
+	attributes := attributeClaims(attributeEntity, user)
+	expiration := sessionTime(user, config.AccessTokenTime)
+	accessToken := middlewares.GenerateJwtToken(&middlewares.TokenParam{
+		SessionId:      sessionId,
+		Role:           user.Role,
+		System:         system.SystemCode,
+		ClientId:       user.ClientId,
+		Attributes:     attributes,
+		ExpirationTime: time.Now().Add(expiration),
+	})
+
+	claims := userClaims(user, attributes)
+	claims.Nonce = code.Nonce
+	claims.AuthTime = code.AuthTime.Unix()
+	claims.Issuer = oidcIssuer()
+	claims.Subject = user.Id.Hex()
+	claims.Audience = jwt.ClaimStrings{clientId}
+	idToken, err := middlewares.GenerateIdToken(claims, time.Now().Add(config.IdTokenTime))
+	if err != nil {
+		oauthError(ctx, http.StatusInternalServerError, constant.OAuthServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int64(expiration.Seconds()),
+		"id_token":     idToken,
+		"scope":        code.Scope,
+	})
+}
+
+// authenticateCodeClient checks the secret of a confidential client. A public client may send no
+// secret, but one it sends must still be the right one.
+func authenticateCodeClient(system *model.System, clientSecret string) bool {
+	if clientSecret == "" {
+		return system.PublicClient
+	}
+	return system.OAuthClientSecret != "" && utils.ComparePasswordAndHashedPassword(clientSecret, system.OAuthClientSecret) == nil
+}
+
+func validateAuthorize(systemEntity repository.ISystem, req request.Authorize) (*model.System, *authorizeError) {
+	if req.ClientId == "" {
+		return nil, &authorizeError{Code: constant.OAuthInvalidRequest, Description: "client_id is required"}
+	}
+	system, err := systemEntity.GetSystemByOAuthClientId(req.ClientId)
+	if err != nil {
+		return nil, &authorizeError{Code: constant.OAuthInvalidClient, Description: "unknown client"}
+	}
+	if !containsString(system.RedirectUris, req.RedirectUri) {
+		return nil, &authorizeError{Code: constant.OAuthInvalidRequest, Description: "redirect_uri is not registered for this client"}
+	}
+	if req.ResponseType != constant.ResponseTypeCode {
+		return nil, &authorizeError{Code: constant.OAuthUnsupportedResponseType, Description: "only the code response type is supported", Redirect: true}
+	}
+	if !containsString(strings.Fields(req.Scope), constant.ScopeOpenId) {
+		return nil, &authorizeError{Code: constant.OAuthInvalidScope, Description: "the openid scope is required", Redirect: true}
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != constant.CodeChallengeS256 {
+		return nil, &authorizeError{Code: constant.OAuthInvalidRequest, Description: "PKCE with S256 is required", Redirect: true}
+	}
+	return system, nil
+}
+
+func rejectAuthorize(ctx *gin.Context, req request.Authorize, authErr *authorizeError) {
+	if !authErr.Redirect {
+		renderPage(ctx, http.StatusBadRequest, view.Error, authErr.Description)
+		return
+	}
+	redirect, _ := url.Parse(req.RedirectUri)
+	query := redirect.Query()
+	query.Set("error", authErr.Code)
+	if authErr.Description != "" {
+		query.Set("error_description", authErr.Description)
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	redirect.RawQuery = query.Encode()
+	ctx.Redirect(http.StatusFound, redirect.String())
+}
+
+func renderLogin(ctx *gin.Context, status int, page loginPage) {
+	page.Action = oidcBasePath + "/oauth/authorize"
+	token, err := authorizeCsrfToken(ctx)
+	if err != nil {
+		logrus.Error(err)
+		renderPage(ctx, http.StatusInternalServerError, view.Error, "the sign-in page is not available, try again later")
+		return
+	}
+	page.CsrfToken = token
+	renderPage(ctx, status, view.Login, page)
+}
+
+// authorizeCsrfToken keeps the token of the browser so pages open in other tabs stay usable, or
+// issues one. The cookie is only sent by pages of the API itself.
+func authorizeCsrfToken(ctx *gin.Context) (string, error) {
+	token, err := ctx.Cookie(authorizeCsrfCookie)
+	if err != nil || len(token) < 32 {
+		token, err = utils.GenerateSecret("", 32)
+		if err != nil {
+			return "", err
+		}
+	}
+	ctx.SetSameSite(http.SameSiteStrictMode)
+	secure := strings.HasPrefix(oidcIssuer(), "https://")
+	ctx.SetCookie(authorizeCsrfCookie, token, int(config.AuthorizeCsrfTime.Seconds()), oidcBasePath+"/oauth/authorize", "", secure, true)
+	return token, nil
+}
+
+// validAuthorizeCsrf compares the token posted by the sign-in page with the one of its cookie
+func validAuthorizeCsrf(ctx *gin.Context, token string) bool {
+	cookie, err := ctx.Cookie(authorizeCsrfCookie)
+	if err != nil || cookie == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(token)) == 1
+}
+
+func renderPage(ctx *gin.Context, status int, page *template.Template, data interface{}) {
+	// the sign-in page must not be framed by another site
+	ctx.Header("X-Frame-Options", "DENY")
+	ctx.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Status(status)
+	ctx.Header("Content-Type", "text/html; charset=utf-8")
+	err := page.Execute(ctx.Writer, data)
+	if err != nil {
+		logrus.Error(err)
+	}
+	ctx.Abort()
+}
+
+// CheckOidcIssuer makes sure OIDC_ISSUER is an absolute http(s) URL, the API doesn't start without it
+func CheckOidcIssuer() error {
+	issuer, err := url.Parse(os.Getenv("OIDC_ISSUER"))
+	if err != nil {
+		return err
+	}
+	if (issuer.Scheme != "https" && issuer.Scheme != "http") || issuer.Host == "" {
+		return errors.New("OIDC_ISSUER must be the public URL of the API, e.g. https://um.example.com" + oidcBasePath)
+	}
+	return nil
+}
+
+// oidcIssuer reads the issuer from OIDC_ISSUER, which StartGin requires. It is never taken from the
+// request, the Host header is up to the client and the issuer is signed into tokens.
+func oidcIssuer() string {
+	return strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/")
+}
+
+func userClaims(user *model.User, attributes map[string]interface{}) *middlewares.IdClaims {
+	claims := &middlewares.IdClaims{
+		Name:              strings.TrimSpace(user.FirstName + " " + user.LastName),
+		GivenName:         user.FirstName,
+		FamilyName:        user.LastName,
+		PreferredUsername: user.Username,
+		Email:             user.Email,
+		Role:              user.Role,
+		ClientId:          user.ClientId,
+		Attributes:        attributes,
+	}
+	if user.Email != "" {
+		emailVerified := user.EmailVerified
+		claims.EmailVerified = &emailVerified
+	}
+	return claims
+}
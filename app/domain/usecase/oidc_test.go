@@ -0,0 +1,280 @@
+package usecase
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/middlewares"
+)
+
+const (
+	testClientSecret = "client-secret-1"
+	testCodeVerifier = "verifier-0123456789-0123456789-0123456789"
+	testRedirectUri  = "https://app.example.com/callback"
+)
+
+type fakeAuthCodes struct {
+	repository.IAuthCode
+	mu    sync.Mutex
+	codes map[string]model.AuthCode
+}
+
+func newFakeAuthCodes() *fakeAuthCodes {
+	return &fakeAuthCodes{codes: map[string]model.AuthCode{}}
+}
+
+func (fake *fakeAuthCodes) CreateAuthCode(code string, item model.AuthCode, expiration time.Duration) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.codes[code] = item
+	return nil
+}
+
+func (fake *fakeAuthCodes) ConsumeAuthCode(code string) (*model.AuthCode, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	item, ok := fake.codes[code]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	delete(fake.codes, code)
+	return &item, nil
+}
+
+func TestExchangeAuthCodeClientSecret(t *testing.T) {
+	user := &model.User{Id: primitive.NewObjectID(), Username: "jane", ClientId: "ACME", Role: constant.USER, Status: constant.ACTIVE}
+	confidential := model.System{Id: primitive.NewObjectID(), SystemCode: "PORTAL", OAuthClientId: "sys_portal", OAuthClientSecret: utils.HashPassword(testClientSecret)}
+	public := model.System{Id: primitive.NewObjectID(), SystemCode: "MOBILE", OAuthClientId: "sys_mobile", OAuthClientSecret: utils.HashPassword(testClientSecret), PublicClient: true}
+	authCodes := newFakeAuthCodes()
+	router := gin.New()
+	router.POST("/oauth/token", IssueToken(newFakeUsers(user), &fakeAttributes{}, newFakeSessions(), &fakeSystems{systems: []model.System{confidential, public}}, authCodes, &fakeHistories{}, &fakeEvents{}))
+
+	for _, test := range []struct {
+		name   string
+		system model.System
+		secret string
+		status int
+	}{
+		{"confidential client with its secret", confidential, testClientSecret, http.StatusOK},
+		{"confidential client without a secret", confidential, "", http.StatusUnauthorized},
+		{"confidential client with a wrong secret", confidential, "wrong-secret", http.StatusUnauthorized},
+		{"public client without a secret", public, "", http.StatusOK},
+		{"public client with a wrong secret", public, "wrong-secret", http.StatusUnauthorized},
+	} {
+		recorder := exchangeTestCode(router, authCodes, test.system, user, test.secret)
+		if recorder.Code != test.status {
+			t.Errorf("%s: answered %d %s, want %d", test.name, recorder.Code, recorder.Body.String(), test.status)
+			continue
+		}
+		body := map[string]interface{}{}
+		_ = json.Unmarshal(recorder.Body.Bytes(), &body)
+		if test.status == http.StatusUnauthorized && body["error"] != constant.OAuthInvalidClient {
+			t.Errorf("%s: answered %v, want %s", test.name, body, constant.OAuthInvalidClient)
+		}
+	}
+}
+
+func TestExchangeAuthCodeValidity(t *testing.T) {
+	validUntil := time.Now().Add(time.Hour)
+	user := &model.User{Id: primitive.NewObjectID(), Username: "jane", ClientId: "ACME", Role: constant.USER, Status: constant.ACTIVE, ValidUntil: &validUntil}
+	system := model.System{Id: primitive.NewObjectID(), SystemCode: "PORTAL", OAuthClientId: "sys_portal", OAuthClientSecret: utils.HashPassword(testClientSecret)}
+	authCodes := newFakeAuthCodes()
+	router := gin.New()
+	router.POST("/oauth/token", IssueToken(newFakeUsers(user), &fakeAttributes{}, newFakeSessions(), &fakeSystems{systems: []model.System{system}}, authCodes, &fakeHistories{}, &fakeEvents{}))
+
+	recorder := exchangeTestCode(router, authCodes, system, user, testClientSecret)
+	body := map[string]interface{}{}
+	_ = json.Unmarshal(recorder.Body.Bytes(), &body)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("answered %d %v", recorder.Code, body)
+	}
+	if expiresIn, _ := body["expires_in"].(float64); expiresIn <= 0 || expiresIn > time.Hour.Seconds() {
+		t.Fatalf("expires_in is %v, want the token to end with validUntil in an hour", body["expires_in"])
+	}
+	claims, err := middlewares.ParseJwtToken(body["access_token"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ExpiresAt == nil || claims.ExpiresAt.After(validUntil.Add(time.Second)) {
+		t.Fatalf("access token expires at %v, after validUntil %v", claims.ExpiresAt, validUntil)
+	}
+}
+
+// exchangeTestCode stores an authorization code of user for system and exchanges it at /oauth/token
+func exchangeTestCode(router http.Handler, authCodes *fakeAuthCodes, system model.System, user *model.User, secret string) *httptest.ResponseRecorder {
+	sum := sha256.Sum256([]byte(testCodeVerifier))
+	code := primitive.NewObjectID().Hex()
+	_ = authCodes.CreateAuthCode(code, model.AuthCode{
+		SystemId:      system.Id.Hex(),
+		OAuthClientId: system.OAuthClientId,
+		RedirectUri:   testRedirectUri,
+		UserId:        user.Id.Hex(),
+		Scope:         "openid",
+		CodeChallenge: base64.RawURLEncoding.EncodeToString(sum[:]),
+		AuthTime:      time.Now(),
+	}, time.Minute)
+	form := url.Values{
+		"grant_type":    {constant.GrantTypeAuthorizationCode},
+		"client_id":     {system.OAuthClientId},
+		"code":          {code},
+		"redirect_uri":  {testRedirectUri},
+		"code_verifier": {testCodeVerifier},
+	}
+	if secret != "" {
+		form.Set("client_secret", secret)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestOidcIssuerIgnoresHost(t *testing.T) {
+	for _, test := range []struct {
+		issuer string
+		valid  bool
+	}{
+		{"https://um.example.com/api/um/v1", true},
+		{"http://localhost:8585/api/um/v1/", true},
+		{"", false},
+		{"um.example.com/api/um/v1", false},
+		{"ftp://um.example.com", false},
+	} {
+		t.Setenv("OIDC_ISSUER", test.issuer)
+		if err := CheckOidcIssuer(); (err == nil) != test.valid {
+			t.Errorf("CheckOidcIssuer with %q: %v, want valid %v", test.issuer, err, test.valid)
+		}
+	}
+
+	t.Setenv("OIDC_ISSUER", "https://um.example.com/api/um/v1/")
+	router := gin.New()
+	router.GET("/.well-known/openid-configuration", OpenIdConfiguration())
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+	req.Host = "evil.example.net"
+	req.Header.Set("X-Forwarded-Proto", "http")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	body := map[string]interface{}{}
+	_ = json.Unmarshal(recorder.Body.Bytes(), &body)
+	if body["issuer"] != "https://um.example.com/api/um/v1" || body["token_endpoint"] != "https://um.example.com/api/um/v1/oauth/token" {
+		t.Fatalf("discovery answered %v, want the configured issuer whatever the Host", body)
+	}
+}
+
+func TestAuthorizeLoginCsrf(t *testing.T) {
+	user := &model.User{Id: primitive.NewObjectID(), Username: "jane", Password: utils.HashPassword("correct horse 42"), ClientId: "ACME", Role: constant.USER, Status: constant.ACTIVE}
+	system := model.System{Id: primitive.NewObjectID(), ClientId: "ACME", SystemName: "Portal", SystemCode: "PORTAL", OAuthClientId: "sys_portal", RedirectUris: []string{testRedirectUri}}
+	systems := &fakeSystems{systems: []model.System{system}}
+	histories := &fakeHistories{}
+	router := gin.New()
+	router.GET("/oauth/authorize", AuthorizePage(systems))
+	router.POST("/oauth/authorize", AuthorizeLogin(newFakeUsers(user), systems, newFakeAuthCodes(), NewAuthenticatorChain(NewLocalAuthenticator()), &fakeClientSettings{}, histories))
+
+	form := url.Values{
+		"response_type":         {constant.ResponseTypeCode},
+		"client_id":             {system.OAuthClientId},
+		"redirect_uri":          {testRedirectUri},
+		"scope":                 {"openid"},
+		"code_challenge":        {"challenge"},
+		"code_challenge_method": {constant.CodeChallengeS256},
+	}
+	page := httptest.NewRecorder()
+	router.ServeHTTP(page, httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+form.Encode(), nil))
+	var cookie *http.Cookie
+	for _, item := range page.Result().Cookies() {
+		if item.Name == authorizeCsrfCookie {
+			cookie = item
+		}
+	}
+	if page.Code != http.StatusOK || cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("sign-in page answered %d with cookie %+v", page.Code, cookie)
+	}
+	if !strings.Contains(page.Body.String(), `name="csrf_token" value="`+cookie.Value+`"`) {
+		t.Fatalf("sign-in page doesn't carry the token of its cookie")
+	}
+
+	for _, test := range []struct {
+		name   string
+		cookie string
+		token  string
+		status int
+	}{
+		{"form posted by another site", "", "", http.StatusForbidden},
+		{"token without its cookie", "", cookie.Value, http.StatusForbidden},
+		{"token of another cookie", strings.Repeat("x", 43), cookie.Value, http.StatusForbidden},
+		{"form of the sign-in page", cookie.Value, cookie.Value, http.StatusFound},
+	} {
+		histories.items = nil
+		post := url.Values{"username": {"jane"}, "password": {"correct horse 42"}, "csrf_token": {test.token}}
+		for key, values := range form {
+			post[key] = values
+		}
+		req := httptest.NewRequest(http.MethodPost, "/oauth/authorize", strings.NewReader(post.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: authorizeCsrfCookie, Value: test.cookie})
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != test.status {
+			t.Errorf("%s: answered %d, want %d", test.name, recorder.Code, test.status)
+			continue
+		}
+		if test.status == http.StatusForbidden && len(histories.items) != 0 {
+			t.Errorf("%s: checked the credentials", test.name)
+		}
+		if test.status == http.StatusFound && !strings.Contains(recorder.Header().Get("Location"), "code=") {
+			t.Errorf("%s: redirected to %s, want a code", test.name, recorder.Header().Get("Location"))
+		}
+	}
+}
+
+func TestUserInfoEmailVerified(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		email         string
+		emailVerified bool
+		want          interface{}
+	}{
+		{"verified email", "jane@acme.test", true, true},
+		{"unverified email", "jane@acme.test", false, false},
+		{"no email", "", false, nil},
+	} {
+		jane := &model.User{Id: primitive.NewObjectID(), Username: "jane", ClientId: "ACM", Role: constant.USER, Status: constant.ACTIVE, Email: test.email, EmailVerified: test.emailVerified, Phone: "+15550100", PhoneVerified: true}
+		router := gin.New()
+		router.GET("/oauth/userinfo", func(ctx *gin.Context) {
+			ctx.Set(middlewares.UserId, jane.Id.Hex())
+		}, UserInfo(newFakeUsers(jane), &fakeAttributes{}))
+		status, body := serveJson(t, router, http.MethodGet, "/oauth/userinfo", nil)
+		if status != http.StatusOK || body["email_verified"] != test.want {
+			t.Errorf("%s: userinfo answered %d %v, want email_verified %v", test.name, status, body, test.want)
+		}
+		if _, ok := body["phone_number"]; ok {
+			t.Errorf("%s: userinfo answered a phone_number", test.name)
+		}
+
+		// the ID token carries the same claim
+		data, _ := json.Marshal(userClaims(jane, nil))
+		claims := map[string]interface{}{}
+		_ = json.Unmarshal(data, &claims)
+		if claims["email_verified"] != test.want {
+			t.Errorf("%s: ID token claims %v, want email_verified %v", test.name, claims, test.want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package usecase
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+)
+
+var errPasswordlessInvalid = errors.New("invalid or expired code")
+
+// PasswordlessStart sends a one-time code or a single-use link to the email or phone of a user. The
+// answer is the same whether or not the user exists and can sign in this way, so it can't be used
+// to find accounts.
+func PasswordlessStart(
+	userEntity repository.IUser,
+	systemEntity repository.ISystem,
+	clientSettingEntity repository.IClientSetting,
+	passwordlessEntity repository.IPasswordless,
+	notifier Notifier,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.PasswordlessStart{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		challengeId, err := utils.GenerateSecret("", 16)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		err = sendPasswordless(userEntity, systemEntity, clientSettingEntity, passwordlessEntity, notifier, challengeId, req)
+		if err != nil {
+			logrus.Info("passwordless login of " + req.Username + " not sent: " + err.Error())
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"challengeId": challengeId,
+			"expiresIn":   int(config.PasswordlessTime.Seconds()),
+		})
+	}
+}
+
+// PasswordlessVerify exchanges a code with its challengeId, or the token of a link, for an access
+// token, or for the passkey challenge of users who have one
+func PasswordlessVerify(
+	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
+	sessionEntity repository.ISession,
+	clientSettingEntity repository.IClientSetting,
+	passwordlessEntity repository.IPasswordless,
+	loginHistoryEntity repository.ILoginHistory,
+	eventEntity repository.IEvent,
+	relyingParty *webauthn.WebAuthn,
+	webauthnEntity repository.IWebauthn,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.PasswordlessVerify{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		history := model.LoginHistory{Event: constant.LoginEventLogin}
+		fail := func(reason string, err error) {
+			if history.UserId != "" {
+				history.FailureReason = reason
+				recordLoginHistory(ctx, loginHistoryEntity, history)
+			}
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		}
+
+		challenge, err := verifyPasswordless(passwordlessEntity, req)
+		if challenge != nil {
+			history.UserId = challenge.UserId
+			history.ClientId = challenge.ClientId
+			history.System = challenge.System
+		}
+		if err != nil {
+			fail(constant.LoginFailureWrongCode, err)
+			return
+		}
+
+		user, err := userEntity.GetUserById(challenge.UserId)
+		if err != nil {
+			fail(constant.LoginFailureUserNotFound, errPasswordlessInvalid)
+			return
+		}
+		history.Username = user.Username
+		if !isUserActive(user) {
+			fail(constant.LoginFailureUserInactive, errors.New("user is not active"))
+			return
+		}
+		setting, err := clientSettingEntity.GetClientSetting(user.ClientId)
+		if err != nil || !setting.PasswordlessEnabled {
+			fail(constant.LoginFailurePasswordless, errors.New("passwordless login is disabled"))
+			return
+		}
+		completeLogin(ctx, userEntity, attributeEntity, sessionEntity, loginHistoryEntity, eventEntity, relyingParty, webauthnEntity, user, challenge.System)
+	}
+}
+
+func sendPasswordless(
+	userEntity repository.IUser,
+	systemEntity repository.ISystem,
+	clientSettingEntity repository.IClientSetting,
+	passwordlessEntity repository.IPasswordless,
+	notifier Notifier,
+	challengeId string,
+	req request.PasswordlessStart,
+) error {
+	user, err := userEntity.GetUserByUsername(req.Username)
+	if err != nil {
+		return err
+	}
+	if user.Role == constant.SUPER {
+		return errors.New("SUPER users sign in with their password")
+	}
+	if !isUserActive(user) {
+		return errors.New("user is not active")
+	}
+	setting, err := clientSettingEntity.GetClientSetting(user.ClientId)
+	if err != nil || !setting.PasswordlessEnabled {
+		return errors.New("passwordless login is disabled")
+	}
+	channel, address := passwordlessAddress(user, req.Channel)
+	if address == "" {
+		return errors.New("no verified address to send to")
+	}
+
+	challenge := model.PasswordlessChallenge{
+		UserId:     user.Id.Hex(),
+		ClientId:   user.ClientId,
+		System:     req.System,
+		Method:     req.Method,
+		ExpireDate: time.Now().Add(config.PasswordlessTime),
+	}
+	notification := model.Notification{
+		Purpose:  constant.NotificationPasswordless,
+		Channel:  channel,
+		To:       address,
+		UserId:   user.Id.Hex(),
+		ClientId: user.ClientId,
+	}
+	minutes := strconv.Itoa(int(config.PasswordlessTime.Minutes()))
+	switch req.Method {
+	case constant.PasswordlessCode:
+		code := utils.GenerateCode(constant.PasswordlessCodeLength)
+		if code == "" {
+			return errors.New("can't generate a code")
+		}
+		challenge.CodeHash = utils.HashToken(challengeId + code)
+		notification.Code = code
+		notification.Subject = "Your sign-in code"
+		notification.Message = "Your sign-in code is " + code + ". It expires in " + minutes + " minutes."
+	case constant.PasswordlessLink:
+		system, err := systemEntity.GetSystem(user.ClientId, req.System)
+		if err != nil {
+			return err
+		}
+		if !containsString(system.RedirectUris, req.RedirectUri) {
+			return errors.New("redirectUri is not registered for " + req.System)
+		}
+		link, err := signedLink(req.RedirectUri, constant.PasswordlessTokenParam, constant.NotificationPasswordless, challengeId)
+		if err != nil {
+			return err
+		}
+		notification.Link = link
+		notification.Subject = "Your sign-in link"
+		notification.Message = "Sign in with " + link + " within " + minutes + " minutes."
+	}
+
+	started, err := passwordlessEntity.StartCooldown(user.Id.Hex(), config.PasswordlessResendTime)
+	if err != nil {
+		return err
+	}
+	if !started {
+		return errors.New("a code was sent less than " + config.PasswordlessResendTime.String() + " ago")
+	}
+	err = passwordlessEntity.CreateChallenge(challengeId, challenge, config.PasswordlessTime)
+	if err != nil {
+		return err
+	}
+	return notifier.Notify(notification)
+}
+
+// verifyPasswordless checks a code or a link and consumes its challenge. A challenge is burnt after
+// PasswordlessMaxAttempts wrong codes. The challenge is returned with the error once it is known,
+// for the login history.
+func verifyPasswordless(passwordlessEntity repository.IPasswordless, req request.PasswordlessVerify) (*model.PasswordlessChallenge, error) {
+	if req.Token != "" {
+		challengeId, ok := verifySignedToken(constant.NotificationPasswordless, req.Token)
+		if !ok {
+			return nil, errPasswordlessInvalid
+		}
+		challenge, err := passwordlessEntity.ConsumeChallenge(challengeId)
+		if err != nil {
+			return nil, errPasswordlessInvalid
+		}
+		if challenge.Method != constant.PasswordlessLink {
+			return challenge, errPasswordlessInvalid
+		}
+		return challenge, nil
+	}
+
+	challenge, err := passwordlessEntity.GetChallenge(req.ChallengeId)
+	if err != nil {
+		return nil, errPasswordlessInvalid
+	}
+	if challenge.Method != constant.PasswordlessCode {
+		return challenge, errPasswordlessInvalid
+	}
+	codeHash := utils.HashToken(req.ChallengeId + req.Code)
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(challenge.CodeHash)) != 1 {
+		attempts, err := passwordlessEntity.CountAttempt(req.ChallengeId, config.PasswordlessTime)
+		if err != nil || attempts >= constant.PasswordlessMaxAttempts {
+			_, _ = passwordlessEntity.ConsumeChallenge(req.ChallengeId)
+		}
+		return challenge, errPasswordlessInvalid
+	}
+	// consuming fails when a concurrent request used the code first
+	_, err = passwordlessEntity.ConsumeChallenge(req.ChallengeId)
+	if err != nil {
+		return challenge, errPasswordlessInvalid
+	}
+	return challenge, nil
+}
+
+// passwordlessAddress picks the verified address of the channel asked for, or the verified email and
+// then the verified phone
+func passwordlessAddress(user *model.User, channel string) (string, string) {
+	email := ""
+	if user.EmailVerified {
+		email = user.Email
+	}
+	phone := ""
+	if user.PhoneVerified {
+		phone = user.Phone
+	}
+	switch {
+	case channel == constant.ChannelEmail:
+		return channel, email
+	case channel == constant.ChannelSms:
+		return channel, phone
+	case email != "":
+		return constant.ChannelEmail, email
+	}
+	return constant.ChannelSms, phone
+}
@@ -0,0 +1,283 @@
+package usecase
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+)
+
+// fakePasswordless keeps challenges, attempts and cooldowns in memory without expiring them
+type fakePasswordless struct {
+	repository.IPasswordless
+	mu         sync.Mutex
+	challenges map[string]model.PasswordlessChallenge
+	attempts   map[string]int64
+	cooldowns  map[string]bool
+}
+
+func newFakePasswordless() *fakePasswordless {
+	return &fakePasswordless{
+		challenges: map[string]model.PasswordlessChallenge{},
+		attempts:   map[string]int64{},
+		cooldowns:  map[string]bool{},
+	}
+}
+
+func (fake *fakePasswordless) CreateChallenge(id string, item model.PasswordlessChallenge, expiration time.Duration) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.challenges[id] = item
+	return nil
+}
+
+func (fake *fakePasswordless) GetChallenge(id string) (*model.PasswordlessChallenge, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	item, ok := fake.challenges[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &item, nil
+}
+
+func (fake *fakePasswordless) ConsumeChallenge(id string) (*model.PasswordlessChallenge, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	item, ok := fake.challenges[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	delete(fake.challenges, id)
+	return &item, nil
+}
+
+func (fake *fakePasswordless) CountAttempt(id string, expiration time.Duration) (int64, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.attempts[id]++
+	return fake.attempts[id], nil
+}
+
+func (fake *fakePasswordless) StartCooldown(userId string, expiration time.Duration) (bool, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.cooldowns[userId] {
+		return false, nil
+	}
+	fake.cooldowns[userId] = true
+	return true, nil
+}
+
+type passwordlessHarness struct {
+	router       *gin.Engine
+	passwordless *fakePasswordless
+	notifier     *fakeNotifier
+	histories    *fakeHistories
+}
+
+func newPasswordlessHarness(users ...*model.User) *passwordlessHarness {
+	harness := &passwordlessHarness{passwordless: newFakePasswordless(), notifier: &fakeNotifier{}, histories: &fakeHistories{}}
+	userEntity := newFakeUsers(users...)
+	systems := &fakeSystems{systems: []model.System{{ClientId: "ACM", SystemCode: "POS", RedirectUris: []string{"https://pos.acme.test/signin"}}}}
+	settings := &fakeClientSettings{settings: []model.ClientSetting{{ClientId: "ACM", PasswordlessEnabled: true}}}
+	harness.router = gin.New()
+	harness.router.POST("/passwordless/start", PasswordlessStart(userEntity, systems, settings, harness.passwordless, harness.notifier))
+	harness.router.POST("/passwordless/verify", PasswordlessVerify(userEntity, &fakeAttributes{}, newFakeSessions(), settings, harness.passwordless, harness.histories, &fakeEvents{}, nil, nil))
+	return harness
+}
+
+// start asks for a code or a link and returns the challengeId, and the notification sent if any
+func (harness *passwordlessHarness) start(t *testing.T, username string, method string) (string, *model.Notification) {
+	t.Helper()
+	sent := len(harness.notifier.notifications)
+	body := gin.H{"username": username, "system": "POS", "method": method}
+	if method == constant.PasswordlessLink {
+		body["redirectUri"] = "https://pos.acme.test/signin"
+	}
+	status, result := serveJson(t, harness.router, http.MethodPost, "/passwordless/start", body)
+	if status != http.StatusOK {
+		t.Fatalf("start %s: answered %d %v", username, status, result)
+	}
+	challengeId, _ := result["challengeId"].(string)
+	if len(harness.notifier.notifications) == sent {
+		return challengeId, nil
+	}
+	return challengeId, &harness.notifier.notifications[len(harness.notifier.notifications)-1]
+}
+
+func (harness *passwordlessHarness) verify(t *testing.T, body gin.H) (int, map[string]interface{}) {
+	t.Helper()
+	return serveJson(t, harness.router, http.MethodPost, "/passwordless/verify", body)
+}
+
+// linkToken reads the token from the fragment of a sign-in link
+func linkToken(t *testing.T, link string) string {
+	t.Helper()
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimPrefix(parsed.Fragment, constant.PasswordlessTokenParam+"=")
+}
+
+func passwordlessUser(username string, clientId string, role string, status string) *model.User {
+	return &model.User{Id: primitive.NewObjectID(), Username: username, ClientId: clientId, Role: role, Status: status, Email: username + "@acme.test", EmailVerified: true}
+}
+
+func TestPasswordlessStartSameAnswer(t *testing.T) {
+	harness := newPasswordlessHarness(
+		passwordlessUser("jane", "ACM", constant.USER, constant.ACTIVE),
+		passwordlessUser("john", "ACM", constant.USER, constant.INACTIVE),
+		passwordlessUser("root", "ACM", constant.SUPER, constant.ACTIVE),
+		passwordlessUser("jim", "GLB", constant.USER, constant.ACTIVE),
+	)
+	for _, test := range []struct {
+		username string
+		sent     bool
+	}{
+		{"jane", true},
+		{"joan", false},
+		{"john", false},
+		{"root", false},
+		{"jim", false},
+	} {
+		status, result := serveJson(t, harness.router, http.MethodPost, "/passwordless/start", gin.H{"username": test.username, "system": "POS", "method": "code"})
+		challengeId, _ := result["challengeId"].(string)
+		if status != http.StatusOK || len(result) != 2 || len(challengeId) == 0 || result["expiresIn"] != float64(600) {
+			t.Errorf("%s: answered %d %v, want a challengeId and expiresIn", test.username, status, result)
+		}
+		_, stored := harness.passwordless.challenges[challengeId]
+		if stored != test.sent {
+			t.Errorf("%s: stored a challenge %v, want %v", test.username, stored, test.sent)
+		}
+	}
+	if len(harness.notifier.notifications) != 1 || harness.notifier.notifications[0].To != "jane@acme.test" {
+		t.Errorf("sent %v, want one code to jane", harness.notifier.notifications)
+	}
+}
+
+func TestPasswordlessCodeBurned(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		wrong  int
+		status int
+	}{
+		{"right code", 0, http.StatusOK},
+		{"right code after wrong codes", constant.PasswordlessMaxAttempts - 1, http.StatusOK},
+		{"right code after too many wrong codes", constant.PasswordlessMaxAttempts, http.StatusUnauthorized},
+	} {
+		harness := newPasswordlessHarness(passwordlessUser("jane", "ACM", constant.USER, constant.ACTIVE))
+		challengeId, notification := harness.start(t, "jane", constant.PasswordlessCode)
+		if notification == nil {
+			t.Fatalf("%s: no code sent", test.name)
+		}
+		wrong := "000000"
+		if notification.Code == wrong {
+			wrong = "111111"
+		}
+		for i := 0; i < test.wrong; i++ {
+			if status, _ := harness.verify(t, gin.H{"challengeId": challengeId, "code": wrong}); status != http.StatusUnauthorized {
+				t.Errorf("%s: wrong code answered %d", test.name, status)
+			}
+		}
+		status, result := harness.verify(t, gin.H{"challengeId": challengeId, "code": notification.Code})
+		if status != test.status {
+			t.Errorf("%s: answered %d %v, want %d", test.name, status, result, test.status)
+		}
+		// a code works once
+		if status, _ := harness.verify(t, gin.H{"challengeId": challengeId, "code": notification.Code}); status != http.StatusUnauthorized {
+			t.Errorf("%s: used code answered %d", test.name, status)
+		}
+		if last := harness.histories.items[len(harness.histories.items)-1]; test.status != http.StatusOK && last.FailureReason != constant.LoginFailureWrongCode {
+			t.Errorf("%s: recorded %q, want %s", test.name, last.FailureReason, constant.LoginFailureWrongCode)
+		}
+	}
+}
+
+func TestPasswordlessMethodMismatch(t *testing.T) {
+	harness := newPasswordlessHarness(passwordlessUser("jane", "ACM", constant.USER, constant.ACTIVE))
+
+	// the token of a link isn't a code
+	challengeId, notification := harness.start(t, "jane", constant.PasswordlessLink)
+	if notification == nil || notification.Link == "" {
+		t.Fatalf("no link sent: %v", notification)
+	}
+	token := linkToken(t, notification.Link)
+	if status, _ := harness.verify(t, gin.H{"challengeId": challengeId, "code": token}); status != http.StatusUnauthorized {
+		t.Errorf("link token as a code answered %d", status)
+	}
+	if status, result := harness.verify(t, gin.H{"token": token}); status != http.StatusOK {
+		t.Errorf("link answered %d %v", status, result)
+	}
+	if status, _ := harness.verify(t, gin.H{"token": token}); status != http.StatusUnauthorized {
+		t.Errorf("used link answered %d", status)
+	}
+
+	// nor is a code challenge signed as a link
+	harness.passwordless.cooldowns = map[string]bool{}
+	challengeId, notification = harness.start(t, "jane", constant.PasswordlessCode)
+	if notification == nil {
+		t.Fatal("no code sent")
+	}
+	forged := challengeId + "." + challengeSignature(constant.NotificationPasswordless, challengeId)
+	if status, _ := harness.verify(t, gin.H{"token": forged}); status != http.StatusUnauthorized {
+		t.Errorf("code challenge as a link answered %d", status)
+	}
+	if status, _ := harness.verify(t, gin.H{"token": challengeId + "." + strings.Repeat("0", 64)}); status != http.StatusUnauthorized {
+		t.Errorf("unsigned token answered %d", status)
+	}
+}
+
+func TestPasswordlessResendCooldown(t *testing.T) {
+	harness := newPasswordlessHarness(passwordlessUser("jane", "ACM", constant.USER, constant.ACTIVE))
+	first, notification := harness.start(t, "jane", constant.PasswordlessCode)
+	if notification == nil {
+		t.Fatal("no code sent")
+	}
+	second, notification := harness.start(t, "jane", constant.PasswordlessCode)
+	if notification != nil {
+		t.Errorf("sent %v during the cooldown", notification)
+	}
+	if _, stored := harness.passwordless.challenges[second]; stored || first == second {
+		t.Error("stored a challenge during the cooldown")
+	}
+	if _, stored := harness.passwordless.challenges[first]; !stored {
+		t.Error("the cooldown dropped the first challenge")
+	}
+}
+
+func TestPasswordlessDisabledClient(t *testing.T) {
+	jim := passwordlessUser("jim", "GLB", constant.USER, constant.ACTIVE)
+	harness := newPasswordlessHarness(jim)
+	if _, notification := harness.start(t, "jim", constant.PasswordlessCode); notification != nil {
+		t.Errorf("sent %v to a client without passwordless login", notification)
+	}
+
+	// a challenge left from before passwordless login was turned off
+	code := "123456"
+	_ = harness.passwordless.CreateChallenge("challenge-1", model.PasswordlessChallenge{
+		UserId:   jim.Id.Hex(),
+		ClientId: "GLB",
+		System:   "POS",
+		Method:   constant.PasswordlessCode,
+		CodeHash: utils.HashToken("challenge-1" + code),
+	}, time.Minute)
+	status, result := harness.verify(t, gin.H{"challengeId": "challenge-1", "code": code})
+	if status != http.StatusUnauthorized {
+		t.Errorf("answered %d %v, want %d", status, result, http.StatusUnauthorized)
+	}
+	if len(harness.histories.items) != 1 || harness.histories.items[0].FailureReason != constant.LoginFailurePasswordless {
+		t.Errorf("recorded %v, want %s", harness.histories.items, constant.LoginFailurePasswordless)
+	}
+}
@@ -0,0 +1,264 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/middlewares"
+)
+
+// preferenceNamespacePattern allows a name, or a system code and a name separated by a dot
+var preferenceNamespacePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}(\.[A-Za-z0-9][A-Za-z0-9_-]{0,63})?$`)
+
+// GetPreferences lists the namespaces of the user the system of the token can see, the shared ones
+// and its own
+func GetPreferences(preferenceEntity repository.IPreference) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId := ctx.GetString(middlewares.UserId)
+		items, err := preferenceEntity.GetPreferences(userId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		system := ctx.GetString(middlewares.System)
+		result := []model.Preference{}
+		for _, item := range items {
+			if preferenceSystem(item.Namespace) == "" || preferenceSystem(item.Namespace) == system {
+				result = append(result, item)
+			}
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func GetPreference(preferenceEntity repository.IPreference) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		namespace, ok := preferenceNamespace(ctx)
+		if !ok {
+			return
+		}
+		result, err := preferenceEntity.GetPreference(ctx.GetString(middlewares.UserId), namespace)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "preference not found"})
+			return
+		}
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// SavePreference replaces the value of a namespace with the JSON body, checked against the schema
+// of the namespace when the client has one
+func SavePreference(preferenceEntity repository.IPreference, preferenceSchemaEntity repository.IPreferenceSchema) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		namespace, ok := preferenceNamespace(ctx)
+		if !ok {
+			return
+		}
+		value, ok := readJsonBody(ctx, constant.PreferenceMaxBytes)
+		if !ok {
+			return
+		}
+
+		clientId := ctx.GetString(middlewares.ClientId)
+		schema, err := preferenceSchemaEntity.GetPreferenceSchema(clientId, namespace)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if schema != nil {
+			err = validatePreference(schema.Schema, value)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "value doesn't match the schema of " + namespace + ": " + err.Error()})
+				return
+			}
+		}
+
+		userId := ctx.GetString(middlewares.UserId)
+		_, err = preferenceEntity.GetPreference(userId, namespace)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			count, err := preferenceEntity.CountPreferences(userId)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if count >= constant.PreferenceLimit {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "too many preferences, " + strconv.Itoa(constant.PreferenceLimit) + " namespaces at most"})
+				return
+			}
+		}
+		result, err := preferenceEntity.SavePreference(userId, clientId, namespace, value)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func DeletePreference(preferenceEntity repository.IPreference) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		namespace, ok := preferenceNamespace(ctx)
+		if !ok {
+			return
+		}
+		result, err := preferenceEntity.RemovePreference(ctx.GetString(middlewares.UserId), namespace)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "preference not found"})
+			return
+		}
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func GetPreferenceSchemas(preferenceSchemaEntity repository.IPreferenceSchema) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		result, err := preferenceSchemaEntity.GetPreferenceSchemas(ctx.GetString(middlewares.ClientId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// SavePreferenceSchema sets the JSON schema of a namespace from the body, the values already kept
+// aren't checked again
+func SavePreferenceSchema(preferenceSchemaEntity repository.IPreferenceSchema, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		namespace := ctx.Param("namespace")
+		if !preferenceNamespacePattern.MatchString(namespace) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid namespace"})
+			return
+		}
+		schema, ok := readJsonBody(ctx, constant.PreferenceSchemaMaxBytes)
+		if !ok {
+			return
+		}
+		_, err := compilePreferenceSchema(schema)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid schema: " + err.Error()})
+			return
+		}
+
+		clientId := ctx.GetString(middlewares.ClientId)
+		before, _ := preferenceSchemaEntity.GetPreferenceSchema(clientId, namespace)
+		result, err := preferenceSchemaEntity.SavePreferenceSchema(clientId, namespace, schema, ctx.GetString(middlewares.UserId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditPreferenceSchemaUpdate, constant.TargetPreferenceSchema, result.Id.Hex(), clientId, before, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func DeletePreferenceSchema(preferenceSchemaEntity repository.IPreferenceSchema, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		clientId := ctx.GetString(middlewares.ClientId)
+		result, err := preferenceSchemaEntity.RemovePreferenceSchema(clientId, ctx.Param("namespace"))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditPreferenceSchemaDelete, constant.TargetPreferenceSchema, result.Id.Hex(), clientId, result, nil) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// preferenceNamespace checks the namespace of the path. A namespace of another system than the one
+// of the token is refused.
+func preferenceNamespace(ctx *gin.Context) (string, bool) {
+	namespace := ctx.Param("namespace")
+	if !preferenceNamespacePattern.MatchString(namespace) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid namespace"})
+		return "", false
+	}
+	system := preferenceSystem(namespace)
+	if system != "" && system != ctx.GetString(middlewares.System) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "namespace belongs to system " + system})
+		return "", false
+	}
+	return namespace, true
+}
+
+// preferenceSystem returns the system code a namespace belongs to, empty for shared namespaces
+func preferenceSystem(namespace string) string {
+	system, _, found := strings.Cut(namespace, ".")
+	if !found {
+		return ""
+	}
+	return system
+}
+
+// readJsonBody reads a JSON body of at most limit bytes, compacted
+func readJsonBody(ctx *gin.Context, limit int64) (json.RawMessage, bool) {
+	data, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "body is larger than " + strconv.FormatInt(limit>>10, 10) + " KB"})
+		return nil, false
+	}
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	var buffer bytes.Buffer
+	err = json.Compact(&buffer, data)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "body must be JSON"})
+		return nil, false
+	}
+	return buffer.Bytes(), true
+}
+
+// compilePreferenceSchema compiles a JSON schema on its own, $ref to other documents aren't loaded so
+// a schema can't reach files or URLs
+func compilePreferenceSchema(schema json.RawMessage) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, errors.New("$ref to " + url + " is not allowed")
+	}
+	err := compiler.AddResource("mem://preference.json", bytes.NewReader(schema))
+	if err != nil {
+		return nil, err
+	}
+	return compiler.Compile("mem://preference.json")
+}
+
+func validatePreference(schema json.RawMessage, value json.RawMessage) error {
+	compiled, err := compilePreferenceSchema(schema)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	var document interface{}
+	err = decoder.Decode(&document)
+	if err != nil {
+		return err
+	}
+	return compiled.Validate(document)
+}
@@ -0,0 +1,290 @@
+package usecase
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/middlewares"
+)
+
+type fakePreferences struct {
+	repository.IPreference
+	mu    sync.Mutex
+	items map[string]map[string]model.Preference
+}
+
+func newFakePreferences() *fakePreferences {
+	return &fakePreferences{items: map[string]map[string]model.Preference{}}
+}
+
+func (fake *fakePreferences) GetPreferences(userId string) ([]model.Preference, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	items := []model.Preference{}
+	for _, item := range fake.items[userId] {
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (fake *fakePreferences) GetPreference(userId string, namespace string) (*model.Preference, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	item, ok := fake.items[userId][namespace]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &item, nil
+}
+
+func (fake *fakePreferences) CountPreferences(userId string) (int64, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return int64(len(fake.items[userId])), nil
+}
+
+func (fake *fakePreferences) SavePreference(userId string, clientId string, namespace string, value json.RawMessage) (*model.Preference, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.items[userId] == nil {
+		fake.items[userId] = map[string]model.Preference{}
+	}
+	objId, _ := primitive.ObjectIDFromHex(userId)
+	item := model.Preference{Id: primitive.NewObjectID(), UserId: objId, ClientId: clientId, Namespace: namespace, Value: value}
+	fake.items[userId][namespace] = item
+	return &item, nil
+}
+
+func (fake *fakePreferences) RemovePreference(userId string, namespace string) (*model.Preference, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	item, ok := fake.items[userId][namespace]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	delete(fake.items[userId], namespace)
+	return &item, nil
+}
+
+type fakePreferenceSchemas struct {
+	repository.IPreferenceSchema
+	schemas []model.PreferenceSchema
+}
+
+func (fake *fakePreferenceSchemas) GetPreferenceSchema(clientId string, namespace string) (*model.PreferenceSchema, error) {
+	for _, schema := range fake.schemas {
+		if schema.ClientId == clientId && schema.Namespace == namespace {
+			return &schema, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (fake *fakePreferenceSchemas) SavePreferenceSchema(clientId string, namespace string, schema json.RawMessage, updatedBy string) (*model.PreferenceSchema, error) {
+	item := model.PreferenceSchema{Id: primitive.NewObjectID(), ClientId: clientId, Namespace: namespace, Schema: schema}
+	fake.schemas = append(fake.schemas, item)
+	return &item, nil
+}
+
+// preferenceRouter serves the preferences of userId signed in to the POS system of ACM
+func preferenceRouter(userId string, preferences *fakePreferences, schemas *fakePreferenceSchemas) *gin.Engine {
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set(middlewares.UserId, userId)
+		ctx.Set(middlewares.ClientId, "ACM")
+		ctx.Set(middlewares.System, "POS")
+	})
+	router.GET("/preference", GetPreferences(preferences))
+	router.GET("/preference/:namespace", GetPreference(preferences))
+	router.PUT("/preference/:namespace", SavePreference(preferences, schemas))
+	router.DELETE("/preference/:namespace", DeletePreference(preferences))
+	router.PUT("/admin/preference-schema/:namespace", SavePreferenceSchema(schemas, &fakeAudit{}))
+	return router
+}
+
+func servePreference(router http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return recorder
+}
+
+func TestPreferenceNamespace(t *testing.T) {
+	userId := primitive.NewObjectID().Hex()
+	preferences := newFakePreferences()
+	for _, namespace := range []string{"theme", "POS.layout", "CRM.layout"} {
+		_, _ = preferences.SavePreference(userId, "ACM", namespace, json.RawMessage(`{"dark":true}`))
+	}
+	router := preferenceRouter(userId, preferences, &fakePreferenceSchemas{})
+
+	for _, test := range []struct {
+		method    string
+		namespace string
+		status    int
+	}{
+		{http.MethodGet, "theme", http.StatusOK},
+		{http.MethodGet, "POS.layout", http.StatusOK},
+		{http.MethodGet, "POS.missing", http.StatusNotFound},
+		{http.MethodGet, "CRM.layout", http.StatusForbidden},
+		{http.MethodPut, "CRM.layout", http.StatusForbidden},
+		{http.MethodDelete, "CRM.layout", http.StatusForbidden},
+		{http.MethodPut, "POS.layout", http.StatusOK},
+		{http.MethodPut, "POS.a.b", http.StatusBadRequest},
+		{http.MethodPut, "-theme", http.StatusBadRequest},
+		{http.MethodPut, "POS.", http.StatusBadRequest},
+		{http.MethodPut, strings.Repeat("a", 65), http.StatusBadRequest},
+	} {
+		recorder := servePreference(router, test.method, "/preference/"+test.namespace, `{"dark":false}`)
+		if recorder.Code != test.status {
+			t.Errorf("%s %s: answered %d %s, want %d", test.method, test.namespace, recorder.Code, recorder.Body.String(), test.status)
+		}
+	}
+	if _, err := preferences.GetPreference(userId, "CRM.layout"); err != nil {
+		t.Error("another system's namespace was deleted")
+	}
+	if item, _ := preferences.GetPreference(userId, "CRM.layout"); string(item.Value) != `{"dark":true}` {
+		t.Errorf("another system's namespace was changed to %s", item.Value)
+	}
+
+	// the listing leaves out the namespaces of other systems
+	recorder := servePreference(router, http.MethodGet, "/preference", "")
+	var items []model.Preference
+	_ = json.Unmarshal(recorder.Body.Bytes(), &items)
+	namespaces := []string{}
+	for _, item := range items {
+		namespaces = append(namespaces, item.Namespace)
+	}
+	sort.Strings(namespaces)
+	if got := strings.Join(namespaces, ","); got != "POS.layout,theme" {
+		t.Errorf("listed %s, want POS.layout and theme", got)
+	}
+}
+
+func TestSavePreferenceBody(t *testing.T) {
+	userId := primitive.NewObjectID().Hex()
+	preferences := newFakePreferences()
+	router := preferenceRouter(userId, preferences, &fakePreferenceSchemas{})
+	largest := `"` + strings.Repeat("a", constant.PreferenceMaxBytes-2) + `"`
+
+	for _, test := range []struct {
+		name   string
+		body   string
+		status int
+		value  string
+	}{
+		{"object", "{ \"dark\" :\n true }", http.StatusOK, `{"dark":true}`},
+		{"largest value", largest, http.StatusOK, largest},
+		{"one byte too large", largest + " ", http.StatusRequestEntityTooLarge, ""},
+		{"far too large", `"` + strings.Repeat("a", constant.PreferenceMaxBytes*4) + `"`, http.StatusRequestEntityTooLarge, ""},
+		{"not JSON", "dark=true", http.StatusBadRequest, ""},
+		{"empty", "", http.StatusBadRequest, ""},
+	} {
+		delete(preferences.items, userId)
+		recorder := servePreference(router, http.MethodPut, "/preference/theme", test.body)
+		if recorder.Code != test.status {
+			t.Errorf("%s: answered %d %.200s, want %d", test.name, recorder.Code, recorder.Body.String(), test.status)
+			continue
+		}
+		item, err := preferences.GetPreference(userId, "theme")
+		if test.value == "" && err == nil {
+			t.Errorf("%s: saved %.200s", test.name, item.Value)
+		}
+		if test.value != "" && (err != nil || string(item.Value) != test.value) {
+			t.Errorf("%s: saved %v, want the compacted body", test.name, err)
+		}
+	}
+}
+
+func TestCompilePreferenceSchema(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		schema string
+		valid  bool
+	}{
+		{"plain schema", `{"type":"object","properties":{"dark":{"type":"boolean"}}}`, true},
+		{"draft 2020-12", `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"object"}`, true},
+		{"local $ref", `{"$defs":{"flag":{"type":"boolean"}},"properties":{"dark":{"$ref":"#/$defs/flag"}}}`, true},
+		{"remote $ref", `{"$ref":"https://schemas.example.com/theme.json"}`, false},
+		{"nested remote $ref", `{"properties":{"dark":{"$ref":"http://127.0.0.1:8080/flag.json"}}}`, false},
+		{"file $ref", `{"$ref":"file:///etc/passwd"}`, false},
+		{"remote $schema", `{"$schema":"https://schemas.example.com/meta.json"}`, false},
+		{"not a schema", `{"type":12}`, false},
+	} {
+		_, err := compilePreferenceSchema(json.RawMessage(test.schema))
+		if (err == nil) != test.valid {
+			t.Errorf("%s: %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+
+	// the admin endpoint refuses the schema and stores nothing
+	schemas := &fakePreferenceSchemas{}
+	router := preferenceRouter(primitive.NewObjectID().Hex(), newFakePreferences(), schemas)
+	recorder := servePreference(router, http.MethodPut, "/admin/preference-schema/theme", `{"$ref":"https://schemas.example.com/theme.json"}`)
+	if recorder.Code != http.StatusBadRequest || len(schemas.schemas) != 0 {
+		t.Errorf("remote $ref answered %d %s, stored %d schemas", recorder.Code, recorder.Body.String(), len(schemas.schemas))
+	}
+}
+
+func TestSavePreferenceSchemaCheck(t *testing.T) {
+	userId := primitive.NewObjectID().Hex()
+	schemas := &fakePreferenceSchemas{schemas: []model.PreferenceSchema{{ClientId: "ACM", Namespace: "theme", Schema: json.RawMessage(`{"type":"object","properties":{"dark":{"type":"boolean"}},"additionalProperties":false}`)}}}
+	router := preferenceRouter(userId, newFakePreferences(), schemas)
+	for _, test := range []struct {
+		body   string
+		status int
+	}{
+		{`{"dark":true}`, http.StatusOK},
+		{`{"dark":"yes"}`, http.StatusBadRequest},
+		{`{"dark":true,"font":"mono"}`, http.StatusBadRequest},
+		{`[]`, http.StatusBadRequest},
+	} {
+		if recorder := servePreference(router, http.MethodPut, "/preference/theme", test.body); recorder.Code != test.status {
+			t.Errorf("%s: answered %d %s, want %d", test.body, recorder.Code, recorder.Body.String(), test.status)
+		}
+	}
+}
+
+func TestPreferenceLimit(t *testing.T) {
+	userId := primitive.NewObjectID().Hex()
+	preferences := newFakePreferences()
+	router := preferenceRouter(userId, preferences, &fakePreferenceSchemas{})
+	for i := 0; i < constant.PreferenceLimit-1; i++ {
+		_, _ = preferences.SavePreference(userId, "ACM", "ns"+strconv.Itoa(i), json.RawMessage(`1`))
+	}
+
+	for _, test := range []struct {
+		name      string
+		namespace string
+		status    int
+	}{
+		{"last namespace", "last", http.StatusOK},
+		{"namespace over the limit", "extra", http.StatusBadRequest},
+		{"existing namespace at the limit", "ns0", http.StatusOK},
+		{"namespace saved again at the limit", "last", http.StatusOK},
+	} {
+		recorder := servePreference(router, http.MethodPut, "/preference/"+test.namespace, `2`)
+		if recorder.Code != test.status {
+			t.Errorf("%s: answered %d %s, want %d", test.name, recorder.Code, recorder.Body.String(), test.status)
+		}
+	}
+	if count, _ := preferences.CountPreferences(userId); count != constant.PreferenceLimit {
+		t.Errorf("kept %d namespaces, want %d", count, constant.PreferenceLimit)
+	}
+
+	// deleting one makes room again
+	servePreference(router, http.MethodDelete, "/preference/ns1", "")
+	if recorder := servePreference(router, http.MethodPut, "/preference/extra", `2`); recorder.Code != http.StatusOK {
+		t.Errorf("after a delete answered %d %s", recorder.Code, recorder.Body.String())
+	}
+}
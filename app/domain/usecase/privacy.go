@@ -0,0 +1,300 @@
+package usecase
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/middlewares"
+)
+
+type exportFile struct {
+	name string
+	data []byte
+}
+
+// ExportUserById answers a zip archive of the personal data held about a user, for a data subject
+// access request
+func ExportUserById(
+	userEntity repository.IUser,
+	historyEntity repository.ILoginHistory,
+	auditEntity repository.IAudit,
+	sessionEntity repository.ISession,
+	preferenceEntity repository.IPreference,
+	groupEntity repository.IGroup,
+	apiKeyEntity repository.IApiKey,
+	invitationEntity repository.IInvitation,
+	impersonationEntity repository.IImpersonation,
+	blobStore repository.IBlobStore,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		err := userEntity.ValidateUserRole(ctx.GetString(middlewares.Role), id)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		clientId := ctx.GetString(middlewares.ClientId)
+		user, err := userEntity.GetUserByClientId(id, clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		files, err := userExportFiles(user, historyEntity, auditEntity, sessionEntity, preferenceEntity, groupEntity, apiKeyEntity, invitationEntity, impersonationEntity, blobStore)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		manifest, _ := json.MarshalIndent(gin.H{
+			"userId":       id,
+			"clientId":     clientId,
+			"exportedBy":   ctx.GetString(middlewares.UserId),
+			"exportedDate": time.Now(),
+		}, "", "  ")
+		files = append([]exportFile{{name: "manifest.json", data: manifest}}, files...)
+
+		var buffer bytes.Buffer
+		archive := zip.NewWriter(&buffer)
+		for _, file := range files {
+			writer, err := archive.Create(file.name)
+			if err == nil {
+				_, err = writer.Write(file.data)
+			}
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		err = archive.Close()
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditUserExport, constant.TargetUser, id, clientId, nil, nil) {
+			return
+		}
+		ctx.Header("Content-Disposition", `attachment; filename="user-`+id+`.zip"`)
+		ctx.Data(http.StatusOK, "application/zip", buffer.Bytes())
+	}
+}
+
+// EraseUserById anonymises a user instead of deleting them, so createdBy, updatedBy and the audit log
+// keep pointing to a record. Everything kept beside the user record is removed or blanked, and the
+// diffs of the audit events about the user are redacted. It can run again to finish a partial erasure.
+func EraseUserById(
+	userEntity repository.IUser,
+	historyEntity repository.ILoginHistory,
+	auditEntity repository.IAudit,
+	sessionEntity repository.ISession,
+	preferenceEntity repository.IPreference,
+	groupEntity repository.IGroup,
+	authzEntity repository.IAuthz,
+	apiKeyEntity repository.IApiKey,
+	invitationEntity repository.IInvitation,
+	impersonationEntity repository.IImpersonation,
+	deliveryEntity repository.IDelivery,
+	blobStore repository.IBlobStore,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId := ctx.GetString(middlewares.UserId)
+		id := ctx.Param("id")
+		if userId == id {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "can't erase self user"})
+			return
+		}
+		err := userEntity.ValidateUserRole(ctx.GetString(middlewares.Role), id)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		clientId := ctx.GetString(middlewares.ClientId)
+		user, err := userEntity.GetUserByClientId(id, clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		apiKeys, err := apiKeyEntity.GetApiKeysByUserId(id)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		invitations, err := invitationEntity.GetInvitationsByUserId(id)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		targetIds := userTargetIds(id, apiKeys, invitations)
+
+		result := user
+		if user.ErasedDate == nil {
+			result, err = userEntity.EraseUser(id, clientId, userId)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		redaction := newAuditEvent(ctx, constant.AuditRedact, constant.TargetUser, id, clientId)
+		_, redactErr := auditEntity.RedactEvents(targetIds, redaction)
+		err = errors.Join(
+			sessionEntity.RemoveSessionsByUserId(id),
+			groupEntity.RemoveMemberFromAll(id),
+			authzEntity.InvalidateUser(id),
+			preferenceEntity.RemovePreferences(id),
+			apiKeyEntity.RemoveApiKeysByUserId(id),
+			invitationEntity.RemoveInvitationsByUserId(id),
+			historyEntity.AnonymizeLoginHistories(id),
+			impersonationEntity.AnonymizeLogs(id),
+			deliveryEntity.ScrubUserDeliveries(id, result.Username),
+			redactErr,
+		)
+		if user.Avatar != "" {
+			err = errors.Join(err, blobStore.RemovePrefix(avatarPrefix(user.Avatar)))
+		}
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "user is erased but some data is left, retry: " + err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditUserErase, constant.TargetUser, id, clientId, nil, nil) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// userExportFiles collects the JSON files of an export. The IP and user agent of what others did about
+// the user, and the diff of what the user did to others, are left out as they are about other people.
+func userExportFiles(
+	user *model.User,
+	historyEntity repository.ILoginHistory,
+	auditEntity repository.IAudit,
+	sessionEntity repository.ISession,
+	preferenceEntity repository.IPreference,
+	groupEntity repository.IGroup,
+	apiKeyEntity repository.IApiKey,
+	invitationEntity repository.IInvitation,
+	impersonationEntity repository.IImpersonation,
+	blobStore repository.IBlobStore,
+) ([]exportFile, error) {
+	id := user.Id.Hex()
+	histories, err := historyEntity.GetLoginHistoriesByUserId(id)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := sessionEntity.GetSessionsByUserId(id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		for _, history := range histories {
+			if history.Success && history.SessionId == sessions[i].Id {
+				sessions[i].System = history.System
+				sessions[i].Ip = history.Ip
+				sessions[i].UserAgent = history.UserAgent
+				loginDate := history.CreatedDate
+				sessions[i].LoginDate = &loginDate
+				break
+			}
+		}
+	}
+	preferences, err := preferenceEntity.GetPreferences(id)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := groupEntity.GetGroupsByMemberId(id)
+	if err != nil {
+		return nil, err
+	}
+	memberships := []gin.H{}
+	for _, group := range groups {
+		memberships = append(memberships, gin.H{"id": group.Id, "name": group.Name, "grants": group.Grants})
+	}
+	apiKeys, err := apiKeyEntity.GetApiKeysByUserId(id)
+	if err != nil {
+		return nil, err
+	}
+	invitations, err := invitationEntity.GetInvitationsByUserId(id)
+	if err != nil {
+		return nil, err
+	}
+	targetIds := userTargetIds(id, apiKeys, invitations)
+	events, err := auditEntity.GetEventsByUserId(id, targetIds)
+	if err != nil {
+		return nil, err
+	}
+	for i := range events {
+		if events[i].ActorId != id && events[i].ImpersonatorId != id {
+			events[i].Ip = ""
+			events[i].UserAgent = ""
+		}
+		if !containsString(targetIds, events[i].TargetId) {
+			events[i].Diff = nil
+		}
+	}
+	impersonations, err := impersonationEntity.GetLogsByUserId(id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range impersonations {
+		if impersonations[i].ActorId != id {
+			impersonations[i].Ip = ""
+			impersonations[i].UserAgent = ""
+		}
+	}
+
+	documents := []struct {
+		name  string
+		value interface{}
+	}{
+		{"profile.json", user},
+		{"login-history.json", histories},
+		{"sessions.json", sessions},
+		{"audit.json", events},
+		{"preferences.json", preferences},
+		{"groups.json", memberships},
+		{"api-keys.json", apiKeys},
+		{"invitations.json", invitations},
+		{"impersonations.json", impersonations},
+	}
+	var files []exportFile
+	for _, document := range documents {
+		data, err := json.MarshalIndent(document.value, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, exportFile{name: document.name, data: data})
+	}
+	if user.Avatar != "" {
+		for _, size := range constant.AvatarSizes {
+			data, err := blobStore.Get(avatarKey(user.Avatar, size))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, exportFile{name: "avatar/" + strconv.Itoa(size) + ".jpg", data: data})
+		}
+	}
+	return files, nil
+}
+
+// userTargetIds returns the id of a user with the ids of their API keys and invitations, the audit
+// events about any of them hold personal data of the user
+func userTargetIds(userId string, apiKeys []model.ApiKey, invitations []model.Invitation) []string {
+	targetIds := []string{userId}
+	for _, apiKey := range apiKeys {
+		targetIds = append(targetIds, apiKey.Id.Hex())
+	}
+	for _, invitation := range invitations {
+		targetIds = append(targetIds, invitation.Id.Hex())
+	}
+	return targetIds
+}
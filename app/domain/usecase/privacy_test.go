@@ -0,0 +1,553 @@
+package usecase
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/middlewares"
+)
+
+// ValidateUserRole lets an ADMIN handle USER accounts and a SUPER ADMIN accounts, like the repository
+func (fake *fakeUsers) ValidateUserRole(role string, id string) error {
+	user, err := fake.GetUserById(id)
+	if err != nil {
+		return err
+	}
+	if (role == constant.ADMIN && user.Role == constant.USER) || (role == constant.SUPER && user.Role == constant.ADMIN) {
+		return nil
+	}
+	return errors.New("invalid role permission")
+}
+
+func (fake *fakeUsers) EraseUser(id string, clientId string, erasedBy string) (*model.User, error) {
+	return fake.update(id, func(user *model.User) {
+		now := time.Now()
+		user.Username = "erased-" + id
+		user.FirstName, user.LastName, user.Email, user.Phone, user.Password = "", "", "", "", ""
+		user.Avatar, user.Attributes = "", nil
+		user.Status = constant.INACTIVE
+		user.ErasedDate = &now
+	})
+}
+
+func (fake *fakeSessions) GetSessionsByUserId(userId string) ([]model.ActiveSession, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	sessions := []model.ActiveSession{}
+	for sessionId, owner := range fake.sessions {
+		if owner == userId {
+			sessions = append(sessions, model.ActiveSession{Id: sessionId})
+		}
+	}
+	return sessions, nil
+}
+
+func (fake *fakeSessions) RemoveSessionsByUserId(userId string) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for sessionId, owner := range fake.sessions {
+		if owner == userId {
+			delete(fake.sessions, sessionId)
+		}
+	}
+	return nil
+}
+
+func (fake *fakeGroups) RemoveMemberFromAll(userId string) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for _, group := range fake.groups {
+		members := []primitive.ObjectID{}
+		for _, member := range group.Members {
+			if member.Hex() != userId {
+				members = append(members, member)
+			}
+		}
+		group.Members = members
+	}
+	return nil
+}
+
+func (fake *fakePreferences) RemovePreferences(userId string) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	delete(fake.items, userId)
+	return nil
+}
+
+func (fake *fakeHistories) GetLoginHistoriesByUserId(userId string) ([]model.LoginHistory, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	items := []model.LoginHistory{}
+	for _, item := range fake.items {
+		if item.UserId == userId {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (fake *fakeHistories) AnonymizeLoginHistories(userId string) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for i := range fake.items {
+		if fake.items[i].UserId == userId {
+			fake.items[i].Username, fake.items[i].Ip, fake.items[i].UserAgent = "", "", ""
+		}
+	}
+	return nil
+}
+
+func (fake *fakeImpersonations) GetLogsByUserId(userId string) ([]model.ImpersonationLog, error) {
+	items := []model.ImpersonationLog{}
+	for _, item := range fake.items {
+		if item.UserId == userId || item.ActorId == userId {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (fake *fakeImpersonations) AnonymizeLogs(actorId string) error {
+	for i := range fake.items {
+		if fake.items[i].ActorId == actorId {
+			fake.items[i].Ip, fake.items[i].UserAgent = "", ""
+		}
+	}
+	return nil
+}
+
+func (fake *fakeInvitations) GetInvitationsByUserId(userId string) ([]model.Invitation, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	items := []model.Invitation{}
+	for _, item := range fake.items {
+		if item.UserId.Hex() == userId {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (fake *fakeInvitations) RemoveInvitationsByUserId(userId string) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	items := []model.Invitation{}
+	for _, item := range fake.items {
+		if item.UserId.Hex() != userId {
+			items = append(items, item)
+		}
+	}
+	fake.items = items
+	return nil
+}
+
+// GetEventsByUserId returns the events the user made and the ones about any of targetIds
+func (fake *fakeAudit) GetEventsByUserId(userId string, targetIds []string) ([]model.AuditEvent, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	items := []model.AuditEvent{}
+	for _, item := range fake.items {
+		if item.ActorId == userId || item.ImpersonatorId == userId || containsString(targetIds, item.TargetId) {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// RedactEvents appends the AUDIT_REDACT event before emptying the diffs, like the repository
+func (fake *fakeAudit) RedactEvents(targetIds []string, redaction model.AuditEvent) (int64, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	var seqs []int64
+	for _, item := range fake.items {
+		if containsString(targetIds, item.TargetId) && !item.Redacted && item.Action != constant.AuditRedact {
+			seqs = append(seqs, item.Seq)
+		}
+	}
+	if len(seqs) == 0 {
+		return 0, nil
+	}
+	redaction.Action = constant.AuditRedact
+	redaction.RedactedSeqs = seqs
+	fake.items = append(fake.items, redaction)
+	for i := range fake.items {
+		for _, seq := range seqs {
+			if fake.items[i].Seq == seq {
+				fake.items[i].Diff = map[string]model.AuditChange{}
+				fake.items[i].Redacted = true
+			}
+		}
+	}
+	return int64(len(seqs)), nil
+}
+
+func (fake *fakeBlobs) RemovePrefix(prefix string) error {
+	for key := range fake.blobs {
+		if strings.HasPrefix(key, prefix) {
+			delete(fake.blobs, key)
+		}
+	}
+	return nil
+}
+
+type fakeApiKeys struct {
+	repository.IApiKey
+	items     []model.ApiKey
+	removeErr error
+}
+
+func (fake *fakeApiKeys) GetApiKeysByUserId(userId string) ([]model.ApiKey, error) {
+	items := []model.ApiKey{}
+	for _, item := range fake.items {
+		if item.UserId.Hex() == userId {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (fake *fakeApiKeys) RemoveApiKeysByUserId(userId string) error {
+	if fake.removeErr != nil {
+		return fake.removeErr
+	}
+	items := []model.ApiKey{}
+	for _, item := range fake.items {
+		if item.UserId.Hex() != userId {
+			items = append(items, item)
+		}
+	}
+	fake.items = items
+	return nil
+}
+
+// fakeDeliveries keeps the username each user's webhook payloads were scrubbed to
+type fakeDeliveries struct {
+	repository.IDelivery
+	mu        sync.Mutex
+	usernames map[string]string
+}
+
+func (fake *fakeDeliveries) ScrubUserDeliveries(userId string, username string) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.usernames[userId] = username
+	return nil
+}
+
+// privacyHarness holds the data of jane, the USER being exported or erased, and of john, a USER of the
+// same client whose data must stay untouched
+type privacyHarness struct {
+	router         *gin.Engine
+	jane, john     *model.User
+	users          *fakeUsers
+	sessions       *fakeSessions
+	histories      *fakeHistories
+	audit          *fakeAudit
+	preferences    *fakePreferences
+	groups         *fakeGroups
+	authz          *fakeAuthz
+	apiKeys        *fakeApiKeys
+	invitations    *fakeInvitations
+	impersonations *fakeImpersonations
+	deliveries     *fakeDeliveries
+	blobs          *fakeBlobs
+	adminId        string
+}
+
+func newPrivacyHarness() *privacyHarness {
+	admin := &model.User{Id: primitive.NewObjectID(), Username: "admin", ClientId: "ACME", Role: constant.ADMIN, Status: constant.ACTIVE}
+	jane := &model.User{Id: primitive.NewObjectID(), Username: "jane", FirstName: "Jane", Email: "jane@acme.test", ClientId: "ACME", Role: constant.USER, Status: constant.ACTIVE, Avatar: primitive.NewObjectID().Hex()}
+	john := &model.User{Id: primitive.NewObjectID(), Username: "john", FirstName: "John", Email: "john@acme.test", ClientId: "ACME", Role: constant.USER, Status: constant.ACTIVE}
+	harness := &privacyHarness{
+		jane:           jane,
+		john:           john,
+		users:          newFakeUsers(admin, jane, john),
+		sessions:       newFakeSessions(),
+		histories:      &fakeHistories{},
+		audit:          &fakeAudit{},
+		preferences:    newFakePreferences(),
+		groups:         newFakeGroups(&model.Group{Id: primitive.NewObjectID(), ClientId: "ACME", Name: "staff", Members: []primitive.ObjectID{jane.Id, john.Id}}),
+		authz:          &fakeAuthz{},
+		invitations:    &fakeInvitations{},
+		impersonations: &fakeImpersonations{},
+		deliveries:     &fakeDeliveries{usernames: map[string]string{}},
+		blobs:          &fakeBlobs{blobs: map[string][]byte{avatarKey(jane.Avatar, constant.AvatarDefaultSize): []byte("jpeg")}},
+		adminId:        admin.Id.Hex(),
+	}
+	janeId, johnId := jane.Id.Hex(), john.Id.Hex()
+
+	janeSession, _ := harness.sessions.CreateSession(janeId, time.Hour)
+	_, _ = harness.sessions.CreateSession(janeId, time.Hour)
+	_, _ = harness.sessions.CreateSession(johnId, time.Hour)
+	_, _ = harness.histories.CreateLoginHistory(model.LoginHistory{UserId: janeId, Username: "jane", ClientId: "ACME", Success: true, SessionId: janeSession, System: "POS", Ip: "192.0.2.1", UserAgent: "jane-browser"})
+	_, _ = harness.histories.CreateLoginHistory(model.LoginHistory{UserId: johnId, Username: "john", ClientId: "ACME", Success: true, Ip: "192.0.2.2", UserAgent: "john-browser"})
+	_, _ = harness.preferences.SavePreference(janeId, "ACME", "theme", json.RawMessage(`{"dark":true}`))
+	_, _ = harness.preferences.SavePreference(johnId, "ACME", "theme", json.RawMessage(`{"dark":false}`))
+	janeKey := model.ApiKey{Id: primitive.NewObjectID(), UserId: jane.Id, ClientId: "ACME", Name: "jane's key"}
+	harness.apiKeys = &fakeApiKeys{items: []model.ApiKey{janeKey, {Id: primitive.NewObjectID(), UserId: john.Id, ClientId: "ACME", Name: "john's key"}}}
+	janeInvitation, _ := harness.invitations.CreateInvitation(model.Invitation{UserId: jane.Id, ClientId: "ACME", Username: "jane", Email: "jane@acme.test"})
+	_, _ = harness.invitations.CreateInvitation(model.Invitation{UserId: john.Id, ClientId: "ACME", Username: "john", Email: "john@acme.test"})
+	_, _ = harness.impersonations.CreateLog(model.ImpersonationLog{ActorId: harness.adminId, UserId: janeId, ClientId: "ACME", Ip: "203.0.113.1", UserAgent: "admin-browser"})
+
+	diff := func(field string, from string, to string) map[string]model.AuditChange {
+		return map[string]model.AuditChange{field: {From: json.RawMessage(`"` + from + `"`), To: json.RawMessage(`"` + to + `"`)}}
+	}
+	for i, item := range []model.AuditEvent{
+		// the admin changed jane
+		{ActorId: harness.adminId, TargetType: constant.TargetUser, TargetId: janeId, Diff: diff("email", "jane@old.test", "jane@acme.test")},
+		// jane changed herself
+		{ActorId: janeId, TargetType: constant.TargetUser, TargetId: janeId, Diff: diff("firstName", "J", "Jane")},
+		// the admin changed the API key and the invitation of jane
+		{ActorId: harness.adminId, TargetId: janeKey.Id.Hex(), Diff: diff("name", "key", "jane's key")},
+		{ActorId: harness.adminId, TargetId: janeInvitation.Id.Hex(), Diff: diff("email", "", "jane@acme.test")},
+		// jane changed john, the diff is about john
+		{ActorId: janeId, TargetType: constant.TargetUser, TargetId: johnId, Diff: diff("phone", "", "+15550100")},
+		// the admin changed john
+		{ActorId: harness.adminId, TargetType: constant.TargetUser, TargetId: johnId, Diff: diff("email", "", "john@acme.test")},
+	} {
+		item.Seq = int64(i + 1)
+		item.ClientId = "ACME"
+		item.Action = constant.AuditUserUpdate
+		item.Ip = "198.51.100." + item.ActorId[len(item.ActorId)-2:]
+		item.UserAgent = item.ActorId + "-agent"
+		_, _ = harness.audit.CreateEvent(item)
+	}
+
+	harness.router = gin.New()
+	harness.router.Use(func(ctx *gin.Context) {
+		ctx.Set(middlewares.UserId, harness.adminId)
+		ctx.Set(middlewares.Role, constant.ADMIN)
+		ctx.Set(middlewares.ClientId, "ACME")
+	})
+	harness.router.GET("/admin/user/:id/export", ExportUserById(harness.users, harness.histories, harness.audit, harness.sessions, harness.preferences, harness.groups, harness.apiKeys, harness.invitations, harness.impersonations, harness.blobs))
+	harness.router.POST("/admin/user/:id/erase", EraseUserById(harness.users, harness.histories, harness.audit, harness.sessions, harness.preferences, harness.groups, harness.authz, harness.apiKeys, harness.invitations, harness.impersonations, harness.deliveries, harness.blobs))
+	return harness
+}
+
+func (harness *privacyHarness) erase(t *testing.T, id string) (int, map[string]interface{}) {
+	t.Helper()
+	return serveJson(t, harness.router, http.MethodPost, "/admin/user/"+id+"/erase", nil)
+}
+
+// auditActions counts the audit events recorded by action
+func (harness *privacyHarness) auditActions() map[string]int {
+	actions := map[string]int{}
+	for _, item := range harness.audit.items {
+		actions[item.Action]++
+	}
+	return actions
+}
+
+// checkErased checks nothing personal is left of jane and nothing of john was touched
+func (harness *privacyHarness) checkErased(t *testing.T) {
+	t.Helper()
+	janeId, johnId := harness.jane.Id.Hex(), harness.john.Id.Hex()
+	jane := harness.jane
+	if jane.Username != "erased-"+janeId || jane.FirstName != "" || jane.Email != "" || jane.Status != constant.INACTIVE || jane.ErasedDate == nil {
+		t.Errorf("jane isn't blanked: %+v", jane)
+	}
+	if harness.john.Username != "john" || harness.john.Email != "john@acme.test" || harness.john.ErasedDate != nil {
+		t.Errorf("john was changed: %+v", harness.john)
+	}
+	if sessions, _ := harness.sessions.GetSessionsByUserId(janeId); len(sessions) != 0 {
+		t.Errorf("kept %d sessions of jane", len(sessions))
+	}
+	if sessions, _ := harness.sessions.GetSessionsByUserId(johnId); len(sessions) != 1 {
+		t.Errorf("kept %d sessions of john, want 1", len(sessions))
+	}
+	for _, group := range harness.groups.groups {
+		if len(group.Members) != 1 || group.Members[0] != harness.john.Id {
+			t.Errorf("group members %v, want john only", group.Members)
+		}
+	}
+	if keys, _ := harness.apiKeys.GetApiKeysByUserId(janeId); len(keys) != 0 || len(harness.apiKeys.items) != 1 {
+		t.Errorf("API keys %v, want john's only", harness.apiKeys.items)
+	}
+	if len(harness.invitations.items) != 1 || harness.invitations.items[0].UserId != harness.john.Id {
+		t.Errorf("invitations %v, want john's only", harness.invitations.items)
+	}
+	if _, ok := harness.preferences.items[janeId]; ok || len(harness.preferences.items[johnId]) != 1 {
+		t.Errorf("preferences %v, want john's only", harness.preferences.items)
+	}
+	for _, item := range harness.histories.items {
+		if item.UserId == janeId && (item.Username != "" || item.Ip != "" || item.UserAgent != "") {
+			t.Errorf("login history of jane kept %q %q %q", item.Username, item.Ip, item.UserAgent)
+		}
+		if item.UserId == johnId && item.Ip == "" {
+			t.Error("login history of john was anonymised")
+		}
+	}
+	if len(harness.blobs.blobs) != 0 {
+		t.Errorf("kept avatar files %v", harness.blobs.blobs)
+	}
+	if !containsString(harness.authz.invalidated, janeId) {
+		t.Error("authorization decisions of jane weren't invalidated")
+	}
+	if username := harness.deliveries.usernames[janeId]; username != "erased-"+janeId {
+		t.Errorf("webhook deliveries scrubbed to %q", username)
+	}
+
+	for _, item := range harness.audit.items {
+		if item.Action != constant.AuditUserUpdate {
+			continue
+		}
+		aboutJane := item.TargetId != johnId
+		if aboutJane && (!item.Redacted || len(item.Diff) != 0) {
+			t.Errorf("event %d about jane kept its diff %v", item.Seq, item.Diff)
+		}
+		if !aboutJane && (item.Redacted || len(item.Diff) == 0) {
+			t.Errorf("event %d about john was redacted", item.Seq)
+		}
+	}
+	var redactions []model.AuditEvent
+	for _, item := range harness.audit.items {
+		if item.Action == constant.AuditRedact {
+			redactions = append(redactions, item)
+		}
+	}
+	if len(redactions) != 1 || len(redactions[0].RedactedSeqs) != 4 || redactions[0].TargetId != janeId {
+		t.Errorf("redactions %+v, want one listing the 4 events about jane", redactions)
+	}
+}
+
+func TestEraseUser(t *testing.T) {
+	harness := newPrivacyHarness()
+	status, result := harness.erase(t, harness.jane.Id.Hex())
+	if status != http.StatusOK || result["username"] != "erased-"+harness.jane.Id.Hex() {
+		t.Fatalf("answered %d %v", status, result)
+	}
+	harness.checkErased(t)
+	if actions := harness.auditActions(); actions[constant.AuditUserErase] != 1 {
+		t.Errorf("audit %v, want one %s", actions, constant.AuditUserErase)
+	}
+}
+
+func TestEraseUserRefused(t *testing.T) {
+	harness := newPrivacyHarness()
+	for _, test := range []struct {
+		name   string
+		id     string
+		status int
+	}{
+		{"self", harness.adminId, http.StatusBadRequest},
+		{"missing user", primitive.NewObjectID().Hex(), http.StatusForbidden},
+	} {
+		if status, result := harness.erase(t, test.id); status != test.status {
+			t.Errorf("%s: answered %d %v, want %d", test.name, status, result, test.status)
+		}
+	}
+	if len(harness.audit.items) != 6 {
+		t.Errorf("recorded %d audit events, want none", len(harness.audit.items)-6)
+	}
+}
+
+func TestEraseUserRetry(t *testing.T) {
+	harness := newPrivacyHarness()
+	harness.apiKeys.removeErr = errors.New("connection reset")
+	status, result := harness.erase(t, harness.jane.Id.Hex())
+	if status != http.StatusInternalServerError {
+		t.Fatalf("failed step answered %d %v, want %d", status, result, http.StatusInternalServerError)
+	}
+	// the record is erased and the other steps ran, only USER_ERASE waits for a complete erasure
+	if harness.jane.ErasedDate == nil || len(harness.invitations.items) != 1 {
+		t.Error("the steps before and after the failure didn't run")
+	}
+	if actions := harness.auditActions(); actions[constant.AuditUserErase] != 0 {
+		t.Errorf("audit %v, want no %s yet", actions, constant.AuditUserErase)
+	}
+	erasedDate := *harness.jane.ErasedDate
+
+	harness.apiKeys.removeErr = nil
+	status, result = harness.erase(t, harness.jane.Id.Hex())
+	if status != http.StatusOK {
+		t.Fatalf("retry answered %d %v", status, result)
+	}
+	harness.checkErased(t)
+	if !harness.jane.ErasedDate.Equal(erasedDate) {
+		t.Error("the retry erased the record again")
+	}
+	if actions := harness.auditActions(); actions[constant.AuditUserErase] != 1 {
+		t.Errorf("audit %v, want one %s", actions, constant.AuditUserErase)
+	}
+}
+
+func TestExportUserLeavesOutOthers(t *testing.T) {
+	harness := newPrivacyHarness()
+	janeId := harness.jane.Id.Hex()
+	recorder := httptest.NewRecorder()
+	harness.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/user/"+janeId+"/export", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("answered %d %s", recorder.Code, recorder.Body.String())
+	}
+	archive, err := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		reader, _ := file.Open()
+		files[file.Name], _ = io.ReadAll(reader)
+		_ = reader.Close()
+	}
+	for _, name := range []string{"manifest.json", "profile.json", "login-history.json", "sessions.json", "audit.json", "preferences.json", "groups.json", "api-keys.json", "invitations.json", "impersonations.json", "avatar/128.jpg"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("no %s in the export", name)
+		}
+	}
+
+	var events []model.AuditEvent
+	_ = json.Unmarshal(files["audit.json"], &events)
+	if len(events) != 5 {
+		t.Errorf("exported %d audit events, want the 5 about or by jane", len(events))
+	}
+	for _, event := range events {
+		byJane := event.ActorId == janeId
+		if !byJane && (event.Ip != "" || event.UserAgent != "") {
+			t.Errorf("event %d by someone else kept %q %q", event.Seq, event.Ip, event.UserAgent)
+		}
+		if byJane && (event.Ip == "" || event.UserAgent == "") {
+			t.Errorf("event %d by jane lost her IP and user agent", event.Seq)
+		}
+		aboutOthers := event.TargetId == harness.john.Id.Hex()
+		if aboutOthers && len(event.Diff) != 0 {
+			t.Errorf("event %d about john kept its diff %v", event.Seq, event.Diff)
+		}
+		if !aboutOthers && len(event.Diff) == 0 {
+			t.Errorf("event %d about jane lost its diff", event.Seq)
+		}
+	}
+
+	var impersonations []model.ImpersonationLog
+	_ = json.Unmarshal(files["impersonations.json"], &impersonations)
+	if len(impersonations) != 1 || impersonations[0].Ip != "" || impersonations[0].UserAgent != "" {
+		t.Errorf("impersonations %+v, want the admin's IP and user agent left out", impersonations)
+	}
+	var sessions []model.ActiveSession
+	_ = json.Unmarshal(files["sessions.json"], &sessions)
+	if len(sessions) != 2 {
+		t.Errorf("exported %d sessions, want jane's 2", len(sessions))
+	}
+	for _, name := range []string{"login-history.json", "preferences.json", "api-keys.json", "invitations.json"} {
+		if bytes.Contains(files[name], []byte("john")) || bytes.Contains(files[name], []byte(`"dark": false`)) {
+			t.Errorf("%s holds data of john: %s", name, files[name])
+		}
+	}
+	if actions := harness.auditActions(); actions[constant.AuditUserExport] != 1 {
+		t.Errorf("audit %v, want one %s", actions, constant.AuditUserExport)
+	}
+}
@@ -0,0 +1,26 @@
+package usecase
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+	"um/app/domain/repository"
+)
+
+// RateLimit answers 429 once an IP made limit requests to name within window. Requests go through
+// when Redis can't count them.
+func RateLimit(rateLimitEntity repository.IRateLimit, name string, limit int64, window time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		count, err := rateLimitEntity.Hit(name+":"+ctx.ClientIP(), window)
+		if err != nil {
+			logrus.Error(err)
+			return
+		}
+		if count > limit {
+			ctx.Header("Retry-After", strconv.Itoa(int(window.Seconds())))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many requests, try again later"})
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package usecase
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+// Register signs a user up to the client of a registration code. The user is ACTIVE right away, or
+// PENDING until an ADMIN approves them when the client requires approval.
+func Register(userEntity repository.IUser, clientSettingEntity repository.IClientSetting, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.Register{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		setting, err := clientSettingEntity.GetClientSettingByRegistrationCode(req.Code)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid registration code"})
+			return
+		}
+		err = utils.CheckPasswordPolicy(req.Password, req.Username)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		found, _ := userEntity.GetUserByUsername(req.Username)
+		if found != nil {
+			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "username is taken"})
+			return
+		}
+
+		status := constant.ACTIVE
+		if setting.ApprovalRequired {
+			status = constant.PENDING
+		}
+		result, err := userEntity.CreateUser(request.User{
+			FirstName: req.FirstName,
+			LastName:  req.LastName,
+			Phone:     req.Phone,
+			Email:     req.Email,
+			Username:  req.Username,
+			Password:  req.Password,
+			ClientId:  setting.ClientId,
+			Status:    status,
+			Source:    constant.SourceRegistration,
+		}, constant.USER)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.Set(middlewares.UserId, result.Id.Hex())
+		if !recordAudit(ctx, auditEntity, constant.AuditUserRegister, constant.TargetUser, result.Id.Hex(), result.ClientId, nil, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func GetPendingRegistrations(userEntity repository.IUser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		clientId := ctx.GetString(middlewares.ClientId)
+		result, err := userEntity.GetPendingRegistrations(clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		setAvatarUrls(result)
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// ApproveRegistration activates a user waiting for approval and tells them they can sign in
+func ApproveRegistration(userEntity repository.IUser, notifier Notifier, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		clientId := ctx.GetString(middlewares.ClientId)
+		user, ok := pendingRegistration(ctx, userEntity, id, clientId)
+		if !ok {
+			return
+		}
+
+		result, err := userEntity.UpdateStatusById(id, clientId, request.UpdateStatus{
+			Status:    constant.ACTIVE,
+			UpdatedBy: ctx.GetString(middlewares.UserId),
+		})
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditUserApprove, constant.TargetUser, id, clientId, user, result) {
+			return
+		}
+		notifyRegistration(notifier, result, "Your account is approved", "Your account "+result.Username+" is approved, you can sign in now.")
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// RejectRegistration deletes a user waiting for approval, which frees the username, and tells them
+func RejectRegistration(
+	userEntity repository.IUser,
+	groupEntity repository.IGroup,
+	authzEntity repository.IAuthz,
+	notifier Notifier,
+	auditEntity repository.IAudit,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		clientId := ctx.GetString(middlewares.ClientId)
+		_, ok := pendingRegistration(ctx, userEntity, id, clientId)
+		if !ok {
+			return
+		}
+
+		result, err := userEntity.RemoveUserById(id, clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		_ = groupEntity.RemoveMemberFromAll(id)
+		invalidateUser(authzEntity, id)
+		if !recordAudit(ctx, auditEntity, constant.AuditUserReject, constant.TargetUser, id, clientId, result, nil) {
+			return
+		}
+		notifyRegistration(notifier, result, "Your registration was declined", "Your registration as "+result.Username+" was declined.")
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func pendingRegistration(ctx *gin.Context, userEntity repository.IUser, id string, clientId string) (*model.User, bool) {
+	user, err := userEntity.GetUserByClientId(id, clientId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if user.Status != constant.PENDING || user.Source != constant.SourceRegistration {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "user is not waiting for approval"})
+		return nil, false
+	}
+	return user, true
+}
+
+// notifyRegistration emails the outcome of a registration, the decision stands when it can't be sent
+func notifyRegistration(notifier Notifier, user *model.User, subject string, message string) {
+	if user.Email == "" {
+		return
+	}
+	err := notifier.Notify(model.Notification{
+		Purpose:  constant.NotificationRegistration,
+		Channel:  constant.ChannelEmail,
+		To:       user.Email,
+		Subject:  subject,
+		Message:  message,
+		UserId:   user.Id.Hex(),
+		ClientId: user.ClientId,
+	})
+	if err != nil {
+		logrus.Error(err)
+	}
+}
@@ -0,0 +1,98 @@
+package usecase
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+func TestRegisterApproveLogin(t *testing.T) {
+	users := newFakeUsers()
+	settings := &fakeClientSettings{settings: []model.ClientSetting{{
+		ClientId:            "ACME",
+		RegistrationEnabled: true,
+		RegistrationCode:    "join-acme",
+		ApprovalRequired:    true,
+	}}}
+	audit := &fakeAudit{}
+	notifier := &fakeNotifier{}
+	histories := &fakeHistories{}
+
+	router := gin.New()
+	router.POST("/auth/register", Register(users, settings, audit))
+	router.POST("/auth/login", Login(users, &fakeAttributes{}, newFakeSessions(), NewAuthenticatorChain(NewLocalAuthenticator()), settings, histories, &fakeEvents{}, nil, nil))
+	router.POST("/admin/user/pending/:id/approve", func(ctx *gin.Context) {
+		ctx.Set(middlewares.UserId, primitive.NewObjectID().Hex())
+		ctx.Set(middlewares.ClientId, "ACME")
+		ctx.Set(middlewares.Role, constant.ADMIN)
+	}, ApproveRegistration(users, notifier, audit))
+
+	code, body := serveJson(t, router, http.MethodPost, "/auth/register", gin.H{
+		"code":      "join-acme",
+		"username":  "jane",
+		"password":  "correct horse 42",
+		"email":     "jane@example.com",
+		"firstName": "Jane",
+		"lastName":  "Doe",
+	})
+	if code != http.StatusOK {
+		t.Fatalf("register answered %d %v", code, body)
+	}
+	if body["status"] != constant.PENDING || body["source"] != constant.SourceRegistration {
+		t.Fatalf("registered user is %v from %v, want PENDING from %v", body["status"], body["source"], constant.SourceRegistration)
+	}
+	id, _ := body["id"].(string)
+
+	login := gin.H{"username": "jane", "password": "correct horse 42", "system": "portal"}
+	code, body = serveJson(t, router, http.MethodPost, "/auth/login", login)
+	if code != http.StatusUnauthorized || body["error"] != "user is not active" {
+		t.Fatalf("login before approval answered %d %v", code, body)
+	}
+
+	code, body = serveJson(t, router, http.MethodPost, "/admin/user/pending/"+id+"/approve", nil)
+	if code != http.StatusOK {
+		t.Fatalf("approve answered %d %v", code, body)
+	}
+	if len(notifier.notifications) != 1 {
+		t.Fatalf("approval sent %d notifications, want 1", len(notifier.notifications))
+	}
+
+	code, body = serveJson(t, router, http.MethodPost, "/auth/login", gin.H{"username": "jane", "password": "wrong password 1", "system": "portal"})
+	if code != http.StatusUnauthorized {
+		t.Fatalf("login with a wrong password answered %d %v", code, body)
+	}
+	code, body = serveJson(t, router, http.MethodPost, "/auth/login", login)
+	if code != http.StatusOK || body["accessToken"] == nil {
+		t.Fatalf("login after approval answered %d %v", code, body)
+	}
+}
+
+func TestLocalAuthenticatorSources(t *testing.T) {
+	users := newFakeUsers()
+	authenticator := NewLocalAuthenticator()
+	for _, test := range []struct {
+		source  string
+		role    string
+		handled bool
+	}{
+		{"", constant.USER, true},
+		{constant.SourceRegistration, constant.USER, true},
+		{constant.SourceLdap, constant.USER, false},
+		{constant.SourceLdap, constant.SUPER, true},
+	} {
+		user, _ := users.CreateUser(request.User{Username: "jane", Password: "s3cret-pass", Source: test.source}, test.role)
+		_, err := authenticator.Authenticate(request.Login{Username: "jane", Password: "s3cret-pass"}, user)
+		if test.handled && err != nil {
+			t.Errorf("%q %s user: %v, want the password accepted", test.source, test.role, err)
+		}
+		if !test.handled && err != errNotHandled {
+			t.Errorf("%q %s user: %v, want it left to the next authenticator", test.source, test.role, err)
+		}
+	}
+}
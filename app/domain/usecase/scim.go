@@ -0,0 +1,981 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+const scimBasePath = "/scim/v2"
+
+var scimBulkIdPattern = regexp.MustCompile(`bulkId:[^"/\s]+`)
+
+// scimError is answered with the SCIM error schema, other errors are mapped by scimFailure
+type scimError struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (err *scimError) Error() string {
+	return err.Detail
+}
+
+// scimService implements the SCIM operations once for their endpoints and for bulk requests
+type scimService struct {
+	userEntity  repository.IUser
+	groupEntity repository.IGroup
+	authzEntity repository.IAuthz
+	auditEntity repository.IAudit
+}
+
+// RequireScimToken authenticates a SCIM client with one of the bearer tokens of its client
+func RequireScimToken(scimTokenEntity repository.IScimToken) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		header := ctx.GetHeader("Authorization")
+		token := strings.TrimPrefix(header, "Bearer ")
+		if token == "" || token == header {
+			scimFail(ctx, &scimError{Status: http.StatusUnauthorized, Detail: "missing authorization header"})
+			return
+		}
+		scimToken, err := scimTokenEntity.GetTokenByHash(utils.HashToken(token))
+		if err != nil {
+			scimFail(ctx, &scimError{Status: http.StatusUnauthorized, Detail: "invalid token"})
+			return
+		}
+		if scimToken.LastUsedDate == nil || time.Since(*scimToken.LastUsedDate) > config.ScimTokenTouchTime {
+			err = scimTokenEntity.TouchToken(scimToken.Id)
+			if err != nil {
+				logrus.Error(err)
+			}
+		}
+
+		ctx.Set(middlewares.ClientId, scimToken.ClientId)
+		ctx.Set(middlewares.UserId, constant.ScimActorPrefix+scimToken.Id.Hex())
+		logrus.Info("ClientId: " + scimToken.ClientId)
+	}
+}
+
+func GetScimTokens(scimTokenEntity repository.IScimToken) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		result, err := scimTokenEntity.GetTokensByClientId(ctx.GetString(middlewares.ClientId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// AddScimToken issues a token for the SCIM client of the client, it is only returned here
+func AddScimToken(scimTokenEntity repository.IScimToken, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.ScimToken{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		token, err := utils.GenerateSecret(constant.ScimTokenPrefix, 32)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.ClientId = ctx.GetString(middlewares.ClientId)
+		req.CreatedBy = ctx.GetString(middlewares.UserId)
+		prefix := token[:len(constant.ScimTokenPrefix)+6]
+		result, err := scimTokenEntity.CreateToken(req, utils.HashToken(token), prefix)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditScimTokenCreate, constant.TargetScim, result.Id.Hex(), result.ClientId, nil, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"scimToken": result,
+			"token":     token,
+		})
+	}
+}
+
+func DeleteScimToken(scimTokenEntity repository.IScimToken, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		result, err := scimTokenEntity.RemoveTokenById(id, ctx.GetString(middlewares.ClientId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditScimTokenDelete, constant.TargetScim, id, result.ClientId, result, nil) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func GetScimServiceProviderConfig() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		scimRespond(ctx, http.StatusOK, gin.H{
+			"schemas":          []string{constant.ScimSchemaConfig},
+			"documentationUri": "https://datatracker.ietf.org/doc/html/rfc7644",
+			"patch":            gin.H{"supported": true},
+			"bulk": gin.H{
+				"supported":      true,
+				"maxOperations":  constant.ScimBulkMaxOperations,
+				"maxPayloadSize": constant.ScimBulkMaxPayload,
+			},
+			"filter":         gin.H{"supported": true, "maxResults": constant.ScimMaxResults},
+			"changePassword": gin.H{"supported": true},
+			"sort":           gin.H{"supported": false},
+			"etag":           gin.H{"supported": false},
+			"authenticationSchemes": []gin.H{{
+				"type":        "oauthbearertoken",
+				"name":        "Bearer token",
+				"description": "A SCIM token of the client issued under /admin/scim/tokens",
+			}},
+		})
+	}
+}
+
+func GetScimResourceTypes() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		resources := []gin.H{
+			{
+				"schemas":  []string{constant.ScimSchemaResourceType},
+				"id":       "User",
+				"name":     "User",
+				"endpoint": "/Users",
+				"schema":   constant.ScimSchemaUser,
+			},
+			{
+				"schemas":  []string{constant.ScimSchemaResourceType},
+				"id":       "Group",
+				"name":     "Group",
+				"endpoint": "/Groups",
+				"schema":   constant.ScimSchemaGroup,
+			},
+		}
+		scimRespond(ctx, http.StatusOK, scimList(int64(len(resources)), 1, resources, len(resources)))
+	}
+}
+
+func GetScimUsers(userEntity repository.IUser, groupEntity repository.IGroup) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.GetScimResources{}
+		err := ctx.ShouldBindQuery(&req)
+		if err != nil {
+			scimFail(ctx, &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidValue, Detail: err.Error()})
+			return
+		}
+		service := scimService{userEntity: userEntity, groupEntity: groupEntity}
+		result, err := service.listUsers(ctx, ctx.GetString(middlewares.ClientId), req)
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		scimRespond(ctx, http.StatusOK, result)
+	}
+}
+
+func GetScimUser(userEntity repository.IUser, groupEntity repository.IGroup) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		service := scimService{userEntity: userEntity, groupEntity: groupEntity}
+		result, err := service.getUser(ctx, ctx.GetString(middlewares.ClientId), ctx.Param("id"))
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		scimRespond(ctx, http.StatusOK, result)
+	}
+}
+
+func AddScimUser(userEntity repository.IUser, groupEntity repository.IGroup, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		data, err := ctx.GetRawData()
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		service := scimService{userEntity: userEntity, groupEntity: groupEntity, authzEntity: authzEntity, auditEntity: auditEntity}
+		result, err := service.createUser(ctx, ctx.GetString(middlewares.ClientId), data)
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		ctx.Header("Location", result.Meta.Location)
+		scimRespond(ctx, http.StatusCreated, result)
+	}
+}
+
+func ReplaceScimUser(userEntity repository.IUser, groupEntity repository.IGroup, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		data, err := ctx.GetRawData()
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		service := scimService{userEntity: userEntity, groupEntity: groupEntity, authzEntity: authzEntity, auditEntity: auditEntity}
+		result, err := service.replaceUser(ctx, ctx.GetString(middlewares.ClientId), ctx.Param("id"), data)
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		scimRespond(ctx, http.StatusOK, result)
+	}
+}
+
+func PatchScimUser(userEntity repository.IUser, groupEntity repository.IGroup, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		data, err := ctx.GetRawData()
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		service := scimService{userEntity: userEntity, groupEntity: groupEntity, authzEntity: authzEntity, auditEntity: auditEntity}
+		result, err := service.patchUser(ctx, ctx.GetString(middlewares.ClientId), ctx.Param("id"), data)
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		scimRespond(ctx, http.StatusOK, result)
+	}
+}
+
+func DeleteScimUser(userEntity repository.IUser, groupEntity repository.IGroup, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		service := scimService{userEntity: userEntity, groupEntity: groupEntity, authzEntity: authzEntity, auditEntity: auditEntity}
+		err := service.deleteUser(ctx, ctx.GetString(middlewares.ClientId), ctx.Param("id"))
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+func GetScimGroups(groupEntity repository.IGroup) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.GetScimResources{}
+		err := ctx.ShouldBindQuery(&req)
+		if err != nil {
+			scimFail(ctx, &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidValue, Detail: err.Error()})
+			return
+		}
+		service := scimService{groupEntity: groupEntity}
+		result, err := service.listGroups(ctx, ctx.GetString(middlewares.ClientId), req)
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		scimRespond(ctx, http.StatusOK, result)
+	}
+}
+
+func GetScimGroup(groupEntity repository.IGroup) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		service := scimService{groupEntity: groupEntity}
+		result, err := service.getGroup(ctx, ctx.GetString(middlewares.ClientId), ctx.Param("id"))
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		scimRespond(ctx, http.StatusOK, result)
+	}
+}
+
+func AddScimGroup(userEntity repository.IUser, groupEntity repository.IGroup, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		data, err := ctx.GetRawData()
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		service := scimService{userEntity: userEntity, groupEntity: groupEntity, authzEntity: authzEntity, auditEntity: auditEntity}
+		result, err := service.createGroup(ctx, ctx.GetString(middlewares.ClientId), data)
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		ctx.Header("Location", result.Meta.Location)
+		scimRespond(ctx, http.StatusCreated, result)
+	}
+}
+
+func ReplaceScimGroup(userEntity repository.IUser, groupEntity repository.IGroup, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		data, err := ctx.GetRawData()
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		service := scimService{userEntity: userEntity, groupEntity: groupEntity, authzEntity: authzEntity, auditEntity: auditEntity}
+		result, err := service.replaceGroup(ctx, ctx.GetString(middlewares.ClientId), ctx.Param("id"), data)
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		scimRespond(ctx, http.StatusOK, result)
+	}
+}
+
+func PatchScimGroup(userEntity repository.IUser, groupEntity repository.IGroup, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		data, err := ctx.GetRawData()
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		service := scimService{userEntity: userEntity, groupEntity: groupEntity, authzEntity: authzEntity, auditEntity: auditEntity}
+		result, err := service.patchGroup(ctx, ctx.GetString(middlewares.ClientId), ctx.Param("id"), data)
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		scimRespond(ctx, http.StatusOK, result)
+	}
+}
+
+func DeleteScimGroup(groupEntity repository.IGroup, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		service := scimService{groupEntity: groupEntity, authzEntity: authzEntity, auditEntity: auditEntity}
+		err := service.deleteGroup(ctx, ctx.GetString(middlewares.ClientId), ctx.Param("id"))
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+// ScimBulk runs the operations of a bulk request in order. A POST with a bulkId can be referenced
+// as "bulkId:<id>" by the operations after it, and failOnErrors stops the request after that many
+// failed operations.
+func ScimBulk(userEntity repository.IUser, groupEntity repository.IGroup, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, constant.ScimBulkMaxPayload)
+		data, err := ctx.GetRawData()
+		if err != nil {
+			scimFail(ctx, &scimError{Status: http.StatusRequestEntityTooLarge, Detail: "bulk request exceeds " + strconv.Itoa(constant.ScimBulkMaxPayload) + " bytes"})
+			return
+		}
+		req := request.ScimBulk{}
+		err = scimDecode(data, &req)
+		if err != nil {
+			scimFail(ctx, err)
+			return
+		}
+		if len(req.Operations) > constant.ScimBulkMaxOperations {
+			scimFail(ctx, &scimError{Status: http.StatusRequestEntityTooLarge, Detail: "bulk request exceeds " + strconv.Itoa(constant.ScimBulkMaxOperations) + " operations"})
+			return
+		}
+
+		service := scimService{userEntity: userEntity, groupEntity: groupEntity, authzEntity: authzEntity, auditEntity: auditEntity}
+		clientId := ctx.GetString(middlewares.ClientId)
+		bulkIds := map[string]string{}
+		responses := []gin.H{}
+		failures := 0
+		for _, operation := range req.Operations {
+			if req.FailOnErrors > 0 && failures >= req.FailOnErrors {
+				break
+			}
+			response, failed := service.bulkOperation(ctx, clientId, operation, bulkIds)
+			if failed {
+				failures++
+			}
+			responses = append(responses, response)
+		}
+		scimRespond(ctx, http.StatusOK, gin.H{
+			"schemas":    []string{constant.ScimSchemaBulkResponse},
+			"Operations": responses,
+		})
+	}
+}
+
+func (service *scimService) listUsers(ctx *gin.Context, clientId string, req request.GetScimResources) (gin.H, error) {
+	filter, startIndex, count, err := scimPage(req)
+	if err != nil {
+		return nil, err
+	}
+	users, total, err := service.userEntity.GetUsersByScimFilter(clientId, filter, startIndex, count)
+	if err != nil {
+		return nil, err
+	}
+	resources := []*model.ScimUser{}
+	for i := range users {
+		resources = append(resources, toScimUser(&users[i], service.userGroups(&users[i]), scimBaseUrl()))
+	}
+	return scimList(total, startIndex, resources, len(resources)), nil
+}
+
+func (service *scimService) getUser(ctx *gin.Context, clientId string, id string) (*model.ScimUser, error) {
+	user, err := service.userEntity.GetUserByClientId(id, clientId)
+	if err != nil {
+		return nil, err
+	}
+	return toScimUser(user, service.userGroups(user), scimBaseUrl()), nil
+}
+
+func (service *scimService) createUser(ctx *gin.Context, clientId string, data []byte) (*model.ScimUser, error) {
+	scimUser := model.ScimUser{}
+	err := scimDecode(data, &scimUser)
+	if err != nil {
+		return nil, err
+	}
+	form, err := fromScimUser(scimUser, clientId)
+	if err != nil {
+		return nil, err
+	}
+	if form.Password == "" {
+		// provisioned users sign in through the identity provider, nobody knows this password
+		form.Password, err = utils.GenerateSecret("", 32)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := service.userEntity.CreateScimUser(form)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, &scimError{Status: http.StatusConflict, ScimType: constant.ScimUniqueness, Detail: "userName " + form.Username + " is already taken"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = appendAudit(ctx, service.auditEntity, constant.AuditUserCreate, constant.TargetUser, result.Id.Hex(), result.ClientId, nil, result)
+	if err != nil {
+		return nil, err
+	}
+	return toScimUser(result, []model.Group{}, scimBaseUrl()), nil
+}
+
+func (service *scimService) replaceUser(ctx *gin.Context, clientId string, id string, data []byte) (*model.ScimUser, error) {
+	before, err := service.managedUser(clientId, id)
+	if err != nil {
+		return nil, err
+	}
+	scimUser := model.ScimUser{}
+	err = scimDecode(data, &scimUser)
+	if err != nil {
+		return nil, err
+	}
+	form, err := fromScimUser(scimUser, clientId)
+	if err != nil {
+		return nil, err
+	}
+	return service.saveUser(ctx, before, form)
+}
+
+func (service *scimService) patchUser(ctx *gin.Context, clientId string, id string, data []byte) (*model.ScimUser, error) {
+	before, err := service.managedUser(clientId, id)
+	if err != nil {
+		return nil, err
+	}
+	patch := request.ScimPatch{}
+	err = scimDecode(data, &patch)
+	if err != nil {
+		return nil, err
+	}
+
+	scimUser := model.ScimUser{}
+	err = patchScimResource(toScimUser(before, nil, ""), patch, &scimUser)
+	if err != nil {
+		return nil, err
+	}
+	form, err := fromScimUser(scimUser, clientId)
+	if err != nil {
+		return nil, err
+	}
+	return service.saveUser(ctx, before, form)
+}
+
+func (service *scimService) saveUser(ctx *gin.Context, before *model.User, form request.ScimUserForm) (*model.ScimUser, error) {
+	id := before.Id.Hex()
+	result, err := service.userEntity.ReplaceScimUser(id, before.ClientId, form)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, &scimError{Status: http.StatusConflict, ScimType: constant.ScimUniqueness, Detail: "userName " + form.Username + " is already taken"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	invalidateUser(service.authzEntity, id)
+
+	action := constant.AuditUserUpdate
+	if before.Status != result.Status {
+		action = constant.AuditUserStatusUpdate
+	}
+	err = appendAudit(ctx, service.auditEntity, action, constant.TargetUser, id, result.ClientId, before, result)
+	if err == nil && form.Password != "" {
+		err = appendAudit(ctx, service.auditEntity, constant.AuditUserPasswordSet, constant.TargetUser, id, result.ClientId, nil, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toScimUser(result, service.userGroups(result), scimBaseUrl()), nil
+}
+
+func (service *scimService) deleteUser(ctx *gin.Context, clientId string, id string) error {
+	_, err := service.managedUser(clientId, id)
+	if err != nil {
+		return err
+	}
+	result, err := service.userEntity.RemoveUserById(id, clientId)
+	if err != nil {
+		return err
+	}
+	_ = service.groupEntity.RemoveMemberFromAll(id)
+	invalidateUser(service.authzEntity, id)
+	return appendAudit(ctx, service.auditEntity, constant.AuditUserDelete, constant.TargetUser, id, result.ClientId, result, nil)
+}
+
+// managedUser returns a user SCIM may change, ADMIN and SUPER users are only managed in um-api
+func (service *scimService) managedUser(clientId string, id string) (*model.User, error) {
+	user, err := service.userEntity.GetUserByClientId(id, clientId)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role != constant.USER {
+		return nil, &scimError{Status: http.StatusForbidden, Detail: "only USER accounts can be provisioned"}
+	}
+	return user, nil
+}
+
+func (service *scimService) userGroups(user *model.User) []model.Group {
+	groups, err := service.groupEntity.GetGroupsByMemberId(user.Id.Hex())
+	if err != nil {
+		logrus.Error(err)
+		return []model.Group{}
+	}
+	return groups
+}
+
+func (service *scimService) listGroups(ctx *gin.Context, clientId string, req request.GetScimResources) (gin.H, error) {
+	filter, startIndex, count, err := scimPage(req)
+	if err != nil {
+		return nil, err
+	}
+	groups, total, err := service.groupEntity.GetGroupsByScimFilter(clientId, filter, startIndex, count)
+	if err != nil {
+		return nil, err
+	}
+	resources := []*model.ScimGroup{}
+	for i := range groups {
+		resources = append(resources, toScimGroup(&groups[i], scimBaseUrl()))
+	}
+	return scimList(total, startIndex, resources, len(resources)), nil
+}
+
+func (service *scimService) getGroup(ctx *gin.Context, clientId string, id string) (*model.ScimGroup, error) {
+	group, err := service.groupEntity.GetGroupById(id, clientId)
+	if err != nil {
+		return nil, err
+	}
+	return toScimGroup(group, scimBaseUrl()), nil
+}
+
+func (service *scimService) createGroup(ctx *gin.Context, clientId string, data []byte) (*model.ScimGroup, error) {
+	scimGroup := model.ScimGroup{}
+	err := scimDecode(data, &scimGroup)
+	if err != nil {
+		return nil, err
+	}
+	form, err := service.groupForm(scimGroup, clientId, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := service.groupEntity.CreateScimGroup(form)
+	if err != nil {
+		return nil, err
+	}
+	invalidateMembers(service.authzEntity, result)
+	err = appendAudit(ctx, service.auditEntity, constant.AuditGroupCreate, constant.TargetGroup, result.Id.Hex(), result.ClientId, nil, result)
+	if err != nil {
+		return nil, err
+	}
+	return toScimGroup(result, scimBaseUrl()), nil
+}
+
+func (service *scimService) replaceGroup(ctx *gin.Context, clientId string, id string, data []byte) (*model.ScimGroup, error) {
+	before, err := service.groupEntity.GetGroupById(id, clientId)
+	if err != nil {
+		return nil, err
+	}
+	scimGroup := model.ScimGroup{}
+	err = scimDecode(data, &scimGroup)
+	if err != nil {
+		return nil, err
+	}
+	form, err := service.groupForm(scimGroup, clientId, before.Members)
+	if err != nil {
+		return nil, err
+	}
+	return service.saveGroup(ctx, before, form)
+}
+
+func (service *scimService) patchGroup(ctx *gin.Context, clientId string, id string, data []byte) (*model.ScimGroup, error) {
+	before, err := service.groupEntity.GetGroupById(id, clientId)
+	if err != nil {
+		return nil, err
+	}
+	patch := request.ScimPatch{}
+	err = scimDecode(data, &patch)
+	if err != nil {
+		return nil, err
+	}
+
+	scimGroup := model.ScimGroup{}
+	err = patchScimResource(toScimGroup(before, ""), patch, &scimGroup)
+	if err != nil {
+		return nil, err
+	}
+	form, err := service.groupForm(scimGroup, clientId, before.Members)
+	if err != nil {
+		return nil, err
+	}
+	return service.saveGroup(ctx, before, form)
+}
+
+func (service *scimService) saveGroup(ctx *gin.Context, before *model.Group, form request.ScimGroupForm) (*model.ScimGroup, error) {
+	id := before.Id.Hex()
+	result, err := service.groupEntity.ReplaceScimGroup(id, before.ClientId, form)
+	if err != nil {
+		return nil, err
+	}
+	invalidateMembers(service.authzEntity, before)
+	invalidateMembers(service.authzEntity, result)
+	err = appendAudit(ctx, service.auditEntity, constant.AuditGroupUpdate, constant.TargetGroup, id, result.ClientId, before, result)
+	if err != nil {
+		return nil, err
+	}
+	return toScimGroup(result, scimBaseUrl()), nil
+}
+
+func (service *scimService) deleteGroup(ctx *gin.Context, clientId string, id string) error {
+	result, err := service.groupEntity.RemoveGroupById(id, clientId)
+	if err != nil {
+		return err
+	}
+	invalidateMembers(service.authzEntity, result)
+	return appendAudit(ctx, service.auditEntity, constant.AuditGroupDelete, constant.TargetGroup, id, result.ClientId, result, nil)
+}
+
+// groupForm maps a SCIM group, every member that isn't in the group yet must be a user of the client
+func (service *scimService) groupForm(scimGroup model.ScimGroup, clientId string, existing []primitive.ObjectID) (request.ScimGroupForm, error) {
+	form := request.ScimGroupForm{
+		Name:       strings.TrimSpace(scimGroup.DisplayName),
+		ExternalId: scimGroup.ExternalId,
+		Members:    []string{},
+		ClientId:   clientId,
+	}
+	if form.Name == "" {
+		return form, &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidValue, Detail: "displayName is required"}
+	}
+
+	known := map[string]bool{}
+	for _, member := range existing {
+		known[member.Hex()] = true
+	}
+	added := map[string]bool{}
+	for _, member := range scimGroup.Members {
+		userId := strings.ToLower(member.Value)
+		if added[userId] {
+			continue
+		}
+		if !known[userId] {
+			if _, err := service.userEntity.GetUserByClientId(userId, clientId); err != nil {
+				return form, &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidValue, Detail: "invalid member " + member.Value}
+			}
+		}
+		added[userId] = true
+		form.Members = append(form.Members, userId)
+	}
+	return form, nil
+}
+
+// bulkOperation runs one operation of a bulk request and returns its response, and whether it failed
+func (service *scimService) bulkOperation(ctx *gin.Context, clientId string, operation request.ScimBulkOperation, bulkIds map[string]string) (gin.H, bool) {
+	method := strings.ToUpper(operation.Method)
+	response := gin.H{"method": method}
+	if operation.BulkId != "" {
+		response["bulkId"] = operation.BulkId
+	}
+
+	path := resolveBulkIds(operation.Path, bulkIds)
+	data := resolveBulkIds(string(operation.Data), bulkIds)
+	var id, resourceType string
+	var err error
+	if strings.Contains(path+data, "bulkId:") {
+		err = &scimError{Status: http.StatusConflict, ScimType: constant.ScimInvalidValue, Detail: "unresolved bulkId reference"}
+	} else {
+		id, resourceType, err = service.bulkDispatch(ctx, clientId, method, path, []byte(data))
+	}
+	if err != nil {
+		failure := scimFailure(err)
+		response["status"] = strconv.Itoa(failure.Status)
+		response["response"] = scimErrorBody(failure)
+		return response, true
+	}
+
+	status := http.StatusOK
+	switch method {
+	case http.MethodPost:
+		status = http.StatusCreated
+		if operation.BulkId != "" {
+			bulkIds[operation.BulkId] = id
+		}
+	case http.MethodDelete:
+		status = http.StatusNoContent
+	}
+	if method != http.MethodDelete {
+		response["location"] = scimBaseUrl() + "/" + resourceType + "/" + id
+	}
+	response["status"] = strconv.Itoa(status)
+	return response, false
+}
+
+// bulkDispatch runs an operation on "/Users", "/Groups" or one of their resources, and returns the
+// id and type of the resource
+func (service *scimService) bulkDispatch(ctx *gin.Context, clientId string, method string, path string, data []byte) (string, string, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	resourceType := parts[0]
+	id := ""
+	if len(parts) == 2 {
+		id = parts[1]
+	}
+	if len(parts) > 2 || (method == http.MethodPost) != (id == "") {
+		return "", "", &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidPath, Detail: "invalid path " + path + " for " + method}
+	}
+
+	switch resourceType + " " + method {
+	case "Users POST":
+		result, err := service.createUser(ctx, clientId, data)
+		if err != nil {
+			return "", "", err
+		}
+		return result.Id, resourceType, nil
+	case "Users PUT":
+		_, err := service.replaceUser(ctx, clientId, id, data)
+		return id, resourceType, err
+	case "Users PATCH":
+		_, err := service.patchUser(ctx, clientId, id, data)
+		return id, resourceType, err
+	case "Users DELETE":
+		return id, resourceType, service.deleteUser(ctx, clientId, id)
+	case "Groups POST":
+		result, err := service.createGroup(ctx, clientId, data)
+		if err != nil {
+			return "", "", err
+		}
+		return result.Id, resourceType, nil
+	case "Groups PUT":
+		_, err := service.replaceGroup(ctx, clientId, id, data)
+		return id, resourceType, err
+	case "Groups PATCH":
+		_, err := service.patchGroup(ctx, clientId, id, data)
+		return id, resourceType, err
+	case "Groups DELETE":
+		return id, resourceType, service.deleteGroup(ctx, clientId, id)
+	}
+	return "", "", &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidPath, Detail: "invalid path " + path + " for " + method}
+}
+
+func resolveBulkIds(text string, bulkIds map[string]string) string {
+	return scimBulkIdPattern.ReplaceAllStringFunc(text, func(reference string) string {
+		if id, ok := bulkIds[strings.TrimPrefix(reference, "bulkId:")]; ok {
+			return id
+		}
+		return reference
+	})
+}
+
+func toScimUser(user *model.User, groups []model.Group, baseUrl string) *model.ScimUser {
+	id := user.Id.Hex()
+	active := user.Status == constant.ACTIVE
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	result := &model.ScimUser{
+		Schemas:    []string{constant.ScimSchemaUser},
+		Id:         id,
+		ExternalId: user.ExternalId,
+		UserName:   user.Username,
+		Name: model.ScimName{
+			Formatted:  name,
+			GivenName:  user.FirstName,
+			FamilyName: user.LastName,
+		},
+		DisplayName: name,
+		Active:      &active,
+		Meta: &model.ScimMeta{
+			ResourceType: "User",
+			Created:      user.CreatedDate.UTC().Format(time.RFC3339),
+			LastModified: user.UpdatedDate.UTC().Format(time.RFC3339),
+			Location:     baseUrl + "/Users/" + id,
+		},
+	}
+	if user.Email != "" {
+		result.Emails = []model.ScimMultiValue{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	if user.Phone != "" {
+		result.PhoneNumbers = []model.ScimMultiValue{{Value: user.Phone, Type: "work", Primary: true}}
+	}
+	for _, group := range groups {
+		groupId := group.Id.Hex()
+		result.Groups = append(result.Groups, model.ScimMultiValue{Value: groupId, Display: group.Name, Ref: baseUrl + "/Groups/" + groupId})
+	}
+	return result
+}
+
+func fromScimUser(scimUser model.ScimUser, clientId string) (request.ScimUserForm, error) {
+	form := request.ScimUserForm{
+		Username:   strings.TrimSpace(scimUser.UserName),
+		FirstName:  scimUser.Name.GivenName,
+		LastName:   scimUser.Name.FamilyName,
+		Email:      scimPrimary(scimUser.Emails),
+		Phone:      scimPrimary(scimUser.PhoneNumbers),
+		Active:     scimUser.Active == nil || *scimUser.Active,
+		ExternalId: scimUser.ExternalId,
+		Password:   scimUser.Password,
+		ClientId:   clientId,
+	}
+	if form.Username == "" {
+		return form, &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidValue, Detail: "userName is required"}
+	}
+	return form, nil
+}
+
+func toScimGroup(group *model.Group, baseUrl string) *model.ScimGroup {
+	id := group.Id.Hex()
+	members := []model.ScimMultiValue{}
+	for _, member := range group.Members {
+		memberId := member.Hex()
+		members = append(members, model.ScimMultiValue{Value: memberId, Ref: baseUrl + "/Users/" + memberId})
+	}
+	return &model.ScimGroup{
+		Schemas:     []string{constant.ScimSchemaGroup},
+		Id:          id,
+		ExternalId:  group.ExternalId,
+		DisplayName: group.Name,
+		Members:     members,
+		Meta: &model.ScimMeta{
+			ResourceType: "Group",
+			Created:      group.CreatedDate.UTC().Format(time.RFC3339),
+			LastModified: group.UpdatedDate.UTC().Format(time.RFC3339),
+			Location:     baseUrl + "/Groups/" + id,
+		},
+	}
+}
+
+// scimPrimary returns the primary value of a multi-valued attribute, or its first value
+func scimPrimary(values []model.ScimMultiValue) string {
+	for _, value := range values {
+		if value.Primary {
+			return value.Value
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0].Value
+}
+
+func scimPage(req request.GetScimResources) (*utils.ScimFilter, int64, int64, error) {
+	var filter *utils.ScimFilter
+	if req.Filter != "" {
+		var err error
+		filter, err = utils.ParseScimFilter(req.Filter)
+		if err != nil {
+			return nil, 0, 0, &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidFilter, Detail: err.Error()}
+		}
+	}
+	startIndex := req.StartIndex
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count := int64(constant.ScimMaxResults)
+	if req.Count != nil && *req.Count < count {
+		count = *req.Count
+	}
+	if count < 0 {
+		count = 0
+	}
+	return filter, startIndex, count, nil
+}
+
+func scimList(total int64, startIndex int64, resources interface{}, itemsPerPage int) gin.H {
+	return gin.H{
+		"schemas":      []string{constant.ScimSchemaListResponse},
+		"totalResults": total,
+		"startIndex":   startIndex,
+		"itemsPerPage": itemsPerPage,
+		"Resources":    resources,
+	}
+}
+
+func scimBaseUrl() string {
+	return oidcIssuer() + scimBasePath
+}
+
+// scimDecode reads a JSON body, gin can't bind the application/scim+json content type
+func scimDecode(data []byte, target interface{}) error {
+	err := json.Unmarshal(data, target)
+	if err != nil {
+		return &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidSyntax, Detail: err.Error()}
+	}
+	return nil
+}
+
+func scimRespond(ctx *gin.Context, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		logrus.Error(err)
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(scimErrorBody(&scimError{Status: status, Detail: err.Error()}))
+	}
+	ctx.Data(status, constant.ScimContentType, data)
+}
+
+func scimFail(ctx *gin.Context, err error) {
+	failure := scimFailure(err)
+	ctx.Abort()
+	scimRespond(ctx, failure.Status, scimErrorBody(failure))
+}
+
+func scimFailure(err error) *scimError {
+	var failure *scimError
+	switch {
+	case errors.As(err, &failure):
+		return failure
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return &scimError{Status: http.StatusNotFound, Detail: "resource not found"}
+	case errors.Is(err, repository.ErrScimFilter):
+		return &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidFilter, Detail: err.Error()}
+	}
+	logrus.Error(err)
+	return &scimError{Status: http.StatusInternalServerError, Detail: err.Error()}
+}
+
+func scimErrorBody(failure *scimError) gin.H {
+	body := gin.H{
+		"schemas": []string{constant.ScimSchemaError},
+		"status":  strconv.Itoa(failure.Status),
+		"detail":  failure.Detail,
+	}
+	if failure.ScimType != "" {
+		body["scimType"] = failure.ScimType
+	}
+	return body
+}
@@ -0,0 +1,271 @@
+package usecase
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/featues/request"
+)
+
+// patchScimResource applies a PATCH request (RFC 7644 section 3.5.2) to the JSON form of resource
+// and decodes the result into target. Attribute names are case insensitive, attributes of schema
+// extensions are ignored.
+func patchScimResource(resource interface{}, patch request.ScimPatch, target interface{}) error {
+	if len(patch.Operations) == 0 {
+		return &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidValue, Detail: "no operations"}
+	}
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+	document := map[string]interface{}{}
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		return err
+	}
+
+	for _, operation := range patch.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidValue, Detail: "invalid op " + operation.Op}
+		}
+		var value interface{}
+		if len(operation.Value) > 0 {
+			err = json.Unmarshal(operation.Value, &value)
+			if err != nil {
+				return &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidValue, Detail: err.Error()}
+			}
+		}
+
+		if operation.Path != "" {
+			err = patchScimPath(document, op, operation.Path, value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if op == "remove" {
+			return &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimNoTarget, Detail: "remove requires a path"}
+		}
+		values, ok := value.(map[string]interface{})
+		if !ok {
+			return &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidValue, Detail: "value must be an object without a path"}
+		}
+		for path, item := range values {
+			err = patchScimPath(document, op, path, item)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// some clients send active as the string "False"
+	activeKey := scimKey(document, "active")
+	if text, ok := document[activeKey].(string); ok {
+		active, err := strconv.ParseBool(text)
+		if err != nil {
+			return &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidValue, Detail: "invalid active " + text}
+		}
+		document[activeKey] = active
+	}
+
+	data, err = json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, target)
+	if err != nil {
+		return &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidValue, Detail: err.Error()}
+	}
+	return nil
+}
+
+// patchScimPath applies an operation on attribute, attribute.subAttribute or
+// attribute[filter].subAttribute
+func patchScimPath(document map[string]interface{}, op string, path string, value interface{}) error {
+	attribute, filter, subAttribute, err := parseScimPath(path)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(attribute, ":") || attribute == "schemas" {
+		return nil
+	}
+	key := scimKey(document, attribute)
+
+	if filter == nil {
+		if subAttribute == "" {
+			patchScimValue(document, op, attribute, value)
+			return nil
+		}
+		parent, ok := document[key].(map[string]interface{})
+		if !ok {
+			if op == "remove" {
+				return nil
+			}
+			parent = map[string]interface{}{}
+			document[key] = parent
+		}
+		patchScimValue(parent, op, subAttribute, value)
+		return nil
+	}
+
+	items, _ := document[key].([]interface{})
+	kept := []interface{}{}
+	matched := false
+	for _, item := range items {
+		element, ok := item.(map[string]interface{})
+		if !ok || !scimMatches(element, filter) {
+			kept = append(kept, item)
+			continue
+		}
+		matched = true
+		if op == "remove" && subAttribute == "" {
+			continue
+		}
+		if subAttribute != "" {
+			patchScimValue(element, op, subAttribute, value)
+		} else if values, ok := value.(map[string]interface{}); ok {
+			mergeScimValues(element, values)
+		}
+		kept = append(kept, element)
+	}
+
+	if !matched && op != "remove" {
+		// emails[type eq "work"].value on a user without a work email adds one
+		if filter.Op != "eq" || subAttribute == "" || strings.Contains(filter.Attribute, ".") {
+			return &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimNoTarget, Detail: "no value matches " + path}
+		}
+		kept = append(kept, map[string]interface{}{filter.Attribute: filter.Value, subAttribute: value})
+	}
+	document[key] = kept
+	return nil
+}
+
+// patchScimValue adds to a multi-valued attribute, merges into a complex one and sets any other.
+// remove with a value removes the items with the same "value", as sent for group members.
+func patchScimValue(target map[string]interface{}, op string, attribute string, value interface{}) {
+	key := scimKey(target, attribute)
+	existing, isList := target[key].([]interface{})
+	values, valueIsList := value.([]interface{})
+	if !valueIsList && value != nil {
+		values = []interface{}{value}
+	}
+
+	switch {
+	case op == "remove" && isList && len(values) > 0:
+		kept := []interface{}{}
+		for _, item := range existing {
+			if !scimContains(values, item) {
+				kept = append(kept, item)
+			}
+		}
+		target[key] = kept
+	case op == "remove":
+		delete(target, key)
+	case op == "add" && isList:
+		target[key] = append(existing, values...)
+	default:
+		current, isMap := target[key].(map[string]interface{})
+		update, valueIsMap := value.(map[string]interface{})
+		if isMap && valueIsMap {
+			mergeScimValues(current, update)
+			return
+		}
+		target[key] = value
+	}
+}
+
+func mergeScimValues(target map[string]interface{}, values map[string]interface{}) {
+	for attribute, value := range values {
+		target[scimKey(target, attribute)] = value
+	}
+}
+
+// scimContains tells whether values holds an item with the same "value" sub-attribute as item
+func scimContains(values []interface{}, item interface{}) bool {
+	element, ok := item.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for _, value := range values {
+		if other, ok := value.(map[string]interface{}); ok && scimEqual(element[scimKey(element, "value")], other[scimKey(other, "value")]) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseScimPath(path string) (string, *utils.ScimFilter, string, error) {
+	head := path
+	subAttribute := ""
+	var filter *utils.ScimFilter
+	if open := strings.Index(path, "["); open >= 0 {
+		end := strings.LastIndex(path, "]")
+		if end < open {
+			return "", nil, "", &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidPath, Detail: "invalid path " + path}
+		}
+		var err error
+		filter, err = utils.ParseScimFilter(path[open+1 : end])
+		if err != nil {
+			return "", nil, "", &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidPath, Detail: err.Error()}
+		}
+		head = path[:open]
+		subAttribute = strings.TrimPrefix(path[end+1:], ".")
+	}
+
+	attribute := utils.ScimAttribute(head)
+	if filter == nil && !strings.Contains(attribute, ":") {
+		if dot := strings.Index(attribute, "."); dot >= 0 {
+			subAttribute = attribute[dot+1:]
+			attribute = attribute[:dot]
+		}
+	}
+	if attribute == "" {
+		return "", nil, "", &scimError{Status: http.StatusBadRequest, ScimType: constant.ScimInvalidPath, Detail: "invalid path " + path}
+	}
+	return attribute, filter, subAttribute, nil
+}
+
+// scimMatches evaluates the filter of a value path on one item of a multi-valued attribute
+func scimMatches(element map[string]interface{}, filter *utils.ScimFilter) bool {
+	switch filter.Op {
+	case "and":
+		return scimMatches(element, filter.Filters[0]) && scimMatches(element, filter.Filters[1])
+	case "or":
+		return scimMatches(element, filter.Filters[0]) || scimMatches(element, filter.Filters[1])
+	case "not":
+		return !scimMatches(element, filter.Filters[0])
+	}
+	value := element[scimKey(element, filter.Attribute)]
+	switch filter.Op {
+	case "pr":
+		return value != nil && value != ""
+	case "eq":
+		return scimEqual(value, filter.Value)
+	case "ne":
+		return !scimEqual(value, filter.Value)
+	}
+	return false
+}
+
+func scimEqual(value interface{}, other interface{}) bool {
+	text, isText := value.(string)
+	otherText, otherIsText := other.(string)
+	if isText && otherIsText {
+		return strings.EqualFold(text, otherText)
+	}
+	return value == other
+}
+
+// scimKey returns the key of an attribute in a JSON object, matching names case insensitively
+func scimKey(document map[string]interface{}, attribute string) string {
+	for key := range document {
+		if strings.EqualFold(key, attribute) {
+			return key
+		}
+	}
+	return attribute
+}
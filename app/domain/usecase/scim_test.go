@@ -0,0 +1,182 @@
+package usecase
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+func (fake *fakeGroups) ReplaceScimGroup(id string, clientId string, form request.ScimGroupForm) (*model.Group, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	group, ok := fake.groups[id]
+	if !ok || group.ClientId != clientId {
+		return nil, mongo.ErrNoDocuments
+	}
+	group.Name = form.Name
+	group.ExternalId = form.ExternalId
+	group.Members = []primitive.ObjectID{}
+	for _, userId := range form.Members {
+		member, _ := primitive.ObjectIDFromHex(userId)
+		group.Members = append(group.Members, member)
+	}
+	return fake.copyOf(group), nil
+}
+
+func (fake *fakeUsers) ReplaceScimUser(id string, clientId string, form request.ScimUserForm) (*model.User, error) {
+	return fake.update(id, func(user *model.User) {
+		user.Username = form.Username
+		user.FirstName = form.FirstName
+		user.LastName = form.LastName
+		user.Email = form.Email
+		user.Phone = form.Phone
+		user.ExternalId = form.ExternalId
+		user.Status = constant.INACTIVE
+		if form.Active {
+			user.Status = constant.ACTIVE
+		}
+	})
+}
+
+func scimRouter(users *fakeUsers, groups *fakeGroups, authz *fakeAuthz) *gin.Engine {
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) { ctx.Set(middlewares.ClientId, "ACM") })
+	router.PATCH("/Users/:id", PatchScimUser(users, groups, authz, &fakeAudit{}))
+	router.PATCH("/Groups/:id", PatchScimGroup(users, groups, authz, &fakeAudit{}))
+	return router
+}
+
+func scimPatch(operations ...gin.H) gin.H {
+	return gin.H{"schemas": []string{constant.ScimSchemaPatchOp}, "Operations": operations}
+}
+
+func TestPatchScimGroupMembers(t *testing.T) {
+	jane := &model.User{Id: primitive.NewObjectID(), Username: "jane", ClientId: "ACM", Role: constant.USER, Status: constant.ACTIVE}
+	john := &model.User{Id: primitive.NewObjectID(), Username: "john", ClientId: "ACM", Role: constant.USER, Status: constant.ACTIVE}
+	joan := &model.User{Id: primitive.NewObjectID(), Username: "joan", ClientId: "ACM", Role: constant.USER, Status: constant.ACTIVE}
+	other := &model.User{Id: primitive.NewObjectID(), Username: "jim", ClientId: "GLB", Role: constant.USER, Status: constant.ACTIVE}
+	member := func(user *model.User) gin.H { return gin.H{"value": user.Id.Hex()} }
+
+	for _, test := range []struct {
+		name        string
+		patch       gin.H
+		status      int
+		members     []*model.User
+		invalidated []*model.User
+	}{
+		{"add a member", scimPatch(gin.H{"op": "add", "path": "members", "value": []gin.H{member(joan)}}),
+			http.StatusOK, []*model.User{jane, john, joan}, []*model.User{jane, john, joan}},
+		{"add a member without a path", scimPatch(gin.H{"op": "Add", "value": gin.H{"members": []gin.H{member(joan)}}}),
+			http.StatusOK, []*model.User{jane, john, joan}, []*model.User{jane, john, joan}},
+		{"add a member already in the group", scimPatch(gin.H{"op": "add", "path": "members", "value": []gin.H{member(jane)}}),
+			http.StatusOK, []*model.User{jane, john}, []*model.User{jane, john}},
+		{"remove a member by filter", scimPatch(gin.H{"op": "remove", "path": `members[value eq "` + jane.Id.Hex() + `"]`}),
+			http.StatusOK, []*model.User{john}, []*model.User{jane, john}},
+		{"remove a member by value", scimPatch(gin.H{"op": "remove", "path": "members", "value": []gin.H{member(john)}}),
+			http.StatusOK, []*model.User{jane}, []*model.User{jane, john}},
+		{"remove all members", scimPatch(gin.H{"op": "remove", "path": "members"}),
+			http.StatusOK, nil, []*model.User{jane, john}},
+		{"replace the members", scimPatch(gin.H{"op": "replace", "path": "members", "value": []gin.H{member(joan)}}),
+			http.StatusOK, []*model.User{joan}, []*model.User{jane, john, joan}},
+		{"add a user of another client", scimPatch(gin.H{"op": "add", "path": "members", "value": []gin.H{member(other)}}),
+			http.StatusBadRequest, []*model.User{jane, john}, nil},
+		{"remove without a path", scimPatch(gin.H{"op": "remove", "value": gin.H{"members": []gin.H{member(jane)}}}),
+			http.StatusBadRequest, []*model.User{jane, john}, nil},
+		{"unknown op", scimPatch(gin.H{"op": "move", "path": "members", "value": []gin.H{member(joan)}}),
+			http.StatusBadRequest, []*model.User{jane, john}, nil},
+	} {
+		group := &model.Group{Id: primitive.NewObjectID(), ClientId: "ACM", Name: "staff", Members: []primitive.ObjectID{jane.Id, john.Id}}
+		groups := newFakeGroups(group)
+		authz := &fakeAuthz{}
+		router := scimRouter(newFakeUsers(jane, john, joan, other), groups, authz)
+
+		status, body := serveJson(t, router, http.MethodPatch, "/Groups/"+group.Id.Hex(), test.patch)
+		if status != test.status {
+			t.Errorf("%s: answered %d %v, want %d", test.name, status, body, test.status)
+		}
+		if got, want := scimMemberIds(group.Members), userIds(test.members); got != want {
+			t.Errorf("%s: members %s, want %s", test.name, got, want)
+		}
+		if got, want := scimUniqueIds(authz.invalidated), userIds(test.invalidated); got != want {
+			t.Errorf("%s: dropped the decisions of %s, want %s", test.name, got, want)
+		}
+	}
+}
+
+func TestPatchScimUserActive(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		patch  gin.H
+		status int
+		active string
+	}{
+		{"replace active", scimPatch(gin.H{"op": "replace", "path": "active", "value": false}), http.StatusOK, constant.INACTIVE},
+		{"replace active as a string", scimPatch(gin.H{"op": "Replace", "path": "active", "value": "False"}), http.StatusOK, constant.INACTIVE},
+		{"replace active without a path", scimPatch(gin.H{"op": "replace", "value": gin.H{"active": false}}), http.StatusOK, constant.INACTIVE},
+		{"add active", scimPatch(gin.H{"op": "add", "path": "active", "value": true}), http.StatusOK, constant.ACTIVE},
+		{"remove active", scimPatch(gin.H{"op": "remove", "path": "active"}), http.StatusOK, constant.ACTIVE},
+		{"deactivate and reactivate", scimPatch(
+			gin.H{"op": "replace", "path": "active", "value": false},
+			gin.H{"op": "replace", "path": "active", "value": true},
+		), http.StatusOK, constant.ACTIVE},
+		{"invalid active", scimPatch(gin.H{"op": "replace", "path": "active", "value": "maybe"}), http.StatusBadRequest, constant.ACTIVE},
+	} {
+		jane := &model.User{Id: primitive.NewObjectID(), Username: "jane", ClientId: "ACM", Role: constant.USER, Status: constant.ACTIVE}
+		authz := &fakeAuthz{}
+		router := scimRouter(newFakeUsers(jane), newFakeGroups(), authz)
+
+		status, body := serveJson(t, router, http.MethodPatch, "/Users/"+jane.Id.Hex(), test.patch)
+		if status != test.status {
+			t.Errorf("%s: answered %d %v, want %d", test.name, status, body, test.status)
+		}
+		if jane.Status != test.active {
+			t.Errorf("%s: status %s, want %s", test.name, jane.Status, test.active)
+		}
+		if status == http.StatusOK && (body["active"] == true) != (test.active == constant.ACTIVE) {
+			t.Errorf("%s: answered active %v, want %s", test.name, body["active"], test.active)
+		}
+		if invalidated := len(authz.invalidated) > 0; invalidated != (status == http.StatusOK) {
+			t.Errorf("%s: dropped the decisions %v", test.name, authz.invalidated)
+		}
+	}
+}
+
+func userIds(users []*model.User) string {
+	ids := []string{}
+	for _, user := range users {
+		ids = append(ids, user.Id.Hex())
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func scimMemberIds(members []primitive.ObjectID) string {
+	ids := []string{}
+	for _, member := range members {
+		ids = append(ids, member.Hex())
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func scimUniqueIds(ids []string) string {
+	unique := map[string]bool{}
+	result := []string{}
+	for _, id := range ids {
+		if !unique[id] {
+			unique[id] = true
+			result = append(result, id)
+		}
+	}
+	sort.Strings(result)
+	return strings.Join(result, ",")
+}
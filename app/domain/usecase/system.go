@@ -2,28 +2,14 @@ package usecase
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"net/http"
+	"um/app/core/constant"
 	"um/app/domain/repository"
 	"um/app/featues/request"
 	"um/middlewares"
 )
 
-func NotifyPosProductLotsExpire(systemEntity repository.ISystem) gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		systemCode := "POS"
-		result, err := systemEntity.GetSystemsByCode(systemCode)
-		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		path := "/api/pos/v1/products/lots/expire-notify"
-		for _, item := range result {
-			_, _ = middlewares.NotifyMassage(item.Host + path)
-		}
-		ctx.JSON(http.StatusOK, gin.H{"message": "success"})
-	}
-}
-
 func GetSystem(systemEntity repository.ISystem) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		systemCode := ctx.GetString(middlewares.System)
@@ -55,7 +41,7 @@ func GetSystems(systemEntity repository.ISystem) gin.HandlerFunc {
 	}
 }
 
-func AddSystem(systemEntity repository.ISystem) gin.HandlerFunc {
+func AddSystem(systemEntity repository.ISystem, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		req := request.System{}
 		err := ctx.ShouldBind(&req)
@@ -72,6 +58,10 @@ func AddSystem(systemEntity repository.ISystem) gin.HandlerFunc {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		invalidateAll(authzEntity)
+		if !recordAudit(ctx, auditEntity, constant.AuditSystemCreate, constant.TargetSystem, result.Id.Hex(), result.ClientId, nil, result) {
+			return
+		}
 		ctx.JSON(http.StatusOK, result)
 	}
 }
@@ -88,7 +78,13 @@ func GetSystemById(systemEntity repository.ISystem) gin.HandlerFunc {
 	}
 }
 
-func DeleteSystemById(systemEntity repository.ISystem) gin.HandlerFunc {
+func DeleteSystemById(
+	systemEntity repository.ISystem,
+	webhookEntity repository.IWebhook,
+	deliveryEntity repository.IDelivery,
+	authzEntity repository.IAuthz,
+	auditEntity repository.IAudit,
+) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id := ctx.Param("id")
 		result, err := systemEntity.RemoveSystemById(id)
@@ -96,11 +92,21 @@ func DeleteSystemById(systemEntity repository.ISystem) gin.HandlerFunc {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if err = webhookEntity.RemoveWebhooksBySystemId(id); err != nil {
+			logrus.Error(err)
+		}
+		if err = deliveryEntity.RemoveDeliveriesBySystemId(id); err != nil {
+			logrus.Error(err)
+		}
+		invalidateAll(authzEntity)
+		if !recordAudit(ctx, auditEntity, constant.AuditSystemDelete, constant.TargetSystem, id, result.ClientId, result, nil) {
+			return
+		}
 		ctx.JSON(http.StatusOK, result)
 	}
 }
 
-func UpdateSystemById(systemEntity repository.ISystem) gin.HandlerFunc {
+func UpdateSystemById(systemEntity repository.ISystem, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		req := request.UpdateSystem{}
 		err := ctx.ShouldBind(&req)
@@ -111,11 +117,16 @@ func UpdateSystemById(systemEntity repository.ISystem) gin.HandlerFunc {
 		userId := ctx.GetString(middlewares.UserId)
 		id := ctx.Param("id")
 		req.UpdatedBy = userId
+		before, _ := systemEntity.GetSystemById(id)
 		result, err := systemEntity.UpdateSystemById(id, req)
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		invalidateAll(authzEntity)
+		if !recordAudit(ctx, auditEntity, constant.AuditSystemUpdate, constant.TargetSystem, id, result.ClientId, before, result) {
+			return
+		}
 		ctx.JSON(http.StatusOK, result)
 	}
 }
@@ -22,7 +22,7 @@ func GetUsers(userEntity repository.IUser) gin.HandlerFunc {
 	}
 }
 
-func AddAdmin(userEntity repository.IUser) gin.HandlerFunc {
+func AddAdmin(userEntity repository.IUser, auditEntity repository.IAudit) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		req := request.User{}
 		err := ctx.ShouldBind(&req)
@@ -44,11 +44,14 @@ func AddAdmin(userEntity repository.IUser) gin.HandlerFunc {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if !recordAudit(ctx, auditEntity, constant.AuditUserCreate, constant.TargetUser, result.Id.Hex(), result.ClientId, nil, result) {
+			return
+		}
 		ctx.JSON(http.StatusOK, result)
 	}
 }
 
-func AddUser(userEntity repository.IUser) gin.HandlerFunc {
+func AddUser(userEntity repository.IUser, attributeEntity repository.IAttribute, auditEntity repository.IAudit) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		req := request.User{}
 		err := ctx.ShouldBind(&req)
@@ -62,6 +65,10 @@ func AddUser(userEntity repository.IUser) gin.HandlerFunc {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid client id"})
 			return
 		}
+		if req.ValidFrom != nil && req.ValidUntil != nil && !req.ValidUntil.After(*req.ValidFrom) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "validUntil must be after validFrom"})
+			return
+		}
 
 		userId := ctx.GetString(middlewares.UserId)
 		found, _ := userEntity.GetUserByUsername(req.Username)
@@ -69,6 +76,11 @@ func AddUser(userEntity repository.IUser) gin.HandlerFunc {
 			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "username is taken"})
 			return
 		}
+		req.UniqueAttributes, err = validateAttributes(attributeEntity, userEntity, clientId, "", req.Attributes, nil, false)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
 		req.CreatedBy = userId
 		result, err := userEntity.CreateUser(req, constant.USER)
@@ -76,11 +88,14 @@ func AddUser(userEntity repository.IUser) gin.HandlerFunc {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if !recordAudit(ctx, auditEntity, constant.AuditUserCreate, constant.TargetUser, result.Id.Hex(), result.ClientId, nil, result) {
+			return
+		}
 		ctx.JSON(http.StatusOK, result)
 	}
 }
 
-func ChangePassword(userEntity repository.IUser) gin.HandlerFunc {
+func ChangePassword(userEntity repository.IUser, auditEntity repository.IAudit) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		req := request.ChangePassword{}
 		err := ctx.ShouldBind(&req)
@@ -108,11 +123,14 @@ func ChangePassword(userEntity repository.IUser) gin.HandlerFunc {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if !recordAudit(ctx, auditEntity, constant.AuditUserPasswordChange, constant.TargetUser, result.Id.Hex(), result.ClientId, nil, nil) {
+			return
+		}
 		ctx.JSON(http.StatusOK, result)
 	}
 }
 
-func DeleteUserById(userEntity repository.IUser) gin.HandlerFunc {
+func DeleteUserById(userEntity repository.IUser, groupEntity repository.IGroup, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		userId := ctx.GetString(middlewares.UserId)
 		id := ctx.Param("id")
@@ -127,6 +145,11 @@ func DeleteUserById(userEntity repository.IUser) gin.HandlerFunc {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		_ = groupEntity.RemoveMemberFromAll(id)
+		invalidateUser(authzEntity, id)
+		if !recordAudit(ctx, auditEntity, constant.AuditUserDelete, constant.TargetUser, id, result.ClientId, result, nil) {
+			return
+		}
 		ctx.JSON(http.StatusOK, result)
 	}
 }
@@ -140,6 +163,7 @@ func GetUserById(userEntity repository.IUser) gin.HandlerFunc {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		setAvatarUrl(result)
 		ctx.JSON(http.StatusOK, result)
 	}
 }
@@ -152,23 +176,33 @@ func GetUserInfo(userEntity repository.IUser) gin.HandlerFunc {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		result.ImpersonatedBy = ctx.GetString(middlewares.Actor)
+		setAvatarUrl(result)
 		ctx.JSON(http.StatusOK, result)
 	}
 }
 
-func GetUsersByClientId(userEntity repository.IUser) gin.HandlerFunc {
+// GetUsersByClientId lists the users of the client, attributes[key]=value narrows them to the
+// users with that custom attribute value
+func GetUsersByClientId(userEntity repository.IUser, attributeEntity repository.IAttribute) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		clientId := ctx.GetString(middlewares.ClientId)
-		result, err := userEntity.GetUserAll(clientId)
+		attributes, err := attributeFilter(attributeEntity, clientId, ctx.QueryMap("attributes"))
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		result, err := userEntity.GetUserAll(clientId, attributes)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		setAvatarUrls(result)
 		ctx.JSON(http.StatusOK, result)
 	}
 }
 
-func SetPassword(userEntity repository.IUser) gin.HandlerFunc {
+func SetPassword(userEntity repository.IUser, auditEntity repository.IAudit) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		req := request.SetPassword{}
 		err := ctx.ShouldBind(&req)
@@ -185,11 +219,14 @@ func SetPassword(userEntity repository.IUser) gin.HandlerFunc {
 			return
 		}
 
+		if !recordAudit(ctx, auditEntity, constant.AuditUserPasswordSet, constant.TargetUser, result.Id.Hex(), result.ClientId, nil, nil) {
+			return
+		}
 		ctx.JSON(http.StatusOK, result)
 	}
 }
 
-func UpdateRoleById(userEntity repository.IUser) gin.HandlerFunc {
+func UpdateRoleById(userEntity repository.IUser, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		req := request.UpdateRole{}
 		err := ctx.ShouldBind(&req)
@@ -214,16 +251,21 @@ func UpdateRoleById(userEntity repository.IUser) gin.HandlerFunc {
 		userId := ctx.GetString(middlewares.UserId)
 		clientId := ctx.GetString(middlewares.ClientId)
 		req.UpdatedBy = userId
+		before, _ := userEntity.GetUserById(id)
 		result, err := userEntity.UpdateRoleById(id, clientId, req)
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		invalidateUser(authzEntity, id)
+		if !recordAudit(ctx, auditEntity, constant.AuditUserRoleUpdate, constant.TargetUser, id, result.ClientId, before, result) {
+			return
+		}
 		ctx.JSON(http.StatusOK, result)
 	}
 }
 
-func UpdateStatusById(userEntity repository.IUser) gin.HandlerFunc {
+func UpdateStatusById(userEntity repository.IUser, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		req := request.UpdateStatus{}
 		err := ctx.ShouldBind(&req)
@@ -244,16 +286,25 @@ func UpdateStatusById(userEntity repository.IUser) gin.HandlerFunc {
 		userId := ctx.GetString(middlewares.UserId)
 		clientId := ctx.GetString(middlewares.ClientId)
 		req.UpdatedBy = userId
+		before, _ := userEntity.GetUserById(id)
+		if before != nil && before.ErasedDate != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "user is erased"})
+			return
+		}
 		result, err := userEntity.UpdateStatusById(id, clientId, req)
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		invalidateUser(authzEntity, id)
+		if !recordAudit(ctx, auditEntity, constant.AuditUserStatusUpdate, constant.TargetUser, id, result.ClientId, before, result) {
+			return
+		}
 		ctx.JSON(http.StatusOK, result)
 	}
 }
 
-func UpdateUserInfo(userEntity repository.IUser) gin.HandlerFunc {
+func UpdateUserInfo(userEntity repository.IUser, attributeEntity repository.IAttribute, auditEntity repository.IAudit) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		req := request.UpdateUser{}
 		err := ctx.ShouldBind(&req)
@@ -266,16 +317,31 @@ func UpdateUserInfo(userEntity repository.IUser) gin.HandlerFunc {
 		clientId := ctx.GetString(middlewares.ClientId)
 
 		req.UpdatedBy = userId
+		before, err := userEntity.GetUserById(userId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Attributes != nil {
+			req.UniqueAttributes, err = validateAttributes(attributeEntity, userEntity, clientId, userId, req.Attributes, before.Attributes, true)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
 		result, err := userEntity.UpdateUserById(userId, clientId, req)
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if !recordAudit(ctx, auditEntity, constant.AuditUserUpdate, constant.TargetUser, userId, result.ClientId, before, result) {
+			return
+		}
 		ctx.JSON(http.StatusOK, result)
 	}
 }
 
-func UpdateUserById(userEntity repository.IUser) gin.HandlerFunc {
+func UpdateUserById(userEntity repository.IUser, attributeEntity repository.IAttribute, auditEntity repository.IAudit) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		req := request.UpdateUser{}
 		err := ctx.ShouldBind(&req)
@@ -298,12 +364,24 @@ func UpdateUserById(userEntity repository.IUser) gin.HandlerFunc {
 
 		clientId := ctx.GetString(middlewares.ClientId)
 
+		if req.Attributes != nil {
+			req.UniqueAttributes, err = validateAttributes(attributeEntity, userEntity, clientId, id, req.Attributes, nil, false)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
 		req.UpdatedBy = userId
+		before, _ := userEntity.GetUserById(id)
 		result, err := userEntity.UpdateUserById(id, clientId, req)
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if !recordAudit(ctx, auditEntity, constant.AuditUserUpdate, constant.TargetUser, id, result.ClientId, before, result) {
+			return
+		}
 		ctx.JSON(http.StatusOK, result)
 	}
 }
@@ -0,0 +1,47 @@
+package usecase
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"um/app/core/constant"
+	"um/middlewares"
+)
+
+func TestAddUserIgnoresServerFields(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		field string
+		value string
+	}{
+		{"pending status", "status", constant.PENDING},
+		{"unknown status", "Status", "LOCKED"},
+		{"LDAP source", "source", constant.SourceLdap},
+		{"registration source", "SOURCE", constant.SourceRegistration},
+	} {
+		users := newFakeUsers()
+		router := gin.New()
+		router.POST("/admin/user", func(ctx *gin.Context) {
+			ctx.Set(middlewares.UserId, primitive.NewObjectID().Hex())
+			ctx.Set(middlewares.ClientId, "ACM")
+			ctx.Set(middlewares.Role, constant.ADMIN)
+		}, AddUser(users, &fakeAttributes{}, &fakeAudit{}))
+
+		code, body := serveJson(t, router, http.MethodPost, "/admin/user", gin.H{
+			"username": "jane",
+			"password": "s3cret-pass",
+			"clientId": "ACM",
+			test.field: test.value,
+		})
+		if code != http.StatusOK {
+			t.Errorf("%s: answered %d %v", test.name, code, body)
+			continue
+		}
+		created, err := users.GetUserByUsername("jane")
+		if err != nil || created.Status != constant.ACTIVE || created.Source != "" {
+			t.Errorf("%s: created %+v %v, want an ACTIVE local user whatever was posted", test.name, created, err)
+		}
+	}
+}
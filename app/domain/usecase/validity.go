@@ -0,0 +1,100 @@
+package usecase
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+// isUserActive tells whether a user may sign in or act now, ACTIVE and within their validity window
+func isUserActive(user *model.User) bool {
+	return user.Status == constant.ACTIVE && withinValidity(user, time.Now())
+}
+
+func withinValidity(user *model.User, now time.Time) bool {
+	if user.ValidFrom != nil && now.Before(*user.ValidFrom) {
+		return false
+	}
+	return user.ValidUntil == nil || now.Before(*user.ValidUntil)
+}
+
+// sessionTime shortens a session so it doesn't outlive the validity of its user. A result of zero
+// or less means the validity has ended, Redis would keep a key with such an expiration forever.
+func sessionTime(user *model.User, expiration time.Duration) time.Duration {
+	if user.ValidUntil != nil {
+		remaining := time.Until(*user.ValidUntil)
+		if remaining < expiration {
+			return remaining
+		}
+	}
+	return expiration
+}
+
+func UpdateValidityById(userEntity repository.IUser, sessionEntity repository.ISession, authzEntity repository.IAuthz, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.UpdateValidity{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.ValidFrom != nil && req.ValidUntil != nil && !req.ValidUntil.After(*req.ValidFrom) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "validUntil must be after validFrom"})
+			return
+		}
+
+		id := ctx.Param("id")
+		clientId := ctx.GetString(middlewares.ClientId)
+		user, err := userEntity.GetUserByClientId(id, clientId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.UpdatedBy = ctx.GetString(middlewares.UserId)
+		result, err := userEntity.UpdateValidityById(id, clientId, req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// sessions opened before were only capped by the previous validUntil
+		if !withinValidity(result, time.Now()) {
+			_ = sessionEntity.RemoveSessionsByUserId(id)
+		}
+		invalidateUser(authzEntity, id)
+		if !recordAudit(ctx, auditEntity, constant.AuditUserValidityUpdate, constant.TargetUser, id, clientId, user, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// GetExpiringUsers lists the ACTIVE users of the client whose validity ends within days, 14 by
+// default
+func GetExpiringUsers(userEntity repository.IUser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.GetExpiringUsers{}
+		err := ctx.ShouldBindQuery(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		within := config.UserExpiringWarningTime
+		if req.Days > 0 {
+			within = time.Duration(req.Days) * 24 * time.Hour
+		}
+		clientId := ctx.GetString(middlewares.ClientId)
+		result, err := userEntity.GetExpiringUsers(clientId, time.Now().Add(within))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		setAvatarUrls(result)
+		ctx.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,65 @@
+package usecase
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/middlewares"
+)
+
+func TestRequireSessionValidity(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	for _, test := range []struct {
+		name       string
+		validFrom  *time.Time
+		validUntil *time.Time
+		status     int
+	}{
+		{"no window", nil, nil, http.StatusOK},
+		{"within the window", &past, &future, http.StatusOK},
+		{"after validUntil", nil, &past, http.StatusUnauthorized},
+		{"before validFrom", &future, nil, http.StatusUnauthorized},
+	} {
+		user := &model.User{Id: primitive.NewObjectID(), Status: constant.ACTIVE, ValidFrom: test.validFrom, ValidUntil: test.validUntil}
+		sessions := newFakeSessions()
+		sessionId, _ := sessions.CreateSession(user.Id.Hex(), time.Hour)
+		router := gin.New()
+		router.GET("/me", func(ctx *gin.Context) {
+			ctx.Set(middlewares.SessionId, sessionId)
+		}, RequireSession(sessions, newFakeUsers(user)), func(ctx *gin.Context) {
+			ctx.JSON(http.StatusOK, gin.H{"id": ctx.GetString(middlewares.UserId)})
+		})
+
+		code, body := serveJson(t, router, http.MethodGet, "/me", nil)
+		if code != test.status {
+			t.Errorf("%s: answered %d %v, want %d", test.name, code, body, test.status)
+		}
+		if _, err := sessions.GetSessionById(sessionId); (err == nil) != (test.status == http.StatusOK) {
+			t.Errorf("%s: session kept is %v, want it removed once refused", test.name, err == nil)
+		}
+	}
+}
+
+func TestSessionTimeAfterValidity(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	user := &model.User{Id: primitive.NewObjectID(), Status: constant.ACTIVE, ValidUntil: &past}
+	if expiration := sessionTime(user, config.AccessTokenTime); expiration > 0 {
+		t.Fatalf("sessionTime = %v after validUntil, want zero or less", expiration)
+	}
+
+	sessions := newFakeSessions()
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+	_, err := startSession(ctx, newFakeUsers(user), sessions, &fakeHistories{}, &fakeEvents{}, user, "portal")
+	if err == nil || len(sessions.sessions) != 0 {
+		t.Fatalf("startSession after validUntil opened %d sessions, err %v, want it refused", len(sessions.sessions), err)
+	}
+}
@@ -0,0 +1,203 @@
+package usecase
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+var errVerificationInvalid = errors.New("invalid or expired code")
+
+// StartVerification sends a code or a link to the email or phone of the signed-in user to prove they
+// own it
+func StartVerification(
+	userEntity repository.IUser,
+	systemEntity repository.ISystem,
+	verificationEntity repository.IVerification,
+	notifier Notifier,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.VerificationStart{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, err := userEntity.GetUserById(ctx.GetString(middlewares.UserId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		address, verified := user.Email, user.EmailVerified
+		if req.Channel == constant.ChannelSms {
+			address, verified = user.Phone, user.PhoneVerified
+		}
+		if address == "" {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "no " + req.Channel + " address to verify"})
+			return
+		}
+		if verified {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": address + " is already verified"})
+			return
+		}
+
+		challengeId, err := utils.GenerateSecret("", 16)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		challenge := model.VerificationChallenge{
+			UserId:  user.Id.Hex(),
+			Channel: req.Channel,
+			Address: address,
+			Method:  req.Method,
+		}
+		notification := model.Notification{
+			Purpose:  constant.NotificationVerification,
+			Channel:  req.Channel,
+			To:       address,
+			UserId:   user.Id.Hex(),
+			ClientId: user.ClientId,
+		}
+		minutes := strconv.Itoa(int(config.VerificationTime.Minutes()))
+		switch req.Method {
+		case constant.VerificationCode:
+			code := utils.GenerateCode(constant.VerificationCodeLength)
+			if code == "" {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "can't generate a code"})
+				return
+			}
+			challenge.CodeHash = utils.HashToken(challengeId + code)
+			notification.Code = code
+			notification.Subject = "Your verification code"
+			notification.Message = "Your verification code is " + code + ". It expires in " + minutes + " minutes."
+		case constant.VerificationLink:
+			system, err := systemEntity.GetSystem(user.ClientId, req.System)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if !containsString(system.RedirectUris, req.RedirectUri) {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "redirectUri is not registered for " + req.System})
+				return
+			}
+			link, err := signedLink(req.RedirectUri, constant.VerificationTokenParam, constant.NotificationVerification, challengeId)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			notification.Link = link
+			notification.Subject = "Verify your address"
+			notification.Message = "Verify " + address + " with " + link + " within " + minutes + " minutes."
+		}
+
+		started, err := verificationEntity.StartCooldown(user.Id.Hex()+":"+req.Channel, config.VerificationResendTime)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !started {
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "a code was sent less than " + config.VerificationResendTime.String() + " ago"})
+			return
+		}
+		err = verificationEntity.CreateVerification(challengeId, challenge, config.VerificationTime)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		err = notifier.Notify(notification)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"challengeId": challengeId,
+			"expiresIn":   int(config.VerificationTime.Seconds()),
+		})
+	}
+}
+
+// ConfirmVerification checks a code sent to the signed-in user. A challenge is burnt after
+// VerificationMaxAttempts wrong codes.
+func ConfirmVerification(userEntity repository.IUser, verificationEntity repository.IVerification, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.VerificationConfirm{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		challenge, err := verificationEntity.GetVerification(req.ChallengeId)
+		if err != nil || challenge.Method != constant.VerificationCode || challenge.UserId != ctx.GetString(middlewares.UserId) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errVerificationInvalid.Error()})
+			return
+		}
+		codeHash := utils.HashToken(req.ChallengeId + req.Code)
+		if subtle.ConstantTimeCompare([]byte(codeHash), []byte(challenge.CodeHash)) != 1 {
+			attempts, err := verificationEntity.CountAttempt(req.ChallengeId, config.VerificationTime)
+			if err != nil || attempts >= constant.VerificationMaxAttempts {
+				_, _ = verificationEntity.ConsumeVerification(req.ChallengeId)
+			}
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errVerificationInvalid.Error()})
+			return
+		}
+		// consuming fails when a concurrent request used the code first
+		_, err = verificationEntity.ConsumeVerification(req.ChallengeId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errVerificationInvalid.Error()})
+			return
+		}
+		setContactVerified(ctx, userEntity, auditEntity, challenge)
+	}
+}
+
+// ConfirmVerificationLink checks the token of a link, which may be opened where the user isn't
+// signed in
+func ConfirmVerificationLink(userEntity repository.IUser, verificationEntity repository.IVerification, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.VerificationToken{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		challengeId, ok := verifySignedToken(constant.NotificationVerification, req.Token)
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errVerificationInvalid.Error()})
+			return
+		}
+		challenge, err := verificationEntity.ConsumeVerification(challengeId)
+		if err != nil || challenge.Method != constant.VerificationLink {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errVerificationInvalid.Error()})
+			return
+		}
+		ctx.Set(middlewares.UserId, challenge.UserId)
+		setContactVerified(ctx, userEntity, auditEntity, challenge)
+	}
+}
+
+func setContactVerified(ctx *gin.Context, userEntity repository.IUser, auditEntity repository.IAudit, challenge *model.VerificationChallenge) {
+	user, err := userEntity.GetUserById(challenge.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := userEntity.SetContactVerified(challenge.UserId, challenge.Channel, challenge.Address)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": challenge.Address + " is no longer the " + challenge.Channel + " address of the user"})
+		return
+	}
+	if !recordAudit(ctx, auditEntity, constant.AuditUserContactVerify, constant.TargetUser, challenge.UserId, result.ClientId, user, result) {
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,212 @@
+package usecase
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/middlewares"
+)
+
+// fakeVerifications keeps challenges and attempts in memory without expiring them
+type fakeVerifications struct {
+	repository.IVerification
+	mu         sync.Mutex
+	challenges map[string]model.VerificationChallenge
+	attempts   map[string]int64
+}
+
+func newFakeVerifications() *fakeVerifications {
+	return &fakeVerifications{challenges: map[string]model.VerificationChallenge{}, attempts: map[string]int64{}}
+}
+
+func (fake *fakeVerifications) CreateVerification(id string, item model.VerificationChallenge, expiration time.Duration) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.challenges[id] = item
+	return nil
+}
+
+func (fake *fakeVerifications) GetVerification(id string) (*model.VerificationChallenge, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	item, ok := fake.challenges[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &item, nil
+}
+
+func (fake *fakeVerifications) ConsumeVerification(id string) (*model.VerificationChallenge, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	item, ok := fake.challenges[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	delete(fake.challenges, id)
+	return &item, nil
+}
+
+func (fake *fakeVerifications) CountAttempt(id string, expiration time.Duration) (int64, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.attempts[id]++
+	return fake.attempts[id], nil
+}
+
+// SetContactVerified only matches the user while the address is still the one sent a code, like the
+// filter of the repository
+func (fake *fakeUsers) SetContactVerified(id string, channel string, address string) (*model.User, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	user, ok := fake.users[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	switch {
+	case channel == constant.ChannelSms && user.Phone == address:
+		user.PhoneVerified = true
+	case channel == constant.ChannelEmail && user.Email == address:
+		user.EmailVerified = true
+	default:
+		return nil, mongo.ErrNoDocuments
+	}
+	return fake.copyOf(user), nil
+}
+
+// verificationRouter confirms codes as the user in the userId query parameter
+func verificationRouter(users *fakeUsers, verifications *fakeVerifications, audit *fakeAudit) *gin.Engine {
+	router := gin.New()
+	router.POST("/verification/confirm", func(ctx *gin.Context) {
+		ctx.Set(middlewares.UserId, ctx.Query("userId"))
+	}, ConfirmVerification(users, verifications, audit))
+	router.POST("/verification/link", ConfirmVerificationLink(users, verifications, audit))
+	return router
+}
+
+func verificationChallenge(user *model.User, channel string, address string, method string, code string) (string, model.VerificationChallenge) {
+	challengeId := primitive.NewObjectID().Hex()
+	challenge := model.VerificationChallenge{UserId: user.Id.Hex(), Channel: channel, Address: address, Method: method}
+	if code != "" {
+		challenge.CodeHash = utils.HashToken(challengeId + code)
+	}
+	return challengeId, challenge
+}
+
+func TestConfirmVerificationBurnsCode(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		wrong    int
+		status   int
+		verified bool
+	}{
+		{"right code", 0, http.StatusOK, true},
+		{"right code after wrong codes", constant.VerificationMaxAttempts - 1, http.StatusOK, true},
+		{"right code after too many wrong codes", constant.VerificationMaxAttempts, http.StatusBadRequest, false},
+	} {
+		jane := &model.User{Id: primitive.NewObjectID(), Username: "jane", ClientId: "ACM", Email: "jane@acme.test"}
+		users := newFakeUsers(jane)
+		verifications := newFakeVerifications()
+		audit := &fakeAudit{}
+		router := verificationRouter(users, verifications, audit)
+		challengeId, challenge := verificationChallenge(jane, constant.ChannelEmail, jane.Email, constant.VerificationCode, "123456")
+		_ = verifications.CreateVerification(challengeId, challenge, time.Minute)
+
+		path := "/verification/confirm?userId=" + jane.Id.Hex()
+		for i := 0; i < test.wrong; i++ {
+			if status, _ := serveJson(t, router, http.MethodPost, path, gin.H{"challengeId": challengeId, "code": "654321"}); status != http.StatusBadRequest {
+				t.Errorf("%s: wrong code answered %d", test.name, status)
+			}
+		}
+		status, result := serveJson(t, router, http.MethodPost, path, gin.H{"challengeId": challengeId, "code": "123456"})
+		if status != test.status {
+			t.Errorf("%s: answered %d %v, want %d", test.name, status, result, test.status)
+		}
+		if jane.EmailVerified != test.verified {
+			t.Errorf("%s: verified %v, want %v", test.name, jane.EmailVerified, test.verified)
+		}
+		if recorded := len(audit.items) == 1 && audit.items[0].Action == constant.AuditUserContactVerify; recorded != test.verified {
+			t.Errorf("%s: audit %v", test.name, audit.items)
+		}
+	}
+}
+
+func TestConfirmVerificationOtherUser(t *testing.T) {
+	jane := &model.User{Id: primitive.NewObjectID(), Username: "jane", ClientId: "ACM", Email: "jane@acme.test"}
+	john := &model.User{Id: primitive.NewObjectID(), Username: "john", ClientId: "ACM", Email: "john@acme.test"}
+	verifications := newFakeVerifications()
+	router := verificationRouter(newFakeUsers(jane, john), verifications, &fakeAudit{})
+	challengeId, challenge := verificationChallenge(jane, constant.ChannelEmail, jane.Email, constant.VerificationCode, "123456")
+	_ = verifications.CreateVerification(challengeId, challenge, time.Minute)
+
+	status, result := serveJson(t, router, http.MethodPost, "/verification/confirm?userId="+john.Id.Hex(), gin.H{"challengeId": challengeId, "code": "123456"})
+	if status != http.StatusBadRequest {
+		t.Errorf("another user answered %d %v, want %d", status, result, http.StatusBadRequest)
+	}
+	if jane.EmailVerified || john.EmailVerified {
+		t.Error("another user verified the address")
+	}
+	// the attempt of another user doesn't count towards burning the code
+	if verifications.attempts[challengeId] != 0 {
+		t.Errorf("counted %d attempts", verifications.attempts[challengeId])
+	}
+	status, result = serveJson(t, router, http.MethodPost, "/verification/confirm?userId="+jane.Id.Hex(), gin.H{"challengeId": challengeId, "code": "123456"})
+	if status != http.StatusOK || !jane.EmailVerified {
+		t.Errorf("owner answered %d %v, want the address verified", status, result)
+	}
+}
+
+func TestConfirmVerificationAddressChanged(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		channel string
+		method  string
+	}{
+		{"email by code", constant.ChannelEmail, constant.VerificationCode},
+		{"phone by code", constant.ChannelSms, constant.VerificationCode},
+		{"email by link", constant.ChannelEmail, constant.VerificationLink},
+	} {
+		jane := &model.User{Id: primitive.NewObjectID(), Username: "jane", ClientId: "ACM", Email: "jane@acme.test", Phone: "+15550100"}
+		verifications := newFakeVerifications()
+		audit := &fakeAudit{}
+		router := verificationRouter(newFakeUsers(jane), verifications, audit)
+		address, code := jane.Email, "123456"
+		if test.channel == constant.ChannelSms {
+			address = jane.Phone
+		}
+		if test.method == constant.VerificationLink {
+			code = ""
+		}
+		challengeId, challenge := verificationChallenge(jane, test.channel, address, test.method, code)
+		_ = verifications.CreateVerification(challengeId, challenge, time.Minute)
+
+		// the user changed both addresses after the code was sent
+		jane.Email, jane.Phone = "jane@other.test", "+15550199"
+		var status int
+		var result map[string]interface{}
+		if test.method == constant.VerificationLink {
+			token := challengeId + "." + challengeSignature(constant.NotificationVerification, challengeId)
+			status, result = serveJson(t, router, http.MethodPost, "/verification/link", gin.H{"token": token})
+		} else {
+			status, result = serveJson(t, router, http.MethodPost, "/verification/confirm?userId="+jane.Id.Hex(), gin.H{"challengeId": challengeId, "code": code})
+		}
+		if status != http.StatusBadRequest {
+			t.Errorf("%s: answered %d %v, want %d", test.name, status, result, http.StatusBadRequest)
+		}
+		if jane.EmailVerified || jane.PhoneVerified {
+			t.Errorf("%s: verified the new address", test.name)
+		}
+		if len(audit.items) != 0 {
+			t.Errorf("%s: audit %v", test.name, audit.items)
+		}
+	}
+}
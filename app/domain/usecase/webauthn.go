@@ -0,0 +1,457 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"strings"
+	"time"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+var errPasskeysDisabled = errors.New("passkeys are not configured")
+
+// NewRelyingParty configures WebAuthn for rpId, the domain passkeys are bound to, and origins, the
+// comma-separated origins of the pages calling navigator.credentials. Passkeys are off without an
+// rpId.
+func NewRelyingParty(rpId string, rpName string, origins string) (*webauthn.WebAuthn, error) {
+	if rpId == "" {
+		return nil, nil
+	}
+	if rpName == "" {
+		rpName = "User Management"
+	}
+	rpOrigins := []string{}
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			rpOrigins = append(rpOrigins, origin)
+		}
+	}
+	if len(rpOrigins) == 0 {
+		rpOrigins = append(rpOrigins, "https://"+rpId)
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:                  rpId,
+		RPDisplayName:         rpName,
+		RPOrigins:             rpOrigins,
+		AttestationPreference: protocol.PreferNoAttestation,
+	})
+}
+
+// webauthnUser presents a user to WebAuthn, its user handle is the 12 bytes of its id
+type webauthnUser struct {
+	user *model.User
+}
+
+func (item webauthnUser) WebAuthnID() []byte {
+	return item.user.Id[:]
+}
+
+func (item webauthnUser) WebAuthnName() string {
+	return item.user.Username
+}
+
+func (item webauthnUser) WebAuthnDisplayName() string {
+	name := strings.TrimSpace(item.user.FirstName + " " + item.user.LastName)
+	if name == "" {
+		return item.user.Username
+	}
+	return name
+}
+
+func (item webauthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (item webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := []webauthn.Credential{}
+	for _, credential := range item.user.Webauthn {
+		id, err := base64.RawURLEncoding.DecodeString(credential.Id)
+		if err != nil {
+			continue
+		}
+		transports := []protocol.AuthenticatorTransport{}
+		for _, transport := range credential.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              id,
+			PublicKey:       credential.PublicKey,
+			AttestationType: credential.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: credential.BackupEligible,
+				BackupState:    credential.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    credential.Aaguid,
+				SignCount: credential.SignCount,
+			},
+		})
+	}
+	return credentials
+}
+
+// BeginWebauthnRegistration returns the options for navigator.credentials.create of a new passkey
+// of the signed-in user
+func BeginWebauthnRegistration(relyingParty *webauthn.WebAuthn, userEntity repository.IUser, webauthnEntity repository.IWebauthn) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if relyingParty == nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errPasskeysDisabled.Error()})
+			return
+		}
+		userId := ctx.GetString(middlewares.UserId)
+		user, err := userEntity.GetUserById(userId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		exclusions := []protocol.CredentialDescriptor{}
+		for _, credential := range (webauthnUser{user}).WebAuthnCredentials() {
+			exclusions = append(exclusions, credential.Descriptor())
+		}
+		creation, session, err := relyingParty.BeginRegistration(webauthnUser{user},
+			webauthn.WithExclusions(exclusions),
+			webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+		)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		challengeId, err := createWebauthnChallenge(webauthnEntity, model.WebauthnChallenge{
+			Ceremony: constant.WebauthnRegister,
+			UserId:   userId,
+			Session:  *session,
+		})
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"challengeId": challengeId,
+			"publicKey":   creation.Response,
+		})
+	}
+}
+
+// FinishWebauthnRegistration verifies the new credential and stores it with the user
+func FinishWebauthnRegistration(
+	relyingParty *webauthn.WebAuthn,
+	userEntity repository.IUser,
+	webauthnEntity repository.IWebauthn,
+	auditEntity repository.IAudit,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if relyingParty == nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errPasskeysDisabled.Error()})
+			return
+		}
+		req := request.WebauthnRegister{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userId := ctx.GetString(middlewares.UserId)
+		challenge, err := webauthnEntity.ConsumeWebauthnChallenge(req.ChallengeId)
+		if err != nil || challenge.Ceremony != constant.WebauthnRegister || challenge.UserId != userId {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid or expired challenge"})
+			return
+		}
+		user, err := userEntity.GetUserById(userId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(req.Credential))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		credential, err := relyingParty.CreateCredential(webauthnUser{user}, challenge.Session, parsed)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		item := model.WebauthnCredential{
+			Id:              base64.RawURLEncoding.EncodeToString(credential.ID),
+			Name:            req.Name,
+			PublicKey:       credential.PublicKey,
+			AttestationType: credential.AttestationType,
+			Transports:      []string{},
+			Aaguid:          credential.Authenticator.AAGUID,
+			SignCount:       credential.Authenticator.SignCount,
+			BackupEligible:  credential.Flags.BackupEligible,
+			BackupState:     credential.Flags.BackupState,
+			CreatedDate:     time.Now(),
+		}
+		if item.Name == "" {
+			item.Name = constant.WebauthnDefaultName
+		}
+		for _, transport := range credential.Transport {
+			item.Transports = append(item.Transports, string(transport))
+		}
+		_, err = userEntity.AddWebauthnCredential(userId, item)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditWebauthnRegister, constant.TargetUser, userId, user.ClientId, nil, item) {
+			return
+		}
+		ctx.JSON(http.StatusOK, item)
+	}
+}
+
+func GetWebauthnCredentials(userEntity repository.IUser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := userEntity.GetUserById(ctx.GetString(middlewares.UserId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, webauthnCredentials(user))
+	}
+}
+
+func RemoveWebauthnCredential(userEntity repository.IUser, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId := ctx.GetString(middlewares.UserId)
+		id := ctx.Param("id")
+		result, err := userEntity.RemoveWebauthnCredential(userId, id)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditWebauthnRemove, constant.TargetUser, userId, result.ClientId, gin.H{"id": id}, nil) {
+			return
+		}
+		ctx.JSON(http.StatusOK, webauthnCredentials(result))
+	}
+}
+
+func GetUserWebauthnCredentials(userEntity repository.IUser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := userEntity.GetUserByClientId(ctx.Param("id"), ctx.GetString(middlewares.ClientId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, webauthnCredentials(user))
+	}
+}
+
+// RemoveUserWebauthnCredential lets an admin remove a lost passkey of a user of the client
+func RemoveUserWebauthnCredential(userEntity repository.IUser, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		credentialId := ctx.Param("credentialId")
+		_, err := userEntity.GetUserByClientId(id, ctx.GetString(middlewares.ClientId))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result, err := userEntity.RemoveWebauthnCredential(id, credentialId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditWebauthnRemove, constant.TargetUser, id, result.ClientId, gin.H{"id": credentialId}, nil) {
+			return
+		}
+		ctx.JSON(http.StatusOK, webauthnCredentials(result))
+	}
+}
+
+// BeginWebauthnLogin returns the options for navigator.credentials.get to sign in with a passkey.
+// The authenticator picks the account, so no username is asked for.
+func BeginWebauthnLogin(relyingParty *webauthn.WebAuthn, webauthnEntity repository.IWebauthn) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if relyingParty == nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errPasskeysDisabled.Error()})
+			return
+		}
+		req := request.WebauthnLoginStart{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		assertion, session, err := relyingParty.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		challengeId, err := createWebauthnChallenge(webauthnEntity, model.WebauthnChallenge{
+			Ceremony: constant.WebauthnLogin,
+			System:   req.System,
+			Session:  *session,
+		})
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"challengeId": challengeId,
+			"publicKey":   assertion.Response,
+		})
+	}
+}
+
+// FinishWebauthnLogin verifies the assertion of a passkey login, or of the second factor asked for
+// by a password login, and starts the session
+func FinishWebauthnLogin(
+	relyingParty *webauthn.WebAuthn,
+	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
+	sessionEntity repository.ISession,
+	webauthnEntity repository.IWebauthn,
+	loginHistoryEntity repository.ILoginHistory,
+	eventEntity repository.IEvent,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if relyingParty == nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errPasskeysDisabled.Error()})
+			return
+		}
+		req := request.WebauthnLogin{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		challenge, err := webauthnEntity.ConsumeWebauthnChallenge(req.ChallengeId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge"})
+			return
+		}
+		parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(req.Credential))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user *model.User
+		var credential *webauthn.Credential
+		switch challenge.Ceremony {
+		case constant.WebauthnMfa:
+			user, err = userEntity.GetUserById(challenge.UserId)
+			if err == nil {
+				credential, err = relyingParty.ValidateLogin(webauthnUser{user}, challenge.Session, parsed)
+			}
+		case constant.WebauthnLogin:
+			credential, err = relyingParty.ValidateDiscoverableLogin(func(rawId, userHandle []byte) (webauthn.User, error) {
+				var id primitive.ObjectID
+				if len(userHandle) != len(id) {
+					return nil, errors.New("unknown user handle")
+				}
+				copy(id[:], userHandle)
+				user, err = userEntity.GetUserById(id.Hex())
+				if err != nil {
+					return nil, err
+				}
+				return webauthnUser{user}, nil
+			}, challenge.Session, parsed)
+		default:
+			err = errors.New("invalid challenge")
+		}
+
+		history := model.LoginHistory{Event: constant.LoginEventLogin, System: challenge.System}
+		if user != nil {
+			history.UserId = user.Id.Hex()
+			history.Username = user.Username
+			history.ClientId = user.ClientId
+		}
+		fail := func(reason string, message string) {
+			if history.UserId != "" {
+				history.FailureReason = reason
+				recordLoginHistory(ctx, loginHistoryEntity, history)
+			}
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
+		}
+		if err != nil {
+			logrus.Info("passkey login failed: " + err.Error())
+			fail(constant.LoginFailurePasskey, "invalid passkey")
+			return
+		}
+		if credential.Authenticator.CloneWarning {
+			logrus.Warn("passkey of user " + history.UserId + " reused an old signature counter, it may be cloned")
+			fail(constant.LoginFailurePasskey, "invalid passkey")
+			return
+		}
+		if !isUserActive(user) {
+			fail(constant.LoginFailureUserInactive, "user is not active")
+			return
+		}
+		err = userEntity.TouchWebauthnCredential(user.Id.Hex(), base64.RawURLEncoding.EncodeToString(credential.ID), credential.Authenticator.SignCount, credential.Flags.BackupState)
+		if err != nil {
+			logrus.Error(err)
+		}
+
+		token, err := loginToken(ctx, userEntity, attributeEntity, sessionEntity, loginHistoryEntity, eventEntity, user, challenge.System)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"accessToken": token,
+		})
+	}
+}
+
+// beginWebauthnMfa asks a user who signed in with a password or a code to confirm with a passkey
+func beginWebauthnMfa(relyingParty *webauthn.WebAuthn, webauthnEntity repository.IWebauthn, user *model.User, system string) (gin.H, error) {
+	if relyingParty == nil {
+		return nil, errPasskeysDisabled
+	}
+	assertion, session, err := relyingParty.BeginLogin(webauthnUser{user})
+	if err != nil {
+		return nil, err
+	}
+	challengeId, err := createWebauthnChallenge(webauthnEntity, model.WebauthnChallenge{
+		Ceremony: constant.WebauthnMfa,
+		UserId:   user.Id.Hex(),
+		System:   system,
+		Session:  *session,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"mfaRequired": true,
+		"challengeId": challengeId,
+		"publicKey":   assertion.Response,
+	}, nil
+}
+
+func createWebauthnChallenge(webauthnEntity repository.IWebauthn, challenge model.WebauthnChallenge) (string, error) {
+	challengeId, err := utils.GenerateSecret("", 16)
+	if err != nil {
+		return "", err
+	}
+	err = webauthnEntity.CreateWebauthnChallenge(challengeId, challenge, config.WebauthnTime)
+	if err != nil {
+		return "", err
+	}
+	return challengeId, nil
+}
+
+func webauthnCredentials(user *model.User) []model.WebauthnCredential {
+	if user.Webauthn == nil {
+		return []model.WebauthnCredential{}
+	}
+	return user.Webauthn
+}
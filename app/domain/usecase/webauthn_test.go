@@ -0,0 +1,311 @@
+package usecase
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+const webauthnTestOrigin = "https://example.com"
+
+// virtualAuthenticator is a platform authenticator with one ES256 passkey, it answers the options
+// of the begin endpoints like navigator.credentials would
+type virtualAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newVirtualAuthenticator(t *testing.T) *virtualAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialId := make([]byte, 16)
+	_, _ = rand.Read(credentialId)
+	return &virtualAuthenticator{key: key, credentialId: credentialId}
+}
+
+func (authenticator *virtualAuthenticator) clientData(t *testing.T, ceremony string, options map[string]interface{}) []byte {
+	t.Helper()
+	challenge, _ := options["challenge"].(string)
+	data, err := json.Marshal(gin.H{"type": ceremony, "challenge": challenge, "origin": webauthnTestOrigin, "crossOrigin": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func (authenticator *virtualAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIdHash := sha256.Sum256([]byte("example.com"))
+	data := append(rpIdHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, authenticator.signCount)
+	return append(data, attested...)
+}
+
+// create makes the passkey for the options of BeginWebauthnRegistration
+func (authenticator *virtualAuthenticator) create(t *testing.T, options map[string]interface{}) json.RawMessage {
+	t.Helper()
+	user, _ := options["user"].(map[string]interface{})
+	userId, _ := user["id"].(string)
+	handle, err := base64.RawURLEncoding.DecodeString(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator.userHandle = handle
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         1,
+		XCoord:        authenticator.key.X.FillBytes(make([]byte, 32)),
+		YCoord:        authenticator.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attested := make([]byte, 16)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(authenticator.credentialId)))
+	attested = append(attested, authenticator.credentialId...)
+	attested = append(attested, publicKey...)
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authenticator.authData(0x45, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authenticator.credential(t, gin.H{
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(authenticator.clientData(t, "webauthn.create", options)),
+		"attestationObject": base64.RawURLEncoding.EncodeToString(attestation),
+	})
+}
+
+// get signs the options of BeginWebauthnLogin or of a second factor with the passkey
+func (authenticator *virtualAuthenticator) get(t *testing.T, options map[string]interface{}) json.RawMessage {
+	t.Helper()
+	authenticator.signCount++
+	clientData := authenticator.clientData(t, "webauthn.get", options)
+	authData := authenticator.authData(0x05, nil)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, authenticator.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authenticator.credential(t, gin.H{
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+		"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+		"signature":         base64.RawURLEncoding.EncodeToString(signature),
+		"userHandle":        base64.RawURLEncoding.EncodeToString(authenticator.userHandle),
+	})
+}
+
+func (authenticator *virtualAuthenticator) credential(t *testing.T, response gin.H) json.RawMessage {
+	t.Helper()
+	id := base64.RawURLEncoding.EncodeToString(authenticator.credentialId)
+	data, err := json.Marshal(gin.H{"id": id, "rawId": id, "type": "public-key", "response": response})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+type webauthnHarness struct {
+	users      *fakeUsers
+	user       *model.User
+	histories  *fakeHistories
+	audit      *fakeAudit
+	challenges *fakeChallenges
+	router     *gin.Engine
+}
+
+func newWebauthnHarness(t *testing.T) *webauthnHarness {
+	t.Helper()
+	relyingParty, err := NewRelyingParty("example.com", "", webauthnTestOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	harness := &webauthnHarness{
+		users:      newFakeUsers(),
+		histories:  &fakeHistories{},
+		audit:      &fakeAudit{},
+		challenges: newFakeChallenges(),
+	}
+	harness.user, _ = harness.users.CreateUser(request.User{Username: "alice", Password: "s3cret-pass", ClientId: "ACME"}, constant.USER)
+	sessions := newFakeSessions()
+	signedIn := func(ctx *gin.Context) {
+		ctx.Set(middlewares.UserId, harness.user.Id.Hex())
+		ctx.Set(middlewares.ClientId, harness.user.ClientId)
+	}
+	harness.router = gin.New()
+	harness.router.POST("/user/webauthn/register/begin", signedIn, BeginWebauthnRegistration(relyingParty, harness.users, harness.challenges))
+	harness.router.POST("/user/webauthn/register/finish", signedIn, FinishWebauthnRegistration(relyingParty, harness.users, harness.challenges, harness.audit))
+	harness.router.POST("/auth/webauthn/login/begin", BeginWebauthnLogin(relyingParty, harness.challenges))
+	harness.router.POST("/auth/webauthn/login/finish", FinishWebauthnLogin(relyingParty, harness.users, &fakeAttributes{}, sessions, harness.challenges, harness.histories, &fakeEvents{}))
+	harness.router.POST("/auth/login", Login(harness.users, &fakeAttributes{}, sessions, NewAuthenticatorChain(NewLocalAuthenticator()), &fakeClientSettings{}, harness.histories, &fakeEvents{}, relyingParty, harness.challenges))
+	return harness
+}
+
+func (harness *webauthnHarness) register(t *testing.T, authenticator *virtualAuthenticator) {
+	t.Helper()
+	code, body := serveJson(t, harness.router, http.MethodPost, "/user/webauthn/register/begin", nil)
+	if code != http.StatusOK {
+		t.Fatalf("register begin answered %d %v", code, body)
+	}
+	options, _ := body["publicKey"].(map[string]interface{})
+	code, body = serveJson(t, harness.router, http.MethodPost, "/user/webauthn/register/finish", gin.H{
+		"challengeId": body["challengeId"],
+		"name":        "laptop",
+		"credential":  authenticator.create(t, options),
+	})
+	if code != http.StatusOK {
+		t.Fatalf("register finish answered %d %v", code, body)
+	}
+}
+
+// passkeyLogin signs a discoverable login in and returns the answer of the finish endpoint
+func (harness *webauthnHarness) passkeyLogin(t *testing.T, authenticator *virtualAuthenticator) (int, map[string]interface{}) {
+	t.Helper()
+	code, body := serveJson(t, harness.router, http.MethodPost, "/auth/webauthn/login/begin", gin.H{"system": "portal"})
+	if code != http.StatusOK {
+		t.Fatalf("login begin answered %d %v", code, body)
+	}
+	options, _ := body["publicKey"].(map[string]interface{})
+	return serveJson(t, harness.router, http.MethodPost, "/auth/webauthn/login/finish", gin.H{
+		"challengeId": body["challengeId"],
+		"credential":  authenticator.get(t, options),
+	})
+}
+
+func (harness *webauthnHarness) lastFailure() string {
+	if len(harness.histories.items) == 0 {
+		return ""
+	}
+	return harness.histories.items[len(harness.histories.items)-1].FailureReason
+}
+
+func TestFinishWebauthnRegistration(t *testing.T) {
+	harness := newWebauthnHarness(t)
+	authenticator := newVirtualAuthenticator(t)
+	harness.register(t, authenticator)
+
+	user, _ := harness.users.GetUserById(harness.user.Id.Hex())
+	if len(user.Webauthn) != 1 || user.Webauthn[0].Id != base64.RawURLEncoding.EncodeToString(authenticator.credentialId) || user.Webauthn[0].Name != "laptop" {
+		t.Fatalf("user has passkeys %+v", user.Webauthn)
+	}
+	if len(harness.audit.items) != 1 || harness.audit.items[0].Action != constant.AuditWebauthnRegister {
+		t.Fatalf("audit log has %+v", harness.audit.items)
+	}
+
+	code, body := serveJson(t, harness.router, http.MethodPost, "/user/webauthn/register/begin", nil)
+	if code != http.StatusOK {
+		t.Fatalf("register begin answered %d %v", code, body)
+	}
+	options, _ := body["publicKey"].(map[string]interface{})
+	excluded, _ := options["excludeCredentials"].([]interface{})
+	if len(excluded) != 1 {
+		t.Fatalf("registration options exclude %v, want the registered passkey", options["excludeCredentials"])
+	}
+	finish := gin.H{"challengeId": body["challengeId"], "credential": newVirtualAuthenticator(t).create(t, map[string]interface{}{"challenge": "forged", "user": options["user"]})}
+	if code, body = serveJson(t, harness.router, http.MethodPost, "/user/webauthn/register/finish", finish); code != http.StatusBadRequest {
+		t.Fatalf("registration with another challenge answered %d %v", code, body)
+	}
+	if code, body = serveJson(t, harness.router, http.MethodPost, "/user/webauthn/register/finish", finish); code != http.StatusBadRequest || body["error"] != "invalid or expired challenge" {
+		t.Fatalf("reused challenge answered %d %v", code, body)
+	}
+}
+
+func TestFinishWebauthnLoginDiscoverable(t *testing.T) {
+	harness := newWebauthnHarness(t)
+	authenticator := newVirtualAuthenticator(t)
+	harness.register(t, authenticator)
+
+	code, body := harness.passkeyLogin(t, authenticator)
+	if code != http.StatusOK || body["accessToken"] == nil {
+		t.Fatalf("passkey login answered %d %v", code, body)
+	}
+	user, _ := harness.users.GetUserById(harness.user.Id.Hex())
+	if user.Webauthn[0].SignCount != authenticator.signCount {
+		t.Fatalf("stored sign count is %d, want %d", user.Webauthn[0].SignCount, authenticator.signCount)
+	}
+
+	stranger := newVirtualAuthenticator(t)
+	stranger.userHandle = authenticator.userHandle
+	code, body = harness.passkeyLogin(t, stranger)
+	if code != http.StatusUnauthorized || harness.lastFailure() != constant.LoginFailurePasskey {
+		t.Fatalf("login with an unknown passkey answered %d %v, history %q", code, body, harness.lastFailure())
+	}
+}
+
+func TestFinishWebauthnLoginMfa(t *testing.T) {
+	harness := newWebauthnHarness(t)
+	authenticator := newVirtualAuthenticator(t)
+	harness.register(t, authenticator)
+
+	code, body := serveJson(t, harness.router, http.MethodPost, "/auth/login", gin.H{"username": "alice", "password": "s3cret-pass", "system": "portal"})
+	if code != http.StatusOK || body["mfaRequired"] != true || body["accessToken"] != nil {
+		t.Fatalf("password login answered %d %v, want a passkey challenge", code, body)
+	}
+	options, _ := body["publicKey"].(map[string]interface{})
+	allowed, _ := options["allowCredentials"].([]interface{})
+	if len(allowed) != 1 {
+		t.Fatalf("challenge allows %v, want the passkey of the user", options["allowCredentials"])
+	}
+	challengeId := body["challengeId"]
+
+	stranger := newVirtualAuthenticator(t)
+	stranger.userHandle = authenticator.userHandle
+	code, body = serveJson(t, harness.router, http.MethodPost, "/auth/webauthn/login/finish", gin.H{"challengeId": challengeId, "credential": stranger.get(t, options)})
+	if code != http.StatusUnauthorized || harness.lastFailure() != constant.LoginFailurePasskey {
+		t.Fatalf("second factor with another passkey answered %d %v, history %q", code, body, harness.lastFailure())
+	}
+
+	code, body = serveJson(t, harness.router, http.MethodPost, "/auth/login", gin.H{"username": "alice", "password": "s3cret-pass", "system": "portal"})
+	if code != http.StatusOK {
+		t.Fatalf("password login answered %d %v", code, body)
+	}
+	options, _ = body["publicKey"].(map[string]interface{})
+	code, body = serveJson(t, harness.router, http.MethodPost, "/auth/webauthn/login/finish", gin.H{"challengeId": body["challengeId"], "credential": authenticator.get(t, options)})
+	if code != http.StatusOK || body["accessToken"] == nil {
+		t.Fatalf("second factor answered %d %v", code, body)
+	}
+}
+
+func TestFinishWebauthnLoginCloneWarning(t *testing.T) {
+	harness := newWebauthnHarness(t)
+	authenticator := newVirtualAuthenticator(t)
+	harness.register(t, authenticator)
+
+	authenticator.signCount = 10
+	if code, body := harness.passkeyLogin(t, authenticator); code != http.StatusOK {
+		t.Fatalf("passkey login answered %d %v", code, body)
+	}
+
+	// a copy of the key left behind at an older counter
+	authenticator.signCount = 3
+	code, body := harness.passkeyLogin(t, authenticator)
+	if code != http.StatusUnauthorized || harness.lastFailure() != constant.LoginFailurePasskey {
+		t.Fatalf("login with a counter gone backwards answered %d %v, history %q", code, body, harness.lastFailure())
+	}
+	user, _ := harness.users.GetUserById(harness.user.Id.Hex())
+	if user.Webauthn[0].SignCount != 11 {
+		t.Fatalf("stored sign count is %d, want 11 kept from the last good login", user.Webauthn[0].SignCount)
+	}
+}
@@ -0,0 +1,218 @@
+package usecase
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/repository"
+	"um/app/featues/request"
+	"um/middlewares"
+)
+
+func GetWebhooks(webhookEntity repository.IWebhook) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		systemId := ctx.Param("id")
+		result, err := webhookEntity.GetWebhooksBySystemId(systemId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// AddWebhook returns the signing secret once, it can't be read back afterward
+func AddWebhook(webhookEntity repository.IWebhook, systemEntity repository.ISystem, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.Webhook{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		err = validateEventTypes(req.Events)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		system, err := systemEntity.GetSystemById(ctx.Param("id"))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		secret, err := utils.GenerateSecret("whsec_", 32)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		req.CreatedBy = ctx.GetString(middlewares.UserId)
+		result, err := webhookEntity.CreateWebhook(system, secret, req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditWebhookCreate, constant.TargetWebhook, result.Id.Hex(), result.ClientId, nil, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"webhook": result,
+			"secret":  secret,
+		})
+	}
+}
+
+func GetWebhookById(webhookEntity repository.IWebhook) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		result, err := webhookEntity.GetWebhookById(ctx.Param("webhookId"), ctx.Param("id"))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func UpdateWebhookById(webhookEntity repository.IWebhook, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.UpdateWebhook{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		err = validateEventTypes(req.Events)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		id := ctx.Param("webhookId")
+		systemId := ctx.Param("id")
+		req.UpdatedBy = ctx.GetString(middlewares.UserId)
+		before, _ := webhookEntity.GetWebhookById(id, systemId)
+		result, err := webhookEntity.UpdateWebhookById(id, systemId, req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditWebhookUpdate, constant.TargetWebhook, id, result.ClientId, before, result) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func DeleteWebhookById(webhookEntity repository.IWebhook, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("webhookId")
+		result, err := webhookEntity.RemoveWebhookById(id, ctx.Param("id"))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditWebhookDelete, constant.TargetWebhook, id, result.ClientId, result, nil) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+// RotateWebhookSecret replaces the signing secret right away, receivers must switch to the returned one
+func RotateWebhookSecret(webhookEntity repository.IWebhook, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		secret, err := utils.GenerateSecret("whsec_", 32)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		id := ctx.Param("webhookId")
+		userId := ctx.GetString(middlewares.UserId)
+		result, err := webhookEntity.UpdateSecretById(id, ctx.Param("id"), secret, userId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditWebhookRotate, constant.TargetWebhook, id, result.ClientId, nil, nil) {
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"webhook": result,
+			"secret":  secret,
+		})
+	}
+}
+
+func GetWebhookDeliveries(deliveryEntity repository.IDelivery) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.GetWebhookDeliveries{}
+		err := ctx.ShouldBindQuery(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.SystemId = ctx.Param("id")
+		result, err := deliveryEntity.GetDeliveries(req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func GetWebhookDeadLetters(deliveryEntity repository.IDelivery) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := request.GetWebhookDeliveries{}
+		err := ctx.ShouldBindQuery(&req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.SystemId = ctx.Param("id")
+		req.Status = constant.DeliveryDead
+		result, err := deliveryEntity.GetDeliveries(req)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func RedeliverWebhook(deliveryEntity repository.IDelivery, auditEntity repository.IAudit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("deliveryId")
+		result, err := deliveryEntity.Redeliver(id, ctx.Param("id"))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !recordAudit(ctx, auditEntity, constant.AuditWebhookRedeliver, constant.TargetWebhook, result.WebhookId.Hex(), result.ClientId, nil, nil) {
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func validateEventTypes(events []string) error {
+	for _, event := range events {
+		if event == constant.WebhookAllEvents {
+			continue
+		}
+		valid := false
+		for _, eventType := range constant.EventTypes {
+			if event == eventType {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return errors.New("invalid event type " + event)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"github.com/sirupsen/logrus"
+	"time"
+	"um/app/core/config"
+	"um/app/domain/repository"
+)
+
+const userExpiryLock = "user-expiry"
+
+const userExpiryBatch = 100
+
+// StartUserExpirySweeper turns users past their validUntil to EXPIRED and signs them out. Logins are
+// refused from validUntil on already, the sweeper catches the sessions and the status up.
+func StartUserExpirySweeper(userEntity repository.IUser, sessionEntity repository.ISession, authzEntity repository.IAuthz, lockEntity repository.ILock) {
+	go func() {
+		ticker := time.NewTicker(config.UserExpiryInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sweepExpiredUsers(userEntity, sessionEntity, authzEntity, lockEntity)
+		}
+	}()
+}
+
+func sweepExpiredUsers(userEntity repository.IUser, sessionEntity repository.ISession, authzEntity repository.IAuthz, lockEntity repository.ILock) {
+	token, err := lockEntity.Acquire(userExpiryLock, config.UserExpiryLockTime)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	if token == "" {
+		return
+	}
+	defer func() {
+		_ = lockEntity.Release(userExpiryLock, token)
+	}()
+
+	for {
+		users, err := userEntity.ExpireUsers(time.Now(), userExpiryBatch)
+		for _, user := range users {
+			userId := user.Id.Hex()
+			logrus.Info("user " + userId + " expired")
+			err := sessionEntity.RemoveSessionsByUserId(userId)
+			if err != nil {
+				logrus.Error(err)
+			}
+			err = authzEntity.InvalidateUser(userId)
+			if err != nil {
+				logrus.Error(err)
+			}
+		}
+		if err != nil {
+			logrus.Error(err)
+			return
+		}
+		if len(users) < userExpiryBatch {
+			return
+		}
+	}
+}
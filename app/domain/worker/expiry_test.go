@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+)
+
+// fakeValidityUsers expires the ACTIVE users past their validUntil, limit at a time
+type fakeValidityUsers struct {
+	repository.IUser
+	users []*model.User
+}
+
+func (fake *fakeValidityUsers) ExpireUsers(now time.Time, limit int64) ([]model.User, error) {
+	var expired []model.User
+	for _, user := range fake.users {
+		if int64(len(expired)) == limit {
+			break
+		}
+		if user.Status == constant.ACTIVE && user.ValidUntil != nil && !user.ValidUntil.After(now) {
+			user.Status = constant.EXPIRED
+			expired = append(expired, *user)
+		}
+	}
+	return expired, nil
+}
+
+type fakeUserSessions struct {
+	repository.ISession
+	removed map[string]bool
+}
+
+func (fake *fakeUserSessions) RemoveSessionsByUserId(userId string) error {
+	fake.removed[userId] = true
+	return nil
+}
+
+type fakeUserAuthz struct {
+	repository.IAuthz
+	invalidated map[string]bool
+}
+
+func (fake *fakeUserAuthz) InvalidateUser(userId string) error {
+	fake.invalidated[userId] = true
+	return nil
+}
+
+func TestSweepExpiredUsers(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	users := &fakeValidityUsers{}
+	for i := 0; i < userExpiryBatch+1; i++ {
+		users.users = append(users.users, &model.User{Id: primitive.NewObjectID(), Status: constant.ACTIVE, ValidUntil: &past})
+	}
+	current := &model.User{Id: primitive.NewObjectID(), Status: constant.ACTIVE, ValidUntil: &future}
+	unlimited := &model.User{Id: primitive.NewObjectID(), Status: constant.ACTIVE}
+	users.users = append(users.users, current, unlimited)
+	sessions := &fakeUserSessions{removed: map[string]bool{}}
+	authz := &fakeUserAuthz{invalidated: map[string]bool{}}
+
+	sweepExpiredUsers(users, sessions, authz, &fakeLock{})
+	for _, user := range users.users[:userExpiryBatch+1] {
+		id := user.Id.Hex()
+		if user.Status != constant.EXPIRED || !sessions.removed[id] || !authz.invalidated[id] {
+			t.Fatalf("user past validUntil is %s, signed out %v, decisions dropped %v", user.Status, sessions.removed[id], authz.invalidated[id])
+		}
+	}
+	for _, user := range []*model.User{current, unlimited} {
+		if user.Status != constant.ACTIVE || sessions.removed[user.Id.Hex()] {
+			t.Fatalf("user within its validity is %s, signed out %v", user.Status, sessions.removed[user.Id.Hex()])
+		}
+	}
+}
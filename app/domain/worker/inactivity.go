@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"time"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+)
+
+const inactivityLock = "user-inactivity"
+
+// StartInactivitySweeper applies the inactivity policy of every client that has one: users get a
+// warning inactivityWarningDays before they would be disabled, and are turned INACTIVE after
+// inactivityDays without signing in.
+func StartInactivitySweeper(
+	userEntity repository.IUser,
+	clientSettingEntity repository.IClientSetting,
+	sessionEntity repository.ISession,
+	authzEntity repository.IAuthz,
+	lockEntity repository.ILock,
+	notify func(model.Notification) error,
+) {
+	go func() {
+		ticker := time.NewTicker(config.InactivityInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sweepInactiveUsers(userEntity, clientSettingEntity, sessionEntity, authzEntity, lockEntity, notify)
+		}
+	}()
+}
+
+func sweepInactiveUsers(
+	userEntity repository.IUser,
+	clientSettingEntity repository.IClientSetting,
+	sessionEntity repository.ISession,
+	authzEntity repository.IAuthz,
+	lockEntity repository.ILock,
+	notify func(model.Notification) error,
+) {
+	token, err := lockEntity.Acquire(inactivityLock, config.InactivityLockTime)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	if token == "" {
+		return
+	}
+	defer func() {
+		_ = lockEntity.Release(inactivityLock, token)
+	}()
+
+	policies, err := clientSettingEntity.GetInactivityPolicies()
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	now := time.Now()
+	for _, policy := range policies {
+		if policy.InactivityWarningDays > 0 {
+			warnInactiveUsers(userEntity, policy, now, notify)
+		}
+		disableInactiveUsers(userEntity, sessionEntity, authzEntity, policy, now)
+	}
+}
+
+func warnInactiveUsers(userEntity repository.IUser, policy model.ClientSetting, now time.Time, notify func(model.Notification) error) {
+	cutoff := now.AddDate(0, 0, policy.InactivityWarningDays-policy.InactivityDays)
+	users, err := userEntity.GetDormantUsers(policy.ClientId, cutoff)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	days := strconv.Itoa(policy.InactivityWarningDays)
+	for _, user := range users {
+		if user.InactivityWarnedDate != nil {
+			continue
+		}
+		// only a verified address is known to reach the user and not someone else
+		if user.Email != "" && user.EmailVerified {
+			err = notify(model.Notification{
+				Purpose:  constant.NotificationInactivity,
+				Channel:  constant.ChannelEmail,
+				To:       user.Email,
+				Subject:  "Your account will be disabled",
+				Message:  "You haven't signed in as " + user.Username + " for a while. Sign in within " + days + " days to keep your account.",
+				UserId:   user.Id.Hex(),
+				ClientId: user.ClientId,
+			})
+			if err != nil {
+				logrus.Error(err)
+				continue
+			}
+		}
+		err = userEntity.MarkInactivityWarned(user.Id.Hex())
+		if err != nil {
+			logrus.Error(err)
+		}
+	}
+}
+
+// disableInactiveUsers disables the users past the inactivity period, once they were warned long
+// enough ago when the policy warns
+func disableInactiveUsers(userEntity repository.IUser, sessionEntity repository.ISession, authzEntity repository.IAuthz, policy model.ClientSetting, now time.Time) {
+	cutoff := now.AddDate(0, 0, -policy.InactivityDays)
+	users, err := userEntity.GetDormantUsers(policy.ClientId, cutoff)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	warnedBefore := now.AddDate(0, 0, -policy.InactivityWarningDays)
+	for _, user := range users {
+		if policy.InactivityWarningDays > 0 && (user.InactivityWarnedDate == nil || user.InactivityWarnedDate.After(warnedBefore)) {
+			continue
+		}
+		userId := user.Id.Hex()
+		_, err = userEntity.DisableDormantUser(userId, cutoff)
+		if err != nil {
+			logrus.Error(err)
+			continue
+		}
+		logrus.Info("user " + userId + " disabled after " + strconv.Itoa(policy.InactivityDays) + " days without login")
+		err = sessionEntity.RemoveSessionsByUserId(userId)
+		if err != nil {
+			logrus.Error(err)
+		}
+		err = authzEntity.InvalidateUser(userId)
+		if err != nil {
+			logrus.Error(err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+)
+
+type fakeDormantUsers struct {
+	repository.IUser
+	users  []model.User
+	warned []string
+}
+
+func (fake *fakeDormantUsers) GetDormantUsers(clientId string, cutoff time.Time) ([]model.User, error) {
+	return fake.users, nil
+}
+
+func (fake *fakeDormantUsers) MarkInactivityWarned(id string) error {
+	fake.warned = append(fake.warned, id)
+	return nil
+}
+
+func TestWarnInactiveUsersOnlyVerifiedEmail(t *testing.T) {
+	verified := model.User{Id: primitive.NewObjectID(), Username: "jane", Email: "jane@example.com", EmailVerified: true}
+	unverified := model.User{Id: primitive.NewObjectID(), Username: "john", Email: "john@example.com"}
+	users := &fakeDormantUsers{users: []model.User{verified, unverified}}
+	var sent []model.Notification
+	notify := func(notification model.Notification) error {
+		sent = append(sent, notification)
+		return nil
+	}
+
+	policy := model.ClientSetting{ClientId: "ACME", InactivityDays: 90, InactivityWarningDays: 7}
+	warnInactiveUsers(users, policy, time.Now(), notify)
+	if len(sent) != 1 || sent[0].To != verified.Email {
+		t.Fatalf("sent %v, want one warning to %s", sent, verified.Email)
+	}
+	if len(users.warned) != 2 {
+		t.Fatalf("marked %d users warned, want both so the unverified one is disabled just as late", len(users.warned))
+	}
+}
@@ -0,0 +1,76 @@
+package worker
+
+import (
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"time"
+	"um/app/core/config"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+)
+
+const outboxRelayLock = "outbox-relay"
+
+const outboxRelayBatch = 100
+
+// StartOutboxRelay moves events from the Mongo outbox to the publisher. An event is marked
+// published only once the publisher accepted it, so consumers see every event at least once. An
+// event the publisher keeps refusing while it takes the next one is dead-lettered, so it doesn't
+// hold the others back.
+func StartOutboxRelay(eventEntity repository.IEvent, publisher repository.IPublisher, lockEntity repository.ILock) {
+	go func() {
+		ticker := time.NewTicker(config.OutboxRelayInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			relayOutbox(eventEntity, publisher, lockEntity)
+		}
+	}()
+}
+
+func relayOutbox(eventEntity repository.IEvent, publisher repository.IPublisher, lockEntity repository.ILock) {
+	token, err := lockEntity.Acquire(outboxRelayLock, config.OutboxRelayLockTime)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	if token == "" {
+		return
+	}
+	defer func() {
+		_ = lockEntity.Release(outboxRelayLock, token)
+	}()
+
+	events, err := eventEntity.GetPendingEvents(outboxRelayBatch)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	var stuck *model.Event
+	for i, event := range events {
+		err = publisher.Publish(event)
+		if err != nil {
+			logrus.Error(err)
+			_ = eventEntity.MarkFailed(event.Id, err.Error())
+			if stuck != nil || event.Attempts+1 < config.OutboxMaxAttempts {
+				// stop to keep the stream in outbox order, the publisher may be unavailable
+				return
+			}
+			// try the next event to tell a poison event from a publisher that is down
+			stuck = &events[i]
+			continue
+		}
+		if stuck != nil {
+			logrus.Error("outbox event " + stuck.Id.Hex() + " failed " + strconv.Itoa(stuck.Attempts+1) + " times, dead-lettered")
+			err = eventEntity.MarkDeadLetter(stuck.Id)
+			if err != nil {
+				logrus.Error(err)
+			}
+			stuck = nil
+		}
+		err = eventEntity.MarkPublished(event.Id)
+		if err != nil {
+			logrus.Error(err)
+			return
+		}
+	}
+}
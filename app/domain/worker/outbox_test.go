@@ -0,0 +1,129 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"um/app/core/config"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+)
+
+type fakeOutbox struct {
+	repository.IEvent
+	events []*model.Event
+}
+
+func (fake *fakeOutbox) find(id primitive.ObjectID) *model.Event {
+	for _, event := range fake.events {
+		if event.Id == id {
+			return event
+		}
+	}
+	return nil
+}
+
+func (fake *fakeOutbox) GetPendingEvents(limit int64) ([]model.Event, error) {
+	var events []model.Event
+	for _, event := range fake.events {
+		if event.PublishedDate == nil && event.DeadLetterDate == nil {
+			events = append(events, *event)
+		}
+	}
+	return events, nil
+}
+
+func (fake *fakeOutbox) MarkPublished(id primitive.ObjectID) error {
+	now := time.Now()
+	fake.find(id).PublishedDate = &now
+	return nil
+}
+
+func (fake *fakeOutbox) MarkFailed(id primitive.ObjectID, reason string) error {
+	event := fake.find(id)
+	event.Attempts++
+	event.LastError = reason
+	return nil
+}
+
+func (fake *fakeOutbox) MarkDeadLetter(id primitive.ObjectID) error {
+	now := time.Now()
+	fake.find(id).DeadLetterDate = &now
+	return nil
+}
+
+// fakePublisher refuses the events in poison, or every event while down
+type fakePublisher struct {
+	down      bool
+	poison    map[primitive.ObjectID]bool
+	published []primitive.ObjectID
+}
+
+func (fake *fakePublisher) Publish(event model.Event) error {
+	if fake.down || fake.poison[event.Id] {
+		return errors.New("publish failed")
+	}
+	fake.published = append(fake.published, event.Id)
+	return nil
+}
+
+type fakeLock struct {
+	repository.ILock
+}
+
+func (fake *fakeLock) Acquire(key string, expiration time.Duration) (string, error) {
+	return "token", nil
+}
+
+func (fake *fakeLock) Release(key string, token string) error {
+	return nil
+}
+
+func newOutbox(count int) *fakeOutbox {
+	fake := &fakeOutbox{}
+	for i := 0; i < count; i++ {
+		fake.events = append(fake.events, &model.Event{Id: primitive.NewObjectID()})
+	}
+	return fake
+}
+
+func TestRelayOutboxDeadLettersPoisonEvent(t *testing.T) {
+	outbox := newOutbox(3)
+	poison := outbox.events[0]
+	publisher := &fakePublisher{poison: map[primitive.ObjectID]bool{poison.Id: true}}
+
+	for i := 1; i < config.OutboxMaxAttempts; i++ {
+		relayOutbox(outbox, publisher, &fakeLock{})
+		if len(publisher.published) != 0 {
+			t.Fatalf("tick %d published %d events past the failing one, want the order kept", i, len(publisher.published))
+		}
+	}
+	relayOutbox(outbox, publisher, &fakeLock{})
+	if poison.DeadLetterDate == nil || poison.Attempts != config.OutboxMaxAttempts || poison.LastError == "" {
+		t.Fatalf("poison event is %+v, want it dead-lettered after %d attempts", poison, config.OutboxMaxAttempts)
+	}
+	if len(publisher.published) != 2 {
+		t.Fatalf("published %d events, want the 2 behind the poison event", len(publisher.published))
+	}
+}
+
+func TestRelayOutboxKeepsEventsWhilePublisherIsDown(t *testing.T) {
+	outbox := newOutbox(3)
+	publisher := &fakePublisher{down: true}
+
+	for i := 0; i < 2*config.OutboxMaxAttempts; i++ {
+		relayOutbox(outbox, publisher, &fakeLock{})
+	}
+	for _, event := range outbox.events {
+		if event.DeadLetterDate != nil {
+			t.Fatalf("event %s was dead-lettered while the publisher was down", event.Id.Hex())
+		}
+	}
+	publisher.down = false
+	relayOutbox(outbox, publisher, &fakeLock{})
+	if len(publisher.published) != 3 || publisher.published[0] != outbox.events[0].Id {
+		t.Fatalf("published %v, want all 3 events in order once the publisher is back", publisher.published)
+	}
+}
@@ -0,0 +1,222 @@
+package worker
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/core/utils"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/middlewares"
+)
+
+// StartScheduler runs every active job whose next run is due. Each run holds a Redis lock on its
+// job, extended while the run lasts, so one instance runs a job at a time however many instances
+// are deployed.
+func StartScheduler(jobEntity repository.IJob, jobRunEntity repository.IJobRun, systemEntity repository.ISystem, lockEntity repository.ILock) {
+	go func() {
+		ticker := time.NewTicker(config.SchedulerInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			scheduleJobs(jobEntity, jobRunEntity, systemEntity, lockEntity)
+		}
+	}()
+}
+
+func scheduleJobs(jobEntity repository.IJob, jobRunEntity repository.IJobRun, systemEntity repository.ISystem, lockEntity repository.ILock) {
+	jobs, err := jobEntity.GetDueJobs(time.Now())
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	for _, job := range jobs {
+		go func(job model.Job) {
+			_, err := RunJob(jobEntity, jobRunEntity, systemEntity, lockEntity, job.Id.Hex(), constant.JobTriggerSchedule)
+			if err != nil {
+				logrus.Error(err)
+			}
+		}(job)
+	}
+}
+
+// RunJob runs a job under its lock and records the run. It returns a nil run without error when
+// the job is locked by another run, or when a scheduled run is no longer due because another
+// instance already ran it.
+func RunJob(
+	jobEntity repository.IJob,
+	jobRunEntity repository.IJobRun,
+	systemEntity repository.ISystem,
+	lockEntity repository.ILock,
+	id string,
+	trigger string,
+) (*model.JobRun, error) {
+	lockKey := "job:" + id
+	token, err := lockEntity.Acquire(lockKey, config.JobLockTime)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, nil
+	}
+	stopKeeping := keepLock(lockEntity, lockKey, token, config.JobLockTime)
+	defer func() {
+		stopKeeping()
+		_ = lockEntity.Release(lockKey, token)
+	}()
+
+	// reload under the lock, the copy the caller saw may already have been run
+	job, err := jobEntity.GetJobById(id)
+	if err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	if trigger == constant.JobTriggerSchedule && (!job.Active || job.NextRunDate.After(started)) {
+		return nil, nil
+	}
+
+	nextRunDate := job.NextRunDate
+	if trigger == constant.JobTriggerSchedule {
+		nextRunDate, err = NextJobRun(job.Cron, job.Timezone, started)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = jobEntity.UpdateNextRunById(job.Id, started, nextRunDate)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := callJobHosts(systemEntity, job)
+	if err != nil {
+		return nil, err
+	}
+	return jobRunEntity.CreateJobRun(model.JobRun{
+		JobId:        job.Id,
+		Trigger:      trigger,
+		Status:       jobRunStatus(results),
+		Results:      results,
+		StartedDate:  started,
+		FinishedDate: time.Now(),
+	})
+}
+
+// keepLock extends a held lock every third of its expiration until the returned func is called, so
+// a run whose retries take longer than the expiration keeps its job to itself
+func keepLock(lockEntity repository.ILock, key string, token string, expiration time.Duration) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(expiration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				held, err := lockEntity.Extend(key, token, expiration)
+				if err != nil {
+					logrus.Error(err)
+				} else if !held {
+					logrus.Warning("lock " + key + " was lost")
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+// NextJobRun returns the first time after now that cron matches in the named timezone, or the
+// zero time when it never matches again
+func NextJobRun(cron string, timezone string, now time.Time) (time.Time, error) {
+	schedule, err := utils.ParseCron(cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	location := time.UTC
+	if timezone != "" {
+		location, err = time.LoadLocation(timezone)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	next := schedule.Next(now.In(location))
+	if next.IsZero() {
+		return next, nil
+	}
+	return next.UTC(), nil
+}
+
+func callJobHosts(systemEntity repository.ISystem, job *model.Job) ([]model.JobHostResult, error) {
+	systems, err := systemEntity.GetSystemsByCode(job.SystemCode)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]model.JobHostResult, len(systems))
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, constant.JobConcurrency)
+	for i, system := range systems {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, system model.System) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = callJobHost(job, system)
+		}(i, system)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// callJobHost calls one host, retrying failures up to job.Retries times with a doubling wait
+func callJobHost(job *model.Job, system model.System) model.JobHostResult {
+	result := model.JobHostResult{
+		SystemId: system.Id,
+		ClientId: system.ClientId,
+		Url:      system.Host + job.Path,
+	}
+	started := time.Now()
+	wait := config.JobRetryBaseTime
+	for attempt := 0; attempt <= job.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		result.Attempts++
+		statusCode, err := middlewares.NotifyMassage(context.Background(), job.Method, result.Url, job.Payload)
+		result.StatusCode = statusCode
+		if err == nil {
+			result.Success = true
+			result.Error = ""
+			break
+		}
+		result.Error = err.Error()
+	}
+	result.Duration = time.Since(started).Milliseconds()
+	return result
+}
+
+func jobRunStatus(results []model.JobHostResult) string {
+	if len(results) == 0 {
+		return constant.JobRunNoTargets
+	}
+	succeeded := 0
+	for _, result := range results {
+		if result.Success {
+			succeeded++
+		}
+	}
+	switch {
+	case succeeded == len(results):
+		return constant.JobRunSuccess
+	case succeeded == 0:
+		return constant.JobRunFailed
+	default:
+		return constant.JobRunPartial
+	}
+}
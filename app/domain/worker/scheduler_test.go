@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"um/app/domain/repository"
+)
+
+// fakeHeldLock counts the extensions of a lock that stays held
+type fakeHeldLock struct {
+	repository.ILock
+	mu       sync.Mutex
+	extended int
+}
+
+func (fake *fakeHeldLock) Extend(key string, token string, expiration time.Duration) (bool, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.extended++
+	return true, nil
+}
+
+func (fake *fakeHeldLock) extensions() int {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return fake.extended
+}
+
+func TestKeepLockOutlivesExpiration(t *testing.T) {
+	lock := &fakeHeldLock{}
+	expiration := 30 * time.Millisecond
+	stop := keepLock(lock, "job:1", "token", expiration)
+
+	// a run taking several expirations, as retries with backoff can
+	time.Sleep(4 * expiration)
+	stop()
+	extended := lock.extensions()
+	if extended < 4 {
+		t.Fatalf("lock was extended %d times during 4 expirations, want it kept all along", extended)
+	}
+
+	time.Sleep(2 * expiration)
+	if lock.extensions() != extended {
+		t.Fatalf("lock was extended %d more times after the run", lock.extensions()-extended)
+	}
+}
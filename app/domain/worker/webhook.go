@@ -0,0 +1,254 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+	"os"
+	"sync"
+	"time"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/middlewares"
+)
+
+var errWebhookInactive = errors.New("webhook is not active")
+
+const webhookDispatchLock = "webhook-dispatch"
+
+const webhookDispatchBatch = 100
+
+const webhookFanoutBatch = 100
+
+// webhookConcurrency bounds the number of receivers called at the same time
+const webhookConcurrency = 10
+
+// StartWebhookFanout reads the event stream as a member of the webhook consumer group until ctx
+// is cancelled, see runWebhookFanout
+func StartWebhookFanout(ctx context.Context, subscriber repository.ISubscriber, webhookEntity repository.IWebhook, deliveryEntity repository.IDelivery) {
+	hostname, _ := os.Hostname()
+	consumer := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	go runWebhookFanout(ctx, subscriber, webhookEntity, deliveryEntity, consumer)
+}
+
+// runWebhookFanout joins the webhook consumer group once, then reads the event stream and queues one
+// delivery per subscribed webhook. A message is acknowledged only after its deliveries are stored,
+// and after an error the consumer rereads its unacknowledged messages first.
+func runWebhookFanout(
+	ctx context.Context,
+	subscriber repository.ISubscriber,
+	webhookEntity repository.IWebhook,
+	deliveryEntity repository.IDelivery,
+	consumer string,
+) {
+	for ctx.Err() == nil {
+		err := subscriber.Subscribe(constant.WebhookConsumerGroup)
+		if err == nil {
+			break
+		}
+		logrus.Error(err)
+		sleepContext(ctx, config.WebhookDispatchInterval)
+	}
+	pending := true
+	for ctx.Err() == nil {
+		var err error
+		pending, err = fanoutWebhooks(subscriber, webhookEntity, deliveryEntity, consumer, pending)
+		if err != nil {
+			logrus.Error(err)
+			pending = true
+			sleepContext(ctx, config.WebhookDispatchInterval)
+		}
+	}
+}
+
+// sleepContext waits for duration or until ctx is cancelled
+func sleepContext(ctx context.Context, duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+func fanoutWebhooks(
+	subscriber repository.ISubscriber,
+	webhookEntity repository.IWebhook,
+	deliveryEntity repository.IDelivery,
+	consumer string,
+	pending bool,
+) (bool, error) {
+	messages, err := subscriber.Read(constant.WebhookConsumerGroup, consumer, webhookFanoutBatch, pending)
+	if err != nil {
+		return pending, err
+	}
+	for _, message := range messages {
+		webhooks, err := webhookEntity.GetSubscribedWebhooks(message.Event.ClientId, message.Event.Type)
+		if err != nil {
+			return pending, err
+		}
+		err = deliveryEntity.CreateDeliveries(message.Event, webhooks)
+		if err != nil {
+			return pending, err
+		}
+		err = subscriber.Ack(constant.WebhookConsumerGroup, message.StreamId)
+		if err != nil {
+			return pending, err
+		}
+	}
+	// keep draining pending messages until none are left, then switch to new ones
+	return pending && len(messages) > 0, nil
+}
+
+// StartWebhookDispatcher sends due deliveries and schedules failed ones with exponential backoff.
+// A delivery that fails constant.WebhookMaxAttempts times is moved to the dead-letter status.
+// Cancelling ctx stops the dispatcher and aborts the calls in flight.
+func StartWebhookDispatcher(
+	ctx context.Context,
+	deliveryEntity repository.IDelivery,
+	webhookEntity repository.IWebhook,
+	systemEntity repository.ISystem,
+	lockEntity repository.ILock,
+) {
+	go func() {
+		ticker := time.NewTicker(config.WebhookDispatchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				dispatchWebhooks(ctx, deliveryEntity, webhookEntity, systemEntity, lockEntity)
+			}
+		}
+	}()
+}
+
+func dispatchWebhooks(
+	ctx context.Context,
+	deliveryEntity repository.IDelivery,
+	webhookEntity repository.IWebhook,
+	systemEntity repository.ISystem,
+	lockEntity repository.ILock,
+) {
+	token, err := lockEntity.Acquire(webhookDispatchLock, config.WebhookDispatchLockTime)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	if token == "" {
+		return
+	}
+	defer func() {
+		_ = lockEntity.Release(webhookDispatchLock, token)
+	}()
+
+	deliveries, err := deliveryEntity.GetDueDeliveries(webhookDispatchBatch)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, webhookConcurrency)
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(delivery model.WebhookDelivery) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			deliverWebhook(ctx, deliveryEntity, webhookEntity, systemEntity, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+func deliverWebhook(
+	ctx context.Context,
+	deliveryEntity repository.IDelivery,
+	webhookEntity repository.IWebhook,
+	systemEntity repository.ISystem,
+	delivery model.WebhookDelivery,
+) {
+	started := time.Now()
+	attempt := model.WebhookAttempt{Date: started}
+
+	endpoint, secret, err := resolveWebhook(webhookEntity, systemEntity, delivery)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) && !errors.Is(err, errWebhookInactive) {
+		// a lookup failure is not the receiver's fault, the delivery stays due for the next run
+		logrus.Error(err)
+		return
+	}
+	if err != nil {
+		// the webhook is gone or disabled, retrying will not help until someone redelivers it
+		attempt.Error = err.Error()
+		err = deliveryEntity.RecordAttempt(delivery.Id, attempt, constant.DeliveryDead, delivery.RetryCount, started)
+		if err != nil {
+			logrus.Error(err)
+		}
+		return
+	}
+
+	attempt.Url = endpoint
+	attempt.StatusCode, err = middlewares.SendWebhook(ctx, middlewares.WebhookMessage{
+		Endpoint:   endpoint,
+		Secret:     secret,
+		EventId:    delivery.EventId,
+		EventType:  delivery.EventType,
+		DeliveryId: delivery.Id.Hex(),
+		Body:       delivery.Payload,
+	})
+	attempt.Duration = time.Since(started).Milliseconds()
+	if ctx.Err() != nil {
+		// cut off by the shutdown, not the receiver's fault, the delivery stays due for the next run
+		return
+	}
+
+	status := constant.DeliverySuccess
+	retryCount := delivery.RetryCount
+	nextAttemptDate := started
+	if err != nil {
+		attempt.Error = err.Error()
+		retryCount++
+		status = constant.DeliveryFailed
+		nextAttemptDate = time.Now().Add(webhookBackoff(retryCount))
+		if retryCount >= constant.WebhookMaxAttempts {
+			status = constant.DeliveryDead
+		}
+	}
+	err = deliveryEntity.RecordAttempt(delivery.Id, attempt, status, retryCount, nextAttemptDate)
+	if err != nil {
+		logrus.Error(err)
+	}
+}
+
+func resolveWebhook(webhookEntity repository.IWebhook, systemEntity repository.ISystem, delivery model.WebhookDelivery) (string, string, error) {
+	webhook, err := webhookEntity.GetWebhookById(delivery.WebhookId.Hex(), delivery.SystemId.Hex())
+	if err != nil {
+		return "", "", fmt.Errorf("webhook: %w", err)
+	}
+	if !webhook.Active {
+		return "", "", errWebhookInactive
+	}
+	system, err := systemEntity.GetSystemById(delivery.SystemId.Hex())
+	if err != nil {
+		return "", "", fmt.Errorf("system: %w", err)
+	}
+	return system.Host + webhook.Path, webhook.Secret, nil
+}
+
+// webhookBackoff doubles the wait after every failed attempt up to config.WebhookRetryMaxTime
+func webhookBackoff(retryCount int) time.Duration {
+	wait := config.WebhookRetryBaseTime
+	for i := 1; i < retryCount; i++ {
+		wait *= 2
+		if wait >= config.WebhookRetryMaxTime {
+			return config.WebhookRetryMaxTime
+		}
+	}
+	return wait
+}
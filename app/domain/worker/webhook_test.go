@@ -0,0 +1,336 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/domain/model"
+	"um/app/domain/repository"
+	"um/middlewares"
+)
+
+// fakeDeliveries returns the deliveries due at now, which the test moves forward
+type fakeDeliveries struct {
+	repository.IDelivery
+	mu         sync.Mutex
+	now        time.Time
+	deliveries []*model.WebhookDelivery
+	failCreate bool
+}
+
+func (fake *fakeDeliveries) CreateDeliveries(event model.Event, webhooks []model.Webhook) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.failCreate {
+		return errors.New("store down")
+	}
+	for _, webhook := range webhooks {
+		fake.deliveries = append(fake.deliveries, &model.WebhookDelivery{
+			Id:        primitive.NewObjectID(),
+			WebhookId: webhook.Id,
+			SystemId:  webhook.SystemId,
+			EventId:   event.Id.Hex(),
+			EventType: event.Type,
+			Status:    constant.DeliveryPending,
+		})
+	}
+	return nil
+}
+
+func (fake *fakeDeliveries) GetDueDeliveries(limit int64) ([]model.WebhookDelivery, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	var deliveries []model.WebhookDelivery
+	for _, delivery := range fake.deliveries {
+		due := delivery.Status == constant.DeliveryPending || delivery.Status == constant.DeliveryFailed
+		if due && !delivery.NextAttemptDate.After(fake.now) {
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (fake *fakeDeliveries) RecordAttempt(id primitive.ObjectID, attempt model.WebhookAttempt, status string, retryCount int, nextAttemptDate time.Time) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for _, delivery := range fake.deliveries {
+		if delivery.Id == id {
+			delivery.Attempts = append(delivery.Attempts, attempt)
+			delivery.Status = status
+			delivery.RetryCount = retryCount
+			delivery.NextAttemptDate = nextAttemptDate
+		}
+	}
+	return nil
+}
+
+type fakeWebhooks struct {
+	repository.IWebhook
+	webhooks []model.Webhook
+}
+
+func (fake *fakeWebhooks) GetWebhookById(id string, systemId string) (*model.Webhook, error) {
+	for _, webhook := range fake.webhooks {
+		if webhook.Id.Hex() == id && webhook.SystemId.Hex() == systemId {
+			return &webhook, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (fake *fakeWebhooks) GetSubscribedWebhooks(clientId string, eventType string) ([]model.Webhook, error) {
+	return fake.webhooks, nil
+}
+
+type fakeWebhookSystems struct {
+	repository.ISystem
+	system model.System
+}
+
+func (fake *fakeWebhookSystems) GetSystemById(id string) (*model.System, error) {
+	if fake.system.Id.Hex() != id {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &fake.system, nil
+}
+
+// fakeSubscriber hands out messages once and cancels the fan-out after reads calls to Read
+type fakeSubscriber struct {
+	mu         sync.Mutex
+	messages   []model.StreamMessage
+	subscribed int
+	reads      int
+	pending    []bool
+	acked      []string
+	cancel     context.CancelFunc
+}
+
+func (fake *fakeSubscriber) Subscribe(group string) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.subscribed++
+	return nil
+}
+
+func (fake *fakeSubscriber) Read(group string, consumer string, count int64, pending bool) ([]model.StreamMessage, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.pending = append(fake.pending, pending)
+	if len(fake.pending) >= fake.reads {
+		fake.cancel()
+	}
+	var messages []model.StreamMessage
+	for _, message := range fake.messages {
+		if !fake.isAcked(message.StreamId) {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+func (fake *fakeSubscriber) isAcked(streamId string) bool {
+	for _, acked := range fake.acked {
+		if acked == streamId {
+			return true
+		}
+	}
+	return false
+}
+
+func (fake *fakeSubscriber) Ack(group string, streamIds ...string) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.acked = append(fake.acked, streamIds...)
+	return nil
+}
+
+// webhookHarness points one webhook at a receiver answering status
+type webhookHarness struct {
+	deliveries *fakeDeliveries
+	webhooks   *fakeWebhooks
+	systems    *fakeWebhookSystems
+	mu         sync.Mutex
+	calls      int
+	status     int
+	signature  string
+	body       []byte
+}
+
+func newWebhookHarness(t *testing.T, status int) *webhookHarness {
+	harness := &webhookHarness{status: status}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		harness.mu.Lock()
+		defer harness.mu.Unlock()
+		harness.calls++
+		harness.signature = r.Header.Get(middlewares.WebhookSignatureHeader)
+		harness.body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(harness.status)
+	}))
+	t.Cleanup(receiver.Close)
+
+	system := model.System{Id: primitive.NewObjectID(), ClientId: "ACM", Host: receiver.URL}
+	webhook := model.Webhook{Id: primitive.NewObjectID(), SystemId: system.Id, Path: "/hooks", Secret: "test-secret", Active: true}
+	harness.webhooks = &fakeWebhooks{webhooks: []model.Webhook{webhook}}
+	harness.systems = &fakeWebhookSystems{system: system}
+	harness.deliveries = &fakeDeliveries{now: time.Now(), deliveries: []*model.WebhookDelivery{{
+		Id:        primitive.NewObjectID(),
+		WebhookId: webhook.Id,
+		SystemId:  system.Id,
+		EventId:   primitive.NewObjectID().Hex(),
+		EventType: "user.created",
+		Payload:   []byte(`{"type":"user.created"}`),
+		Status:    constant.DeliveryPending,
+	}}}
+	return harness
+}
+
+func (harness *webhookHarness) dispatch(ctx context.Context) {
+	dispatchWebhooks(ctx, harness.deliveries, harness.webhooks, harness.systems, &fakeLock{})
+}
+
+func TestDispatchWebhookSigned(t *testing.T) {
+	harness := newWebhookHarness(t, http.StatusNoContent)
+	harness.dispatch(context.Background())
+
+	delivery := harness.deliveries.deliveries[0]
+	if delivery.Status != constant.DeliverySuccess || delivery.RetryCount != 0 || len(delivery.Attempts) != 1 {
+		t.Fatalf("delivery is %s after %d retries and %d attempts, want SUCCESS after one attempt", delivery.Status, delivery.RetryCount, len(delivery.Attempts))
+	}
+	if delivery.Attempts[0].StatusCode != http.StatusNoContent || delivery.Attempts[0].Url != harness.systems.system.Host+"/hooks" {
+		t.Fatalf("attempt is %+v", delivery.Attempts[0])
+	}
+	timestamp, err := strconv.ParseInt(strings.TrimPrefix(strings.Split(harness.signature, ",")[0], "t="), 10, 64)
+	if err != nil || harness.signature != middlewares.SignWebhook("test-secret", timestamp, harness.body) {
+		t.Fatalf("receiver got signature %q for %s", harness.signature, harness.body)
+	}
+}
+
+func TestDispatchWebhookRetriesThenDeadLetters(t *testing.T) {
+	harness := newWebhookHarness(t, http.StatusInternalServerError)
+	delivery := harness.deliveries.deliveries[0]
+
+	for attempt := 1; attempt <= constant.WebhookMaxAttempts; attempt++ {
+		before := time.Now()
+		harness.dispatch(context.Background())
+		if harness.calls != attempt || delivery.RetryCount != attempt {
+			t.Fatalf("attempt %d: receiver called %d times, retry count %d", attempt, harness.calls, delivery.RetryCount)
+		}
+		want := constant.DeliveryFailed
+		if attempt == constant.WebhookMaxAttempts {
+			want = constant.DeliveryDead
+		}
+		if delivery.Status != want {
+			t.Fatalf("attempt %d: delivery is %s, want %s", attempt, delivery.Status, want)
+		}
+		if delivery.Attempts[attempt-1].StatusCode != http.StatusInternalServerError || delivery.Attempts[attempt-1].Error == "" {
+			t.Fatalf("attempt %d recorded %+v", attempt, delivery.Attempts[attempt-1])
+		}
+		wait := delivery.NextAttemptDate.Sub(before)
+		if wait < webhookBackoff(attempt) || wait > webhookBackoff(attempt)+time.Minute {
+			t.Fatalf("attempt %d: next attempt in %s, want %s", attempt, wait, webhookBackoff(attempt))
+		}
+
+		// not due again before the backoff elapsed
+		harness.dispatch(context.Background())
+		if harness.calls != attempt {
+			t.Fatalf("attempt %d: delivery was retried before its backoff elapsed", attempt)
+		}
+		harness.deliveries.now = delivery.NextAttemptDate
+	}
+
+	harness.dispatch(context.Background())
+	if harness.calls != constant.WebhookMaxAttempts {
+		t.Fatalf("dead-lettered delivery was sent again, %d calls", harness.calls)
+	}
+}
+
+func TestDispatchWebhookInactive(t *testing.T) {
+	harness := newWebhookHarness(t, http.StatusOK)
+	harness.webhooks.webhooks[0].Active = false
+	harness.dispatch(context.Background())
+
+	delivery := harness.deliveries.deliveries[0]
+	if harness.calls != 0 || delivery.Status != constant.DeliveryDead || delivery.Attempts[0].Error != errWebhookInactive.Error() {
+		t.Fatalf("delivery to an inactive webhook is %s after %d calls, want DEAD without a call", delivery.Status, harness.calls)
+	}
+}
+
+func TestDispatchWebhookCancelled(t *testing.T) {
+	harness := newWebhookHarness(t, http.StatusOK)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	harness.dispatch(ctx)
+
+	delivery := harness.deliveries.deliveries[0]
+	if harness.calls != 0 || delivery.Status != constant.DeliveryPending || len(delivery.Attempts) != 0 {
+		t.Fatalf("cancelled dispatch left the delivery %s with %d attempts, want it PENDING and untouched", delivery.Status, len(delivery.Attempts))
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	for _, test := range []struct {
+		retryCount int
+		wait       time.Duration
+	}{
+		{1, config.WebhookRetryBaseTime},
+		{2, 2 * config.WebhookRetryBaseTime},
+		{3, 4 * config.WebhookRetryBaseTime},
+		{constant.WebhookMaxAttempts, 128 * config.WebhookRetryBaseTime},
+		{30, config.WebhookRetryMaxTime},
+	} {
+		if wait := webhookBackoff(test.retryCount); wait != test.wait {
+			t.Errorf("retry %d: waits %s, want %s", test.retryCount, wait, test.wait)
+		}
+	}
+}
+
+func TestRunWebhookFanoutSubscribesOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	event := model.Event{Id: primitive.NewObjectID(), ClientId: "ACM", Type: "user.created"}
+	subscriber := &fakeSubscriber{messages: []model.StreamMessage{{StreamId: "1-0", Event: event}}, reads: 5, cancel: cancel}
+	webhooks := &fakeWebhooks{webhooks: []model.Webhook{{Id: primitive.NewObjectID(), SystemId: primitive.NewObjectID()}}}
+	deliveries := &fakeDeliveries{}
+
+	runWebhookFanout(ctx, subscriber, webhooks, deliveries, "test-consumer")
+
+	if subscriber.subscribed != 1 {
+		t.Fatalf("joined the consumer group %d times over %d reads, want once", subscriber.subscribed, len(subscriber.pending))
+	}
+	if len(deliveries.deliveries) != 1 || len(subscriber.acked) != 1 {
+		t.Fatalf("queued %d deliveries and acknowledged %v, want the message queued and acknowledged once", len(deliveries.deliveries), subscriber.acked)
+	}
+	if !subscriber.pending[0] || subscriber.pending[len(subscriber.pending)-1] {
+		t.Fatalf("read pending %v, want the unacknowledged messages first and new ones after", subscriber.pending)
+	}
+}
+
+func TestFanoutWebhooksKeepsMessageUntilStored(t *testing.T) {
+	event := model.Event{Id: primitive.NewObjectID(), ClientId: "ACM", Type: "user.created"}
+	subscriber := &fakeSubscriber{messages: []model.StreamMessage{{StreamId: "1-0", Event: event}}, reads: 10, cancel: func() {}}
+	webhooks := &fakeWebhooks{webhooks: []model.Webhook{{Id: primitive.NewObjectID(), SystemId: primitive.NewObjectID()}}}
+	deliveries := &fakeDeliveries{failCreate: true}
+
+	_, err := fanoutWebhooks(subscriber, webhooks, deliveries, "test-consumer", false)
+	if err == nil || len(subscriber.acked) != 0 {
+		t.Fatalf("failed store answered %v and acknowledged %v, want an error and the message kept", err, subscriber.acked)
+	}
+
+	deliveries.failCreate = false
+	pending, err := fanoutWebhooks(subscriber, webhooks, deliveries, "test-consumer", true)
+	if err != nil || !pending || len(subscriber.acked) != 1 || len(deliveries.deliveries) != 1 {
+		t.Fatalf("reread answered %v and acknowledged %v, want the message stored and acknowledged", err, subscriber.acked)
+	}
+}
@@ -11,7 +11,13 @@ import (
 func ApplyAdminUserAPI(
 	app *gin.RouterGroup,
 	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
+	systemEntity repository.ISystem,
 	sessionEntity repository.ISession,
+	groupEntity repository.IGroup,
+	authzEntity repository.IAuthz,
+	clientSettingEntity repository.IClientSetting,
+	auditEntity repository.IAudit,
 ) {
 
 	route := app.Group("admin/user")
@@ -19,49 +25,77 @@ func ApplyAdminUserAPI(
 	route.GET("",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.ADMIN),
-		usecase.RequireSession(sessionEntity),
-		usecase.GetUsersByClientId(userEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetUsersByClientId(userEntity, attributeEntity),
+	)
+
+	route.GET("/expiring",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetExpiringUsers(userEntity),
+	)
+
+	route.GET("/dormant",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetDormantUsers(userEntity, clientSettingEntity),
 	)
 
 	route.POST("",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.ADMIN),
-		usecase.RequireSession(sessionEntity),
-		usecase.AddUser(userEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.AddUser(userEntity, attributeEntity, auditEntity),
 	)
 
 	route.GET("/:id",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.ADMIN),
-		usecase.RequireSession(sessionEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
 		usecase.GetUserById(userEntity),
 	)
 
 	route.DELETE("/:id",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.ADMIN),
-		usecase.RequireSession(sessionEntity),
-		usecase.DeleteUserById(userEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.DeleteUserById(userEntity, groupEntity, authzEntity, auditEntity),
 	)
 
 	route.PUT("/:id",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.ADMIN),
-		usecase.RequireSession(sessionEntity),
-		usecase.UpdateUserById(userEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateUserById(userEntity, attributeEntity, auditEntity),
 	)
 
 	route.PATCH("/:id/status",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.ADMIN),
-		usecase.RequireSession(sessionEntity),
-		usecase.UpdateStatusById(userEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateStatusById(userEntity, authzEntity, auditEntity),
+	)
+
+	route.PATCH("/:id/validity",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateValidityById(userEntity, sessionEntity, authzEntity, auditEntity),
 	)
 
 	route.PATCH("/:id/role",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.ADMIN),
-		usecase.RequireSession(sessionEntity),
-		usecase.UpdateRoleById(userEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateRoleById(userEntity, authzEntity, auditEntity),
+	)
+
+	route.GET("/:id/permissions",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetUserPermissions(userEntity, systemEntity, groupEntity),
 	)
 }
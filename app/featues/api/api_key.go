@@ -0,0 +1,56 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyApiKeyAPI(
+	app *gin.RouterGroup,
+	apiKeyEntity repository.IApiKey,
+	userEntity repository.IUser,
+	sessionEntity repository.ISession,
+	auditEntity repository.IAudit,
+) {
+
+	route := app.Group("/user/api-keys")
+
+	route.GET("",
+		middlewares.RequireAuthenticated(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetApiKeys(apiKeyEntity),
+	)
+
+	route.POST("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RejectImpersonation(),
+		middlewares.RejectApiKey(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.AddApiKey(apiKeyEntity, auditEntity),
+	)
+
+	route.DELETE("/:id",
+		middlewares.RequireAuthenticated(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.RevokeApiKey(apiKeyEntity, auditEntity),
+	)
+
+	adminRoute := app.Group("admin/user/:id/api-keys")
+
+	adminRoute.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetUserApiKeys(apiKeyEntity, userEntity),
+	)
+
+	adminRoute.DELETE("/:keyId",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.RevokeUserApiKey(apiKeyEntity, userEntity, auditEntity),
+	)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyAttributeAPI(
+	app *gin.RouterGroup,
+	attributeEntity repository.IAttribute,
+	userEntity repository.IUser,
+	sessionEntity repository.ISession,
+	auditEntity repository.IAudit,
+) {
+
+	route := app.Group("admin/attribute")
+
+	route.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetAttributeSchemas(attributeEntity),
+	)
+
+	route.POST("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.AddAttributeSchema(attributeEntity, auditEntity),
+	)
+
+	route.PUT("/:id",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateAttributeSchemaById(attributeEntity, userEntity, auditEntity),
+	)
+
+	route.DELETE("/:id",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.DeleteAttributeSchemaById(attributeEntity, userEntity, auditEntity),
+	)
+}
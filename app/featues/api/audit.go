@@ -0,0 +1,42 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyAuditAPI(
+	app *gin.RouterGroup,
+	auditEntity repository.IAudit,
+	userEntity repository.IUser,
+	sessionEntity repository.ISession,
+) {
+
+	superRoute := app.Group("super/audit")
+
+	superRoute.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetAuditEvents(auditEntity),
+	)
+
+	superRoute.GET("/verify",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.VerifyAuditChain(auditEntity),
+	)
+
+	adminRoute := app.Group("admin/audit")
+
+	adminRoute.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetClientAuditEvents(auditEntity),
+	)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"um/app/domain/repository"
 	"um/app/domain/usecase"
 	"um/middlewares"
@@ -10,37 +11,45 @@ import (
 func ApplyAuthAPI(
 	app *gin.RouterGroup,
 	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
 	sessionEntity repository.ISession,
 	systemEntity repository.ISystem,
+	authenticators usecase.AuthenticatorChain,
+	clientSettingEntity repository.IClientSetting,
+	loginHistoryEntity repository.ILoginHistory,
+	eventEntity repository.IEvent,
+	relyingParty *webauthn.WebAuthn,
+	webauthnEntity repository.IWebauthn,
 ) {
 
 	route := app.Group("auth")
 
 	route.POST("/login",
-		usecase.Login(userEntity, sessionEntity),
+		usecase.Login(userEntity, attributeEntity, sessionEntity, authenticators, clientSettingEntity, loginHistoryEntity, eventEntity, relyingParty, webauthnEntity),
 	)
 
 	route.GET("/keep-alive",
 		middlewares.RequireAuthenticated(),
-		usecase.RequireSession(sessionEntity),
-		usecase.KeepAlive(userEntity, sessionEntity),
+		middlewares.RejectImpersonation(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.KeepAlive(userEntity, attributeEntity, sessionEntity, loginHistoryEntity),
 	)
 
 	route.GET("/system",
 		middlewares.RequireAuthenticated(),
-		usecase.RequireSession(sessionEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
 		usecase.GetSystem(systemEntity),
 	)
 
 	route.POST("/verify-password",
 		middlewares.RequireAuthenticated(),
-		usecase.RequireSession(sessionEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
 		usecase.VerifyPassword(userEntity),
 	)
 
 	route.POST("/logout",
 		middlewares.RequireAuthenticated(),
-		usecase.RequireSession(sessionEntity),
-		usecase.Logout(sessionEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.Logout(sessionEntity, loginHistoryEntity, eventEntity),
 	)
 }
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyAuthzAPI(
+	app *gin.RouterGroup,
+	userEntity repository.IUser,
+	sessionEntity repository.ISession,
+	systemEntity repository.ISystem,
+	groupEntity repository.IGroup,
+	authzEntity repository.IAuthz,
+) {
+
+	route := app.Group("authz")
+
+	route.POST("/check",
+		middlewares.RequireAuthenticated(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.CheckAuthorization(userEntity, sessionEntity, systemEntity, groupEntity, authzEntity),
+	)
+
+	route.POST("/check/batch",
+		middlewares.RequireAuthenticated(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.CheckAuthorizationBatch(userEntity, sessionEntity, systemEntity, groupEntity, authzEntity),
+	)
+
+	route.POST("/system/check",
+		middlewares.RequireSystemAuth(constant.ScopeAuthzCheck),
+		usecase.RequireSystem(systemEntity),
+		usecase.CheckAuthorization(userEntity, sessionEntity, systemEntity, groupEntity, authzEntity),
+	)
+
+	route.POST("/system/check/batch",
+		middlewares.RequireSystemAuth(constant.ScopeAuthzCheck),
+		usecase.RequireSystem(systemEntity),
+		usecase.CheckAuthorizationBatch(userEntity, sessionEntity, systemEntity, groupEntity, authzEntity),
+	)
+
+	route.GET("/system/user/:id",
+		middlewares.RequireSystemAuth(constant.ScopeUserRead),
+		usecase.RequireSystem(systemEntity),
+		usecase.GetSystemUser(userEntity, groupEntity),
+	)
+}
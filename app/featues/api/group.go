@@ -0,0 +1,71 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyGroupAPI(
+	app *gin.RouterGroup,
+	groupEntity repository.IGroup,
+	userEntity repository.IUser,
+	systemEntity repository.ISystem,
+	sessionEntity repository.ISession,
+	authzEntity repository.IAuthz,
+	auditEntity repository.IAudit,
+) {
+
+	route := app.Group("admin/group")
+
+	route.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetGroups(groupEntity),
+	)
+
+	route.POST("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.AddGroup(groupEntity, systemEntity, auditEntity),
+	)
+
+	route.GET("/:id",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetGroupById(groupEntity),
+	)
+
+	route.PUT("/:id",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateGroupById(groupEntity, systemEntity, authzEntity, auditEntity),
+	)
+
+	route.DELETE("/:id",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.DeleteGroupById(groupEntity, authzEntity, auditEntity),
+	)
+
+	route.POST("/:id/members",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.AddGroupMembers(groupEntity, userEntity, authzEntity, auditEntity),
+	)
+
+	route.DELETE("/:id/members/:userId",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.RemoveGroupMember(groupEntity, authzEntity, auditEntity),
+	)
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyLoginHistoryAPI(
+	app *gin.RouterGroup,
+	loginHistoryEntity repository.ILoginHistory,
+	userEntity repository.IUser,
+	sessionEntity repository.ISession,
+) {
+
+	app.GET("/user/login-history",
+		middlewares.RequireAuthenticated(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetUserLoginHistory(loginHistoryEntity),
+	)
+
+	app.GET("/admin/login-history",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetClientLoginHistory(loginHistoryEntity),
+	)
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyIdpAPI(
+	app *gin.RouterGroup,
+	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
+	sessionEntity repository.ISession,
+	idpEntity repository.IIdentityProvider,
+	idpStateEntity repository.IIdpState,
+	clientSettingEntity repository.IClientSetting,
+	loginHistoryEntity repository.ILoginHistory,
+	eventEntity repository.IEvent,
+	auditEntity repository.IAudit,
+	relyingParty *webauthn.WebAuthn,
+	webauthnEntity repository.IWebauthn,
+) {
+
+	login := app.Group("auth/idp")
+
+	login.GET("",
+		usecase.GetLoginProviders(idpEntity),
+	)
+
+	login.GET("/:id/login",
+		usecase.IdpLogin(idpEntity, idpStateEntity),
+	)
+
+	login.GET("/:id/callback",
+		usecase.IdpCallback(userEntity, attributeEntity, sessionEntity, idpEntity, idpStateEntity, loginHistoryEntity, eventEntity, auditEntity, relyingParty, webauthnEntity),
+	)
+
+	route := app.Group("admin/idp")
+
+	route.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetIdentityProviders(idpEntity),
+	)
+
+	route.POST("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.AddIdentityProvider(idpEntity, auditEntity),
+	)
+
+	route.GET("/:id",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetIdentityProviderById(idpEntity),
+	)
+
+	route.PUT("/:id",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateIdentityProviderById(idpEntity, auditEntity),
+	)
+
+	route.DELETE("/:id",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.DeleteIdentityProviderById(idpEntity, auditEntity),
+	)
+
+	setting := app.Group("admin/client/settings")
+
+	setting.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetClientSetting(clientSettingEntity),
+	)
+
+	setting.PUT("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateClientSetting(clientSettingEntity, idpEntity, auditEntity),
+	)
+}
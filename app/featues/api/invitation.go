@@ -0,0 +1,56 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyInvitationAPI(
+	app *gin.RouterGroup,
+	invitationEntity repository.IInvitation,
+	userEntity repository.IUser,
+	systemEntity repository.ISystem,
+	sessionEntity repository.ISession,
+	groupEntity repository.IGroup,
+	authzEntity repository.IAuthz,
+	notifier usecase.Notifier,
+	auditEntity repository.IAudit,
+) {
+
+	app.POST("auth/accept-invite",
+		usecase.AcceptInvite(invitationEntity, userEntity, auditEntity),
+	)
+
+	route := app.Group("admin/user/invite")
+
+	route.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetInvitations(invitationEntity),
+	)
+
+	route.POST("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.InviteUser(invitationEntity, userEntity, systemEntity, notifier, auditEntity),
+	)
+
+	route.POST("/:id/resend",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.ResendInvitation(invitationEntity, notifier, auditEntity),
+	)
+
+	route.DELETE("/:id",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.RevokeInvitation(invitationEntity, userEntity, groupEntity, authzEntity, auditEntity),
+	)
+}
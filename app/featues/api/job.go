@@ -0,0 +1,73 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyJobAPI(
+	app *gin.RouterGroup,
+	jobEntity repository.IJob,
+	jobRunEntity repository.IJobRun,
+	systemEntity repository.ISystem,
+	userEntity repository.IUser,
+	sessionEntity repository.ISession,
+	lockEntity repository.ILock,
+	auditEntity repository.IAudit,
+) {
+
+	route := app.Group("job")
+
+	route.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetJobs(jobEntity),
+	)
+
+	route.POST("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.AddJob(jobEntity, auditEntity),
+	)
+
+	route.GET("/:id",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetJobById(jobEntity),
+	)
+
+	route.PUT("/:id",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateJobById(jobEntity, auditEntity),
+	)
+
+	route.DELETE("/:id",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.DeleteJobById(jobEntity, jobRunEntity, auditEntity),
+	)
+
+	route.POST("/:id/run",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.RunJobNow(jobEntity, jobRunEntity, systemEntity, lockEntity, auditEntity),
+	)
+
+	route.GET("/:id/runs",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetJobRuns(jobRunEntity),
+	)
+
+}
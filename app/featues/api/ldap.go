@@ -0,0 +1,41 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyLdapAPI(
+	app *gin.RouterGroup,
+	ldapConfigEntity repository.ILdapConfig,
+	userEntity repository.IUser,
+	sessionEntity repository.ISession,
+	auditEntity repository.IAudit,
+) {
+
+	route := app.Group("admin/ldap")
+
+	route.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetLdapConfig(ldapConfigEntity),
+	)
+
+	route.PUT("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateLdapConfig(ldapConfigEntity, auditEntity),
+	)
+
+	route.DELETE("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.DeleteLdapConfig(ldapConfigEntity, auditEntity),
+	)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyOAuthAPI(
+	app *gin.RouterGroup,
+	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
+	sessionEntity repository.ISession,
+	systemEntity repository.ISystem,
+	authCodeEntity repository.IAuthCode,
+	authenticators usecase.AuthenticatorChain,
+	clientSettingEntity repository.IClientSetting,
+	loginHistoryEntity repository.ILoginHistory,
+	eventEntity repository.IEvent,
+) {
+
+	app.GET("/.well-known/openid-configuration",
+		usecase.OpenIdConfiguration(),
+	)
+
+	route := app.Group("oauth")
+
+	route.GET("/authorize",
+		usecase.AuthorizePage(systemEntity),
+	)
+
+	route.POST("/authorize",
+		usecase.AuthorizeLogin(userEntity, systemEntity, authCodeEntity, authenticators, clientSettingEntity, loginHistoryEntity),
+	)
+
+	route.POST("/token",
+		usecase.IssueToken(userEntity, attributeEntity, sessionEntity, systemEntity, authCodeEntity, loginHistoryEntity, eventEntity),
+	)
+
+	route.GET("/userinfo",
+		middlewares.RequireAuthenticated(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UserInfo(userEntity, attributeEntity),
+	)
+
+	route.POST("/userinfo",
+		middlewares.RequireAuthenticated(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UserInfo(userEntity, attributeEntity),
+	)
+
+	route.GET("/jwks",
+		usecase.GetJwks(),
+	)
+
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+)
+
+func ApplyPasswordlessAPI(
+	app *gin.RouterGroup,
+	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
+	sessionEntity repository.ISession,
+	systemEntity repository.ISystem,
+	clientSettingEntity repository.IClientSetting,
+	passwordlessEntity repository.IPasswordless,
+	loginHistoryEntity repository.ILoginHistory,
+	eventEntity repository.IEvent,
+	notifier usecase.Notifier,
+	relyingParty *webauthn.WebAuthn,
+	webauthnEntity repository.IWebauthn,
+) {
+
+	route := app.Group("auth/passwordless")
+
+	route.POST("/start",
+		usecase.PasswordlessStart(userEntity, systemEntity, clientSettingEntity, passwordlessEntity, notifier),
+	)
+
+	route.POST("/verify",
+		usecase.PasswordlessVerify(userEntity, attributeEntity, sessionEntity, clientSettingEntity, passwordlessEntity, loginHistoryEntity, eventEntity, relyingParty, webauthnEntity),
+	)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyPreferenceAPI(
+	app *gin.RouterGroup,
+	preferenceEntity repository.IPreference,
+	preferenceSchemaEntity repository.IPreferenceSchema,
+	userEntity repository.IUser,
+	sessionEntity repository.ISession,
+	auditEntity repository.IAudit,
+) {
+
+	route := app.Group("user/preferences")
+
+	route.GET("",
+		middlewares.RequireAuthenticated(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetPreferences(preferenceEntity),
+	)
+
+	route.GET("/:namespace",
+		middlewares.RequireAuthenticated(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetPreference(preferenceEntity),
+	)
+
+	route.PUT("/:namespace",
+		middlewares.RequireAuthenticated(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.SavePreference(preferenceEntity, preferenceSchemaEntity),
+	)
+
+	route.DELETE("/:namespace",
+		middlewares.RequireAuthenticated(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.DeletePreference(preferenceEntity),
+	)
+
+	schemaRoute := app.Group("admin/preference/schema")
+
+	schemaRoute.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetPreferenceSchemas(preferenceSchemaEntity),
+	)
+
+	schemaRoute.PUT("/:namespace",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.SavePreferenceSchema(preferenceSchemaEntity, auditEntity),
+	)
+
+	schemaRoute.DELETE("/:namespace",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.DeletePreferenceSchema(preferenceSchemaEntity, auditEntity),
+	)
+}
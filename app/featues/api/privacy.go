@@ -0,0 +1,58 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyPrivacyAPI(
+	app *gin.RouterGroup,
+	userEntity repository.IUser,
+	historyEntity repository.ILoginHistory,
+	auditEntity repository.IAudit,
+	sessionEntity repository.ISession,
+	preferenceEntity repository.IPreference,
+	groupEntity repository.IGroup,
+	authzEntity repository.IAuthz,
+	apiKeyEntity repository.IApiKey,
+	invitationEntity repository.IInvitation,
+	impersonationEntity repository.IImpersonation,
+	deliveryEntity repository.IDelivery,
+	blobStore repository.IBlobStore,
+) {
+
+	adminRoute := app.Group("admin/user")
+
+	adminRoute.GET("/:id/export",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.ExportUserById(userEntity, historyEntity, auditEntity, sessionEntity, preferenceEntity, groupEntity, apiKeyEntity, invitationEntity, impersonationEntity, blobStore),
+	)
+
+	adminRoute.POST("/:id/erase",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.EraseUserById(userEntity, historyEntity, auditEntity, sessionEntity, preferenceEntity, groupEntity, authzEntity, apiKeyEntity, invitationEntity, impersonationEntity, deliveryEntity, blobStore),
+	)
+
+	superRoute := app.Group("super/user")
+
+	superRoute.GET("/:id/export",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.ExportUserById(userEntity, historyEntity, auditEntity, sessionEntity, preferenceEntity, groupEntity, apiKeyEntity, invitationEntity, impersonationEntity, blobStore),
+	)
+
+	superRoute.POST("/:id/erase",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.EraseUserById(userEntity, historyEntity, auditEntity, sessionEntity, preferenceEntity, groupEntity, authzEntity, apiKeyEntity, invitationEntity, impersonationEntity, deliveryEntity, blobStore),
+	)
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/core/config"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyRegistrationAPI(
+	app *gin.RouterGroup,
+	userEntity repository.IUser,
+	sessionEntity repository.ISession,
+	clientSettingEntity repository.IClientSetting,
+	groupEntity repository.IGroup,
+	authzEntity repository.IAuthz,
+	rateLimitEntity repository.IRateLimit,
+	notifier usecase.Notifier,
+	auditEntity repository.IAudit,
+) {
+
+	app.POST("auth/register",
+		usecase.RateLimit(rateLimitEntity, "register", constant.RegistrationRateLimit, config.RegistrationRateTime),
+		usecase.Register(userEntity, clientSettingEntity, auditEntity),
+	)
+
+	route := app.Group("admin/user/pending")
+
+	route.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetPendingRegistrations(userEntity),
+	)
+
+	route.POST("/:id/approve",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.ApproveRegistration(userEntity, notifier, auditEntity),
+	)
+
+	route.POST("/:id/reject",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.RejectRegistration(userEntity, groupEntity, authzEntity, notifier, auditEntity),
+	)
+}
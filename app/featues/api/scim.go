@@ -0,0 +1,114 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyScimAPI(
+	app *gin.RouterGroup,
+	scimTokenEntity repository.IScimToken,
+	userEntity repository.IUser,
+	groupEntity repository.IGroup,
+	sessionEntity repository.ISession,
+	authzEntity repository.IAuthz,
+	auditEntity repository.IAudit,
+) {
+
+	tokenRoute := app.Group("admin/scim/tokens")
+
+	tokenRoute.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetScimTokens(scimTokenEntity),
+	)
+
+	tokenRoute.POST("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		middlewares.RejectApiKey(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.AddScimToken(scimTokenEntity, auditEntity),
+	)
+
+	tokenRoute.DELETE("/:id",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.DeleteScimToken(scimTokenEntity, auditEntity),
+	)
+
+	route := app.Group("scim/v2")
+
+	route.GET("/ServiceProviderConfig", usecase.GetScimServiceProviderConfig())
+	route.GET("/ResourceTypes", usecase.GetScimResourceTypes())
+
+	route.GET("/Users",
+		usecase.RequireScimToken(scimTokenEntity),
+		usecase.GetScimUsers(userEntity, groupEntity),
+	)
+
+	route.POST("/Users",
+		usecase.RequireScimToken(scimTokenEntity),
+		usecase.AddScimUser(userEntity, groupEntity, authzEntity, auditEntity),
+	)
+
+	route.GET("/Users/:id",
+		usecase.RequireScimToken(scimTokenEntity),
+		usecase.GetScimUser(userEntity, groupEntity),
+	)
+
+	route.PUT("/Users/:id",
+		usecase.RequireScimToken(scimTokenEntity),
+		usecase.ReplaceScimUser(userEntity, groupEntity, authzEntity, auditEntity),
+	)
+
+	route.PATCH("/Users/:id",
+		usecase.RequireScimToken(scimTokenEntity),
+		usecase.PatchScimUser(userEntity, groupEntity, authzEntity, auditEntity),
+	)
+
+	route.DELETE("/Users/:id",
+		usecase.RequireScimToken(scimTokenEntity),
+		usecase.DeleteScimUser(userEntity, groupEntity, authzEntity, auditEntity),
+	)
+
+	route.GET("/Groups",
+		usecase.RequireScimToken(scimTokenEntity),
+		usecase.GetScimGroups(groupEntity),
+	)
+
+	route.POST("/Groups",
+		usecase.RequireScimToken(scimTokenEntity),
+		usecase.AddScimGroup(userEntity, groupEntity, authzEntity, auditEntity),
+	)
+
+	route.GET("/Groups/:id",
+		usecase.RequireScimToken(scimTokenEntity),
+		usecase.GetScimGroup(groupEntity),
+	)
+
+	route.PUT("/Groups/:id",
+		usecase.RequireScimToken(scimTokenEntity),
+		usecase.ReplaceScimGroup(userEntity, groupEntity, authzEntity, auditEntity),
+	)
+
+	route.PATCH("/Groups/:id",
+		usecase.RequireScimToken(scimTokenEntity),
+		usecase.PatchScimGroup(userEntity, groupEntity, authzEntity, auditEntity),
+	)
+
+	route.DELETE("/Groups/:id",
+		usecase.RequireScimToken(scimTokenEntity),
+		usecase.DeleteScimGroup(groupEntity, authzEntity, auditEntity),
+	)
+
+	route.POST("/Bulk",
+		usecase.RequireScimToken(scimTokenEntity),
+		usecase.ScimBulk(userEntity, groupEntity, authzEntity, auditEntity),
+	)
+}
@@ -11,7 +11,13 @@ import (
 func ApplySuperUserAPI(
 	app *gin.RouterGroup,
 	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
 	sessionEntity repository.ISession,
+	groupEntity repository.IGroup,
+	authzEntity repository.IAuthz,
+	impersonationEntity repository.IImpersonation,
+	auditEntity repository.IAudit,
+	eventEntity repository.IEvent,
 ) {
 
 	route := app.Group("super/user")
@@ -19,49 +25,64 @@ func ApplySuperUserAPI(
 	route.GET("",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.SUPER),
-		usecase.RequireSession(sessionEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
 		usecase.GetUsers(userEntity),
 	)
 
 	route.POST("",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.SUPER),
-		usecase.RequireSession(sessionEntity),
-		usecase.AddAdmin(userEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.AddAdmin(userEntity, auditEntity),
 	)
 
 	route.GET("/:id",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.SUPER),
-		usecase.RequireSession(sessionEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
 		usecase.GetUserById(userEntity),
 	)
 
 	route.DELETE("/:id",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.SUPER),
-		usecase.RequireSession(sessionEntity),
-		usecase.DeleteUserById(userEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.DeleteUserById(userEntity, groupEntity, authzEntity, auditEntity),
 	)
 
 	route.PUT("/:id",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.SUPER),
-		usecase.RequireSession(sessionEntity),
-		usecase.UpdateUserById(userEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateUserById(userEntity, attributeEntity, auditEntity),
 	)
 
 	route.PATCH("/:id/status",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.SUPER),
-		usecase.RequireSession(sessionEntity),
-		usecase.UpdateStatusById(userEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateStatusById(userEntity, authzEntity, auditEntity),
 	)
 
 	route.PATCH("/:id/role",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.SUPER),
-		usecase.RequireSession(sessionEntity),
-		usecase.UpdateRoleById(userEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateRoleById(userEntity, authzEntity, auditEntity),
+	)
+
+	route.POST("/:id/impersonate",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		middlewares.RejectApiKey(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.Impersonate(userEntity, attributeEntity, sessionEntity, impersonationEntity, auditEntity, eventEntity),
+	)
+
+	route.GET("/:id/impersonations",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetImpersonationLogs(impersonationEntity),
 	)
 }
@@ -11,7 +11,12 @@ import (
 func ApplySystemAPI(
 	app *gin.RouterGroup,
 	systemEntity repository.ISystem,
+	webhookEntity repository.IWebhook,
+	deliveryEntity repository.IDelivery,
+	userEntity repository.IUser,
 	sessionEntity repository.ISession,
+	authzEntity repository.IAuthz,
+	auditEntity repository.IAudit,
 ) {
 
 	route := app.Group("system")
@@ -19,40 +24,58 @@ func ApplySystemAPI(
 	route.GET("",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.SUPER),
-		usecase.RequireSession(sessionEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
 		usecase.GetSystems(systemEntity),
 	)
 
-	route.GET("/pos/products/lots/expire-notify",
-		usecase.NotifyPosProductLotsExpire(systemEntity),
-	)
-
 	route.POST("",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.SUPER),
-		usecase.RequireSession(sessionEntity),
-		usecase.AddSystem(systemEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.AddSystem(systemEntity, authzEntity, auditEntity),
 	)
 
 	route.GET("/:id",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.SUPER),
-		usecase.RequireSession(sessionEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
 		usecase.GetSystemById(systemEntity),
 	)
 
 	route.DELETE("/:id",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.SUPER),
-		usecase.RequireSession(sessionEntity),
-		usecase.DeleteSystemById(systemEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.DeleteSystemById(systemEntity, webhookEntity, deliveryEntity, authzEntity, auditEntity),
 	)
 
 	route.PUT("/:id",
 		middlewares.RequireAuthenticated(),
 		middlewares.RequireAuthorization(constant.SUPER),
-		usecase.RequireSession(sessionEntity),
-		usecase.UpdateSystemById(systemEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateSystemById(systemEntity, authzEntity, auditEntity),
+	)
+
+	route.POST("/:id/credentials",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		middlewares.RejectApiKey(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.RotateSystemCredentials(systemEntity, auditEntity),
+	)
+
+	route.PUT("/:id/scopes",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateSystemScopes(systemEntity, auditEntity),
+	)
+
+	route.PUT("/:id/redirect-uris",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateSystemRedirectUris(systemEntity, auditEntity),
 	)
 
 }
@@ -10,32 +10,79 @@ import (
 func ApplyUserAPI(
 	app *gin.RouterGroup,
 	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
 	sessionEntity repository.ISession,
+	systemEntity repository.ISystem,
+	verificationEntity repository.IVerification,
+	notifier usecase.Notifier,
+	blobStore repository.IBlobStore,
+	auditEntity repository.IAudit,
 ) {
 
 	route := app.Group("/user")
 
 	route.GET("/info",
 		middlewares.RequireAuthenticated(),
-		usecase.RequireSession(sessionEntity),
+		usecase.RequireSession(sessionEntity, userEntity),
 		usecase.GetUserInfo(userEntity),
 	)
 
 	route.PUT("/info",
 		middlewares.RequireAuthenticated(),
-		usecase.RequireSession(sessionEntity),
-		usecase.UpdateUserInfo(userEntity),
+		middlewares.RejectImpersonation(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateUserInfo(userEntity, attributeEntity, auditEntity),
+	)
+
+	route.PUT("/avatar",
+		middlewares.RequireAuthenticated(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UploadAvatar(userEntity, blobStore, auditEntity),
+	)
+
+	route.DELETE("/avatar",
+		middlewares.RequireAuthenticated(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.RemoveAvatar(userEntity, blobStore, auditEntity),
+	)
+
+	app.GET("/avatar/:version/:size",
+		usecase.ServeAvatar(blobStore),
 	)
 
 	route.PUT("/change-password",
 		middlewares.RequireAuthenticated(),
-		usecase.RequireSession(sessionEntity),
-		usecase.ChangePassword(userEntity),
+		middlewares.RejectImpersonation(),
+		middlewares.RejectApiKey(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.ChangePassword(userEntity, auditEntity),
 	)
 
 	route.POST("/set-password",
 		middlewares.RequireAuthenticated(),
-		usecase.RequireSession(sessionEntity),
-		usecase.SetPassword(userEntity),
+		middlewares.RejectImpersonation(),
+		middlewares.RejectApiKey(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.SetPassword(userEntity, auditEntity),
+	)
+
+	route.POST("/verification",
+		middlewares.RequireAuthenticated(),
+		middlewares.RejectImpersonation(),
+		middlewares.RejectApiKey(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.StartVerification(userEntity, systemEntity, verificationEntity, notifier),
+	)
+
+	route.POST("/verification/confirm",
+		middlewares.RequireAuthenticated(),
+		middlewares.RejectImpersonation(),
+		middlewares.RejectApiKey(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.ConfirmVerification(userEntity, verificationEntity, auditEntity),
+	)
+
+	app.POST("/auth/verification",
+		usecase.ConfirmVerificationLink(userEntity, verificationEntity, auditEntity),
 	)
 }
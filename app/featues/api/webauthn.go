@@ -0,0 +1,82 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyWebauthnAPI(
+	app *gin.RouterGroup,
+	relyingParty *webauthn.WebAuthn,
+	userEntity repository.IUser,
+	attributeEntity repository.IAttribute,
+	sessionEntity repository.ISession,
+	webauthnEntity repository.IWebauthn,
+	loginHistoryEntity repository.ILoginHistory,
+	eventEntity repository.IEvent,
+	auditEntity repository.IAudit,
+) {
+
+	authRoute := app.Group("auth/webauthn")
+
+	authRoute.POST("/login/begin",
+		usecase.BeginWebauthnLogin(relyingParty, webauthnEntity),
+	)
+
+	authRoute.POST("/login/finish",
+		usecase.FinishWebauthnLogin(relyingParty, userEntity, attributeEntity, sessionEntity, webauthnEntity, loginHistoryEntity, eventEntity),
+	)
+
+	route := app.Group("/user/webauthn")
+
+	route.GET("",
+		middlewares.RequireAuthenticated(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetWebauthnCredentials(userEntity),
+	)
+
+	route.POST("/register/begin",
+		middlewares.RequireAuthenticated(),
+		middlewares.RejectImpersonation(),
+		middlewares.RejectApiKey(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.BeginWebauthnRegistration(relyingParty, userEntity, webauthnEntity),
+	)
+
+	route.POST("/register/finish",
+		middlewares.RequireAuthenticated(),
+		middlewares.RejectImpersonation(),
+		middlewares.RejectApiKey(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.FinishWebauthnRegistration(relyingParty, userEntity, webauthnEntity, auditEntity),
+	)
+
+	route.DELETE("/:id",
+		middlewares.RequireAuthenticated(),
+		middlewares.RejectImpersonation(),
+		middlewares.RejectApiKey(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.RemoveWebauthnCredential(userEntity, auditEntity),
+	)
+
+	adminRoute := app.Group("admin/user/:id/webauthn")
+
+	adminRoute.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetUserWebauthnCredentials(userEntity),
+	)
+
+	adminRoute.DELETE("/:credentialId",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.ADMIN),
+		middlewares.RejectApiKey(),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.RemoveUserWebauthnCredential(userEntity, auditEntity),
+	)
+}
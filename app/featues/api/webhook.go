@@ -0,0 +1,86 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"um/app/core/constant"
+	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/middlewares"
+)
+
+func ApplyWebhookAPI(
+	app *gin.RouterGroup,
+	webhookEntity repository.IWebhook,
+	deliveryEntity repository.IDelivery,
+	systemEntity repository.ISystem,
+	userEntity repository.IUser,
+	sessionEntity repository.ISession,
+	auditEntity repository.IAudit,
+) {
+
+	route := app.Group("system/:id/webhooks")
+
+	route.GET("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetWebhooks(webhookEntity),
+	)
+
+	route.POST("",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.AddWebhook(webhookEntity, systemEntity, auditEntity),
+	)
+
+	route.GET("/deliveries",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetWebhookDeliveries(deliveryEntity),
+	)
+
+	route.GET("/dead-letters",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetWebhookDeadLetters(deliveryEntity),
+	)
+
+	route.POST("/deliveries/:deliveryId/redeliver",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.RedeliverWebhook(deliveryEntity, auditEntity),
+	)
+
+	route.GET("/:webhookId",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.GetWebhookById(webhookEntity),
+	)
+
+	route.PUT("/:webhookId",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.UpdateWebhookById(webhookEntity, auditEntity),
+	)
+
+	route.DELETE("/:webhookId",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.DeleteWebhookById(webhookEntity, auditEntity),
+	)
+
+	route.POST("/:webhookId/secret",
+		middlewares.RequireAuthenticated(),
+		middlewares.RequireAuthorization(constant.SUPER),
+		usecase.RequireSession(sessionEntity, userEntity),
+		usecase.RotateWebhookSecret(webhookEntity, auditEntity),
+	)
+
+}
@@ -0,0 +1,12 @@
+package request
+
+import "time"
+
+type ApiKey struct {
+	Name       string    `json:"name" binding:"required"`
+	ExpireDate time.Time `json:"expireDate" binding:"required"`
+	Scopes     []string  `json:"scopes"`
+	AllowedIps []string  `json:"allowedIps"`
+	UserId     string
+	ClientId   string
+}
@@ -0,0 +1,27 @@
+package request
+
+type AttributeSchema struct {
+	Key       string   `json:"key" binding:"required,max=64"`
+	Label     string   `json:"label" binding:"max=128"`
+	Type      string   `json:"type" binding:"required,oneof=string number boolean date"`
+	Required  bool     `json:"required"`
+	Unique    bool     `json:"unique"`
+	Pattern   string   `json:"pattern" binding:"max=512"`
+	Enum      []string `json:"enum" binding:"max=100"`
+	Editable  bool     `json:"editable"`
+	Claim     bool     `json:"claim"`
+	ClientId  string
+	CreatedBy string
+}
+
+// UpdateAttributeSchema changes everything but the key and the type, which the stored values depend on
+type UpdateAttributeSchema struct {
+	Label     string   `json:"label" binding:"max=128"`
+	Required  bool     `json:"required"`
+	Unique    bool     `json:"unique"`
+	Pattern   string   `json:"pattern" binding:"max=512"`
+	Enum      []string `json:"enum" binding:"max=100"`
+	Editable  bool     `json:"editable"`
+	Claim     bool     `json:"claim"`
+	UpdatedBy string
+}
@@ -0,0 +1,16 @@
+package request
+
+import "time"
+
+type GetAuditEvents struct {
+	ClientId   string    `form:"clientId"`
+	ActorId    string    `form:"actorId"`
+	TargetType string    `form:"targetType"`
+	TargetId   string    `form:"targetId"`
+	Action     string    `form:"action"`
+	RequestId  string    `form:"requestId"`
+	From       time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To         time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit      int64     `form:"limit" binding:"omitempty,min=1,max=500"`
+	Offset     int64     `form:"offset" binding:"omitempty,min=0"`
+}
@@ -4,4 +4,5 @@ type Login struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 	System   string `json:"system" binding:"required"`
+	ClientId string `json:"clientId"`
 }
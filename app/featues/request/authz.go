@@ -0,0 +1,13 @@
+package request
+
+type AuthzCheck struct {
+	Token    string `json:"token"`
+	UserId   string `json:"userId"`
+	Action   string `json:"action" binding:"required"`
+	Resource string `json:"resource" binding:"required"`
+	ClientId string `json:"clientId"`
+}
+
+type AuthzCheckBatch struct {
+	Checks []AuthzCheck `json:"checks" binding:"required,min=1,max=100,dive"`
+}
@@ -0,0 +1,31 @@
+package request
+
+type Grant struct {
+	Role   string `json:"role" binding:"required"`
+	System string `json:"system"`
+}
+
+type Group struct {
+	Name        string  `json:"name" binding:"required"`
+	Description string  `json:"description"`
+	Grants      []Grant `json:"grants" binding:"dive"`
+	ClientId    string
+	CreatedBy   string
+}
+
+type UpdateGroup struct {
+	Name        string  `json:"name" binding:"required"`
+	Description string  `json:"description"`
+	Grants      []Grant `json:"grants" binding:"dive"`
+	UpdatedBy   string
+}
+
+type GroupMembers struct {
+	UserIds   []string `json:"userIds" binding:"required,min=1"`
+	UpdatedBy string
+}
+
+type GetPermissions struct {
+	Action   string `form:"action"`
+	Resource string `form:"resource"`
+}
@@ -0,0 +1,14 @@
+package request
+
+import "time"
+
+type GetLoginHistories struct {
+	UserId   string    `form:"userId"`
+	Event    string    `form:"event"`
+	Success  *bool     `form:"success"`
+	From     time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To       time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit    int64     `form:"limit" binding:"omitempty,min=1,max=500"`
+	Offset   int64     `form:"offset" binding:"omitempty,min=0"`
+	ClientId string
+}
@@ -0,0 +1,66 @@
+package request
+
+type ClaimMapping struct {
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+type IdentityProvider struct {
+	Name              string       `json:"name" binding:"required"`
+	Issuer            string       `json:"issuer" binding:"required,url"`
+	OAuthClientId     string       `json:"oauthClientId" binding:"required"`
+	OAuthClientSecret string       `json:"oauthClientSecret" binding:"required"`
+	Scopes            []string     `json:"scopes"`
+	ClaimMapping      ClaimMapping `json:"claimMapping"`
+	AutoProvision     bool         `json:"autoProvision"`
+	LinkByEmail       bool         `json:"linkByEmail"`
+	RedirectUris      []string     `json:"redirectUris" binding:"dive,url"`
+	ClientId          string
+	CreatedBy         string
+}
+
+// UpdateIdentityProvider keeps the stored client secret when OAuthClientSecret is empty
+type UpdateIdentityProvider struct {
+	Name              string       `json:"name" binding:"required"`
+	Issuer            string       `json:"issuer" binding:"required,url"`
+	OAuthClientId     string       `json:"oauthClientId" binding:"required"`
+	OAuthClientSecret string       `json:"oauthClientSecret"`
+	Scopes            []string     `json:"scopes"`
+	ClaimMapping      ClaimMapping `json:"claimMapping"`
+	AutoProvision     bool         `json:"autoProvision"`
+	LinkByEmail       bool         `json:"linkByEmail"`
+	RedirectUris      []string     `json:"redirectUris" binding:"dive,url"`
+	Active            bool         `json:"active"`
+	UpdatedBy         string
+}
+
+type GetLoginProviders struct {
+	ClientId string `form:"clientId" binding:"required"`
+}
+
+type IdpLogin struct {
+	System      string `form:"system" binding:"required"`
+	RedirectUri string `form:"redirectUri"`
+}
+
+type IdpCallback struct {
+	Code             string `form:"code"`
+	State            string `form:"state"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+type ClientSetting struct {
+	PasswordLoginDisabled bool `json:"passwordLoginDisabled"`
+	PasswordlessEnabled   bool `json:"passwordlessEnabled"`
+	RegistrationEnabled   bool `json:"registrationEnabled"`
+	// RegistrationCode is shared with the staff allowed to sign up to the client
+	RegistrationCode string `json:"registrationCode" binding:"omitempty,min=8,max=64"`
+	ApprovalRequired bool   `json:"approvalRequired"`
+	// InactivityDays disables users who didn't sign in for that long, 0 never does
+	InactivityDays        int `json:"inactivityDays" binding:"omitempty,min=7,max=3650"`
+	InactivityWarningDays int `json:"inactivityWarningDays" binding:"omitempty,min=1,ltfield=InactivityDays"`
+	UpdatedBy             string
+}
@@ -0,0 +1,6 @@
+package request
+
+type Impersonate struct {
+	System string `json:"system" binding:"required"`
+	Reason string `json:"reason" binding:"required"`
+}
@@ -0,0 +1,19 @@
+package request
+
+type Invite struct {
+	FirstName   string `json:"firstName"`
+	LastName    string `json:"lastName"`
+	Phone       string `json:"phone"`
+	Email       string `json:"email" binding:"required,email"`
+	Username    string `json:"username" binding:"required"`
+	System      string `json:"system" binding:"required"`
+	RedirectUri string `json:"redirectUri" binding:"required"`
+}
+
+type AcceptInvite struct {
+	Token     string `json:"token" binding:"required"`
+	Password  string `json:"password" binding:"required"`
+	FirstName string `json:"firstName" binding:"required"`
+	LastName  string `json:"lastName" binding:"required"`
+	Phone     string `json:"phone"`
+}
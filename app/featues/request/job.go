@@ -0,0 +1,34 @@
+package request
+
+import "encoding/json"
+
+type Job struct {
+	Name       string          `json:"name" binding:"required"`
+	Cron       string          `json:"cron" binding:"required"`
+	Timezone   string          `json:"timezone"`
+	SystemCode string          `json:"systemCode" binding:"required"`
+	Path       string          `json:"path" binding:"required,startswith=/"`
+	Method     string          `json:"method" binding:"omitempty,oneof=GET POST PUT PATCH DELETE"`
+	Payload    json.RawMessage `json:"payload"`
+	Retries    int             `json:"retries" binding:"min=0,max=5"`
+	Active     *bool           `json:"active"`
+	CreatedBy  string
+}
+
+type UpdateJob struct {
+	Name       string          `json:"name" binding:"required"`
+	Cron       string          `json:"cron" binding:"required"`
+	Timezone   string          `json:"timezone"`
+	SystemCode string          `json:"systemCode" binding:"required"`
+	Path       string          `json:"path" binding:"required,startswith=/"`
+	Method     string          `json:"method" binding:"omitempty,oneof=GET POST PUT PATCH DELETE"`
+	Payload    json.RawMessage `json:"payload"`
+	Retries    int             `json:"retries" binding:"min=0,max=5"`
+	Active     *bool           `json:"active"`
+	UpdatedBy  string
+}
+
+type GetJobRuns struct {
+	Limit  int64 `form:"limit" binding:"omitempty,min=1,max=500"`
+	Offset int64 `form:"offset" binding:"omitempty,min=0"`
+}
@@ -0,0 +1,42 @@
+package request
+
+type LdapAttributes struct {
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	Groups    string `json:"groups"`
+}
+
+type LdapGroupRole struct {
+	Group string `json:"group" binding:"required"`
+	Role  string `json:"role" binding:"required,oneof=ADMIN USER"`
+}
+
+// LdapConfig keeps the stored bind password when BindPassword is empty
+type LdapConfig struct {
+	Url                string          `json:"url" binding:"required,startswith=ldap"`
+	StartTls           bool            `json:"startTls"`
+	InsecureSkipVerify bool            `json:"insecureSkipVerify"`
+	BindDn             string          `json:"bindDn"`
+	BindPassword       string          `json:"bindPassword"`
+	BaseDn             string          `json:"baseDn" binding:"required"`
+	UserFilter         string          `json:"userFilter"`
+	Attributes         LdapAttributes  `json:"attributes"`
+	GroupRoles         []LdapGroupRole `json:"groupRoles" binding:"dive"`
+	DefaultRole        string          `json:"defaultRole" binding:"omitempty,oneof=ADMIN USER"`
+	Enabled            bool            `json:"enabled"`
+	UpdatedBy          string
+}
+
+// DirectoryUser is a user as read from a directory on login
+type DirectoryUser struct {
+	Username  string
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+	Role      string
+	ClientId  string
+	Source    string
+}
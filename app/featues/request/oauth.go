@@ -0,0 +1,31 @@
+package request
+
+// OAuthToken is the form of a token request, client credentials may also come as HTTP Basic auth
+type OAuthToken struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	ClientId     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	Scope        string `form:"scope"`
+	Code         string `form:"code"`
+	RedirectUri  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+}
+
+// Authorize holds the parameters of an authorization request, carried through the login page
+type Authorize struct {
+	ResponseType        string `form:"response_type"`
+	ClientId            string `form:"client_id"`
+	RedirectUri         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	Nonce               string `form:"nonce"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+type AuthorizeLogin struct {
+	Authorize
+	Username  string `form:"username"`
+	Password  string `form:"password"`
+	CsrfToken string `form:"csrf_token"`
+}
@@ -0,0 +1,15 @@
+package request
+
+type PasswordlessStart struct {
+	Username    string `json:"username" binding:"required"`
+	System      string `json:"system" binding:"required"`
+	Method      string `json:"method" binding:"required,oneof=code link"`
+	Channel     string `json:"channel" binding:"omitempty,oneof=email sms"`
+	RedirectUri string `json:"redirectUri" binding:"required_if=Method link,omitempty,url"`
+}
+
+type PasswordlessVerify struct {
+	ChallengeId string `json:"challengeId" binding:"required_without=Token"`
+	Code        string `json:"code" binding:"required_with=ChallengeId"`
+	Token       string `json:"token" binding:"required_without=ChallengeId"`
+}
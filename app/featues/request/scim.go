@@ -0,0 +1,60 @@
+package request
+
+import "encoding/json"
+
+type ScimToken struct {
+	Name      string `json:"name" binding:"required"`
+	ClientId  string
+	CreatedBy string
+}
+
+type GetScimResources struct {
+	Filter     string `form:"filter"`
+	StartIndex int64  `form:"startIndex"`
+	Count      *int64 `form:"count"`
+}
+
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type ScimPatch struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+type ScimBulkOperation struct {
+	Method  string          `json:"method"`
+	BulkId  string          `json:"bulkId,omitempty"`
+	Version string          `json:"version,omitempty"`
+	Path    string          `json:"path"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+type ScimBulk struct {
+	Schemas      []string            `json:"schemas"`
+	FailOnErrors int                 `json:"failOnErrors"`
+	Operations   []ScimBulkOperation `json:"Operations"`
+}
+
+// ScimUserForm is a SCIM user mapped onto the fields of a user
+type ScimUserForm struct {
+	Username   string
+	FirstName  string
+	LastName   string
+	Email      string
+	Phone      string
+	Active     bool
+	ExternalId string
+	Password   string
+	ClientId   string
+}
+
+type ScimGroupForm struct {
+	Name       string
+	ExternalId string
+	Members    []string
+	ClientId   string
+}
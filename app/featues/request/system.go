@@ -18,3 +18,16 @@ type UpdateSystem struct {
 	Host       string `json:"host"  binding:"required"`
 	UpdatedBy  string
 }
+
+type SystemScopes struct {
+	Scopes    []string `json:"scopes" binding:"required"`
+	UpdatedBy string
+}
+
+// SystemRedirectUris registers the system as an authorization code client. A public client, such
+// as a single page or mobile app, can't keep a secret and exchanges codes with PKCE only.
+type SystemRedirectUris struct {
+	RedirectUris []string `json:"redirectUris" binding:"required,dive,url"`
+	PublicClient bool     `json:"publicClient"`
+	UpdatedBy    string
+}
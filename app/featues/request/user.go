@@ -1,5 +1,7 @@
 package request
 
+import "time"
+
 type User struct {
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
@@ -8,7 +10,18 @@ type User struct {
 	Username  string `json:"username" binding:"required"`
 	Password  string `json:"password" binding:"required"`
 	ClientId  string `json:"clientId" binding:"required"`
-	CreatedBy string
+	// ValidFrom and ValidUntil limit when the user can sign in, both are optional
+	ValidFrom  *time.Time `json:"validFrom"`
+	ValidUntil *time.Time `json:"validUntil"`
+	// Attributes are the values of the custom attributes of the client
+	Attributes map[string]interface{} `json:"attributes"`
+	// UniqueAttributes are the keys of Attributes no other user may share, set by the server
+	UniqueAttributes []string `json:"-"`
+	CreatedBy        string
+	// Status of the new user, ACTIVE when empty, and Source, the registration or directory the user
+	// comes from. Both are set by the server, never bound from the body.
+	Status string `json:"-"`
+	Source string `json:"-"`
 }
 
 type UpdateUser struct {
@@ -16,7 +29,11 @@ type UpdateUser struct {
 	LastName  string `json:"lastName" binding:"required"`
 	Phone     string `json:"phone"`
 	Email     string `json:"email"`
-	UpdatedBy string
+	// Attributes replace the custom attributes of the user, they are kept when omitted
+	Attributes map[string]interface{} `json:"attributes"`
+	// UniqueAttributes are the keys of Attributes no other user may share, set by the server
+	UniqueAttributes []string `json:"-"`
+	UpdatedBy        string
 }
 
 type UpdateRole struct {
@@ -24,8 +41,22 @@ type UpdateRole struct {
 	UpdatedBy string
 }
 
+type UpdateValidity struct {
+	ValidFrom  *time.Time `json:"validFrom"`
+	ValidUntil *time.Time `json:"validUntil"`
+	UpdatedBy  string
+}
+
+type GetExpiringUsers struct {
+	Days int `form:"days" binding:"omitempty,min=1,max=365"`
+}
+
+type GetDormantUsers struct {
+	Days int `form:"days" binding:"omitempty,min=1,max=3650"`
+}
+
 type UpdateStatus struct {
-	Status    string `json:"status" binding:"required"`
+	Status    string `json:"status" binding:"required,oneof=ACTIVE INACTIVE"`
 	UpdatedBy string
 }
 
@@ -0,0 +1,17 @@
+package request
+
+type VerificationStart struct {
+	Channel     string `json:"channel" binding:"required,oneof=email sms"`
+	Method      string `json:"method" binding:"required,oneof=code link"`
+	System      string `json:"system" binding:"required_if=Method link"`
+	RedirectUri string `json:"redirectUri" binding:"required_if=Method link,omitempty,url"`
+}
+
+type VerificationConfirm struct {
+	ChallengeId string `json:"challengeId" binding:"required"`
+	Code        string `json:"code" binding:"required"`
+}
+
+type VerificationToken struct {
+	Token string `json:"token" binding:"required"`
+}
@@ -0,0 +1,18 @@
+package request
+
+import "encoding/json"
+
+type WebauthnRegister struct {
+	ChallengeId string          `json:"challengeId" binding:"required"`
+	Name        string          `json:"name" binding:"omitempty,max=64"`
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+}
+
+type WebauthnLoginStart struct {
+	System string `json:"system" binding:"required"`
+}
+
+type WebauthnLogin struct {
+	ChallengeId string          `json:"challengeId" binding:"required"`
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+}
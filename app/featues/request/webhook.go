@@ -0,0 +1,24 @@
+package request
+
+type Webhook struct {
+	Path      string   `json:"path" binding:"required,startswith=/"`
+	Events    []string `json:"events" binding:"required,min=1"`
+	Active    *bool    `json:"active"`
+	CreatedBy string
+}
+
+type UpdateWebhook struct {
+	Path      string   `json:"path" binding:"required,startswith=/"`
+	Events    []string `json:"events" binding:"required,min=1"`
+	Active    *bool    `json:"active"`
+	UpdatedBy string
+}
+
+type GetWebhookDeliveries struct {
+	WebhookId string `form:"webhookId"`
+	EventId   string `form:"eventId"`
+	Status    string `form:"status"`
+	Limit     int64  `form:"limit" binding:"omitempty,min=1,max=500"`
+	Offset    int64  `form:"offset" binding:"omitempty,min=0"`
+	SystemId  string
+}
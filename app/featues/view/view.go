@@ -0,0 +1,15 @@
+package view
+
+import (
+	"embed"
+	"html/template"
+)
+
+//go:embed *.html
+var files embed.FS
+
+// Login renders the sign-in page of the authorization endpoint
+var Login = template.Must(template.ParseFS(files, "login.html"))
+
+// Error renders an authorization error that can't be sent back to the client
+var Error = template.Must(template.ParseFS(files, "error.html"))
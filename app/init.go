@@ -1,10 +1,13 @@
 package app
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"os"
 	"um/app/domain/repository"
+	"um/app/domain/usecase"
+	"um/app/domain/worker"
 	"um/app/featues/api"
 	"um/db"
 	"um/middlewares"
@@ -14,14 +17,24 @@ type Routes struct {
 }
 
 func (app Routes) StartGin() {
+	err := usecase.CheckOidcIssuer()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	err = middlewares.CheckOidcKey()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
 	r := gin.New()
 
-	err := r.SetTrustedProxies(nil)
+	err = r.SetTrustedProxies(nil)
 	if err != nil {
 		logrus.Error(err)
 	}
 
 	r.Use(gin.Logger())
+	r.Use(middlewares.NewRequestId())
 	r.Use(middlewares.NewRecovery())
 	r.Use(middlewares.NewCors([]string{"*"}))
 
@@ -36,12 +49,84 @@ func (app Routes) StartGin() {
 	userEntity := repository.NewUserEntity(resource)
 	sessionEntity := repository.NewSessionEntity(resource)
 	systemEntity := repository.NewSystemEntity(resource)
+	groupEntity := repository.NewGroupEntity(resource)
+	authzEntity := repository.NewAuthzEntity(resource)
+	impersonationEntity := repository.NewImpersonationEntity(resource)
+	auditEntity := repository.NewAuditEntity(resource)
+	loginHistoryEntity := repository.NewLoginHistoryEntity(resource)
+	eventEntity := repository.NewEventEntity(resource)
+	lockEntity := repository.NewLockEntity(resource)
+	publisher := repository.NewStreamPublisher(resource)
+	subscriber := repository.NewStreamSubscriber(resource)
+	webhookEntity := repository.NewWebhookEntity(resource)
+	deliveryEntity := repository.NewDeliveryEntity(resource)
+	jobEntity := repository.NewJobEntity(resource)
+	jobRunEntity := repository.NewJobRunEntity(resource)
+	authCodeEntity := repository.NewAuthCodeEntity(resource)
+	idpEntity := repository.NewIdentityProviderEntity(resource)
+	idpStateEntity := repository.NewIdpStateEntity(resource)
+	clientSettingEntity := repository.NewClientSettingEntity(resource)
+	ldapConfigEntity := repository.NewLdapConfigEntity(resource)
+	scimTokenEntity := repository.NewScimTokenEntity(resource)
+	apiKeyEntity := repository.NewApiKeyEntity(resource)
+	passwordlessEntity := repository.NewPasswordlessEntity(resource)
+	notifier := usecase.NewNotifier(os.Getenv("NOTIFY_URL"))
+	webauthnEntity := repository.NewWebauthnEntity(resource)
+	verificationEntity := repository.NewVerificationEntity(resource)
+	invitationEntity := repository.NewInvitationEntity(resource)
+	rateLimitEntity := repository.NewRateLimitEntity(resource)
+	attributeEntity := repository.NewAttributeEntity(resource)
+	blobStore := repository.NewLocalBlobStore(os.Getenv("BLOB_DIR"))
+	preferenceEntity := repository.NewPreferenceEntity(resource)
+	preferenceSchemaEntity := repository.NewPreferenceSchemaEntity(resource)
+
+	relyingParty, err := usecase.NewRelyingParty(os.Getenv("WEBAUTHN_RP_ID"), os.Getenv("WEBAUTHN_RP_NAME"), os.Getenv("WEBAUTHN_ORIGINS"))
+	if err != nil {
+		logrus.Error(err)
+	}
+
+	authenticators := usecase.NewAuthenticatorChain(
+		usecase.NewLocalAuthenticator(),
+		usecase.NewLdapAuthenticator(userEntity, ldapConfigEntity),
+	)
+
+	// the workers taking a context stop, and abort their calls in flight, when the server stops
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	worker.StartOutboxRelay(eventEntity, publisher, lockEntity)
+	worker.StartWebhookFanout(workerCtx, subscriber, webhookEntity, deliveryEntity)
+	worker.StartWebhookDispatcher(workerCtx, deliveryEntity, webhookEntity, systemEntity, lockEntity)
+	worker.StartScheduler(jobEntity, jobRunEntity, systemEntity, lockEntity)
+	worker.StartUserExpirySweeper(userEntity, sessionEntity, authzEntity, lockEntity)
+	worker.StartInactivitySweeper(userEntity, clientSettingEntity, sessionEntity, authzEntity, lockEntity, notifier.Notify)
+
+	publicRoute.Use(usecase.RecordImpersonation(impersonationEntity))
+	publicRoute.Use(usecase.ResolveApiKey(apiKeyEntity, userEntity))
 
-	api.ApplyAuthAPI(publicRoute, userEntity, sessionEntity, systemEntity)
-	api.ApplyUserAPI(publicRoute, userEntity, sessionEntity)
-	api.ApplyAdminUserAPI(publicRoute, userEntity, sessionEntity)
-	api.ApplySuperUserAPI(publicRoute, userEntity, sessionEntity)
-	api.ApplySystemAPI(publicRoute, systemEntity, sessionEntity)
+	api.ApplyAuthAPI(publicRoute, userEntity, attributeEntity, sessionEntity, systemEntity, authenticators, clientSettingEntity, loginHistoryEntity, eventEntity, relyingParty, webauthnEntity)
+	api.ApplyPasswordlessAPI(publicRoute, userEntity, attributeEntity, sessionEntity, systemEntity, clientSettingEntity, passwordlessEntity, loginHistoryEntity, eventEntity, notifier, relyingParty, webauthnEntity)
+	api.ApplyWebauthnAPI(publicRoute, relyingParty, userEntity, attributeEntity, sessionEntity, webauthnEntity, loginHistoryEntity, eventEntity, auditEntity)
+	api.ApplyUserAPI(publicRoute, userEntity, attributeEntity, sessionEntity, systemEntity, verificationEntity, notifier, blobStore, auditEntity)
+	api.ApplyPreferenceAPI(publicRoute, preferenceEntity, preferenceSchemaEntity, userEntity, sessionEntity, auditEntity)
+	api.ApplyApiKeyAPI(publicRoute, apiKeyEntity, userEntity, sessionEntity, auditEntity)
+	api.ApplyAdminUserAPI(publicRoute, userEntity, attributeEntity, systemEntity, sessionEntity, groupEntity, authzEntity, clientSettingEntity, auditEntity)
+	api.ApplyInvitationAPI(publicRoute, invitationEntity, userEntity, systemEntity, sessionEntity, groupEntity, authzEntity, notifier, auditEntity)
+	api.ApplyAttributeAPI(publicRoute, attributeEntity, userEntity, sessionEntity, auditEntity)
+	api.ApplyRegistrationAPI(publicRoute, userEntity, sessionEntity, clientSettingEntity, groupEntity, authzEntity, rateLimitEntity, notifier, auditEntity)
+	api.ApplyPrivacyAPI(publicRoute, userEntity, loginHistoryEntity, auditEntity, sessionEntity, preferenceEntity, groupEntity, authzEntity, apiKeyEntity, invitationEntity, impersonationEntity, deliveryEntity, blobStore)
+	api.ApplySuperUserAPI(publicRoute, userEntity, attributeEntity, sessionEntity, groupEntity, authzEntity, impersonationEntity, auditEntity, eventEntity)
+	api.ApplySystemAPI(publicRoute, systemEntity, webhookEntity, deliveryEntity, userEntity, sessionEntity, authzEntity, auditEntity)
+	api.ApplyWebhookAPI(publicRoute, webhookEntity, deliveryEntity, systemEntity, userEntity, sessionEntity, auditEntity)
+	api.ApplyOAuthAPI(publicRoute, userEntity, attributeEntity, sessionEntity, systemEntity, authCodeEntity, authenticators, clientSettingEntity, loginHistoryEntity, eventEntity)
+	api.ApplyLdapAPI(publicRoute, ldapConfigEntity, userEntity, sessionEntity, auditEntity)
+	api.ApplyIdpAPI(publicRoute, userEntity, attributeEntity, sessionEntity, idpEntity, idpStateEntity, clientSettingEntity, loginHistoryEntity, eventEntity, auditEntity, relyingParty, webauthnEntity)
+	api.ApplyScimAPI(publicRoute, scimTokenEntity, userEntity, groupEntity, sessionEntity, authzEntity, auditEntity)
+	api.ApplyJobAPI(publicRoute, jobEntity, jobRunEntity, systemEntity, userEntity, sessionEntity, lockEntity, auditEntity)
+	api.ApplyAuthzAPI(publicRoute, userEntity, sessionEntity, systemEntity, groupEntity, authzEntity)
+	api.ApplyGroupAPI(publicRoute, groupEntity, userEntity, systemEntity, sessionEntity, authzEntity, auditEntity)
+	api.ApplyAuditAPI(publicRoute, auditEntity, userEntity, sessionEntity)
+	api.ApplyLoginHistoryAPI(publicRoute, loginHistoryEntity, userEntity, sessionEntity)
 
 	r.NoRoute(middlewares.NoRoute())
 
@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/sirupsen/logrus"
@@ -10,29 +11,76 @@ import (
 	"time"
 )
 
+// ActorClaim identifies the user acting on behalf of the token subject
+type ActorClaim struct {
+	Sub string `json:"sub"`
+}
+
 type AccessClaims struct {
-	Role     string `json:"role"`
-	System   string `json:"system"`
-	ClientId string `json:"clientId"`
+	Role     string      `json:"role"`
+	System   string      `json:"system"`
+	ClientId string      `json:"clientId"`
+	Act      *ActorClaim `json:"act,omitempty"`
+	Scope    string      `json:"scope,omitempty"`
+	// Attributes are the custom attributes of the user the client emits as claims
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// SystemSubjectPrefix marks the subject of a machine token issued to a system, "system:<systemId>"
+const SystemSubjectPrefix = "system:"
+
 type TokenParam struct {
 	SessionId      string
 	Role           string
 	System         string
 	ClientId       string
+	ActorId        string
+	Attributes     map[string]interface{}
 	ExpirationTime time.Time
 }
 
 func GenerateJwtToken(param *TokenParam) string {
 	var jwtKey = []byte(os.Getenv("SECRET_KEY"))
 	claims := &AccessClaims{
-		Role:     param.Role,
+		Role:       param.Role,
+		System:     param.System,
+		ClientId:   param.ClientId,
+		Attributes: param.Attributes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        param.SessionId,
+			ExpiresAt: jwt.NewNumericDate(param.ExpirationTime),
+		},
+	}
+	if param.ActorId != "" {
+		claims.Act = &ActorClaim{Sub: param.ActorId}
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(jwtKey)
+	if err != nil {
+		logrus.Error(err)
+	}
+	return tokenString
+}
+
+type SystemTokenParam struct {
+	SystemId       string
+	System         string
+	ClientId       string
+	Scopes         []string
+	ExpirationTime time.Time
+}
+
+// GenerateSystemToken issues a machine token. It has no session id, so user endpoints reject it.
+func GenerateSystemToken(param *SystemTokenParam) string {
+	var jwtKey = []byte(os.Getenv("SECRET_KEY"))
+	claims := &AccessClaims{
 		System:   param.System,
 		ClientId: param.ClientId,
+		Scope:    strings.Join(param.Scopes, " "),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ID:        param.SessionId,
+			Subject:   SystemSubjectPrefix + param.SystemId,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(param.ExpirationTime),
 		},
 	}
@@ -44,9 +92,44 @@ func GenerateJwtToken(param *TokenParam) string {
 	return tokenString
 }
 
-func RequireAuthenticated() gin.HandlerFunc {
+// ParseJwtToken validates an access token and returns its claims
+func ParseJwtToken(token string) (*AccessClaims, error) {
 	jwtKey := []byte(os.Getenv("SECRET_KEY"))
+	claims := &AccessClaims{}
+	tkn, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tkn == nil || !tkn.Valid || claims.ID == "" {
+		return nil, errors.New("token invalid")
+	}
+	return claims, nil
+}
+
+// ParseSystemToken validates a machine token and returns its claims
+func ParseSystemToken(token string) (*AccessClaims, error) {
+	jwtKey := []byte(os.Getenv("SECRET_KEY"))
+	claims := &AccessClaims{}
+	tkn, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tkn == nil || !tkn.Valid || claims.ID != "" || !strings.HasPrefix(claims.Subject, SystemSubjectPrefix) {
+		return nil, errors.New("token invalid")
+	}
+	return claims, nil
+}
+
+// RequireAuthenticated accepts an access token, or a request already authenticated by an API key
+func RequireAuthenticated() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		if ctx.GetString(ApiKeyId) != "" {
+			return
+		}
 		token := ctx.GetHeader("Authorization")
 		if token == "" {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
@@ -57,23 +140,20 @@ func RequireAuthenticated() gin.HandlerFunc {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
 			return
 		}
-		claims := &AccessClaims{}
-		tkn, err := jwt.ParseWithClaims(jwtToken[1], claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
+		claims, err := ParseJwtToken(jwtToken[1])
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
-		if tkn == nil || !tkn.Valid || claims.ID == "" {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token invalid"})
-			return
-		}
 
 		ctx.Set(SessionId, claims.ID)
 		ctx.Set(Role, claims.Role)
 		ctx.Set(System, claims.System)
 		ctx.Set(ClientId, claims.ClientId)
+		if claims.Act != nil {
+			ctx.Set(Actor, claims.Act.Sub)
+			logrus.Info("Actor: " + claims.Act.Sub)
+		}
 
 		logrus.Info("SessionId: " + claims.ID)
 		logrus.Info("Role: " + claims.Role)
@@ -82,3 +162,51 @@ func RequireAuthenticated() gin.HandlerFunc {
 		return
 	}
 }
+
+// RequireSystemAuth accepts machine tokens only and requires every scope given
+func RequireSystemAuth(scopes ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token := ctx.GetHeader("Authorization")
+		jwtToken := strings.Split(token, "Bearer ")
+		if len(jwtToken) < 2 {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
+			return
+		}
+		claims, err := ParseSystemToken(jwtToken[1])
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		granted := strings.Fields(claims.Scope)
+		for _, scope := range scopes {
+			if !containsScope(granted, scope) {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing scope " + scope})
+				return
+			}
+		}
+
+		systemId := strings.TrimPrefix(claims.Subject, SystemSubjectPrefix)
+		ctx.Set(SystemId, systemId)
+		ctx.Set(System, claims.System)
+		ctx.Set(ClientId, claims.ClientId)
+		ctx.Set(Scope, claims.Scope)
+		if claims.IssuedAt != nil {
+			ctx.Set(IssuedAt, claims.IssuedAt.Time)
+		}
+
+		logrus.Info("SystemId: " + systemId)
+		logrus.Info("Scope: " + claims.Scope)
+		logrus.Info("ClientId: " + claims.ClientId)
+		return
+	}
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, item := range scopes {
+		if item == scope {
+			return true
+		}
+	}
+	return false
+}
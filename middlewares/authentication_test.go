@@ -0,0 +1,65 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTokenKinds(t *testing.T) {
+	t.Setenv("SECRET_KEY", "test-secret")
+	gin.SetMode(gin.TestMode)
+	userToken := GenerateJwtToken(&TokenParam{
+		SessionId:      "session-1",
+		Role:           "USER",
+		System:         "POS",
+		ClientId:       "ACM",
+		ExpirationTime: time.Now().Add(time.Hour),
+	})
+	systemToken := GenerateSystemToken(&SystemTokenParam{
+		SystemId:       "system-1",
+		System:         "POS",
+		ClientId:       "ACM",
+		Scopes:         []string{"authz:check"},
+		ExpirationTime: time.Now().Add(time.Hour),
+	})
+	expiredToken := GenerateSystemToken(&SystemTokenParam{
+		SystemId:       "system-1",
+		Scopes:         []string{"authz:check"},
+		ExpirationTime: time.Now().Add(-time.Minute),
+	})
+
+	router := gin.New()
+	ok := func(ctx *gin.Context) { ctx.Status(http.StatusOK) }
+	router.GET("/user", RequireAuthenticated(), ok)
+	router.GET("/system", RequireSystemAuth("authz:check"), ok)
+	router.GET("/system/users", RequireSystemAuth("user:read"), ok)
+
+	for _, test := range []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"user token on a user endpoint", "/user", userToken, http.StatusOK},
+		{"system token on a user endpoint", "/user", systemToken, http.StatusUnauthorized},
+		{"system token on a system endpoint", "/system", systemToken, http.StatusOK},
+		{"user token on a system endpoint", "/system", userToken, http.StatusUnauthorized},
+		{"system token without the scope", "/system/users", systemToken, http.StatusForbidden},
+		{"expired system token", "/system", expiredToken, http.StatusUnauthorized},
+		{"no token", "/system", "", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != test.status {
+			t.Errorf("%s: answered %d %s, want %d", test.name, recorder.Code, recorder.Body.String(), test.status)
+		}
+	}
+}
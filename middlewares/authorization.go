@@ -42,6 +42,28 @@ func RequireAuthorization(auths ...string) gin.HandlerFunc {
 	}
 }
 
+// RejectImpersonation blocks sensitive endpoints for sessions opened through impersonation
+func RejectImpersonation() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.GetString(Actor) != "" {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed while impersonating"})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// RejectApiKey blocks endpoints that need a user signed in with a password, such as issuing keys
+func RejectApiKey() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.GetString(ApiKeyId) != "" {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed with an api key"})
+			return
+		}
+		ctx.Next()
+	}
+}
+
 func invalidRequest(ctx *gin.Context) {
 	ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Invalid request, restricted endpoint"})
 }
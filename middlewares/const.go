@@ -6,4 +6,10 @@ const (
 	System    = "System"
 	ClientId  = "ClientId"
 	UserId    = "UserId"
+	Actor     = "Actor"
+	RequestId = "RequestId"
+	SystemId  = "SystemId"
+	Scope     = "Scope"
+	IssuedAt  = "IssuedAt"
+	ApiKeyId  = "ApiKeyId"
 )
@@ -15,8 +15,9 @@ func NewCors(allowedOrigins []string) gin.HandlerFunc {
 			"Content-Type", "Content-Length",
 			"Accept-Encoding", "Accept-Language", "Accept",
 			"X-CSRF-Token", "Authorization", "X-Requested-With", "X-Access-Token",
+			"X-Request-Id",
 		},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "X-Request-Id"},
 		AllowCredentials: true,
 	})
 }
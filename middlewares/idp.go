@@ -0,0 +1,239 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const idpTimeout = 10 * time.Second
+
+// jwksRefreshTime is the least time between two fetches of the same JWKS, an unknown kid
+// doesn't make every login hit the provider
+const jwksRefreshTime = 1 * time.Minute
+
+// ProviderMetadata is the part of an OpenID Connect discovery document used for login
+type ProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type cachedMetadata struct {
+	metadata  *ProviderMetadata
+	fetchDate time.Time
+}
+
+type cachedKeys struct {
+	keys      map[string]interface{}
+	fetchDate time.Time
+}
+
+var (
+	idpHttpClient = &http.Client{Timeout: idpTimeout}
+	metadataCache sync.Map
+	jwksCache     sync.Map
+	jwksMutex     sync.Mutex
+)
+
+// DiscoverProvider reads the discovery document of issuer, documents are cached for maxAge
+func DiscoverProvider(issuer string, maxAge time.Duration) (*ProviderMetadata, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	if cached, ok := metadataCache.Load(issuer); ok && time.Since(cached.(cachedMetadata).fetchDate) < maxAge {
+		return cached.(cachedMetadata).metadata, nil
+	}
+	var metadata ProviderMetadata
+	err := getJson(issuer+"/.well-known/openid-configuration", &metadata)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+		return nil, errors.New("discovery document is for issuer " + metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JwksUri == "" {
+		return nil, errors.New("discovery document misses an endpoint")
+	}
+	metadataCache.Store(issuer, cachedMetadata{metadata: &metadata, fetchDate: time.Now()})
+	return &metadata, nil
+}
+
+// ExchangeIdpCode redeems an authorization code at the token endpoint and returns the ID token
+func ExchangeIdpCode(metadata *ProviderMetadata, clientId string, clientSecret string, code string, redirectUri string, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectUri)
+	form.Set("code_verifier", codeVerifier)
+	req, err := http.NewRequest(http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(url.QueryEscape(clientId), url.QueryEscape(clientSecret))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := idpHttpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	var token struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	_ = json.Unmarshal(body, &token)
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d: %s %s", res.StatusCode, token.Error, token.ErrorDescription)
+	}
+	if token.IdToken == "" {
+		return "", errors.New("token endpoint returned no id_token")
+	}
+	return token.IdToken, nil
+}
+
+// VerifyIdpToken checks the signature of an ID token against the JWKS of the provider, and its
+// issuer, audience, expiry and nonce
+func VerifyIdpToken(metadata *ProviderMetadata, rawToken string, clientId string, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return jwksKey(metadata.JwksUri, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "PS256"}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(clientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, errors.New("nonce does not match")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return claims, nil
+}
+
+func jwksKey(jwksUri string, kid string) (interface{}, error) {
+	if cached, ok := jwksCache.Load(jwksUri); ok {
+		if key, found := findKey(cached.(cachedKeys).keys, kid); found {
+			return key, nil
+		}
+	}
+
+	jwksMutex.Lock()
+	defer jwksMutex.Unlock()
+	if cached, ok := jwksCache.Load(jwksUri); ok {
+		keys := cached.(cachedKeys)
+		if key, found := findKey(keys.keys, kid); found {
+			return key, nil
+		}
+		if time.Since(keys.fetchDate) < jwksRefreshTime {
+			return nil, errors.New("unknown key " + kid)
+		}
+	}
+	keys, err := fetchJwks(jwksUri)
+	if err != nil {
+		return nil, err
+	}
+	jwksCache.Store(jwksUri, cachedKeys{keys: keys, fetchDate: time.Now()})
+	if key, found := findKey(keys, kid); found {
+		return key, nil
+	}
+	return nil, errors.New("unknown key " + kid)
+}
+
+// findKey picks the key with kid, or the only key when the token names none
+func findKey(keys map[string]interface{}, kid string) (interface{}, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+func fetchJwks(jwksUri string) (map[string]interface{}, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	err := getJson(jwksUri, &set)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			curve := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[jwk.Crv]
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if curve == nil || errX != nil || errY != nil {
+				continue
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys, nil
+}
+
+func getJson(endpoint string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), idpTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := idpHttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", endpoint, res.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(v)
+}
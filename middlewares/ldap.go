@@ -0,0 +1,129 @@
+package middlewares
+
+import (
+	"crypto/tls"
+	"errors"
+	"github.com/go-ldap/ldap/v3"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrLdapInvalidCredentials is returned when the user isn't found or the password is wrong
+var ErrLdapInvalidCredentials = errors.New("invalid credentials")
+
+type LdapParam struct {
+	Url                string
+	StartTls           bool
+	InsecureSkipVerify bool
+	BindDn             string
+	BindPassword       string
+	BaseDn             string
+	UserFilter         string
+	Attributes         []string
+	Timeout            time.Duration
+}
+
+type LdapEntry struct {
+	Dn         string
+	Attributes map[string][]string
+}
+
+// LdapAuthenticate finds the user with the service account, or anonymously without one, and
+// binds as the user to check the password
+func LdapAuthenticate(param LdapParam, username string, password string) (*LdapEntry, error) {
+	// an empty password is an unauthenticated bind, which most servers accept for any DN
+	if strings.TrimSpace(username) == "" || password == "" {
+		return nil, ErrLdapInvalidCredentials
+	}
+	conn, err := dialLdap(param)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if param.BindDn != "" {
+		err = conn.Bind(param.BindDn, param.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return nil, errors.New("service account bind failed: " + err.Error())
+	}
+
+	filter := strings.ReplaceAll(param.UserFilter, "{username}", ldap.EscapeFilter(strings.TrimSpace(username)))
+	search := ldap.NewSearchRequest(
+		param.BaseDn,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		int(param.Timeout.Seconds()),
+		false,
+		filter,
+		param.Attributes,
+		nil,
+	)
+	result, err := conn.Search(search)
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+	if result == nil || len(result.Entries) != 1 {
+		return nil, ErrLdapInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	err = conn.Bind(entry.DN, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return nil, ErrLdapInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := map[string][]string{}
+	for _, attribute := range entry.Attributes {
+		attributes[strings.ToLower(attribute.Name)] = attribute.Values
+	}
+	return &LdapEntry{Dn: entry.DN, Attributes: attributes}, nil
+}
+
+// Attribute returns the first value of an attribute, names are case insensitive
+func (entry *LdapEntry) Attribute(name string) string {
+	values := entry.Attributes[strings.ToLower(name)]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (entry *LdapEntry) Values(name string) []string {
+	return entry.Attributes[strings.ToLower(name)]
+}
+
+func dialLdap(param LdapParam) (*ldap.Conn, error) {
+	address, err := url.Parse(param.Url)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         address.Hostname(),
+		InsecureSkipVerify: param.InsecureSkipVerify,
+	}
+	conn, err := ldap.DialURL(param.Url,
+		ldap.DialWithDialer(&net.Dialer{Timeout: param.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(param.Timeout)
+	if param.StartTls && address.Scheme == "ldap" {
+		err = conn.StartTLS(tlsConfig)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
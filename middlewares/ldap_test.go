@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLdapAuthenticateRejectsEmptyCredentials(t *testing.T) {
+	// nothing listens there, so a credential that gets past the check fails to dial instead
+	param := LdapParam{Url: "ldap://127.0.0.1:1", UserFilter: "(uid={username})", Timeout: time.Second}
+	for _, test := range []struct {
+		username string
+		password string
+	}{
+		{"jane", ""},
+		{"", "correct horse 42"},
+		{"   ", "correct horse 42"},
+	} {
+		_, err := LdapAuthenticate(param, test.username, test.password)
+		if !errors.Is(err, ErrLdapInvalidCredentials) {
+			t.Errorf("%q with password %q: %v, want it rejected before binding", test.username, test.password, err)
+		}
+	}
+	if _, err := LdapAuthenticate(param, "jane", "correct horse 42"); errors.Is(err, ErrLdapInvalidCredentials) || err == nil {
+		t.Errorf("full credentials: %v, want a dial error", err)
+	}
+}
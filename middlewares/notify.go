@@ -1,14 +1,19 @@
 package middlewares
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"io"
 	"net/http"
+	"time"
 )
 
+const notifyTimeout = 30 * time.Second
+
 type Response struct {
 	Status  int    `json:"status"`
 	Message string `json:"message"`
@@ -23,53 +28,64 @@ type configuration struct {
 	method      string
 	endpoint    string
 	contentType string
+	body        []byte
 }
 
-func NotifyMassage(endpoint string) (*Response, error) {
+// NotifyMassage calls endpoint with method and an optional JSON payload and returns the status
+// code of the response. A status outside 2xx is an error carrying the message of the response.
+func NotifyMassage(ctx context.Context, method string, endpoint string, payload []byte) (int, error) {
 	c := newClient()
-	res, err := c.notify(context.Background(), endpoint)
+	res, err := c.notify(ctx, method, endpoint, payload)
 	if err != nil {
 		logrus.Error(err)
-		return res, err
 	}
-	return res, nil
+	return res, err
 }
 
 func newClient() *client {
-	return &client{httpClient: http.DefaultClient}
+	return &client{httpClient: &http.Client{Timeout: notifyTimeout}}
 }
 
-func (c *client) notify(ctx context.Context, endpoint string) (*Response, error) {
-	configuration := c.createConfiguration(endpoint)
-	req, err := http.NewRequestWithContext(ctx, configuration.method, configuration.endpoint, nil)
+func (c *client) notify(ctx context.Context, method string, endpoint string, payload []byte) (int, error) {
+	configuration := c.createConfiguration(method, endpoint, payload)
+	var body io.Reader
+	if len(configuration.body) > 0 {
+		body = bytes.NewReader(configuration.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, configuration.method, configuration.endpoint, body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to new request: %w", err)
+		return 0, fmt.Errorf("failed to new request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", configuration.contentType)
 	}
 
 	res, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to notify: %w", err)
-	}
-	nResp := &Response{}
-	err = json.NewDecoder(res.Body).Decode(nResp)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode notification response: %w", err)
+		return 0, fmt.Errorf("failed to notify: %w", err)
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode == http.StatusUnauthorized {
-		return nResp, errors.New("invalid access token")
+		return res.StatusCode, errors.New("invalid access token")
 	}
 
-	if res.StatusCode != http.StatusOK {
-		return nResp, errors.New(nResp.Message)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		nResp := &Response{}
+		err = json.NewDecoder(res.Body).Decode(nResp)
+		if err != nil || nResp.Message == "" {
+			return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+		}
+		return res.StatusCode, errors.New(nResp.Message)
 	}
-	return nResp, nil
+	return res.StatusCode, nil
 }
 
-func (c *client) createConfiguration(endpoint string) configuration {
+func (c *client) createConfiguration(method string, endpoint string, payload []byte) configuration {
 	return configuration{
 		endpoint:    endpoint,
-		method:      "GET",
+		method:      method,
 		contentType: "application/json",
+		body:        payload,
 	}
 }
@@ -0,0 +1,134 @@
+package middlewares
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IdClaims are the claims of an OpenID Connect ID token
+type IdClaims struct {
+	Name              string `json:"name,omitempty"`
+	GivenName         string `json:"given_name,omitempty"`
+	FamilyName        string `json:"family_name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	Role              string `json:"role"`
+	ClientId          string `json:"clientId"`
+	Nonce             string `json:"nonce,omitempty"`
+	AuthTime          int64  `json:"auth_time,omitempty"`
+	// Attributes are the custom attributes of the user the client emits as claims
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type Jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type oidcKey struct {
+	privateKey *rsa.PrivateKey
+	kid        string
+}
+
+var (
+	oidcKeyOnce sync.Once
+	oidcKeyPair *oidcKey
+	oidcKeyErr  error
+)
+
+// CheckOidcKey makes sure OIDC_PRIVATE_KEY holds a usable RSA key, the API doesn't start without it.
+// A key generated at start would invalidate every ID token on restart and differ between instances.
+func CheckOidcKey() error {
+	_, err := loadOidcKey()
+	return err
+}
+
+// loadOidcKey reads the RSA key from OIDC_PRIVATE_KEY as PEM (PKCS #1 or PKCS #8)
+func loadOidcKey() (*oidcKey, error) {
+	oidcKeyOnce.Do(func() {
+		privateKey, err := parseOidcKey(os.Getenv("OIDC_PRIVATE_KEY"))
+		if err != nil {
+			oidcKeyErr = errors.New("OIDC_PRIVATE_KEY must be a PEM RSA key: " + err.Error())
+			return
+		}
+		sum := sha256.Sum256(privateKey.PublicKey.N.Bytes())
+		oidcKeyPair = &oidcKey{
+			privateKey: privateKey,
+			kid:        base64.RawURLEncoding.EncodeToString(sum[:8]),
+		}
+	})
+	return oidcKeyPair, oidcKeyErr
+}
+
+func parseOidcKey(value string) (*rsa.PrivateKey, error) {
+	if value == "" {
+		return nil, errors.New("not set")
+	}
+	// keys in .env files usually carry escaped line breaks
+	block, _ := pem.Decode([]byte(strings.ReplaceAll(value, `\n`, "\n")))
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// GenerateIdToken signs ID token claims with RS256
+func GenerateIdToken(claims *IdClaims, expirationTime time.Time) (string, error) {
+	key, err := loadOidcKey()
+	if err != nil {
+		return "", err
+	}
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	claims.ExpiresAt = jwt.NewNumericDate(expirationTime)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.privateKey)
+}
+
+// Jwks returns the public signing key as a JSON Web Key
+func Jwks() []Jwk {
+	key, err := loadOidcKey()
+	if err != nil {
+		logrus.Error(err)
+		return []Jwk{}
+	}
+	publicKey := key.privateKey.PublicKey
+	return []Jwk{
+		{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: key.kid,
+			N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		},
+	}
+}
@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const RequestIdHeader = "X-Request-Id"
+
+// NewRequestId tags every request with an id, reusing the one sent by the caller if present
+func NewRequestId() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestId := ctx.GetHeader(RequestIdHeader)
+		if requestId == "" || len(requestId) > 64 {
+			requestId = uuid.New().String()
+		}
+		ctx.Set(RequestId, requestId)
+		ctx.Header(RequestIdHeader, requestId)
+		ctx.Next()
+	}
+}
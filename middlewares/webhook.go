@@ -0,0 +1,75 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	WebhookSignatureHeader = "X-Um-Signature"
+	WebhookEventHeader     = "X-Um-Event"
+	WebhookEventIdHeader   = "X-Um-Event-Id"
+	WebhookDeliveryHeader  = "X-Um-Delivery"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// webhookResponseLimit caps how much of a receiver's response is read before the connection is reused
+const webhookResponseLimit = 64 * 1024
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+type WebhookMessage struct {
+	Endpoint   string
+	Secret     string
+	EventId    string
+	EventType  string
+	DeliveryId string
+	Body       []byte
+}
+
+// SendWebhook posts a signed message and returns the status code of the receiver. Any status
+// outside 2xx is returned as an error together with the code, cancelling ctx aborts the call.
+func SendWebhook(ctx context.Context, message WebhookMessage) (int, error) {
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, message.Endpoint, bytes.NewReader(message.Body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "um-webhook/1")
+	req.Header.Set(WebhookEventHeader, message.EventType)
+	req.Header.Set(WebhookEventIdHeader, message.EventId)
+	req.Header.Set(WebhookDeliveryHeader, message.DeliveryId)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(message.Secret, timestamp, message.Body))
+
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, webhookResponseLimit))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// SignWebhook returns the signature header value "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">"
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	t := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,14 @@
+package middlewares
+
+import "testing"
+
+func TestSignWebhook(t *testing.T) {
+	// echo -n '1700000000.{"type":"user.created"}' | openssl dgst -sha256 -hmac test-secret
+	want := "t=1700000000,v1=7e33e1ed9316e8f2d164db1c21c6444e4109ff5ab327a065a8c9c91cbb013e4a"
+	if signature := SignWebhook("test-secret", 1700000000, []byte(`{"type":"user.created"}`)); signature != want {
+		t.Fatalf("signed %q, want %q", signature, want)
+	}
+	if signature := SignWebhook("other-secret", 1700000000, []byte(`{"type":"user.created"}`)); signature == want {
+		t.Fatal("another secret gave the same signature")
+	}
+}